@@ -0,0 +1,71 @@
+package filtered_camera
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"go.viam.com/utils"
+)
+
+// activeHoursRejection is the rejected stats label of frames captured outside active_hours
+const activeHoursRejection = "outside active hours"
+
+// ActiveHours is a time of day window, in the server's local time zone, during which captures are allowed.
+// Start and End are "HH:MM" clock times. A window whose End is before its Start runs past midnight.
+type ActiveHours struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+// Validate ensures the window's times parse and differ.
+func (w ActiveHours) Validate(path string) error {
+	start, end, err := w.minutes()
+	if err != nil {
+		return utils.NewConfigValidationError(path, err)
+	}
+	if start == end {
+		return utils.NewConfigValidationError(path, errors.New("start and end must differ"))
+	}
+	return nil
+}
+
+// minutes returns the window's start and end as minutes after midnight.
+func (w ActiveHours) minutes() (int, int, error) {
+	start, err := time.Parse("15:04", w.Start)
+	if err != nil {
+		return 0, 0, fmt.Errorf("start %q must be an HH:MM time", w.Start)
+	}
+	end, err := time.Parse("15:04", w.End)
+	if err != nil {
+		return 0, 0, fmt.Errorf("end %q must be an HH:MM time", w.End)
+	}
+	return start.Hour()*60 + start.Minute(), end.Hour()*60 + end.Minute(), nil
+}
+
+// contains returns true if t's local time of day falls in the window, including its start but not its end.
+func (w ActiveHours) contains(t time.Time) bool {
+	start, end, err := w.minutes()
+	if err != nil {
+		return false
+	}
+	local := t.Local()
+	minute := local.Hour()*60 + local.Minute()
+	if start < end {
+		return minute >= start && minute < end
+	}
+	return minute >= start || minute < end
+}
+
+// withinActiveHours returns true if capturedAt is in any of the active_hours windows, or if none are configured.
+func (fc *filteredCamera) withinActiveHours(capturedAt time.Time) bool {
+	if len(fc.conf.ActiveHours) == 0 {
+		return true
+	}
+	for _, w := range fc.conf.ActiveHours {
+		if w.contains(capturedAt) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,60 @@
+package filtered_camera
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.viam.com/rdk/components/camera"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/services/vision"
+	"go.viam.com/rdk/testutils/inject"
+	"go.viam.com/rdk/vision/classification"
+	"go.viam.com/test"
+)
+
+func TestActiveHours(t *testing.T) {
+	at := func(hour, minute int) time.Time {
+		return time.Date(2025, 6, 1, hour, minute, 0, 0, time.Local)
+	}
+
+	day := ActiveHours{Start: "06:00", End: "20:00"}
+	test.That(t, day.contains(at(5, 59)), test.ShouldBeFalse)
+	test.That(t, day.contains(at(6, 0)), test.ShouldBeTrue)
+	test.That(t, day.contains(at(19, 59)), test.ShouldBeTrue)
+	test.That(t, day.contains(at(20, 0)), test.ShouldBeFalse)
+
+	night := ActiveHours{Start: "22:30", End: "02:00"}
+	test.That(t, night.contains(at(23, 0)), test.ShouldBeTrue)
+	test.That(t, night.contains(at(1, 30)), test.ShouldBeTrue)
+	test.That(t, night.contains(at(12, 0)), test.ShouldBeFalse)
+
+	test.That(t, day.Validate("camera.active_hours.0"), test.ShouldBeNil)
+	test.That(t, ActiveHours{Start: "6am", End: "20:00"}.Validate("camera.active_hours.0"), test.ShouldNotBeNil)
+	test.That(t, ActiveHours{Start: "06:00", End: "06:00"}.Validate("camera.active_hours.0"), test.ShouldNotBeNil)
+
+	// outside the windows frames are rejected by their capture time, without running vision
+	visionCalls := 0
+	visionSvc := inject.NewVisionService("classifier")
+	visionSvc.ClassificationsFunc = func(ctx context.Context, img *camera.NamedImage, n int, extra map[string]interface{}) (classification.Classifications, error) {
+		visionCalls++
+		return classification.Classifications{classification.NewClassification(0.9, "person")}, nil
+	}
+	fc := &filteredCamera{
+		conf:                    &Config{ActiveHours: []ActiveHours{day, night}},
+		logger:                  logging.NewTestLogger(t),
+		otherVisionServices:     []vision.Service{visionSvc},
+		acceptedClassifications: map[string]map[string]float64{"classifier": {"person": 0.8}},
+		acceptedObjects:         map[string]map[string]float64{},
+	}
+	res, _, err := fc.shouldSend(context.Background(), namedA, at(21, 0))
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res, test.ShouldBeFalse)
+	test.That(t, visionCalls, test.ShouldEqual, 0)
+	test.That(t, fc.rejectedStats.Breakdown, test.ShouldResemble, map[string]int{activeHoursRejection: 1})
+
+	res, _, err = fc.shouldSend(context.Background(), namedA, at(12, 0))
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res, test.ShouldBeTrue)
+	test.That(t, visionCalls, test.ShouldEqual, 1)
+}
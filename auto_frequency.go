@@ -0,0 +1,44 @@
+package filtered_camera
+
+import (
+	"math"
+	"slices"
+	"time"
+)
+
+const (
+	// autoFrequencySamples is how many capture intervals the frame rate is estimated from under auto_frequency,
+	// so the estimate is refreshed every autoFrequencySamples frames
+	autoFrequencySamples = 20
+	// autoFrequencyTolerance is how far the estimated frame rate can drift from the buffer's, as a fraction of it,
+	// before the buffer is resized
+	autoFrequencyTolerance = 0.1
+)
+
+// observeFrameRate records the capture time of a frame stored by the background worker. Every autoFrequencySamples
+// intervals, if the median interval puts the frame rate more than autoFrequencyTolerance away from the image
+// buffer's, the buffer is resized for the observed rate. Frames with a capture time no later than the previous
+// frame's are repeats and are ignored. Only the background worker calls this, so it needs no locking.
+func (fc *filteredCamera) observeFrameRate(capturedAt time.Time) {
+	if !capturedAt.After(fc.lastFrameAt) {
+		return
+	}
+	if !fc.lastFrameAt.IsZero() {
+		fc.frameIntervals = append(fc.frameIntervals, capturedAt.Sub(fc.lastFrameAt))
+	}
+	fc.lastFrameAt = capturedAt
+	if len(fc.frameIntervals) < autoFrequencySamples {
+		return
+	}
+
+	slices.Sort(fc.frameIntervals)
+	median := fc.frameIntervals[len(fc.frameIntervals)/2]
+	fc.frameIntervals = fc.frameIntervals[:0]
+	observed := float64(time.Second) / float64(median)
+	current := fc.buf.Status().ImageFrequency
+	if math.Abs(observed-current) <= autoFrequencyTolerance*current {
+		return
+	}
+	fc.logger.Infof("camera delivers about %.2f images/s rather than %v, resizing the image buffer", observed, current)
+	fc.buf.SetImageFrequency(observed)
+}
@@ -0,0 +1,65 @@
+package filtered_camera
+
+import (
+	"context"
+	"image"
+	"testing"
+	"time"
+
+	"go.viam.com/rdk/components/camera"
+	"go.viam.com/rdk/data"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/resource"
+	"go.viam.com/rdk/testutils/inject"
+	"go.viam.com/test"
+
+	imagebuffer "github.com/viam-modules/filtered_camera/image_buffer"
+)
+
+func TestAutoFrequency(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	ctx := context.Background()
+	base := time.Now()
+
+	// the camera delivers a new frame every 250ms, though image_frequency says 1 per second
+	interval := 250 * time.Millisecond
+	captured := base
+	imagesCam := inject.NewCamera("test_camera")
+	imagesCam.ImagesFunc = func(ctx context.Context, filterSourceNames []string, extra map[string]interface{}) (
+		[]camera.NamedImage, resource.ResponseMetadata, error) {
+		captured = captured.Add(interval)
+		img, _ := camera.NamedImageFromImage(image.NewRGBA(image.Rect(0, 0, 10, 10)), "color", "image/jpeg", data.Annotations{})
+		return []camera.NamedImage{img}, resource.ResponseMetadata{CapturedAt: captured}, nil
+	}
+	fc := &filteredCamera{
+		conf:   &Config{WindowSecondsBefore: 2, WindowSecondsAfter: 2, ImageFrequency: 1.0, AutoFrequency: true},
+		logger: logger,
+		cam:    imagesCam,
+		buf:    imagebuffer.NewImageBuffer(0, 1.0, 2, 2, logger, false, 0),
+	}
+	test.That(t, fc.buf.Status().MaxImages, test.ShouldEqual, 12)
+
+	// the buffer is only resized once enough intervals were observed
+	for i := 0; i < autoFrequencySamples; i++ {
+		fc.captureImageInBackground(ctx)
+	}
+	test.That(t, fc.buf.Status().MaxImages, test.ShouldEqual, 12)
+	fc.captureImageInBackground(ctx)
+	test.That(t, fc.buf.Status().ImageFrequency, test.ShouldAlmostEqual, 4.0)
+	test.That(t, fc.buf.Status().MaxImages, test.ShouldEqual, 48)
+
+	// a small drift leaves the size alone
+	interval = 240 * time.Millisecond
+	for i := 0; i < autoFrequencySamples; i++ {
+		fc.captureImageInBackground(ctx)
+	}
+	test.That(t, fc.buf.Status().MaxImages, test.ShouldEqual, 48)
+
+	// the camera slowing down shrinks the buffer, dropping the oldest frames
+	interval = time.Second
+	for i := 0; i < autoFrequencySamples; i++ {
+		fc.captureImageInBackground(ctx)
+	}
+	test.That(t, fc.buf.Status().MaxImages, test.ShouldEqual, 12)
+	test.That(t, fc.buf.GetRingBufferLength(), test.ShouldEqual, 12)
+}
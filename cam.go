@@ -2,8 +2,17 @@ package filtered_camera
 
 import (
 	"context"
+	"encoding/base64"
 	"errors"
 	"fmt"
+	"image"
+	"image/draw"
+	"math"
+	"regexp"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"go.opentelemetry.io/otel/attribute"
@@ -15,19 +24,48 @@ import (
 	"go.viam.com/rdk/resource"
 	"go.viam.com/rdk/services/vision"
 	"go.viam.com/rdk/spatialmath"
+	rutils "go.viam.com/rdk/utils"
 	"go.viam.com/rdk/vision/classification"
 	"go.viam.com/rdk/vision/objectdetection"
 	"go.viam.com/utils"
 
 	imagebuffer "github.com/viam-modules/filtered_camera/image_buffer"
+	imagestats "github.com/viam-modules/filtered_camera/image_stats"
 )
 
 var Model = Family.WithModel("filtered-camera")
 
+// errVisionUnavailable is returned by shouldSend when every accepting vision service failed
+// and buffer_on_vision_failure is set.
+var errVisionUnavailable = errors.New("all vision services are unavailable")
+
 const defaultImageFreq = 1.0
 
+// captureTimeoutTicks is how many background capture intervals a call to the underlying camera can take before it is
+// abandoned, unless capture_timeout_ms is set
+const captureTimeoutTicks = 5
+
+// defaultSpillMaxBytes is how much the frames spilled to spill_dir can take unless spill_max_bytes is set
+const defaultSpillMaxBytes = 256 << 20
+
+// defaultClassificationsTopN is how many classifications are requested from a vision service unless classifications_top_n is set
+const defaultClassificationsTopN = 100
+
+// Values for Config.StatsAttribution
+const (
+	// statsAttributionAll counts every matching label in the accepted stats
+	statsAttributionAll = "all"
+	// statsAttributionBest only counts the highest scoring matching label
+	statsAttributionBest = "best"
+)
+
 type Config struct {
 	Camera string
+	// Cameras are read alongside Camera, their images captured together with its own
+	Cameras []string `json:"cameras,omitempty"`
+	// VisionSources restricts vision to the images from these sources, while images from every source are captured.
+	// With a single source, frames without an image from it run vision on their first image instead
+	VisionSources []string `json:"vision_sources,omitempty"`
 	// Deprecated: use VisionServices instead
 	Vision              string
 	VisionServices      []VisionServiceConfig `json:"vision_services,omitempty"`
@@ -37,16 +75,165 @@ type Config struct {
 	WindowSecondsAfter  int                   `json:"window_seconds_after"`
 	CooldownSecs        int                   `json:"cooldown_s"`
 	Debug               bool                  `json:"debug"`
+	// EmitEvents logs a structured event as each capture window opens and closes, for log-based analytics
+	EmitEvents bool `json:"emit_events"`
+	// TriggerAtToleranceMs anchors trigger_at windows to the closest buffered frame within this many milliseconds
+	TriggerAtToleranceMs int `json:"trigger_at_tolerance_ms"`
+	// AutoFrequency resizes the image buffer for the frame rate observed from the underlying camera instead of image_frequency
+	AutoFrequency bool `json:"auto_frequency"`
+	// MinFlowMagnitude triggers when the optical flow since the previous frame, as a fraction of the frame width, is at least this
+	MinFlowMagnitude float64 `json:"min_flow_magnitude"`
+	// ClassificationsTopN is how many classifications are requested from each vision service, 100 by default
+	ClassificationsTopN int `json:"classifications_top_n"`
+	// DetectionsTopN keeps only this many of the highest scoring detections from each vision service before matching and counting
+	DetectionsTopN int `json:"detections_top_n"`
+	// InclusiveThreshold lets a score equal to a threshold's minimum match it, rather than only scores above it
+	InclusiveThreshold bool `json:"inclusive_threshold"`
+	// DetectionScoreFloor ignores detections scoring below it, whatever the object thresholds and count rules say
+	DetectionScoreFloor float64 `json:"detection_score_floor"`
+	// DegenerateBoxes controls how detections with zero-area or inverted boxes are handled: "keep" (default), "skip" or "whole_frame"
+	DegenerateBoxes string `json:"degenerate_boxes"`
+	// UnlabeledInhibitorThreshold makes inhibitors without any configured classifications or objects inhibit on every
+	// label they report above it. By default such inhibitors are ignored.
+	UnlabeledInhibitorThreshold float64 `json:"unlabeled_inhibitor_threshold"`
+	// InhibitIncomingAnnotations rejects frames that the underlying camera already annotated with any of these labels
+	InhibitIncomingAnnotations []string `json:"inhibit_incoming_annotations,omitempty"`
+	// RetroactiveInhibitSeconds makes an inhibitor match drop frames queued within this many seconds and cancel the open window
+	RetroactiveInhibitSeconds float64 `json:"retroactive_inhibit_seconds"`
+	// InhibitScope is when inhibitors run: "pre_trigger", the default, stops windows from opening, while "in_window"
+	// only drops the inhibited frames captured while a window is open
+	InhibitScope string `json:"inhibit_scope"`
+	// OutageGraceSeconds extends an open capture window by up to this long to make up for failed captures
+	OutageGraceSeconds float64 `json:"outage_grace_seconds"`
+	// MinWindowSeconds keeps every capture window open for at least this long after its trigger
+	MinWindowSeconds int `json:"min_window_seconds"`
+	// ExtendSameLabelOnly only lets an open capture window be extended by the label that opened it
+	ExtendSameLabelOnly bool `json:"extend_same_label_only"`
+	// ContactSheet adds a downscaled contact sheet of each batch of buffered images alongside the full frames
+	ContactSheet bool `json:"contact_sheet"`
+	// AnnotateWindowSeq adds a "seq:<n>" classification with each frame's position within its capture window
+	AnnotateWindowSeq bool `json:"annotate_window_seq"`
+	// AnnotateTriggerFrame adds a "trigger:true" classification to the frame of each capture window nearest to its trigger
+	AnnotateTriggerFrame bool `json:"annotate_trigger_frame"`
+	// AnnotateTriggerReason adds a "trigger_reason:<label>" classification, scored like the label, to every frame of a capture window
+	AnnotateTriggerReason bool `json:"annotate_trigger_reason"`
+	// AnnotateAllDetections attaches every detection from the triggering service to the trigger image, not just the matches
+	AnnotateAllDetections bool `json:"annotate_all_detections"`
+	// BufferOnVisionFailure keeps buffering without capturing, instead of failing, while every accepting vision service errors
+	BufferOnVisionFailure bool `json:"buffer_on_vision_failure"`
+	// StatsAttribution controls which matching labels are counted in the accepted stats: "all" (default) or "best"
+	StatsAttribution string `json:"stats_attribution"`
+	// StatGroups maps labels to the group they are counted under in the stats, e.g. "sedan" to "vehicle"
+	StatGroups map[string]string `json:"stat_groups"`
+	// LabelAliases renames model labels, e.g. "c_0042" to "forklift", in annotations and stats. Thresholds still use the model labels
+	LabelAliases map[string]string `json:"label_aliases,omitempty"`
+	// MaxStatLabels caps how many distinct labels the stats break down, counting any further ones under "other"
+	MaxStatLabels int `json:"max_stat_labels"`
+	// MinImageWidth and MinImageHeight reject frames smaller than this, which are usually corrupt or empty
+	MinImageWidth  int `json:"min_image_width"`
+	MinImageHeight int `json:"min_image_height"`
+	// VisionMaxPixels caps the size of the image passed to the vision services; larger frames are downscaled
+	VisionMaxPixels int `json:"vision_max_pixels"`
+	// VisionGrayscaleToRGB converts grayscale frames to RGB before passing them to the vision services
+	VisionGrayscaleToRGB bool `json:"vision_grayscale_to_rgb"`
+	// CompactRingBuffer keeps the ring buffer spaced at roughly image_frequency by dropping frames that arrive in bursts
+	CompactRingBuffer bool `json:"compact_ring_buffer"`
+	// SpillDir writes ring buffer frames older than the last second to a temporary directory in it to save memory
+	SpillDir string `json:"spill_dir"`
+	// SpillMaxBytes is how much the spilled frames can take before the oldest are dropped
+	SpillMaxBytes int64 `json:"spill_max_bytes"`
+	// BurstDedupeMs drops frames captured within this many milliseconds of a frame already queued to send
+	BurstDedupeMs int `json:"burst_dedupe_ms"`
+	// MinFrameGapMs drops frames captured within this many milliseconds of the previously stored frame
+	MinFrameGapMs int `json:"min_frame_gap_ms"`
+
+	// EncodeWorkers encodes batches of buffered images with this many goroutines before returning them
+	EncodeWorkers int `json:"encode_workers"`
+	// RequeueOnSendFailure puts a batch of buffered images back in the buffer if it fails to be sent
+	RequeueOnSendFailure bool `json:"requeue_on_send_failure"`
+	// LiveFromBuffer serves requests that don't come from data management from the latest background capture instead of the underlying camera
+	LiveFromBuffer bool `json:"live_from_buffer"`
+	// SingleImageSource is the source returned from a frame with several images when a single image is requested
+	SingleImageSource string `json:"single_image_source"`
+	// BurstVisionStride only runs every this many images of a batch from the underlying camera through vision, starting with the first
+	BurstVisionStride int `json:"burst_vision_stride"`
+	// SplitWindowEveryN splits long capture windows into segments of this many frames, each annotated with its own window ID
+	SplitWindowEveryN int `json:"split_window_every_n"`
+	// MaxToSendImages caps how many frames can wait to be sent, dropping the oldest beyond it instead of growing without bound
+	MaxToSendImages int `json:"max_to_send_images"`
+	// MaxPendingWindows drops triggers that would open a new capture window while this many windows still have frames waiting to be consumed
+	MaxPendingWindows int `json:"max_pending_windows"`
+	// MaxOutputLatencyMs returns buffered images that have waited this long even when the current capture fails
+	MaxOutputLatencyMs int `json:"max_output_latency_ms"`
+	// CaptureFrequency is how often, in Hz, the background worker reads the underlying camera, image_frequency by default.
+	// The buffer is still sized from image_frequency.
+	CaptureFrequency float64 `json:"capture_frequency"`
+	// CaptureTimeoutMs abandons a background capture if the underlying camera takes longer than this, 5 capture intervals by default
+	CaptureTimeoutMs int `json:"capture_timeout_ms"`
+	// AllowDualRole silences the warning about a vision service listed both as an inhibitor and as an accepting service
+	AllowDualRole bool `json:"allow_dual_role"`
+	// SampleRejectedRate is the fraction of rejected frames returned anyway, under a distinct source name, for review
+	SampleRejectedRate float64 `json:"sample_rejected_rate"`
+	// CaptureSampleRate is the fraction of triggering frames kept, the others are rejected
+	CaptureSampleRate float64 `json:"capture_sample_rate"`
+	// ActiveHours restricts captures to these local time of day windows, judged by each frame's capture time
+	ActiveHours []ActiveHours `json:"active_hours,omitempty"`
+	// WarmupSecs answers data management with no images, rather than an error, for this long after the camera is built
+	WarmupSecs float64 `json:"warmup_seconds"`
+	// DryRun runs the filter on data management requests and records the decisions without ever capturing
+	DryRun bool `json:"dry_run"`
+
+	// DataManagementKey is an additional extra key that, when true, marks a request as coming from data management
+	DataManagementKey string `json:"data_management_key"`
+
+	// LocalSinkDir is a directory that captured images are also written to
+	LocalSinkDir string `json:"local_sink_dir"`
+	// AdaptiveThreshold lowers the classification thresholds while nothing has triggered for a while
+	AdaptiveThreshold *AdaptiveThresholdConfig `json:"adaptive_threshold,omitempty"`
+
+	Classifications map[string]Threshold
+	Objects         map[string]Threshold
+}
+
+// AdaptiveThresholdConfig describes how accepted classification thresholds relax while the camera is idle.
+// Thresholds start dropping by DecayPerMinute once nothing has triggered for IdleSeconds, never going below
+// Floor, and snap back to their configured values on the next trigger.
+type AdaptiveThresholdConfig struct {
+	IdleSeconds    float64 `json:"idle_seconds"`
+	DecayPerMinute float64 `json:"decay_per_minute"`
+	Floor          float64 `json:"floor"`
+}
 
-	Classifications map[string]float64
-	Objects         map[string]float64
+// Validate ensures all parts of the config are valid.
+func (config *AdaptiveThresholdConfig) Validate(path string) error {
+	if config.IdleSeconds < 0 {
+		return utils.NewConfigValidationError(path+".idle_seconds", errors.New("cannot be negative"))
+	}
+	if config.DecayPerMinute <= 0 {
+		return utils.NewConfigValidationError(path+".decay_per_minute", errors.New("must be greater than 0"))
+	}
+	if config.Floor < 0 || config.Floor > 1 {
+		return utils.NewConfigValidationError(path+".floor", errors.New("must be between 0 and 1"))
+	}
+	return nil
 }
 
 type VisionServiceConfig struct {
-	Vision          string             `json:"vision"`
-	Objects         map[string]float64 `json:"objects,omitempty"`
-	Classifications map[string]float64 `json:"classifications,omitempty"`
-	Inhibit         bool               `json:"inhibit"`
+	Vision          string               `json:"vision"`
+	Objects         map[string]Threshold `json:"objects,omitempty"`
+	Classifications map[string]Threshold `json:"classifications,omitempty"`
+	Inhibit         bool                 `json:"inhibit"`
+	// Inhibits restricts an inhibitor to vetoing these accepting vision services, rather than the whole frame
+	Inhibits []string `json:"inhibits,omitempty"`
+	// AnyLabelMinCount triggers when at least this many detections of any label score above AnyLabelMinScore
+	AnyLabelMinCount int     `json:"any_label_min_count,omitempty"`
+	AnyLabelMinScore float64 `json:"any_label_min_score,omitempty"`
+	// MinTopMargin only accepts classifications when the top label beats the runner-up by more than this
+	MinTopMargin float64 `json:"min_top_margin,omitempty"`
+	// DefaultThreshold is the confidence required of labels that none of the classifications or objects name
+	DefaultThreshold float64 `json:"default_threshold,omitempty"`
+	// ROI crops the frame to this region before it is passed to the vision service
+	ROI *ROI `json:"roi,omitempty"`
 }
 
 // Validate ensures all parts of the config are valid.
@@ -55,6 +242,76 @@ func (config *VisionServiceConfig) Validate(path string) error {
 		return resource.NewConfigValidationFieldRequiredError(path, "vision")
 	}
 
+	if err := validateThresholds(path+".classifications", config.Classifications, false); err != nil {
+		return err
+	}
+	if err := validateThresholds(path+".objects", config.Objects, true); err != nil {
+		return err
+	}
+
+	if config.AnyLabelMinCount < 0 {
+		return utils.NewConfigValidationError(path+".any_label_min_count", errors.New("cannot be negative"))
+	}
+	if config.AnyLabelMinScore < 0 || config.AnyLabelMinScore > 1 {
+		return utils.NewConfigValidationError(path+".any_label_min_score", errors.New("must be between 0 and 1"))
+	}
+	if config.MinTopMargin < 0 || config.MinTopMargin > 1 {
+		return utils.NewConfigValidationError(path+".min_top_margin", errors.New("must be between 0 and 1"))
+	}
+	if config.DefaultThreshold < 0 || config.DefaultThreshold > 1 {
+		return utils.NewConfigValidationError(path+".default_threshold", errors.New("must be between 0 and 1"))
+	}
+	if config.ROI != nil {
+		if err := config.ROI.Validate(path + ".roi"); err != nil {
+			return err
+		}
+	}
+	if len(config.Inhibits) > 0 && !config.Inhibit {
+		return utils.NewConfigValidationError(path+".inhibits", errors.New("is only supported on inhibitors"))
+	}
+	if config.Inhibit && (sustainScores(config.Classifications) != nil || sustainScores(config.Objects) != nil) {
+		return utils.NewConfigValidationError(path, errors.New("sustain thresholds are not supported on inhibitors"))
+	}
+	return nil
+}
+
+// validateThresholds checks that every confidence threshold is between 0 and 1, with any maximum above its
+// minimum and a minimum area only for objects, reporting the path of the offending label
+// (e.g. "vision_services.2.objects.person") if not.
+func validateThresholds(path string, thresholds map[string]Threshold, objects bool) error {
+	labels := make([]string, 0, len(thresholds))
+	for label := range thresholds {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+
+	for _, label := range labels {
+		threshold := thresholds[label]
+		if threshold.Min < 0 || threshold.Min > 1 {
+			return utils.NewConfigValidationError(fmt.Sprintf("%s.%s", path, label),
+				fmt.Errorf("confidence threshold %v must be between 0 and 1", threshold.Min))
+		}
+		if threshold.Max != 0 && (threshold.Max <= threshold.Min || threshold.Max > 1) {
+			return utils.NewConfigValidationError(fmt.Sprintf("%s.%s", path, label),
+				fmt.Errorf("maximum confidence %v must be above the minimum %v and at most 1", threshold.Max, threshold.Min))
+		}
+		if threshold.MinArea < 0 || (threshold.MinArea > 0 && !objects) {
+			return utils.NewConfigValidationError(fmt.Sprintf("%s.%s", path, label),
+				errors.New("min_area must be positive and is only supported for objects"))
+		}
+		if threshold.MinCount < 0 || (threshold.MinCount > 0 && !objects) {
+			return utils.NewConfigValidationError(fmt.Sprintf("%s.%s", path, label),
+				errors.New("min_count must be positive and is only supported for objects"))
+		}
+		if threshold.Sustain < 0 || threshold.Sustain > threshold.Min {
+			return utils.NewConfigValidationError(fmt.Sprintf("%s.%s", path, label),
+				fmt.Errorf("sustain %v must be between 0 and the enter threshold %v", threshold.Sustain, threshold.Min))
+		}
+		if _, err := labelPattern(label); err != nil {
+			return utils.NewConfigValidationError(fmt.Sprintf("%s.%s", path, label),
+				fmt.Errorf("invalid label pattern: %w", err))
+		}
+	}
 	return nil
 }
 
@@ -62,6 +319,12 @@ func (cfg *Config) Validate(path string) ([]string, []string, error) {
 	if cfg.Camera == "" {
 		return nil, nil, utils.NewConfigValidationFieldRequiredError(path, "camera")
 	}
+	for i, name := range cfg.Cameras {
+		if name == "" || name == cfg.Camera || slices.Contains(cfg.Cameras[:i], name) {
+			return nil, nil, utils.NewConfigValidationError(fmt.Sprintf("%s.cameras.%d", path, i),
+				errors.New("must be a camera name not already listed"))
+		}
+	}
 
 	if cfg.Vision == "" && cfg.VisionServices == nil {
 		return nil, nil, utils.NewConfigValidationFieldRequiredError(path, "vision_services")
@@ -89,18 +352,162 @@ func (cfg *Config) Validate(path string) ([]string, []string, error) {
 	if cfg.CooldownSecs < 0 {
 		return nil, nil, utils.NewConfigValidationError(path, errors.New("cooldown_s cannot be negative"))
 	}
+	if cfg.TriggerAtToleranceMs < 0 {
+		return nil, nil, utils.NewConfigValidationError(path, errors.New("trigger_at_tolerance_ms cannot be negative"))
+	}
+	if cfg.MaxStatLabels < 0 {
+		return nil, nil, utils.NewConfigValidationError(path, errors.New("max_stat_labels cannot be negative"))
+	}
+	for label, alias := range cfg.LabelAliases {
+		if alias == "" {
+			return nil, nil, utils.NewConfigValidationError(fmt.Sprintf("%s.label_aliases.%s", path, label), errors.New("alias cannot be empty"))
+		}
+	}
+	if cfg.WarmupSecs < 0 {
+		return nil, nil, utils.NewConfigValidationError(path, errors.New("warmup_seconds cannot be negative"))
+	}
+
+	if cfg.AdaptiveThreshold != nil {
+		if err := cfg.AdaptiveThreshold.Validate(path + ".adaptive_threshold"); err != nil {
+			return nil, nil, err
+		}
+	}
+	for i, w := range cfg.ActiveHours {
+		if err := w.Validate(fmt.Sprintf("%s.active_hours.%d", path, i)); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if cfg.StatsAttribution != "" && cfg.StatsAttribution != statsAttributionAll && cfg.StatsAttribution != statsAttributionBest {
+		return nil, nil, utils.NewConfigValidationError(path,
+			fmt.Errorf("stats_attribution must be %q or %q", statsAttributionAll, statsAttributionBest))
+	}
+
+	if cfg.DegenerateBoxes != "" && cfg.DegenerateBoxes != degenerateBoxesKeep &&
+		cfg.DegenerateBoxes != degenerateBoxesSkip && cfg.DegenerateBoxes != degenerateBoxesWholeFrame {
+		return nil, nil, utils.NewConfigValidationError(path,
+			fmt.Errorf("degenerate_boxes must be %q, %q or %q", degenerateBoxesKeep, degenerateBoxesSkip, degenerateBoxesWholeFrame))
+	}
+
+	if cfg.ClassificationsTopN < 0 || cfg.DetectionsTopN < 0 {
+		return nil, nil, utils.NewConfigValidationError(path, errors.New("classifications_top_n and detections_top_n cannot be negative"))
+	}
+
+	if cfg.UnlabeledInhibitorThreshold < 0 || cfg.UnlabeledInhibitorThreshold > 1 {
+		return nil, nil, utils.NewConfigValidationError(path, errors.New("unlabeled_inhibitor_threshold must be between 0 and 1"))
+	}
+
+	if cfg.DetectionScoreFloor < 0 || cfg.DetectionScoreFloor > 1 {
+		return nil, nil, utils.NewConfigValidationError(path, errors.New("detection_score_floor must be between 0 and 1"))
+	}
+
+	if cfg.MinFlowMagnitude < 0 || cfg.MinFlowMagnitude > 1 {
+		return nil, nil, utils.NewConfigValidationError(path, errors.New("min_flow_magnitude must be between 0 and 1"))
+	}
+
+	if cfg.MinImageWidth < 0 || cfg.MinImageHeight < 0 {
+		return nil, nil, utils.NewConfigValidationError(path, errors.New("min_image_width and min_image_height cannot be negative"))
+	}
+
+	if cfg.VisionMaxPixels < 0 {
+		return nil, nil, utils.NewConfigValidationError(path, errors.New("vision_max_pixels cannot be negative"))
+	}
+
+	if cfg.RetroactiveInhibitSeconds < 0 {
+		return nil, nil, utils.NewConfigValidationError(path, errors.New("retroactive_inhibit_seconds cannot be negative"))
+	}
+
+	switch cfg.InhibitScope {
+	case "", inhibitScopePreTrigger:
+	case inhibitScopeInWindow:
+		if cfg.RetroactiveInhibitSeconds > 0 {
+			return nil, nil, utils.NewConfigValidationError(path,
+				errors.New("retroactive_inhibit_seconds cannot be used with inhibit_scope in_window"))
+		}
+	default:
+		return nil, nil, utils.NewConfigValidationError(path,
+			fmt.Errorf("inhibit_scope must be %q or %q, not %q", inhibitScopePreTrigger, inhibitScopeInWindow, cfg.InhibitScope))
+	}
+
+	if cfg.OutageGraceSeconds < 0 {
+		return nil, nil, utils.NewConfigValidationError(path, errors.New("outage_grace_seconds cannot be negative"))
+	}
+
+	if cfg.MinWindowSeconds < 0 {
+		return nil, nil, utils.NewConfigValidationError(path, errors.New("min_window_seconds cannot be negative"))
+	}
+
+	if cfg.EncodeWorkers < 0 {
+		return nil, nil, utils.NewConfigValidationError(path, errors.New("encode_workers cannot be negative"))
+	}
+
+	if cfg.BurstDedupeMs < 0 {
+		return nil, nil, utils.NewConfigValidationError(path, errors.New("burst_dedupe_ms cannot be negative"))
+	}
+
+	if cfg.MinFrameGapMs < 0 {
+		return nil, nil, utils.NewConfigValidationError(path, errors.New("min_frame_gap_ms cannot be negative"))
+	}
+
+	if cfg.BurstVisionStride < 0 {
+		return nil, nil, utils.NewConfigValidationError(path, errors.New("burst_vision_stride cannot be negative"))
+	}
+
+	if cfg.SplitWindowEveryN < 0 {
+		return nil, nil, utils.NewConfigValidationError(path, errors.New("split_window_every_n cannot be negative"))
+	}
+
+	if cfg.SpillMaxBytes < 0 {
+		return nil, nil, utils.NewConfigValidationError(path, errors.New("spill_max_bytes cannot be negative"))
+	}
+	if cfg.SpillMaxBytes > 0 && cfg.SpillDir == "" {
+		return nil, nil, utils.NewConfigValidationError(path, errors.New("spill_max_bytes requires spill_dir"))
+	}
+
+	if cfg.MaxToSendImages < 0 {
+		return nil, nil, utils.NewConfigValidationError(path, errors.New("max_to_send_images cannot be negative"))
+	}
+
+	if cfg.MaxPendingWindows < 0 {
+		return nil, nil, utils.NewConfigValidationError(path, errors.New("max_pending_windows cannot be negative"))
+	}
+
+	if cfg.MaxOutputLatencyMs < 0 {
+		return nil, nil, utils.NewConfigValidationError(path, errors.New("max_output_latency_ms cannot be negative"))
+	}
 
-	deps := []string{cfg.Camera}
+	if cfg.CaptureFrequency < 0 {
+		return nil, nil, utils.NewConfigValidationError(path, errors.New("capture_frequency cannot be less than 0"))
+	}
+
+	if cfg.CaptureTimeoutMs < 0 {
+		return nil, nil, utils.NewConfigValidationError(path, errors.New("capture_timeout_ms cannot be negative"))
+	}
+
+	if cfg.SampleRejectedRate < 0 || cfg.SampleRejectedRate > 1 {
+		return nil, nil, utils.NewConfigValidationError(path, errors.New("sample_rejected_rate must be between 0 and 1"))
+	}
+	if cfg.CaptureSampleRate < 0 || cfg.CaptureSampleRate > 1 {
+		return nil, nil, utils.NewConfigValidationError(path, errors.New("capture_sample_rate must be between 0 and 1"))
+	}
+
+	deps := append([]string{cfg.Camera}, cfg.Cameras...)
 	inhibitors := []string{}
 	otherVisionServices := []string{}
 
 	if cfg.Vision != "" {
 		logger := logging.NewBlankLogger("deprecated")
 		logger.Warnf("vision is deprecated, please use vision_services instead")
+		if err := validateThresholds(path+".classifications", cfg.Classifications, false); err != nil {
+			return nil, nil, err
+		}
+		if err := validateThresholds(path+".objects", cfg.Objects, true); err != nil {
+			return nil, nil, err
+		}
 		deps = append(deps, cfg.Vision)
 	} else {
 		for idx, vs := range cfg.VisionServices {
-			if err := vs.Validate(fmt.Sprintf("%s.%s.%d", path, "vision-service", idx)); err != nil {
+			if err := vs.Validate(fmt.Sprintf("%s.%s.%d", path, "vision_services", idx)); err != nil {
 				return nil, nil, err
 			}
 			if vs.Inhibit {
@@ -109,6 +516,18 @@ func (cfg *Config) Validate(path string) ([]string, []string, error) {
 				otherVisionServices = append(otherVisionServices, vs.Vision)
 			}
 		}
+		for idx, vs := range cfg.VisionServices {
+			for _, name := range vs.Inhibits {
+				if !slices.Contains(otherVisionServices, name) {
+					return nil, nil, utils.NewConfigValidationError(fmt.Sprintf("%s.vision_services.%d.inhibits", path, idx),
+						fmt.Errorf("%q is not an accepting vision service", name))
+				}
+			}
+		}
+		if dual := dualRoleServices(inhibitors, otherVisionServices); len(dual) > 0 && !cfg.AllowDualRole {
+			logger := logging.NewBlankLogger("dual_role")
+			logger.Warnf("vision services %v are listed both as inhibitors and as accepting services, set allow_dual_role if this is intended", dual)
+		}
 	}
 
 	deps = append(deps, inhibitors...)
@@ -117,100 +536,294 @@ func (cfg *Config) Validate(path string) ([]string, []string, error) {
 	return deps, nil, nil
 }
 
+// dualRoleServices returns the vision services listed both as inhibitors and as accepting services, in the order
+// they are first listed as inhibitors.
+func dualRoleServices(inhibitors, accepting []string) []string {
+	var dual []string
+	for _, name := range inhibitors {
+		if slices.Contains(accepting, name) && !slices.Contains(dual, name) {
+			dual = append(dual, name)
+		}
+	}
+	return dual
+}
+
+// captureInterval is how often the background worker reads the underlying camera: every 1/capture_frequency seconds if
+// set, otherwise every 1/image_frequency seconds.
+func (cfg *Config) captureInterval() time.Duration {
+	freq := cfg.CaptureFrequency
+	if freq == 0 {
+		freq = cfg.ImageFrequency
+	}
+	if freq == 0 {
+		freq = defaultImageFreq
+	}
+	return time.Duration(1000.0/freq) * time.Millisecond
+}
+
 func init() {
 	resource.RegisterComponent(camera.API, Model, resource.Registration[camera.Camera, *Config]{
+		AttributeMapConverter: configFromAttributes,
 		Constructor: func(ctx context.Context, deps resource.Dependencies, conf resource.Config, logger logging.Logger) (camera.Camera, error) {
-			newConf, err := resource.NativeConfig[*Config](conf)
-			if err != nil {
+			fc := &filteredCamera{Named: conf.ResourceName().AsNamed(), logger: logger}
+			fc.acceptedStats.StartTime = time.Now()
+			fc.rejectedStats.StartTime = time.Now()
+			fc.markTriggered(time.Now())
+			if err := fc.Reconfigure(ctx, deps, conf); err != nil {
 				return nil, err
 			}
+			fc.warmUntil = time.Now().Add(time.Duration(fc.conf.WarmupSecs * float64(time.Second)))
+			return fc, nil
+		},
+	})
+}
+
+// Reconfigure applies a new config in place, so that tuning thresholds doesn't lose the ring buffer, the capture
+// windows waiting to be sent or the stats. The vision services and thresholds are set up before anything is
+// replaced, so a config that fails to apply leaves the camera as it was. The image buffer is resized when the window
+// or the image frequency change. The background worker reads the config without locking, so it is stopped while
+// the config is swapped and started again afterwards.
+func (fc *filteredCamera) Reconfigure(ctx context.Context, deps resource.Dependencies, conf resource.Config) error {
+	newConf, err := resource.NativeConfig[*Config](conf)
+	if err != nil {
+		return err
+	}
+
+	next := &filteredCamera{conf: newConf, logger: fc.logger}
+	next.cam, err = camera.FromDependencies(deps, newConf.Camera)
+	if err != nil {
+		return err
+	}
+	for _, name := range newConf.Cameras {
+		cam, err := camera.FromDependencies(deps, name)
+		if err != nil {
+			return err
+		}
+		next.extraCams = append(next.extraCams, cam)
+	}
+	if err := next.setupVision(ctx, deps); err != nil {
+		return err
+	}
+
+	if fc.backgroundWorkers != nil {
+		fc.backgroundWorkers.Stop()
+	}
+	fc.sendMu.Lock()
+	defer fc.sendMu.Unlock()
+	fc.confMu.Lock()
+	defer fc.confMu.Unlock()
+	oldConf := fc.conf
+	fc.conf = newConf
+	fc.debugLogging.Store(newConf.Debug)
+	if fc.cam != next.cam {
+		fc.cam = next.cam
+		fc.streamFallback = false
+		fc.detectImagesSupport(ctx)
+	}
+	fc.extraCams = next.extraCams
+	fc.inhibitors = next.inhibitors
+	fc.otherVisionServices = next.otherVisionServices
+	fc.inhibitedClassifications = next.inhibitedClassifications
+	fc.acceptedClassifications = next.acceptedClassifications
+	fc.inhibitedObjects = next.inhibitedObjects
+	fc.acceptedObjects = next.acceptedObjects
+	fc.classificationCeilings = next.classificationCeilings
+	fc.objectCeilings = next.objectCeilings
+	fc.objectMinAreas = next.objectMinAreas
+	fc.objectMinCounts = next.objectMinCounts
+	fc.sustainClassifications = next.sustainClassifications
+	fc.sustainObjects = next.sustainObjects
+	fc.inclusiveThreshold = next.inclusiveThreshold
+	fc.labelPatterns = next.labelPatterns
+	fc.serviceConfigs = next.serviceConfigs
+	fc.inhibitorScopes = next.inhibitorScopes
+	fc.statsMu.Lock()
+	fc.acceptedStats.Groups = newConf.StatGroups
+	fc.rejectedStats.Groups = newConf.StatGroups
+	fc.acceptedStats.MaxLabels = newConf.MaxStatLabels
+	fc.rejectedStats.MaxLabels = newConf.MaxStatLabels
+	fc.acceptedStats.Aliases = newConf.LabelAliases
+	fc.rejectedStats.Aliases = newConf.LabelAliases
+	fc.statsMu.Unlock()
+
+	fc.configureBuffer(oldConf)
+	fc.configureBackgroundWorker(oldConf)
+	return nil
+}
 
-			fc := &filteredCamera{Named: conf.ResourceName().AsNamed(), conf: newConf, logger: logger}
+// setupVision looks up the vision services of fc.conf and fills in the inhibitors, the accepting services and the
+// thresholds of each.
+func (fc *filteredCamera) setupVision(ctx context.Context, deps resource.Dependencies) error {
+	var err error
+	fc.inclusiveThreshold = fc.conf.InclusiveThreshold
+	if fc.conf.Vision != "" {
+		fc.otherVisionServices = make([]vision.Service, 1)
+		fc.otherVisionServices[0], err = vision.FromDependencies(deps, fc.conf.Vision)
+		if err != nil {
+			return err
+		}
 
-			fc.cam, err = camera.FromDependencies(deps, newConf.Camera)
+		if fc.conf.Classifications != nil {
+			fc.acceptedClassifications = make(map[string]map[string]float64)
+			fc.acceptedClassifications[fc.conf.Vision] = minScores(fc.conf.Classifications)
+			fc.classificationCeilings = map[string]map[string]float64{fc.conf.Vision: maxScores(fc.conf.Classifications)}
+		}
+		if fc.conf.Objects != nil {
+			fc.acceptedObjects = make(map[string]map[string]float64)
+			fc.acceptedObjects[fc.conf.Vision] = minScores(fc.conf.Objects)
+			fc.objectCeilings = map[string]map[string]float64{fc.conf.Vision: maxScores(fc.conf.Objects)}
+			fc.objectMinAreas = map[string]map[string]int{fc.conf.Vision: minAreas(fc.conf.Objects)}
+			fc.objectMinCounts = map[string]map[string]int{fc.conf.Vision: minCounts(fc.conf.Objects)}
+		}
+		fc.sustainClassifications = map[string]map[string]float64{fc.conf.Vision: sustainScores(fc.conf.Classifications)}
+		fc.sustainObjects = map[string]map[string]float64{fc.conf.Vision: sustainScores(fc.conf.Objects)}
+	} else {
+		fc.inhibitors = []vision.Service{}
+		fc.otherVisionServices = []vision.Service{}
+		fc.inhibitedClassifications = make(map[string]map[string]float64)
+		fc.acceptedClassifications = make(map[string]map[string]float64)
+		fc.inhibitedObjects = make(map[string]map[string]float64)
+		fc.acceptedObjects = make(map[string]map[string]float64)
+		fc.classificationCeilings = make(map[string]map[string]float64)
+		fc.objectCeilings = make(map[string]map[string]float64)
+		fc.objectMinAreas = make(map[string]map[string]int)
+		fc.objectMinCounts = make(map[string]map[string]int)
+		fc.sustainClassifications = make(map[string]map[string]float64)
+		fc.sustainObjects = make(map[string]map[string]float64)
+		fc.serviceConfigs = make(map[string]VisionServiceConfig)
+		fc.inhibitorScopes = make(map[string][]string)
+		for _, vs := range fc.conf.VisionServices {
+			visionService, err := vision.FromDependencies(deps, vs.Vision)
 			if err != nil {
-				return nil, err
+				return err
 			}
-			if newConf.Vision != "" {
-				fc.otherVisionServices = make([]vision.Service, 1)
-				fc.otherVisionServices[0], err = vision.FromDependencies(deps, newConf.Vision)
-				if err != nil {
-					return nil, err
-				}
+			fc.serviceConfigs[vs.Vision] = vs
+			fc.classificationCeilings[vs.Vision] = maxScores(vs.Classifications)
+			fc.objectCeilings[vs.Vision] = maxScores(vs.Objects)
+			fc.objectMinAreas[vs.Vision] = minAreas(vs.Objects)
+			fc.objectMinCounts[vs.Vision] = minCounts(vs.Objects)
 
-				if newConf.Classifications != nil {
-					fc.acceptedClassifications = make(map[string]map[string]float64)
-					fc.acceptedClassifications[newConf.Vision] = newConf.Classifications
+			if vs.Inhibit {
+				fc.inhibitors = append(fc.inhibitors, visionService)
+				if len(vs.Inhibits) > 0 {
+					fc.inhibitorScopes[vs.Vision] = vs.Inhibits
 				}
-				if newConf.Objects != nil {
-					fc.acceptedObjects = make(map[string]map[string]float64)
-					fc.acceptedObjects[newConf.Vision] = newConf.Objects
+				if vs.Classifications != nil {
+					fc.inhibitedClassifications[vs.Vision] = minScores(vs.Classifications)
 				}
-			} else {
-				fc.inhibitors = []vision.Service{}
-				fc.otherVisionServices = []vision.Service{}
-				fc.inhibitedClassifications = make(map[string]map[string]float64)
-				fc.acceptedClassifications = make(map[string]map[string]float64)
-				fc.inhibitedObjects = make(map[string]map[string]float64)
-				fc.acceptedObjects = make(map[string]map[string]float64)
-				for _, vs := range newConf.VisionServices {
-					visionService, err := vision.FromDependencies(deps, vs.Vision)
-					if err != nil {
-						return nil, err
-					}
-
-					if vs.Inhibit {
-						fc.inhibitors = append(fc.inhibitors, visionService)
-						if vs.Classifications != nil {
-							fc.inhibitedClassifications[vs.Vision] = vs.Classifications
-						}
-						if vs.Objects != nil {
-							fc.inhibitedObjects[vs.Vision] = vs.Objects
-						}
-					} else {
-						fc.otherVisionServices = append(fc.otherVisionServices, visionService)
-						if vs.Classifications != nil {
-							fc.acceptedClassifications[vs.Vision] = vs.Classifications
-						}
-						if vs.Objects != nil {
-							fc.acceptedObjects[vs.Vision] = vs.Objects
-						}
+				if vs.Objects != nil {
+					fc.inhibitedObjects[vs.Vision] = minScores(vs.Objects)
+				}
+				if len(vs.Classifications) == 0 && len(vs.Objects) == 0 && fc.conf.UnlabeledInhibitorThreshold > 0 {
+					if err := fc.inhibitAllLabels(ctx, visionService, fc.conf.UnlabeledInhibitorThreshold); err != nil {
+						return err
 					}
 				}
+			} else {
+				fc.otherVisionServices = append(fc.otherVisionServices, visionService)
+				fc.sustainClassifications[vs.Vision] = sustainScores(vs.Classifications)
+				fc.sustainObjects[vs.Vision] = sustainScores(vs.Objects)
+				if vs.Classifications != nil {
+					fc.acceptedClassifications[vs.Vision] = minScores(vs.Classifications)
+				}
+				if vs.Objects != nil {
+					fc.acceptedObjects[vs.Vision] = minScores(vs.Objects)
+				}
 			}
-			fc.acceptedStats.startTime = time.Now()
-			fc.rejectedStats.startTime = time.Now()
+		}
+	}
+	fc.labelPatterns, err = compileLabelPatterns(fc.acceptedClassifications, fc.acceptedObjects,
+		fc.inhibitedClassifications, fc.inhibitedObjects)
+	return err
+}
 
-			// Initialize the image buffer
-			imageFreq := newConf.ImageFrequency
-			if imageFreq == 0 {
-				imageFreq = defaultImageFreq
-			}
-			fc.buf = imagebuffer.NewImageBuffer(newConf.WindowSeconds, imageFreq, newConf.WindowSecondsBefore, newConf.WindowSecondsAfter, logger, newConf.Debug, newConf.CooldownSecs)
-
-			// Initialize background image capture worker
-			fc.backgroundWorkers = utils.NewStoppableWorkerWithTicker(
-				time.Duration(1000.0/imageFreq)*time.Millisecond,
-				func(ctx context.Context) {
-					ctx, span := trace.StartSpan(ctx, "filteredcamera::bgWorker")
-					defer span.End()
-					fc.captureImageInBackground(ctx)
-				},
-			)
+// configureBuffer creates the image buffer, or updates the existing one for fc.conf when reconfiguring from oldConf.
+// The ring buffer is only resized when the window or the image frequency change, so its frames otherwise survive.
+func (fc *filteredCamera) configureBuffer(oldConf *Config) {
+	newConf := fc.conf
+	imageFreq := newConf.ImageFrequency
+	if imageFreq == 0 {
+		imageFreq = defaultImageFreq
+	}
+	resized := true
+	if fc.buf == nil {
+		fc.buf = imagebuffer.NewImageBuffer(newConf.WindowSeconds, imageFreq, newConf.WindowSecondsBefore, newConf.WindowSecondsAfter, fc.logger, newConf.Debug, newConf.CooldownSecs)
+		fc.buf.SetEvictionCallback(fc.recordEviction)
+	} else {
+		resized = false
+		if newConf.WindowSeconds != oldConf.WindowSeconds || newConf.WindowSecondsBefore != oldConf.WindowSecondsBefore ||
+			newConf.WindowSecondsAfter != oldConf.WindowSecondsAfter || fc.windowOverridden {
+			fc.buf.SetWindow(newConf.WindowSeconds, newConf.WindowSecondsBefore, newConf.WindowSecondsAfter)
+			fc.windowOverridden = false
+			resized = true
+		}
+		// Under auto_frequency the buffer may have been resized for the observed frame rate, which is kept unless
+		// image_frequency itself changed
+		if newConf.ImageFrequency != oldConf.ImageFrequency {
+			fc.buf.SetImageFrequency(imageFreq)
+			resized = true
+		}
+		fc.buf.SetCooldown(newConf.CooldownSecs)
+		fc.buf.SetDebug(newConf.Debug)
+	}
+	fc.buf.SetExtendSameLabelOnly(newConf.ExtendSameLabelOnly)
+	fc.buf.SetBurstDedupe(time.Duration(newConf.BurstDedupeMs) * time.Millisecond)
+	fc.buf.SetMinFrameGap(time.Duration(newConf.MinFrameGapMs) * time.Millisecond)
+	fc.buf.SetAnnotateSeq(newConf.AnnotateWindowSeq)
+	fc.buf.SetAnnotateTrigger(newConf.AnnotateTriggerFrame)
+	fc.buf.SetAnnotateReason(newConf.AnnotateTriggerReason)
+	fc.buf.SetMinWindow(time.Duration(newConf.MinWindowSeconds) * time.Second)
+	fc.buf.SetCompact(newConf.CompactRingBuffer)
+	fc.buf.SetContactSheet(newConf.ContactSheet)
+	fc.buf.SetMaxPendingWindows(newConf.MaxPendingWindows)
+	fc.buf.SetSplitWindowEveryN(newConf.SplitWindowEveryN)
+	fc.buf.SetMaxToSend(newConf.MaxToSendImages)
+	fc.buf.SetEmitEvents(newConf.EmitEvents)
+	spillMaxBytes := newConf.SpillMaxBytes
+	if spillMaxBytes == 0 {
+		spillMaxBytes = defaultSpillMaxBytes
+	}
+	if err := fc.buf.SetSpill(newConf.SpillDir, spillMaxBytes); err != nil {
+		fc.logger.Warnf("keeping the whole ring buffer in memory: %v", err)
+	}
+	if resized {
+		status := fc.buf.Status()
+		fc.logger.Infof("image buffer holds up to %d images (3 * window seconds * %v images/s); capture windows hold about %d frames before and %d after a trigger",
+			status.MaxImages, status.ImageFrequency, status.FramesBefore, status.FramesAfter)
+	}
+}
 
-			return fc, nil
+// configureBackgroundWorker starts the background image capture worker, which Reconfigure stopped. The frame rate
+// observed for auto_frequency is kept unless reconfiguring from oldConf changed the capture interval.
+func (fc *filteredCamera) configureBackgroundWorker(oldConf *Config) {
+	captureInterval := fc.conf.captureInterval()
+	fc.captureTimeout = captureTimeoutTicks * captureInterval
+	if fc.conf.CaptureTimeoutMs > 0 {
+		fc.captureTimeout = time.Duration(fc.conf.CaptureTimeoutMs) * time.Millisecond
+	}
+	if oldConf != nil && oldConf.captureInterval() != captureInterval {
+		// The frame rate observed for auto_frequency was for the old interval
+		fc.lastFrameAt = time.Time{}
+		fc.frameIntervals = nil
+	}
+	fc.backgroundWorkers = utils.NewStoppableWorkerWithTicker(
+		captureInterval,
+		func(ctx context.Context) {
+			ctx, span := trace.StartSpan(ctx, "filteredcamera::bgWorker")
+			defer span.End()
+			fc.captureImageInBackground(ctx)
 		},
-	})
+	)
 }
 
 type filteredCamera struct {
-	resource.AlwaysRebuild
 	resource.Named
 
 	conf   *Config
 	logger logging.Logger
 
 	cam                      camera.Camera
+	extraCams                []camera.Camera
 	buf                      *imagebuffer.ImageBuffer
 	backgroundWorkers        *utils.StoppableWorkers
 	inhibitors               []vision.Service
@@ -219,95 +832,299 @@ type filteredCamera struct {
 	acceptedClassifications  map[string]map[string]float64
 	inhibitedObjects         map[string]map[string]float64
 	acceptedObjects          map[string]map[string]float64
-	acceptedStats            imageStats
-	rejectedStats            imageStats
+	// classificationCeilings and objectCeilings hold the optional maximum score of each label, keyed by vision service name
+	classificationCeilings map[string]map[string]float64
+	objectCeilings         map[string]map[string]float64
+	// objectMinAreas holds the optional minimum bounding box area of each label, keyed by vision service name
+	objectMinAreas map[string]map[string]int
+	// objectMinCounts holds the optional number of detections each label needs to match, keyed by vision service name
+	objectMinCounts map[string]map[string]int
+	// sustainClassifications and sustainObjects hold the scores that extend an open capture window, keyed by vision
+	// service name and then label
+	sustainClassifications map[string]map[string]float64
+	sustainObjects         map[string]map[string]float64
+	// inclusiveThreshold lets scores equal to a threshold's minimum match it
+	inclusiveThreshold bool
+	// labelPatterns holds the compiled regular expression label keys of all the thresholds, keyed by label key
+	labelPatterns map[string]*regexp.Regexp
+	// inhibitorScopes holds the accepting vision services each scoped inhibitor vetoes, keyed by inhibitor name.
+	// Inhibitors without an entry veto the whole frame.
+	inhibitorScopes map[string][]string
+	// serviceConfigs holds the per vision service settings, keyed by vision service name
+	serviceConfigs map[string]VisionServiceConfig
+	// statsMu guards acceptedStats, rejectedStats, evaluations and the vision availability, which Images and the
+	// background worker update while DoCommand reads them
+	statsMu       sync.Mutex
+	acceptedStats imagestats.Stats
+	rejectedStats imagestats.Stats
+	// evaluations counts the frames run through shouldSend since the stats started, whatever the outcome
+	evaluations int
+	// sendMu serializes Images calls, so that pendingPop belongs to the call in progress
+	sendMu sync.Mutex
+	// confMu is held for writing while Reconfigure swaps the config and vision setup, for the readers that don't hold
+	// sendMu, such as rescore
+	confMu sync.RWMutex
+	// pendingPop is the batch popped from the buffer by the current Images call, until it is committed or rolled back
+	pendingPop *imagebuffer.Pop
+	// windowOverridden is set, under sendMu, while set_window has replaced the configured capture window
+	windowOverridden bool
+	// debugLogging is whether debug logging is on, which is the debug setting until set_debug changes it
+	debugLogging atomic.Bool
+	// sizeLog throttles the errors logged for frames under min_image_width and min_image_height
+	sizeLog undersizedLog
+	// captureFailing and lastCapturedAt track outages of the underlying camera for outage_grace_seconds
+	outageMu       sync.Mutex
+	captureFailing bool
+	lastCapturedAt time.Time
+	// evictions counts the frames discarded by the image buffer, by reason
+	evictionsMu sync.Mutex
+	evictions   map[string]int
+	// lastRejected is the most recently rejected frame, for last_rejected
+	rejectedMu   sync.Mutex
+	lastRejected *rejectedFrame
+	// captureTimeout is how long the background worker waits for the underlying camera, without limit if 0
+	captureTimeout time.Duration
+	// streamFallback is set when the underlying camera doesn't support Images and frames are read from its stream
+	streamFallback bool
+	// triggerMu guards lastTrigger, which Images and force_trigger set and every evaluation reads
+	triggerMu sync.Mutex
+	// lastTrigger is when a frame was last accepted, used to relax thresholds while idle
+	lastTrigger time.Time
+	// visionUnavailable is set, under statsMu, while every accepting vision service is failing
+	visionUnavailable        bool
+	visionUnavailablePeriods int
+	// rejectedSampler draws the numbers compared against sample_rejected_rate, rand.Float64 if nil
+	rejectedSampler func() float64
+	// captureSampler draws the numbers compared against capture_sample_rate, rand.Float64 if nil
+	captureSampler func() float64
+	// warmUntil is when the warmup_seconds after the camera was built end
+	warmUntil time.Time
+	// lastFrameAt and frameIntervals are the capture times observed by the background worker for auto_frequency
+	lastFrameAt    time.Time
+	frameIntervals []time.Duration
+}
+
+// recordAccepted counts a frame in the accepted stats under each of labels.
+func (fc *filteredCamera) recordAccepted(labels ...string) {
+	fc.statsMu.Lock()
+	defer fc.statsMu.Unlock()
+	for _, label := range labels {
+		fc.acceptedStats.Update(label)
+	}
 }
 
-type imageStats struct {
-	total     int
-	breakdown map[string]int
-	startTime time.Time
+// recordRejected counts a frame in the rejected stats under label.
+func (fc *filteredCamera) recordRejected(label string) {
+	fc.statsMu.Lock()
+	defer fc.statsMu.Unlock()
+	fc.rejectedStats.Update(label)
 }
 
-func (is *imageStats) update(visionService string) {
-	is.total++
-	if is.breakdown == nil {
-		is.breakdown = make(map[string]int)
+// recordVerdict counts a frame run through the filter, along with the labels of its verdict in the accepted or the
+// rejected stats, in a single critical section. A frame the filter failed on has no labels and only counts as
+// evaluated.
+func (fc *filteredCamera) recordVerdict(v verdict) {
+	fc.statsMu.Lock()
+	defer fc.statsMu.Unlock()
+	fc.evaluations++
+	stats := &fc.rejectedStats
+	if v.send {
+		stats = &fc.acceptedStats
 	}
-	if _, ok := is.breakdown[visionService]; !ok {
-		is.breakdown[visionService] = 1
-		return
+	for _, label := range v.labels {
+		stats.Update(label)
 	}
-	is.breakdown[visionService]++
 }
 
 func (fc *filteredCamera) formatStats() map[string]interface{} {
-	stats := make(map[string]interface{})
-	stats["accepted"] = make(map[string]interface{})
-	stats["rejected"] = make(map[string]interface{})
-
-	if acceptedStats, ok := stats["accepted"].(map[string]interface{}); !ok {
-		fc.logger.Errorf("failed to get stats")
-		return nil
-	} else {
-		acceptedStats["total"] = fc.acceptedStats.total
-		acceptedStats["vision"] = fc.acceptedStats.breakdown
-	}
-	if rejectedStats, ok := stats["rejected"].(map[string]interface{}); !ok {
-		fc.logger.Errorf("failed to get stats")
-		return nil
-	} else {
-		rejectedStats["total"] = fc.rejectedStats.total
-		rejectedStats["vision"] = fc.rejectedStats.breakdown
+	fc.statsMu.Lock()
+	defer fc.statsMu.Unlock()
+	return map[string]interface{}{
+		"accepted":                   fc.acceptedStats.Summary(),
+		"rejected":                   fc.rejectedStats.Summary(),
+		"evaluations_total":          fc.evaluations,
+		"start_time":                 fc.acceptedStats.StartTime.Format(time.RFC1123),
+		"vision_unavailable_periods": fc.visionUnavailablePeriods,
 	}
+}
 
-	stats["start_time"] = fc.acceptedStats.startTime.Format(time.RFC1123)
-	return stats
+// resetStats zeroes the accepted and rejected counts, restarting them from now.
+func (fc *filteredCamera) resetStats() map[string]interface{} {
+	fc.statsMu.Lock()
+	defer fc.statsMu.Unlock()
+	now := time.Now()
+	fc.acceptedStats = fc.acceptedStats.Cleared(now)
+	fc.rejectedStats = fc.rejectedStats.Cleared(now)
+	fc.evaluations = 0
+	fc.logger.Infof("stats reset")
+	return map[string]interface{}{"reset": true, "start_time": now.Format(time.RFC1123)}
 }
 
-func (fc *filteredCamera) anyClassificationsMatch(visionService string, cs []classification.Classification, inhibit bool) (bool, []classification.Classification) {
+// anyClassificationsMatch returns the classifications that match the thresholds of visionService, best match first.
+// Accepted thresholds are lowered by relaxation, see thresholdRelaxation.
+func (fc *filteredCamera) anyClassificationsMatch(
+	visionService string, cs []classification.Classification, inhibit bool, relaxation float64,
+) (bool, []classification.Classification) {
 	res := []classification.Classification{}
 	for _, c := range cs {
-		if fc.classificationMatches(visionService, c, inhibit) {
+		if fc.classificationMatches(visionService, c, inhibit, relaxation) {
 			res = append(res, c)
 		}
 	}
+	// best match first
+	sort.SliceStable(res, func(i, j int) bool { return res[i].Score() > res[j].Score() })
+	if len(res) > 0 && !inhibit && !hasTopMargin(cs, res[0], fc.serviceConfigs[visionService].MinTopMargin) {
+		return false, []classification.Classification{}
+	}
 	return len(res) > 0, res
 }
 
-func (fc *filteredCamera) classificationMatches(visionService string, c classification.Classification, inhibit bool) bool {
+// hasTopMargin returns true if best is the highest scoring of all the classifications and beats the
+// runner-up by more than margin. A margin of 0 disables the check.
+func hasTopMargin(cs []classification.Classification, best classification.Classification, margin float64) bool {
+	if margin <= 0 {
+		return true
+	}
+	top, runnerUp := 0.0, 0.0
+	for _, c := range cs {
+		if c.Score() > top {
+			top, runnerUp = c.Score(), top
+		} else if c.Score() > runnerUp {
+			runnerUp = c.Score()
+		}
+	}
+	return best.Score() >= top && top-runnerUp > margin
+}
+
+func (fc *filteredCamera) classificationMatches(visionService string, c classification.Classification, inhibit bool, relaxation float64) bool {
 	var allClassifications map[string]map[string]float64
 	if inhibit {
+		// inhibit thresholds are never relaxed
 		allClassifications = fc.inhibitedClassifications
+		relaxation = 0
 	} else {
 		allClassifications = fc.acceptedClassifications
 	}
 
+	ceilings := fc.classificationCeilings[visionService]
 	min, has := allClassifications[visionService][c.Label()]
-	if has && c.Score() > min {
+	if has && fc.clears(c.Score(), fc.effectiveThreshold(min, relaxation)) && belowCeiling(ceilings, c.Label(), c.Score()) {
 		return true
 	}
 
+	patterns := fc.matchingPatterns(allClassifications[visionService], c.Label())
+	for _, key := range patterns {
+		min = allClassifications[visionService][key]
+		if fc.clears(c.Score(), fc.effectiveThreshold(min, relaxation)) && belowCeiling(ceilings, key, c.Score()) {
+			return true
+		}
+	}
+	named := has || len(patterns) > 0
+
 	min, has = allClassifications[visionService]["*"]
-	if has && c.Score() > min {
+	if has && fc.clears(c.Score(), fc.effectiveThreshold(min, relaxation)) && belowCeiling(ceilings, "*", c.Score()) {
 		return true
 	}
 
-	return false
+	min, has = fc.defaultThreshold(visionService)
+	return has && !named && fc.clears(c.Score(), fc.effectiveThreshold(min, relaxation))
+}
+
+// classificationsTopN returns how many classifications to request from a vision service.
+func (fc *filteredCamera) classificationsTopN() int {
+	if fc.conf.ClassificationsTopN > 0 {
+		return fc.conf.ClassificationsTopN
+	}
+	return defaultClassificationsTopN
+}
+
+// effectiveThreshold lowers an accepted classification threshold by relaxation, down to the adaptive threshold floor.
+func (fc *filteredCamera) effectiveThreshold(threshold, relaxation float64) float64 {
+	if relaxation == 0 {
+		return threshold
+	}
+	relaxed := math.Max(threshold-relaxation, fc.conf.AdaptiveThreshold.Floor)
+	return math.Min(relaxed, threshold)
+}
+
+// thresholdRelaxation works out how far accepted thresholds are relaxed at now, based on how long it has been since
+// the last trigger. It is worked out once per evaluation and passed down, so concurrent evaluations don't share it.
+func (fc *filteredCamera) thresholdRelaxation(now time.Time) float64 {
+	if fc.conf.AdaptiveThreshold == nil {
+		return 0
+	}
+	fc.triggerMu.Lock()
+	lastTrigger := fc.lastTrigger
+	fc.triggerMu.Unlock()
+	if lastTrigger.IsZero() {
+		return 0
+	}
+	idle := now.Sub(lastTrigger) - time.Duration(fc.conf.AdaptiveThreshold.IdleSeconds*float64(time.Second))
+	if idle <= 0 {
+		return 0
+	}
+	return fc.conf.AdaptiveThreshold.DecayPerMinute * idle.Minutes()
+}
+
+// startIdleClock starts counting the idle time that relaxes thresholds at now, unless something already triggered.
+func (fc *filteredCamera) startIdleClock(now time.Time) {
+	if fc.conf.AdaptiveThreshold == nil {
+		return
+	}
+	fc.triggerMu.Lock()
+	defer fc.triggerMu.Unlock()
+	if fc.lastTrigger.IsZero() {
+		fc.lastTrigger = now
+	}
+}
+
+// markTriggered records now as the time of the last trigger, which resets the threshold relaxation.
+func (fc *filteredCamera) markTriggered(now time.Time) {
+	fc.triggerMu.Lock()
+	defer fc.triggerMu.Unlock()
+	fc.lastTrigger = now
 }
 
+// anyDetectionsMatch returns the detections that match the thresholds of visionService. A threshold with a
+// min_count only matches once that many detections clear it, counting all the labels matched by a wildcard or
+// pattern key together.
 func (fc *filteredCamera) anyDetectionsMatch(visionService string, ds []objectdetection.Detection, inhibit bool) (bool, []objectdetection.Detection) {
 	res := []objectdetection.Detection{}
+	counts := fc.objectMinCounts[visionService]
+	var matchedKeys []string
 	for _, d := range ds {
-		if fc.detectionMatches(visionService, d, inhibit) {
+		if key, ok := fc.detectionMatch(visionService, d, inhibit); ok {
 			res = append(res, d)
+			matchedKeys = append(matchedKeys, key)
+		}
+	}
+	if len(counts) > 0 {
+		matched := map[string]int{}
+		for _, key := range matchedKeys {
+			matched[key]++
+		}
+		counted := []objectdetection.Detection{}
+		for i, d := range res {
+			if min, has := counts[matchedKeys[i]]; !has || matched[matchedKeys[i]] >= min {
+				counted = append(counted, d)
+			}
 		}
+		res = counted
 	}
+	// best match first
+	sort.SliceStable(res, func(i, j int) bool { return res[i].Score() > res[j].Score() })
 
 	return len(res) > 0, res
 }
 
 func (fc *filteredCamera) detectionMatches(visionService string, d objectdetection.Detection, inhibit bool) bool {
+	_, ok := fc.detectionMatch(visionService, d, inhibit)
+	return ok
+}
+
+// detectionMatch returns the threshold key that d matches for visionService, which is empty for the
+// default_threshold, and whether it matches any.
+func (fc *filteredCamera) detectionMatch(visionService string, d objectdetection.Detection, inhibit bool) (string, bool) {
 	var allDetections map[string]map[string]float64
 	if inhibit {
 		allDetections = fc.inhibitedObjects
@@ -315,59 +1132,743 @@ func (fc *filteredCamera) detectionMatches(visionService string, d objectdetecti
 		allDetections = fc.acceptedObjects
 	}
 
+	ceilings := fc.objectCeilings[visionService]
+	areas := fc.objectMinAreas[visionService]
 	min, has := allDetections[visionService][d.Label()]
-	if has && d.Score() > min {
-		return true
+	if has && fc.clears(d.Score(), min) && belowCeiling(ceilings, d.Label(), d.Score()) && largeEnough(areas, d.Label(), d) {
+		return d.Label(), true
 	}
 
+	patterns := fc.matchingPatterns(allDetections[visionService], d.Label())
+	for _, key := range patterns {
+		min = allDetections[visionService][key]
+		if fc.clears(d.Score(), min) && belowCeiling(ceilings, key, d.Score()) && largeEnough(areas, key, d) {
+			return key, true
+		}
+	}
+	named := has || len(patterns) > 0
+
 	min, has = allDetections[visionService]["*"]
-	if has && d.Score() > min {
-		return true
+	if has && fc.clears(d.Score(), min) && belowCeiling(ceilings, "*", d.Score()) && largeEnough(areas, "*", d) {
+		return "*", true
 	}
 
-	return false
+	min, has = fc.defaultThreshold(visionService)
+	return "", has && !named && fc.clears(d.Score(), min)
+}
+
+// defaultThreshold returns the default_threshold of visionService, which applies to the labels that none of its
+// thresholds name, and whether it has one. Unlike "*", it doesn't apply to labels that have a threshold of their own.
+func (fc *filteredCamera) defaultThreshold(visionService string) (float64, bool) {
+	threshold := fc.serviceConfigs[visionService].DefaultThreshold
+	return threshold, threshold > 0
+}
+
+// matchingPatterns returns the regular expression label keys of thresholds that match label.
+func (fc *filteredCamera) matchingPatterns(thresholds map[string]float64, label string) []string {
+	if len(fc.labelPatterns) == 0 {
+		return nil
+	}
+	var keys []string
+	for key := range thresholds {
+		if pattern, ok := fc.labelPatterns[key]; ok && pattern.MatchString(label) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
 }
 
 func (fc *filteredCamera) Close(ctx context.Context) error {
 	if fc.backgroundWorkers != nil {
 		fc.backgroundWorkers.Stop()
 	}
+	if fc.buf != nil {
+		return fc.buf.Close()
+	}
 	return nil
 }
 
-func (fc *filteredCamera) captureImageInBackground(ctx context.Context) {
-	images, meta, err := fc.cam.Images(ctx, nil, nil)
+// trackOutage notes failed captures from the underlying camera. When captures resume after failing, a capture
+// window that was open at the last good frame is extended by the length of the outage, up to outage_grace_seconds,
+// so the clip picks up where it left off instead of the window expiring while the camera was down.
+func (fc *filteredCamera) trackOutage(capturedAt time.Time, err error) {
+	fc.outageMu.Lock()
+	defer fc.outageMu.Unlock()
 	if err != nil {
-		fc.logger.Debugf("Error capturing image in background: %v", err)
+		fc.captureFailing = true
 		return
 	}
-	now := meta.CapturedAt
-	fc.buf.StoreImages(images, meta, now)
+	if fc.captureFailing && !fc.lastCapturedAt.IsZero() && fc.conf.OutageGraceSeconds > 0 {
+		outage := capturedAt.Sub(fc.lastCapturedAt)
+		grace := time.Duration(fc.conf.OutageGraceSeconds * float64(time.Second))
+		if outage > grace {
+			outage = grace
+		}
+		if outage > 0 && fc.buf.ExtendWindow(fc.lastCapturedAt, outage) {
+			fc.logger.Infof("camera recovered, extended the capture window by %s", outage)
+		}
+	}
+	fc.captureFailing = false
+	fc.lastCapturedAt = capturedAt
 }
 
-func (fc *filteredCamera) DoCommand(ctx context.Context, cmd map[string]interface{}) (map[string]interface{}, error) {
-	return fc.formatStats(), nil
+// detectImagesSupport checks whether the underlying camera can serve Images. Older cameras that only
+// implement Stream fail there, in which case single frames are read from their stream instead.
+func (fc *filteredCamera) detectImagesSupport(ctx context.Context) {
+	if _, _, err := fc.cam.Images(ctx, nil, nil); err == nil {
+		return
+	} else if _, ok := fc.cam.(camera.VideoSource); ok {
+		fc.logger.Infof("camera %q failed to return images (%v), falling back to reading frames from its stream", fc.cam.Name().ShortName(), err)
+		fc.streamFallback = true
+	}
 }
 
-func (fc *filteredCamera) Images(ctx context.Context, filterSourceNames []string, extra map[string]interface{}) ([]camera.NamedImage, resource.ResponseMetadata, error) {
-	return fc.images(ctx, filterSourceNames, extra, false) // false indicates multiple images mode
+// cameraSources are the cameras frames are read from. A read takes them up front, so that one the background worker
+// abandons keeps reading the cameras it started with while Reconfigure replaces them.
+type cameraSources struct {
+	cam            camera.Camera
+	extraCams      []camera.Camera
+	streamFallback bool
 }
 
-// getBufferedImages returns images from the ToSend buffer depending on the image mode.
-// single image just returns the first image in the queue, while otherwise it returns the whole buffer
-// if ToSend is empty, returns false
-func (fc *filteredCamera) getBufferedImages(singleImageMode bool) ([]camera.NamedImage, resource.ResponseMetadata, bool) {
-	if singleImageMode {
-		if x, ok := fc.buf.PopFirstToSend(); ok {
-			return x.Imgs, x.Meta, true
-		}
-	} else {
-		if allImages, batchMeta, ok := fc.buf.PopAllToSend(); ok {
-			return allImages, batchMeta, true
-		}
+// sources returns the cameras frames are currently read from.
+func (fc *filteredCamera) sources() cameraSources {
+	return cameraSources{cam: fc.cam, extraCams: fc.extraCams, streamFallback: fc.streamFallback}
+}
+
+// cameraImages gets images from the underlying camera, synthesizing a single NamedImage from the
+// camera's stream if it doesn't support Images.
+func (fc *filteredCamera) cameraImages(ctx context.Context, filterSourceNames []string, extra map[string]interface{}) ([]camera.NamedImage, resource.ResponseMetadata, error) {
+	images, meta, err := fc.readSources(ctx, fc.sources(), filterSourceNames, extra)
+	fc.trackOutage(meta.CapturedAt, err)
+	return images, meta, err
+}
+
+// readSources reads the underlying camera of src and merges in the images of its extra cameras.
+func (fc *filteredCamera) readSources(ctx context.Context, src cameraSources, filterSourceNames []string, extra map[string]interface{}) ([]camera.NamedImage, resource.ResponseMetadata, error) {
+	images, meta, err := fc.readCamera(ctx, src, filterSourceNames, extra)
+	if err == nil && len(src.extraCams) > 0 {
+		images = fc.extraCameraImages(ctx, src.extraCams, images, filterSourceNames, extra)
 	}
-	// ToSend buffer is empty - no images to capture
-	return nil, resource.ResponseMetadata{}, false
+	return images, meta, err
+}
+
+func (fc *filteredCamera) readCamera(ctx context.Context, src cameraSources, filterSourceNames []string, extra map[string]interface{}) ([]camera.NamedImage, resource.ResponseMetadata, error) {
+	if !src.streamFallback {
+		return src.cam.Images(ctx, filterSourceNames, extra)
+	}
+
+	stream, err := src.cam.(camera.VideoSource).Stream(ctx)
+	if err != nil {
+		return nil, resource.ResponseMetadata{}, err
+	}
+	defer func() {
+		if err := stream.Close(ctx); err != nil {
+			fc.logger.Debugf("error closing camera stream: %v", err)
+		}
+	}()
+
+	img, release, err := stream.Next(ctx)
+	if err != nil {
+		return nil, resource.ResponseMetadata{}, err
+	}
+	meta := resource.ResponseMetadata{CapturedAt: time.Now()}
+	if release != nil {
+		defer release()
+	}
+	// The frame is shared by the stream, so copy it before handing it to the buffer
+	frame := image.NewRGBA(img.Bounds())
+	draw.Draw(frame, frame.Bounds(), img, img.Bounds().Min, draw.Src)
+
+	namedImg, err := camera.NamedImageFromImage(frame, src.cam.Name().ShortName(), rutils.MimeTypeJPEG, data.Annotations{})
+	if err != nil {
+		return nil, meta, err
+	}
+	return []camera.NamedImage{namedImg}, meta, nil
+}
+
+func (fc *filteredCamera) captureImageInBackground(ctx context.Context) {
+	if ctx.Err() != nil {
+		return
+	}
+	images, meta, err := fc.backgroundImages(ctx)
+	if err != nil {
+		fc.logger.Debugf("Error capturing image in background: %v", err)
+		return
+	}
+	// the worker is being stopped, so the frame is dropped rather than held up in vision for in_window inhibitors
+	if ctx.Err() != nil {
+		return
+	}
+	if len(images) == 0 {
+		fc.logger.Debug("camera returned no images, skipping this background capture")
+		return
+	}
+	if images = fc.sizedImages(images); len(images) == 0 {
+		return
+	}
+	fc.storeImages(ctx, images, meta)
+	if fc.conf.AutoFrequency {
+		fc.observeFrameRate(meta.CapturedAt)
+	}
+}
+
+// backgroundImages reads the underlying camera for the background worker, giving up after captureTimeout so that a
+// hung camera doesn't stall the worker. An abandoned call is left to finish on its own and its images are discarded;
+// it only reads the cameras it was given, so it doesn't race with Reconfigure once the worker has moved on.
+func (fc *filteredCamera) backgroundImages(ctx context.Context) ([]camera.NamedImage, resource.ResponseMetadata, error) {
+	if fc.captureTimeout <= 0 {
+		return fc.cameraImages(ctx, nil, nil)
+	}
+	ctx, cancel := context.WithTimeout(ctx, fc.captureTimeout)
+	defer cancel()
+
+	type capture struct {
+		images []camera.NamedImage
+		meta   resource.ResponseMetadata
+		err    error
+	}
+	done := make(chan capture, 1)
+	src := fc.sources()
+	go func() {
+		images, meta, err := fc.readSources(ctx, src, nil, nil)
+		done <- capture{images, meta, err}
+	}()
+	select {
+	case c := <-done:
+		fc.trackOutage(c.meta.CapturedAt, c.err)
+		return c.images, c.meta, c.err
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			fc.trackOutage(time.Time{}, ctx.Err())
+			fc.logger.Warnf("camera did not return images within %v, skipping this background capture", fc.captureTimeout)
+		}
+		return nil, resource.ResponseMetadata{}, ctx.Err()
+	}
+}
+
+// DoCommand runs the command named under the "command" or "cmd" key of cmd, or returns the stats if neither is set.
+func (fc *filteredCamera) DoCommand(ctx context.Context, cmd map[string]interface{}) (map[string]interface{}, error) {
+	name, err := CommandName(cmd)
+	if err != nil {
+		return nil, err
+	}
+	switch name {
+	case "":
+		return fc.formatStats(), nil
+	case "latest_frame":
+		return fc.latestFrame(ctx)
+	case "rescore":
+		return fc.rescore(ctx)
+	case "get_range":
+		return fc.getRange(ctx, cmd)
+	case "export":
+		return fc.export(ctx, cmd)
+	case "buffer_status":
+		return fc.bufferStatus(), nil
+	case "set_debug":
+		return fc.setDebug(cmd)
+	case "set_window":
+		return fc.setWindow(cmd)
+	case "trigger_at":
+		return fc.triggerAt(cmd)
+	case "force_trigger":
+		return fc.forceTrigger(), nil
+	case "reset_stats":
+		return fc.resetStats(), nil
+	case "metrics":
+		return fc.metrics(), nil
+	case "last_rejected":
+		return fc.lastRejectedFrame(ctx)
+	default:
+		return nil, fmt.Errorf("unknown command %q", name)
+	}
+}
+
+// rescore runs the ring buffer back through the vision services with the current thresholds and reports how many
+// of the buffered frames would trigger a capture. The verdicts are only tallied, never counted in the stats, and the
+// buffer is left untouched. Evaluating a frame has no side effects, so it doesn't hold up Images with sendMu, only
+// Reconfigure with confMu, and it stops early once ctx is done.
+func (fc *filteredCamera) rescore(ctx context.Context) (map[string]interface{}, error) {
+	fc.confMu.RLock()
+	defer fc.confMu.RUnlock()
+
+	frames := fc.buf.RingBufferFrames()
+	triggered := 0
+	for _, cached := range frames {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		for _, img := range cached.Imgs {
+			v, err := fc.evaluateFrame(ctx, img, cached.Meta.CapturedAt)
+			if err != nil {
+				return nil, err
+			}
+			if v.send {
+				triggered++
+				break
+			}
+		}
+	}
+	return map[string]interface{}{
+		"frames":        len(frames),
+		"would_trigger": triggered,
+	}, nil
+}
+
+// setDebug turns debug logging on or off at runtime when "value" is given, and reports whether it is on. The setting
+// is kept apart from the config, which Reconfigure owns, and lasts until the next Reconfigure.
+func (fc *filteredCamera) setDebug(cmd map[string]interface{}) (map[string]interface{}, error) {
+	if raw, ok := cmd["value"]; ok {
+		debug, ok := raw.(bool)
+		if !ok {
+			return nil, fmt.Errorf("\"value\" must be a bool, got %T", raw)
+		}
+		fc.debugLogging.Store(debug)
+		fc.buf.SetDebug(debug)
+		fc.logger.Infof("debug logging set to %t", debug)
+	}
+	return map[string]interface{}{"debug": fc.debug()}, nil
+}
+
+// debug reports whether debug logging is on, as configured or as last set with set_debug.
+func (fc *filteredCamera) debug() bool {
+	return fc.debugLogging.Load()
+}
+
+// setWindow changes the capture window at runtime to "window" seconds either side of a trigger, or to "before" and
+// "after" seconds, keeping the current value of whichever of them isn't given, and reports the effective window.
+// The same constraints as the configuration apply. The config is left alone, and the change lasts until the camera is
+// next reconfigured.
+func (fc *filteredCamera) setWindow(cmd map[string]interface{}) (map[string]interface{}, error) {
+	fc.sendMu.Lock()
+	defer fc.sendMu.Unlock()
+
+	window, hasWindow, err := parseSecondsArg(cmd, "window")
+	if err != nil {
+		return nil, err
+	}
+	before, hasBefore, err := parseSecondsArg(cmd, "before")
+	if err != nil {
+		return nil, err
+	}
+	after, hasAfter, err := parseSecondsArg(cmd, "after")
+	if err != nil {
+		return nil, err
+	}
+	if hasWindow && (hasBefore || hasAfter) {
+		return nil, errors.New("if \"window\" is set, \"before\" and \"after\" must not be")
+	}
+
+	status := fc.buf.Status()
+	switch {
+	case hasWindow:
+		before, after = 0, 0
+	case hasBefore || hasAfter:
+		if !hasBefore {
+			before = status.WindowSecondsBefore
+		}
+		if !hasAfter {
+			after = status.WindowSecondsAfter
+		}
+	default:
+		return fc.windowSettings(status), nil
+	}
+	if window == 0 && before == 0 && after == 0 {
+		return nil, errors.New("the window cannot be zero both before and after a trigger")
+	}
+	fc.buf.SetWindow(window, before, after)
+	fc.windowOverridden = true
+	status = fc.buf.Status()
+	fc.logger.Infof("capture window set to %d seconds before and %d after a trigger, image buffer holds up to %d images",
+		status.WindowSecondsBefore, status.WindowSecondsAfter, status.MaxImages)
+	return fc.windowSettings(status), nil
+}
+
+// windowSettings reports the effective capture window for set_window.
+func (fc *filteredCamera) windowSettings(status imagebuffer.Status) map[string]interface{} {
+	return map[string]interface{}{
+		"window_seconds_before": status.WindowSecondsBefore,
+		"window_seconds_after":  status.WindowSecondsAfter,
+		"max_images":            status.MaxImages,
+	}
+}
+
+// parseSecondsArg reads an optional non-negative whole number of seconds from a DoCommand request, returning whether
+// it was given.
+func parseSecondsArg(cmd map[string]interface{}, key string) (int, bool, error) {
+	raw, ok := cmd[key]
+	if !ok {
+		return 0, false, nil
+	}
+	var seconds int
+	switch v := raw.(type) {
+	case float64:
+		if v != math.Trunc(v) {
+			return 0, false, fmt.Errorf("%q must be a whole number of seconds, got %v", key, v)
+		}
+		seconds = int(v)
+	case int:
+		seconds = v
+	default:
+		return 0, false, fmt.Errorf("%q must be a number, got %T", key, raw)
+	}
+	if seconds < 0 {
+		return 0, false, fmt.Errorf("%q cannot be negative", key)
+	}
+	return seconds, true, nil
+}
+
+// triggerAt opens a capture window around "time", an RFC3339 timestamp that defaults to now, as if a vision service
+// had triggered then. With trigger_at_tolerance_ms, the window is anchored to the buffered frame closest to "time"
+// within the tolerance, and the time returned is that frame's. An optional "id" is attached to every frame of the window so they can be joined with the
+// external event that caused the trigger.
+func (fc *filteredCamera) triggerAt(cmd map[string]interface{}) (map[string]interface{}, error) {
+	at := time.Now()
+	if _, ok := cmd["time"]; ok {
+		var err error
+		if at, err = parseTimeArg(cmd, "time"); err != nil {
+			return nil, err
+		}
+	}
+	id := ""
+	if raw, ok := cmd["id"]; ok {
+		if id, ok = raw.(string); !ok {
+			return nil, fmt.Errorf("\"id\" must be a string, got %T", raw)
+		}
+	}
+
+	if fc.conf.TriggerAtToleranceMs > 0 {
+		// An external timestamp rarely matches a frame, so the window is anchored to the closest one
+		at = fc.buf.NearestFrameTime(at, time.Duration(fc.conf.TriggerAtToleranceMs)*time.Millisecond)
+	}
+	triggered := fc.buf.MarkShouldSendWithCorrelationID(at, "trigger_at", id)
+	if triggered {
+		fc.logger.Infof("capture triggered at %s by DoCommand, correlation id %q", at.Format(time.RFC3339Nano), id)
+	}
+	return map[string]interface{}{"triggered": triggered, "time": at.Format(time.RFC3339Nano), "id": id}, nil
+}
+
+// cooldownRejection is the rejected stats label of frames that would have triggered a capture during the cooldown
+const cooldownRejection = "cooldown"
+
+// countCooldown runs the frames captured during the cooldown through the filter, without opening a window, so that
+// the triggers it suppresses are counted in the rejected stats under cooldownRejection. Frames that wouldn't have
+// triggered anyway are counted as usual.
+func (fc *filteredCamera) countCooldown(ctx context.Context, images []camera.NamedImage, now time.Time) {
+	for _, i := range fc.visionIndexes(images) {
+		v, err := fc.evaluateFrame(ctx, images[i], now)
+		if err != nil {
+			fc.logger.Debugf("could not run the filter during the cooldown: %v", err)
+			return
+		}
+		if v.send {
+			v = rejectedVerdict(cooldownRejection)
+		}
+		fc.recordVerdict(v)
+	}
+}
+
+// manualTriggerLabel is the label force_trigger captures are counted under in the accepted stats
+const manualTriggerLabel = "manual"
+
+// forceTrigger opens a capture window now, whatever the vision services report, so that an operator can keep the
+// buffered frames around a moment by hand. It holds sendMu like Images, so the window isn't opened in the middle of
+// an Images call, and counts as an accepted trigger under manualTriggerLabel.
+func (fc *filteredCamera) forceTrigger() map[string]interface{} {
+	fc.sendMu.Lock()
+	defer fc.sendMu.Unlock()
+	now := time.Now()
+	triggered := fc.buf.MarkShouldSendForLabel(now, manualTriggerLabel)
+	if triggered {
+		fc.recordAccepted(manualTriggerLabel)
+		fc.markTriggered(now)
+		fc.logger.Infof("capture forced by DoCommand at %s", now.Format(time.RFC3339Nano))
+	}
+	return map[string]interface{}{"triggered": triggered, "to_send": fc.buf.GetToSendLength()}
+}
+
+// recordEviction counts a frame discarded by the image buffer. It is the buffer's eviction callback.
+func (fc *filteredCamera) recordEviction(capturedAt time.Time, reason string) {
+	fc.evictionsMu.Lock()
+	defer fc.evictionsMu.Unlock()
+	if fc.evictions == nil {
+		fc.evictions = make(map[string]int)
+	}
+	fc.evictions[reason]++
+	if fc.debug() {
+		fc.logger.Infow("image buffer discarded a frame", "capturedAt", capturedAt, "reason", reason)
+	}
+}
+
+// evictionCounts returns how many frames the image buffer has discarded, by reason.
+func (fc *filteredCamera) evictionCounts() map[string]interface{} {
+	fc.evictionsMu.Lock()
+	defer fc.evictionsMu.Unlock()
+	counts := make(map[string]interface{}, len(fc.evictions))
+	for reason, n := range fc.evictions {
+		counts[reason] = n
+	}
+	return counts
+}
+
+// bufferStatus reports how the image buffer is sized for the configured windows and frequency, and how full it is.
+func (fc *filteredCamera) bufferStatus() map[string]interface{} {
+	status := fc.buf.Status()
+	return map[string]interface{}{
+		"max_images":            status.MaxImages,
+		"window_seconds_before": status.WindowSecondsBefore,
+		"window_seconds_after":  status.WindowSecondsAfter,
+		"image_frequency":       status.ImageFrequency,
+		"frames_before":         status.FramesBefore,
+		"frames_after":          status.FramesAfter,
+		"ring_buffer_size":      status.RingBufferSize,
+		"to_send_size":          status.ToSendSize,
+		"capture_from":          formatWindowTime(status.CaptureFrom),
+		"capture_till":          formatWindowTime(status.CaptureTill),
+		"evictions":             fc.evictionCounts(),
+	}
+}
+
+// formatWindowTime formats a capture window boundary for buffer_status, as an empty string if there hasn't been a window.
+func formatWindowTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+// getRange returns the frames in the ring buffer captured between the "from" and "to" RFC3339 times, inclusive,
+// without affecting windowing.
+func (fc *filteredCamera) getRange(ctx context.Context, cmd map[string]interface{}) (map[string]interface{}, error) {
+	from, err := parseTimeArg(cmd, "from")
+	if err != nil {
+		return nil, err
+	}
+	to, err := parseTimeArg(cmd, "to")
+	if err != nil {
+		return nil, err
+	}
+	if to.Before(from) {
+		return nil, fmt.Errorf("\"to\" (%s) is before \"from\" (%s)", to.Format(time.RFC3339Nano), from.Format(time.RFC3339Nano))
+	}
+
+	frames := fc.buf.GetRange(from, to)
+	encoded := make([]interface{}, 0, len(frames))
+	for _, frame := range frames {
+		e, err := encodeCachedData(ctx, frame)
+		if err != nil {
+			return nil, err
+		}
+		encoded = append(encoded, e)
+	}
+	return map[string]interface{}{"frames": encoded}, nil
+}
+
+// defaultExportLimit is how many frames a page of "export" holds unless "limit" is given
+const defaultExportLimit = 10
+
+// export returns a page of up to "limit" ring buffer frames, oldest first, continuing from "cursor" if given. The
+// response's "next_cursor" fetches the next page, and is empty once every frame has been returned.
+func (fc *filteredCamera) export(ctx context.Context, cmd map[string]interface{}) (map[string]interface{}, error) {
+	cursor := ""
+	if raw, ok := cmd["cursor"]; ok {
+		if cursor, ok = raw.(string); !ok {
+			return nil, fmt.Errorf("\"cursor\" must be a string, got %T", raw)
+		}
+	}
+	limit := defaultExportLimit
+	if raw, ok := cmd["limit"]; ok {
+		switch v := raw.(type) {
+		case float64:
+			limit = int(v)
+		case int:
+			limit = v
+		default:
+			return nil, fmt.Errorf("\"limit\" must be a number, got %T", raw)
+		}
+	}
+
+	frames, next, err := fc.buf.ExportPage(cursor, limit)
+	if err != nil {
+		return nil, err
+	}
+	encoded := make([]interface{}, 0, len(frames))
+	for _, frame := range frames {
+		e, err := encodeCachedData(ctx, frame)
+		if err != nil {
+			return nil, err
+		}
+		encoded = append(encoded, e)
+	}
+	return map[string]interface{}{"frames": encoded, "next_cursor": next}, nil
+}
+
+// parseTimeArg reads a required RFC3339 time argument from a DoCommand request.
+func parseTimeArg(cmd map[string]interface{}, key string) (time.Time, error) {
+	raw, ok := cmd[key].(string)
+	if !ok {
+		return time.Time{}, fmt.Errorf("%q must be an RFC3339 timestamp string", key)
+	}
+	t, err := time.Parse(time.RFC3339Nano, raw)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %q: %w", key, err)
+	}
+	return t, nil
+}
+
+// latestFrame returns the most recent frame captured from the underlying camera, bypassing any filtering.
+func (fc *filteredCamera) latestFrame(ctx context.Context) (map[string]interface{}, error) {
+	frame, ok := fc.buf.LatestFrame()
+	if !ok {
+		return nil, errors.New("no frames have been captured yet")
+	}
+	return encodeCachedData(ctx, frame)
+}
+
+// encodeCachedData renders a buffered frame as a DoCommand response, with each image base64 encoded.
+func encodeCachedData(ctx context.Context, frame imagebuffer.CachedData) (map[string]interface{}, error) {
+	images := make([]interface{}, 0, len(frame.Imgs))
+	for _, img := range frame.Imgs {
+		imgBytes, err := img.Bytes(ctx)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, map[string]interface{}{
+			"source_name": img.SourceName,
+			"mime_type":   img.MimeType(),
+			"image":       base64.StdEncoding.EncodeToString(imgBytes),
+		})
+	}
+	return map[string]interface{}{
+		"captured_at": frame.Meta.CapturedAt.Format(time.RFC3339Nano),
+		"images":      images,
+	}, nil
+}
+
+func (fc *filteredCamera) Images(ctx context.Context, filterSourceNames []string, extra map[string]interface{}) ([]camera.NamedImage, resource.ResponseMetadata, error) {
+	fc.sendMu.Lock()
+	defer fc.sendMu.Unlock()
+	fc.pendingPop = nil
+
+	mimeType := RequestedMimeType(extra)
+	if err := fc.checkMimeType(ctx, mimeType); err != nil {
+		return nil, resource.ResponseMetadata{}, err
+	}
+
+	images, meta, err := fc.images(ctx, filterSourceNames, extra, false) // false indicates multiple images mode
+	if err == nil {
+		images, err = transcodeImages(ctx, images, mimeType)
+	}
+	if err == nil && fc.pendingPop != nil {
+		err = fc.prepareBatch(ctx, images)
+	}
+	if fc.pendingPop != nil {
+		if err != nil {
+			fc.logger.Warnf("failed to send buffered images, returning them to the buffer: %v", err)
+			fc.buf.RollbackPop(fc.pendingPop)
+		} else {
+			fc.buf.CommitPop(fc.pendingPop)
+		}
+		fc.pendingPop = nil
+	}
+	if err != nil {
+		return nil, meta, err
+	}
+
+	if fc.conf.LocalSinkDir != "" && IsFromDataMgmtWithKey(ctx, extra, fc.conf.DataManagementKey) {
+		fc.writeToLocalSink(ctx, images)
+	}
+	return images, meta, nil
+}
+
+// prepareBatch encodes a batch of buffered images before it is returned, if encode_workers is set. Failures are only
+// returned when requeue_on_send_failure is set, so that the batch is put back in the buffer instead of being lost.
+func (fc *filteredCamera) prepareBatch(ctx context.Context, images []camera.NamedImage) error {
+	if fc.conf.EncodeWorkers <= 0 {
+		return nil
+	}
+	if err := encodeImages(ctx, images, fc.conf.EncodeWorkers); err != nil {
+		if fc.conf.RequeueOnSendFailure {
+			return err
+		}
+		fc.logger.Warnf("error encoding buffered images: %v", err)
+	}
+	return nil
+}
+
+// getBufferedImages returns images from the ToSend buffer depending on the image mode.
+// single image just returns the first image in the queue, while otherwise it returns the whole buffer
+// if ToSend is empty, returns false
+func (fc *filteredCamera) getBufferedImages(singleImageMode bool) ([]camera.NamedImage, resource.ResponseMetadata, bool) {
+	if singleImageMode {
+		images, meta, ok := fc.buf.PopBatch(true)
+		if ok {
+			images = fc.singleImage(images)
+		}
+		return images, meta, ok
+	}
+	if allImages, batchMeta, pop, ok := fc.buf.PopAllToSendTx(); ok {
+		// Images commits the pop once the batch is ready to send, or rolls it back
+		fc.pendingPop = pop
+		return allImages, batchMeta, true
+	}
+	// ToSend buffer is empty - no images to capture
+	return nil, resource.ResponseMetadata{}, false
+}
+
+// singleImage picks the image of a frame to return in single image mode: the one from single_image_source if it is
+// set, otherwise the first. A frame without that source falls back to its first image.
+func (fc *filteredCamera) singleImage(images []camera.NamedImage) []camera.NamedImage {
+	img, ok := imagebuffer.SourceImage(images, fc.conf.SingleImageSource)
+	if !ok {
+		fc.logger.Debugf("no image from source %q in the frame, returning the first", fc.conf.SingleImageSource)
+		img, ok = imagebuffer.SourceImage(images, "")
+	}
+	if !ok {
+		return images
+	}
+	return []camera.NamedImage{img}
+}
+
+// liveFrame returns the most recent frame captured in the background, restricted to filterSourceNames if any are
+// given, for serving requests that don't come from data management without waiting on the underlying camera.
+// It returns false if nothing has been captured yet or none of the requested sources are in the frame.
+func (fc *filteredCamera) liveFrame(filterSourceNames []string) ([]camera.NamedImage, resource.ResponseMetadata, bool) {
+	frame, ok := fc.buf.LatestFrame()
+	if !ok {
+		return nil, resource.ResponseMetadata{}, false
+	}
+	if len(filterSourceNames) == 0 {
+		return frame.Imgs, frame.Meta, true
+	}
+	images := []camera.NamedImage{}
+	for _, img := range frame.Imgs {
+		if slices.Contains(filterSourceNames, img.SourceName) {
+			images = append(images, img)
+		}
+	}
+	return images, frame.Meta, len(images) > 0
+}
+
+// flushOverdue returns the buffered images if the oldest of them has been waiting longer than max_output_latency_ms
+// at now. It is used when the current call fails, so that a failing camera or vision service doesn't hold back
+// images that were already captured.
+func (fc *filteredCamera) flushOverdue(now time.Time, singleImageMode bool) ([]camera.NamedImage, resource.ResponseMetadata, bool) {
+	if fc.conf.MaxOutputLatencyMs <= 0 {
+		return nil, resource.ResponseMetadata{}, false
+	}
+	oldest, ok := fc.buf.OldestToSend()
+	if !ok {
+		return nil, resource.ResponseMetadata{}, false
+	}
+	waited := now.Sub(oldest)
+	if waited <= time.Duration(fc.conf.MaxOutputLatencyMs)*time.Millisecond {
+		return nil, resource.ResponseMetadata{}, false
+	}
+	fc.logger.Warnf("falling behind: buffered images have waited %s, more than max_output_latency_ms (%d), returning them now",
+		waited, fc.conf.MaxOutputLatencyMs)
+	return fc.getBufferedImages(singleImageMode)
 }
 
 // images checks to see if the trigger is fulfilled or inhibited, and sets the flag to send images
@@ -376,29 +1877,88 @@ func (fc *filteredCamera) getBufferedImages(singleImageMode bool) ([]camera.Name
 func (fc *filteredCamera) images(ctx context.Context, filterSourceNames []string, extra map[string]interface{}, singleImageMode bool) ([]camera.NamedImage, resource.ResponseMetadata, error) {
 	ctx, span := trace.StartSpan(ctx, "filteredcamera::images")
 	defer span.End()
+	if fc.conf.LiveFromBuffer && !IsFromDataMgmtWithKey(ctx, extra, fc.conf.DataManagementKey) {
+		if images, meta, ok := fc.liveFrame(filterSourceNames); ok {
+			return images, meta, nil
+		}
+	}
+
 	// Always call underlying camera to get fresh images
-	images, meta, err := fc.cam.Images(ctx, filterSourceNames, extra)
+	images, meta, err := fc.cameraImages(ctx, filterSourceNames, extra)
 	if err != nil {
+		if IsFromDataMgmtWithKey(ctx, extra, fc.conf.DataManagementKey) {
+			if bufferedImages, bufferedMeta, ok := fc.flushOverdue(time.Now(), singleImageMode); ok {
+				return bufferedImages, bufferedMeta, nil
+			}
+		}
 		return images, meta, err
 	}
 
-	if !IsFromDataMgmt(ctx, extra) {
+	if !IsFromDataMgmtWithKey(ctx, extra, fc.conf.DataManagementKey) {
 		return images, meta, nil
 	}
+	// A freshly built camera has an empty ring buffer, so until it has filled data management gets nothing to store
+	if time.Now().Before(fc.warmUntil) {
+		fc.logger.Debugf("warming up until %s, not capturing", fc.warmUntil.Format(time.RFC3339))
+		return []camera.NamedImage{}, meta, nil
+	}
+	// Some cameras transiently return no images without an error, which leaves nothing to filter
+	if len(images) == 0 {
+		fc.logger.Debug("camera returned no images, only returning buffered images")
+		if bufferedImages, bufferedMeta, ok := fc.getBufferedImages(singleImageMode); ok {
+			return bufferedImages, bufferedMeta, nil
+		}
+		return nil, meta, data.ErrNoCaptureToStore
+	}
+	if fc.conf.DryRun {
+		return nil, meta, fc.dryRun(ctx, images, meta)
+	}
+
+	// Emit a summary of the previous capture window if it has just ended
+	fc.buf.CloseExpiredWindow(meta.CapturedAt)
 
-	// If we're still within an active capture window, skip filter checks
+	// If we're still within an active capture window, skip filter checks other than the sustain thresholds
 	if fc.buf.IsWithinCaptureWindow(meta.CapturedAt) {
-		if fc.conf.Debug {
+		if fc.debug() {
 			fc.logger.Infow("Skipping filter checks",
 				"method", "images",
 				"singleImageMode", singleImageMode,
 				"capturedAt", meta.CapturedAt,
 				"withinCaptureWindow", true)
 		}
+		if fc.hasSustain() {
+			fc.sustainWindow(ctx, images, meta)
+		}
+		if fc.conf.ExtendSameLabelOnly {
+			fc.extendSameLabel(ctx, images, meta)
+		}
+		if fc.conf.RetroactiveInhibitSeconds > 0 && len(fc.inhibitors) > 0 {
+			inhibited, err := fc.inhibitedDuringWindow(ctx, images)
+			if err != nil {
+				return nil, meta, err
+			}
+			if inhibited {
+				fc.retroactiveInhibit(meta.CapturedAt)
+				// Frames queued before the lookback are still sent, but not the inhibited one
+				if bufferedImages, bufferedMeta, ok := fc.getBufferedImages(singleImageMode); ok {
+					return bufferedImages, bufferedMeta, nil
+				}
+				return nil, meta, data.ErrNoCaptureToStore
+			}
+		}
 		if bufferedImages, bufferedMeta, ok := fc.getBufferedImages(singleImageMode); ok {
 			return bufferedImages, bufferedMeta, nil
 		}
 		// If no buffered images, return current image (we're in capture mode)
+		if fc.conf.InhibitScope == inhibitScopeInWindow && len(fc.inhibitors) > 0 {
+			inhibited, err := fc.inhibitedDuringWindow(ctx, images)
+			if err != nil {
+				return nil, meta, err
+			}
+			if inhibited {
+				return nil, meta, data.ErrNoCaptureToStore
+			}
+		}
 		// Apply timestamp to current images for consistency
 		timestampedImages := imagebuffer.TimestampImagesToNames(images, meta)
 		return timestampedImages, meta, nil
@@ -406,13 +1966,14 @@ func (fc *filteredCamera) images(ctx context.Context, filterSourceNames []string
 
 	// If we're in the cooldown period after a capture window, suppress new triggers
 	if fc.buf.IsInCooldown(meta.CapturedAt) {
-		if fc.conf.Debug {
+		if fc.debug() {
 			fc.logger.Infow("Skipping trigger checks - in cooldown period",
 				"method", "images",
 				"singleImageMode", singleImageMode,
 				"capturedAt", meta.CapturedAt,
 				"inCooldown", true)
 		}
+		fc.countCooldown(ctx, images, meta.CapturedAt)
 		// Still return any remaining buffered images from the previous trigger
 		if bufferedImages, bufferedMeta, ok := fc.getBufferedImages(singleImageMode); ok {
 			return bufferedImages, bufferedMeta, nil
@@ -420,7 +1981,7 @@ func (fc *filteredCamera) images(ctx context.Context, filterSourceNames []string
 		return nil, meta, data.ErrNoCaptureToStore
 	}
 
-	if fc.conf.Debug {
+	if fc.debug() {
 		fc.logger.Infow("Running filter checks",
 			"method", "images",
 			"singleImageMode", singleImageMode,
@@ -429,19 +1990,42 @@ func (fc *filteredCamera) images(ctx context.Context, filterSourceNames []string
 	}
 
 	// We're outside capture window, so run filter checks to potentially start a new capture
-	for _, img := range images {
+	var rejected []camera.NamedImage
+	for _, i := range fc.visionIndexes(images) {
+		if fc.conf.BurstVisionStride > 1 && i%fc.conf.BurstVisionStride != 0 {
+			// only every burst_vision_stride-th image of the batch is run through vision
+			continue
+		}
+		img := images[i]
 		// method fc.shouldSend will return true if a filter passes (and inhibit doesn't)
 		shouldSend, annotations, err := fc.shouldSend(ctx, img, meta.CapturedAt)
+		if errors.Is(err, errVisionUnavailable) {
+			// The background worker keeps filling the ring buffer, so once vision recovers a trigger
+			// still has its pre-roll. Until then only previously buffered images are returned.
+			break
+		}
 		if err != nil {
+			if bufferedImages, bufferedMeta, ok := fc.flushOverdue(meta.CapturedAt, singleImageMode); ok {
+				return bufferedImages, bufferedMeta, nil
+			}
 			return nil, meta, err
 		}
 		img.Annotations.BoundingBoxes = annotations.BoundingBoxes
 		img.Annotations.Classifications = annotations.Classifications
 		if shouldSend {
 			// this updates the CaptureTill time to be further in the future
-			fc.buf.MarkShouldSend(meta.CapturedAt)
+			label, score := triggerReason(annotations)
+			if fc.buf.MarkShouldSendForReason(meta.CapturedAt, label, score) {
+				fc.recordTrigger(annotations)
+			}
 
-			fc.buf.StoreImages([]camera.NamedImage{img}, meta, meta.CapturedAt)
+			stored := []camera.NamedImage{img}
+			if len(fc.extraCams) > 0 {
+				// A trigger on any of the cameras captures the images of all of them
+				stored = slices.Clone(images)
+				stored[i] = img
+			}
+			fc.storeImages(ctx, stored, meta)
 
 			if bufferedImages, bufferedMeta, ok := fc.getBufferedImages(singleImageMode); ok {
 				return bufferedImages, bufferedMeta, nil
@@ -451,146 +2035,478 @@ func (fc *filteredCamera) images(ctx context.Context, filterSourceNames []string
 			// Represents the edge case where triggering is happening faster than the buffer can be filled
 			return nil, meta, data.ErrNoCaptureToStore
 		}
+		rejected = append(rejected, img)
 	}
 	// No triggers met and we're outside capture window, but check if we have buffered images from previous triggers
 	if bufferedImages, bufferedMeta, ok := fc.getBufferedImages(singleImageMode); ok {
 		return bufferedImages, bufferedMeta, nil
 	}
 
+	// A fraction of the rejected frames may still be kept for review
+	if sampled, ok := fc.sampleRejected(rejected, meta); ok {
+		return sampled, meta, nil
+	}
+
 	// ToSend buffer is empty - no images to capture
 	return nil, meta, data.ErrNoCaptureToStore
 }
 
+// verdict is the outcome of running a frame through the filter.
+type verdict struct {
+	// send is whether the frame triggers a capture
+	send bool
+	// annotations are those of the vision service that accepted the frame
+	annotations data.Annotations
+	// labels are what the frame is counted under in the accepted stats if it is sent, or in the rejected stats if not
+	labels []string
+	// inhibited is set when an inhibitor rejected the frame before any accepting vision service ran, which drops the
+	// frames queued within retroactive_inhibit_seconds
+	inhibited bool
+	// visionAvailable is set once the accepting vision services answered, so that they are no longer unavailable
+	visionAvailable bool
+}
+
+// acceptedVerdict is the verdict of a frame that triggers a capture, counted under labels.
+func acceptedVerdict(annotations data.Annotations, labels ...string) verdict {
+	return verdict{send: true, annotations: annotations, labels: labels}
+}
+
+// rejectedVerdict is the verdict of a frame that doesn't trigger a capture, counted under label.
+func rejectedVerdict(label string) verdict {
+	return verdict{labels: []string{label}}
+}
+
+// shouldSend runs a frame through the filter and counts the verdict in the stats, keeping a copy of the frame for
+// last_rejected if it is rejected.
 func (fc *filteredCamera) shouldSend(ctx context.Context, namedImg camera.NamedImage, now time.Time) (bool, data.Annotations, error) {
+	fc.startIdleClock(now)
+	v, err := fc.evaluateFrame(ctx, namedImg, now)
+	if errors.Is(err, errVisionUnavailable) {
+		fc.setVisionAvailable(false)
+	}
+	if err != nil {
+		fc.recordVerdict(verdict{})
+		return false, data.Annotations{}, err
+	}
+	if v.visionAvailable {
+		fc.setVisionAvailable(true)
+	}
+	v = fc.sampleVerdict(v)
+	fc.recordVerdict(v)
+	if v.send {
+		fc.markTriggered(now)
+	} else {
+		if v.inhibited {
+			fc.retroactiveInhibit(now)
+		}
+		fc.keepRejected(namedImg, now, v.labels[0])
+	}
+	return v.send, v.annotations, nil
+}
+
+// evaluateFrame runs a frame through the filter, returning whether it triggers a capture along with the annotations
+// of the vision service that accepted it and the stats labels it counts under. It has no side effects: the stats, the
+// trigger time and the vision availability are left to the caller, so that frames can be evaluated without sendMu.
+func (fc *filteredCamera) evaluateFrame(ctx context.Context, namedImg camera.NamedImage, now time.Time) (verdict, error) {
 	ctx, span := trace.StartSpan(ctx, "filteredcamera::shouldSend")
 	defer span.End()
 
-	// inhibitors are first priority
-	for _, vs := range fc.inhibitors {
-		if len(fc.inhibitedClassifications[vs.Name().Name]) > 0 {
-			inhibitorClassificationsCtx, inhibitorClassificationsSpan := trace.StartSpan(ctx, "filteredcamera::inhibitorClassifications")
-			res, err := vs.Classifications(inhibitorClassificationsCtx, &namedImg, 100, nil)
-			if err != nil {
-				fc.logger.Warnf("error getting inhibited classifications")
-				inhibitorClassificationsSpan.RecordError(err)
-				inhibitorClassificationsSpan.End()
-				return false, data.Annotations{}, err
+	if err := fc.checkImageSize(namedImg); err != nil {
+		fc.logImageSize(err)
+		return rejectedVerdict("undersized"), nil
+	}
+	fc.logImageSize(nil)
+
+	if !fc.withinActiveHours(now) {
+		span.SetAttributes(attribute.Bool("outside_active_hours", true))
+		return rejectedVerdict(activeHoursRejection), nil
+	}
+
+	// labels the camera already attached to the frame are checked before running any vision
+	if label, ok := fc.incomingInhibitLabel(namedImg.Annotations); ok {
+		fc.logger.Debugf("rejecting image with incoming annotation %q", label)
+		span.SetAttributes(attribute.String("inhibited_label", label))
+		return rejectedVerdict(label), nil
+	}
+
+	frame, err := fc.newVisionFrame(ctx, namedImg)
+	if err != nil {
+		return verdict{}, err
+	}
+	relaxation := fc.thresholdRelaxation(now)
+
+	// inhibitors are first priority, unless they only apply within capture windows
+	for _, vs := range fc.preTriggerInhibitors() {
+		inhibited, label, err := fc.inhibitedBy(ctx, vs, frame)
+		if err != nil {
+			return verdict{}, err
+		}
+		if inhibited {
+			span.SetAttributes(
+				attribute.String("inhibited_by_vision_service", vs.Name().Name),
+				attribute.String("inhibited_label", label),
+			)
+			v := rejectedVerdict(label)
+			v.inhibited = true
+			return v, nil
+		}
+	}
+
+	if fc.conf.MinFlowMagnitude > 0 {
+		moving, err := fc.flowTriggered(ctx, namedImg)
+		if err != nil {
+			return verdict{}, err
+		}
+		if moving {
+			span.SetAttributes(attribute.Bool("accepted_by_optical_flow", true))
+			return acceptedVerdict(data.Annotations{}, "optical_flow"), nil
+		}
+		if len(fc.otherVisionServices) == 0 {
+			return rejectedVerdict("no motion"), nil
+		}
+	}
+
+	unavailable := 0
+	scoped := map[string]inhibitorResult{}
+	vetoed := ""
+	for _, vs := range fc.otherVisionServices {
+		// inhibitors scoped to this service veto only it
+		label, inhibited, err := fc.vetoedFor(ctx, vs.Name().Name, frame, scoped)
+		if err != nil {
+			return verdict{}, err
+		}
+		if inhibited {
+			if vetoed == "" {
+				vetoed = label
+				span.SetAttributes(attribute.String("inhibited_label", label))
 			}
+			continue
+		}
+		match, annotations, labels, err := fc.acceptedBy(ctx, vs, frame, relaxation)
+		if err != nil {
+			// a cancelled call isn't the vision service failing
+			if ctx.Err() != nil {
+				return verdict{}, ctx.Err()
+			}
+			if !fc.conf.BufferOnVisionFailure {
+				return verdict{}, err
+			}
+			unavailable++
+			continue
+		}
+		if match {
+			span.SetAttributes(
+				attribute.String("accepted_by_vision_service", vs.Name().Name),
+			)
+			v := acceptedVerdict(annotations, labels...)
+			v.visionAvailable = true
+			return v, nil
+		}
+	}
+	if len(fc.otherVisionServices) > 0 && unavailable == len(fc.otherVisionServices) {
+		return verdict{}, errVisionUnavailable
+	}
+
+	var v verdict
+	switch {
+	case vetoed != "":
+		v = rejectedVerdict(vetoed)
+	case len(fc.otherVisionServices) == 0:
+		fc.logger.Debugf("defaulting to true")
+		v = acceptedVerdict(data.Annotations{}, "no vision services triggered")
+	default:
+		fc.logger.Debugf("defaulting to false")
+		v = rejectedVerdict("no vision services triggered")
+	}
+	v.visionAvailable = true
+	return v, nil
+}
+
+// incomingInhibitLabel returns the first of the frame's own annotation labels listed in inhibit_incoming_annotations.
+func (fc *filteredCamera) incomingInhibitLabel(annotations data.Annotations) (string, bool) {
+	if len(fc.conf.InhibitIncomingAnnotations) == 0 {
+		return "", false
+	}
+	for _, c := range annotations.Classifications {
+		if slices.Contains(fc.conf.InhibitIncomingAnnotations, c.Label) {
+			return c.Label, true
+		}
+	}
+	for _, bb := range annotations.BoundingBoxes {
+		if slices.Contains(fc.conf.InhibitIncomingAnnotations, bb.Label) {
+			return bb.Label, true
+		}
+	}
+	return "", false
+}
+
+// inhibitedBy runs a single inhibiting vision service on frame, returning whether any of its configured
+// classifications or objects matched along with the best matching label. It returns ctx's error without calling
+// the service once ctx is done.
+func (fc *filteredCamera) inhibitedBy(ctx context.Context, vs vision.Service, frame *visionFrame) (bool, string, error) {
+	if err := ctx.Err(); err != nil {
+		return false, "", err
+	}
+	img, err := fc.serviceImage(ctx, vs.Name().Name, frame)
+	if err != nil {
+		return false, "", err
+	}
+	if len(fc.inhibitedClassifications[vs.Name().Name]) > 0 {
+		inhibitorClassificationsCtx, inhibitorClassificationsSpan := trace.StartSpan(ctx, "filteredcamera::inhibitorClassifications")
+		res, err := vs.Classifications(inhibitorClassificationsCtx, img, fc.classificationsTopN(), nil)
+		if err != nil {
+			fc.logger.Warnf("error getting inhibited classifications")
+			inhibitorClassificationsSpan.RecordError(err)
 			inhibitorClassificationsSpan.End()
+			return false, "", err
+		}
+		inhibitorClassificationsSpan.End()
 
-			match, label := fc.anyClassificationsMatch(vs.Name().Name, res, true)
-			if match {
-				fc.logger.Debugf("rejecting image with classifications %v", res)
-				fc.rejectedStats.update(label[0].Label())
-				span.SetAttributes(
-					attribute.String("inhibited_by_vision_service", vs.Name().Name),
-					attribute.String("inhibited_label", label[0].Label()),
-				)
-				return false, data.Annotations{}, nil
-			}
+		match, label := fc.anyClassificationsMatch(vs.Name().Name, res, true, 0)
+		if match {
+			fc.logger.Debugf("rejecting image with classifications %v", res)
+			return true, label[0].Label(), nil
 		}
+	}
 
-		if len(fc.inhibitedObjects[vs.Name().Name]) > 0 {
-			inhibitorDetectionsCtx, inhibitorDetectionsSpan := trace.StartSpan(ctx, "filteredcamera::inhibitorDetections")
-			res, err := vs.Detections(inhibitorDetectionsCtx, &namedImg, nil)
-			if err != nil {
-				fc.logger.Warnf("error getting inhibited detections")
-				inhibitorDetectionsSpan.End()
-				return false, data.Annotations{}, err
-			}
+	if len(fc.inhibitedObjects[vs.Name().Name]) > 0 {
+		inhibitorDetectionsCtx, inhibitorDetectionsSpan := trace.StartSpan(ctx, "filteredcamera::inhibitorDetections")
+		res, err := vs.Detections(inhibitorDetectionsCtx, img, nil)
+		if err != nil {
+			fc.logger.Warnf("error getting inhibited detections")
 			inhibitorDetectionsSpan.End()
+			return false, "", err
+		}
+		inhibitorDetectionsSpan.End()
+		res = fc.topDetections(fc.aboveScoreFloor(fc.normalizeDetections(img, res)))
 
-			match, label := fc.anyDetectionsMatch(vs.Name().Name, res, true)
-			if match {
-				fc.logger.Debugf("rejecting image with objects %v", res)
-				fc.rejectedStats.update(label[0].Label())
-				span.SetAttributes(
-					attribute.String("inhibited_by_vision_service", vs.Name().Name),
-					attribute.String("inhibited_label", label[0].Label()),
-				)
-				return false, data.Annotations{}, nil
-			}
+		match, label := fc.anyDetectionsMatch(vs.Name().Name, res, true)
+		if match {
+			fc.logger.Debugf("rejecting image with objects %v", res)
+			return true, label[0].Label(), nil
 		}
 	}
+	return false, "", nil
+}
 
-	for _, vs := range fc.otherVisionServices {
-		if len(fc.acceptedClassifications[vs.Name().Name]) > 0 {
-			acceptedClassificationsCtx, acceptedClassificationsSpan := trace.StartSpan(ctx, "filteredcamera::acceptedClassifications")
-			res, err := vs.Classifications(acceptedClassificationsCtx, &namedImg, 100, nil)
+// inhibitAllLabels configures an inhibitor that has no labels of its own to inhibit on any classification or detection
+// scoring above threshold, for whichever of the two the vision service supports.
+func (fc *filteredCamera) inhibitAllLabels(ctx context.Context, vs vision.Service, threshold float64) error {
+	props, err := vs.GetProperties(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not get properties of inhibitor %q: %w", vs.Name().Name, err)
+	}
+	if props.ClassificationSupported {
+		fc.inhibitedClassifications[vs.Name().Name] = map[string]float64{"*": threshold}
+	}
+	if props.DetectionSupported {
+		fc.inhibitedObjects[vs.Name().Name] = map[string]float64{"*": threshold}
+	}
+	fc.logger.Infof("inhibitor %q has no labels configured, inhibiting on any label above %v", vs.Name().Name, threshold)
+	return nil
+}
+
+// inhibitedDuringWindow runs the inhibitors over frames captured while a capture window is open, so that
+// a late inhibitor can cancel the window or drop the frame. It is only used when retroactive_inhibit_seconds is set
+// or inhibit_scope is in_window.
+func (fc *filteredCamera) inhibitedDuringWindow(ctx context.Context, images []camera.NamedImage) (bool, error) {
+	for _, img := range images {
+		frame, err := fc.newVisionFrame(ctx, img)
+		if err != nil {
+			return false, err
+		}
+		for _, vs := range fc.globalInhibitors() {
+			inhibited, label, err := fc.inhibitedBy(ctx, vs, frame)
 			if err != nil {
-				fc.logger.Warnf("error getting non-inhibited classifications")
-				acceptedClassificationsSpan.RecordError(err)
-				acceptedClassificationsSpan.End()
-				return false, data.Annotations{}, err
+				return false, err
 			}
-			acceptedClassificationsSpan.End()
-
-			match, labels := fc.anyClassificationsMatch(vs.Name().Name, res, false)
-			if match {
-				fc.logger.Debugf("keeping image with classifications %v", res)
-				for _, label := range labels {
-					// Don't include labels in attributes here for now to avoid high cardinality.
-					fc.acceptedStats.update(label.Label())
-				}
-				span.SetAttributes(
-					attribute.String("accepted_by_vision_service", vs.Name().Name),
-				)
-				annotations := classificationToAnnotations(labels)
-				return true, annotations, nil
+			if inhibited {
+				fc.recordRejected(label)
+				return true, nil
 			}
 		}
+	}
+	return false, nil
+}
 
-		if len(fc.acceptedObjects[vs.Name().Name]) > 0 {
-			acceptedDetectionsCtx, acceptedDetectionsSpan := trace.StartSpan(ctx, "filteredcamera::acceptedDetections")
-			res, err := vs.Detections(acceptedDetectionsCtx, &namedImg, nil)
-			if err != nil {
-				fc.logger.Warnf("error getting non-inhibited detections")
-				acceptedDetectionsSpan.RecordError(err)
-				acceptedDetectionsSpan.End()
-				return false, data.Annotations{}, err
+// retroactiveInhibit drops the frames queued within retroactive_inhibit_seconds of now and cancels the
+// open capture window, if any, after an inhibitor matched.
+func (fc *filteredCamera) retroactiveInhibit(now time.Time) {
+	if fc.conf.RetroactiveInhibitSeconds <= 0 {
+		return
+	}
+	since := now.Add(-time.Duration(fc.conf.RetroactiveInhibitSeconds * float64(time.Second)))
+	if dropped := fc.buf.CancelSince(since, now); dropped > 0 {
+		fc.logger.Infof("inhibitor matched, dropped %d frames queued since %s", dropped, since.Format(time.RFC3339Nano))
+	}
+}
+
+// acceptedBy runs a single accepting vision service on frame, returning whether any of its configured
+// classifications or objects matched along with the matching annotations and the labels to count the frame under in
+// the accepted stats. Like inhibitedBy, it returns ctx's error without calling the service once ctx is done.
+func (fc *filteredCamera) acceptedBy(
+	ctx context.Context, vs vision.Service, frame *visionFrame, relaxation float64,
+) (bool, data.Annotations, []string, error) {
+	if err := ctx.Err(); err != nil {
+		return false, data.Annotations{}, nil, err
+	}
+	img, err := fc.serviceImage(ctx, vs.Name().Name, frame)
+	if err != nil {
+		return false, data.Annotations{}, nil, err
+	}
+	if len(fc.acceptedClassifications[vs.Name().Name]) > 0 {
+		acceptedClassificationsCtx, acceptedClassificationsSpan := trace.StartSpan(ctx, "filteredcamera::acceptedClassifications")
+		res, err := vs.Classifications(acceptedClassificationsCtx, img, fc.classificationsTopN(), nil)
+		if err != nil {
+			fc.logger.Warnf("error getting non-inhibited classifications")
+			acceptedClassificationsSpan.RecordError(err)
+			acceptedClassificationsSpan.End()
+			return false, data.Annotations{}, nil, err
+		}
+		acceptedClassificationsSpan.End()
+
+		match, labels := fc.anyClassificationsMatch(vs.Name().Name, res, false, relaxation)
+		if match {
+			fc.logger.Debugf("keeping image with classifications %v", res)
+			statsLabels := labels
+			if fc.conf.StatsAttribution == statsAttributionBest {
+				statsLabels = labels[:1]
 			}
+			annotations := fc.classificationToAnnotations(labels)
+			return true, annotations, classificationLabels(statsLabels), nil
+		}
+	}
+
+	countRule := fc.serviceConfigs[vs.Name().Name]
+	if len(fc.acceptedObjects[vs.Name().Name]) > 0 || countRule.AnyLabelMinCount > 0 {
+		acceptedDetectionsCtx, acceptedDetectionsSpan := trace.StartSpan(ctx, "filteredcamera::acceptedDetections")
+		res, err := vs.Detections(acceptedDetectionsCtx, img, nil)
+		if err != nil {
+			fc.logger.Warnf("error getting non-inhibited detections")
+			acceptedDetectionsSpan.RecordError(err)
 			acceptedDetectionsSpan.End()
+			return false, data.Annotations{}, nil, err
+		}
+		acceptedDetectionsSpan.End()
+		res = fc.topDetections(fc.aboveScoreFloor(fc.normalizeDetections(img, res)))
+
+		match, labels := fc.anyDetectionsMatch(vs.Name().Name, res, false)
+		if match {
+			fc.logger.Debugf("keeping image with objects %v", res)
+			statsLabels := labels
+			if fc.conf.StatsAttribution == statsAttributionBest {
+				statsLabels = labels[:1]
+			}
+			if fc.conf.AnnotateAllDetections {
+				return true, fc.detectionsToAnnotations(res), detectionLabels(statsLabels), nil
+			}
+			annotations := fc.detectionsToAnnotations(labels)
+			return true, annotations, detectionLabels(statsLabels), nil
+		}
 
-			match, labels := fc.anyDetectionsMatch(vs.Name().Name, res, false)
-			if match {
-				fc.logger.Debugf("keeping image with objects %v", res)
-				for _, label := range labels {
-					// Don't include labels in attributes here for now to avoid high cardinality.
-					fc.acceptedStats.update(label.Label())
+		if countRule.AnyLabelMinCount > 0 {
+			counted := fc.detectionsAboveScore(res, countRule.AnyLabelMinScore)
+			if len(counted) >= countRule.AnyLabelMinCount {
+				fc.logger.Debugf("keeping image with %d detections above %v", len(counted), countRule.AnyLabelMinScore)
+				if fc.conf.AnnotateAllDetections {
+					return true, fc.detectionsToAnnotations(res), []string{"any_label_min_count"}, nil
 				}
-				span.SetAttributes(
-					attribute.String("accepted_by_vision_service", vs.Name().Name),
-				)
-				annotations := detectionsToAnnotations(labels)
-				return true, annotations, nil
+				return true, fc.detectionsToAnnotations(counted), []string{"any_label_min_count"}, nil
 			}
 		}
 	}
-	if len(fc.otherVisionServices) == 0 {
-		fc.acceptedStats.update("no vision services triggered")
-		fc.logger.Debugf("defaulting to true")
-		return true, data.Annotations{}, nil
+	return false, data.Annotations{}, nil, nil
+}
+
+// classificationLabels returns the labels of cs.
+func classificationLabels(cs []classification.Classification) []string {
+	labels := make([]string, 0, len(cs))
+	for _, c := range cs {
+		labels = append(labels, c.Label())
+	}
+	return labels
+}
+
+// detectionLabels returns the labels of ds.
+func detectionLabels(ds []objectdetection.Detection) []string {
+	labels := make([]string, 0, len(ds))
+	for _, d := range ds {
+		labels = append(labels, d.Label())
 	}
-	fc.rejectedStats.update("no vision services triggered")
-	fc.logger.Debugf("defaulting to false")
-	return false, data.Annotations{}, nil
+	return labels
 }
 
-func classificationToAnnotations(cs []classification.Classification) data.Annotations {
+// detectionsAboveScore returns the detections of any label that clear minScore, the same way as the other thresholds.
+func (fc *filteredCamera) detectionsAboveScore(ds []objectdetection.Detection, minScore float64) []objectdetection.Detection {
+	res := []objectdetection.Detection{}
+	for _, d := range ds {
+		if fc.clears(d.Score(), minScore) {
+			res = append(res, d)
+		}
+	}
+	return res
+}
+
+// setVisionAvailable tracks whether the accepting vision services are reachable, counting each
+// period during which all of them were failing.
+func (fc *filteredCamera) setVisionAvailable(available bool) {
+	fc.statsMu.Lock()
+	defer fc.statsMu.Unlock()
+	if !available && !fc.visionUnavailable {
+		fc.visionUnavailablePeriods++
+		fc.logger.Warnf("all vision services are unavailable, buffering images without capturing")
+	} else if available && fc.visionUnavailable {
+		fc.logger.Infof("vision services available again")
+	}
+	fc.visionUnavailable = !available
+}
+
+// recordTrigger passes the labels and scores that caused a trigger on to the image buffer,
+// so they can be reported in the summary logged when the capture window closes.
+func (fc *filteredCamera) recordTrigger(annotations data.Annotations) {
+	for _, c := range annotations.Classifications {
+		fc.buf.RecordTrigger(c.Label, confidenceOrZero(c.Confidence))
+	}
+	for _, bb := range annotations.BoundingBoxes {
+		fc.buf.RecordTrigger(bb.Label, confidenceOrZero(bb.Confidence))
+	}
+}
+
+// triggerReason returns the label and score of the first, best scoring, annotation that caused a trigger.
+func triggerReason(annotations data.Annotations) (string, float64) {
+	if len(annotations.Classifications) > 0 {
+		return annotations.Classifications[0].Label, confidenceOrZero(annotations.Classifications[0].Confidence)
+	}
+	if len(annotations.BoundingBoxes) > 0 {
+		return annotations.BoundingBoxes[0].Label, confidenceOrZero(annotations.BoundingBoxes[0].Confidence)
+	}
+	return "", 0
+}
+
+func confidenceOrZero(confidence *float64) float64 {
+	if confidence == nil {
+		return 0
+	}
+	return *confidence
+}
+
+// classificationToAnnotations converts classifications to annotations, renaming their labels per label_aliases.
+func (fc *filteredCamera) classificationToAnnotations(cs []classification.Classification) data.Annotations {
 	annotations := data.Annotations{
 		Classifications: []data.Classification{},
 	}
 	for _, c := range cs {
 		score := c.Score()
 		annotations.Classifications = append(annotations.Classifications, data.Classification{
-			Label:      c.Label(),
+			Label:      fc.labelAlias(c.Label()),
 			Confidence: &score,
 		})
 	}
 	return annotations
 }
 
-func detectionsToAnnotations(ds []objectdetection.Detection) data.Annotations {
+// detectionsToAnnotations converts detections to annotations, renaming their labels per label_aliases.
+func (fc *filteredCamera) detectionsToAnnotations(ds []objectdetection.Detection) data.Annotations {
 	annotations := data.Annotations{
 		BoundingBoxes: make([]data.BoundingBox, 0, len(ds)),
 	}
@@ -599,7 +2515,7 @@ func detectionsToAnnotations(ds []objectdetection.Detection) data.Annotations {
 		bbox := d.NormalizedBoundingBox()
 		if len(bbox) == 4 {
 			annotations.BoundingBoxes = append(annotations.BoundingBoxes, data.BoundingBox{
-				Label:          d.Label(),
+				Label:          fc.labelAlias(d.Label()),
 				Confidence:     &score,
 				XMinNormalized: bbox[0],
 				YMinNormalized: bbox[1],
@@ -611,8 +2527,25 @@ func detectionsToAnnotations(ds []objectdetection.Detection) data.Annotations {
 	return annotations
 }
 
+// labelAlias returns the name label is reported under, its label_aliases entry if it has one.
+func (fc *filteredCamera) labelAlias(label string) string {
+	if alias, ok := fc.conf.LabelAliases[label]; ok {
+		return alias
+	}
+	return label
+}
+
+// NextPointCloud passes through to the underlying camera if it supports point clouds, since filtering only
+// applies to images captured for data management.
 func (fc *filteredCamera) NextPointCloud(ctx context.Context, extra map[string]interface{}) (pointcloud.PointCloud, error) {
-	return nil, fmt.Errorf("filteredCamera doesn't support pointclouds yet")
+	props, err := fc.cam.Properties(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not get properties of camera: %w", err)
+	}
+	if !props.SupportsPCD {
+		return nil, errors.New("filteredCamera doesn't support pointclouds yet")
+	}
+	return fc.cam.NextPointCloud(ctx, extra)
 }
 
 func (fc *filteredCamera) Geometries(ctx context.Context, extra map[string]interface{}) ([]spatialmath.Geometry, error) {
@@ -620,9 +2553,5 @@ func (fc *filteredCamera) Geometries(ctx context.Context, extra map[string]inter
 }
 
 func (fc *filteredCamera) Properties(ctx context.Context) (camera.Properties, error) {
-	p, err := fc.cam.Properties(ctx)
-	if err == nil {
-		p.SupportsPCD = false
-	}
-	return p, err
+	return fc.cam.Properties(ctx)
 }
@@ -2,16 +2,22 @@ package filtered_camera
 
 import (
 	"context"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"image"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"go.viam.com/rdk/components/camera"
 	"go.viam.com/rdk/data"
+	"go.viam.com/rdk/gostream"
 	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/pointcloud"
 	"go.viam.com/rdk/resource"
+	"go.viam.com/rdk/rimage/transform"
 	"go.viam.com/rdk/services/vision"
 	"go.viam.com/rdk/testutils/inject"
 	"go.viam.com/rdk/utils"
@@ -19,6 +25,7 @@ import (
 	"go.viam.com/rdk/vision/objectdetection"
 
 	imagebuffer "github.com/viam-modules/filtered_camera/image_buffer"
+	imagestats "github.com/viam-modules/filtered_camera/image_stats"
 
 	"go.viam.com/test"
 )
@@ -113,8 +120,8 @@ func TestShouldSend(t *testing.T) {
 
 	fc := &filteredCamera{
 		conf: &Config{
-			Classifications: map[string]float64{"a": .8},
-			Objects:         map[string]float64{"b": .8},
+			Classifications: map[string]Threshold{"a": {Min: .8}},
+			Objects:         map[string]Threshold{"b": {Min: .8}},
 			WindowSeconds:   10,
 			ImageFrequency:  1.0,
 		},
@@ -221,8 +228,8 @@ func TestShouldSend(t *testing.T) {
 	test.That(t, res, test.ShouldEqual, true)
 
 	// test accepted stats update properly and don't affect rejected stats
-	fc.acceptedStats = imageStats{}
-	fc.rejectedStats = imageStats{}
+	fc.acceptedStats = imagestats.Stats{}
+	fc.rejectedStats = imagestats.Stats{}
 	fc.inhibitors = []vision.Service{}
 	fc.acceptedClassifications = map[string]map[string]float64{"": {"a": .8}}
 
@@ -232,14 +239,14 @@ func TestShouldSend(t *testing.T) {
 	res, _, err = fc.shouldSend(context.Background(), namedA, time.Now())
 	test.That(t, err, test.ShouldBeNil)
 	test.That(t, res, test.ShouldEqual, true)
-	test.That(t, fc.acceptedStats.total, test.ShouldEqual, 1)
-	test.That(t, fc.acceptedStats.breakdown["a"], test.ShouldEqual, 1)
-	test.That(t, fc.rejectedStats.total, test.ShouldEqual, 0)
-	_, ok := fc.rejectedStats.breakdown["a"]
+	test.That(t, fc.acceptedStats.Total, test.ShouldEqual, 1)
+	test.That(t, fc.acceptedStats.Breakdown["a"], test.ShouldEqual, 1)
+	test.That(t, fc.rejectedStats.Total, test.ShouldEqual, 0)
+	_, ok := fc.rejectedStats.Breakdown["a"]
 	test.That(t, ok, test.ShouldEqual, false)
 
 	// test rejected stats update properly and don't affect accepted stats
-	fc.acceptedStats = imageStats{}
+	fc.acceptedStats = imagestats.Stats{}
 	fc.inhibitors = []vision.Service{
 		getDummyVisionService(),
 	}
@@ -249,28 +256,1649 @@ func TestShouldSend(t *testing.T) {
 	res, _, err = fc.shouldSend(context.Background(), namedB, time.Now())
 	test.That(t, err, test.ShouldBeNil)
 	test.That(t, res, test.ShouldEqual, false)
-	test.That(t, fc.rejectedStats.total, test.ShouldEqual, 1)
-	test.That(t, fc.rejectedStats.breakdown["b"], test.ShouldEqual, 1)
-	test.That(t, fc.acceptedStats.total, test.ShouldEqual, 0)
-	_, ok = fc.acceptedStats.breakdown["b"]
+	test.That(t, fc.rejectedStats.Total, test.ShouldEqual, 1)
+	test.That(t, fc.rejectedStats.Breakdown["b"], test.ShouldEqual, 1)
+	test.That(t, fc.acceptedStats.Total, test.ShouldEqual, 0)
+	_, ok = fc.acceptedStats.Breakdown["b"]
 	test.That(t, ok, test.ShouldEqual, false)
 
 	// test that image that does not match any classification or object is rejected
-	fc.rejectedStats = imageStats{}
+	fc.rejectedStats = imagestats.Stats{}
 	// Reset buffer state to clear CaptureTill
 	fc.buf.SetCaptureTill(time.Time{})
 
 	res, _, err = fc.shouldSend(context.Background(), namedD, time.Now())
 	test.That(t, err, test.ShouldBeNil)
 	test.That(t, res, test.ShouldEqual, false)
-	test.That(t, fc.rejectedStats.total, test.ShouldEqual, 1)
-	test.That(t, fc.rejectedStats.breakdown["no vision services triggered"], test.ShouldEqual, 1)
+	test.That(t, fc.rejectedStats.Total, test.ShouldEqual, 1)
+	test.That(t, fc.rejectedStats.Breakdown["no vision services triggered"], test.ShouldEqual, 1)
+}
+
+func TestStatsAttribution(t *testing.T) {
+	visionSvc := inject.NewVisionService("test_vision")
+	visionSvc.ClassificationsFunc = func(ctx context.Context, img *camera.NamedImage, n int, extra map[string]interface{}) (classification.Classifications, error) {
+		return classification.Classifications{
+			classification.NewClassification(0.85, "dog"),
+			classification.NewClassification(0.95, "cat"),
+			classification.NewClassification(0.5, "bird"),
+		}, nil
+	}
+
+	newCamera := func(attribution string) *filteredCamera {
+		return &filteredCamera{
+			conf:                    &Config{StatsAttribution: attribution},
+			logger:                  logging.NewTestLogger(t),
+			otherVisionServices:     []vision.Service{visionSvc},
+			acceptedClassifications: map[string]map[string]float64{"test_vision": {"*": 0.8}},
+		}
+	}
+
+	// by default every matching label is counted
+	fc := newCamera("")
+	res, annotations, err := fc.shouldSend(context.Background(), namedA, time.Now())
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res, test.ShouldBeTrue)
+	test.That(t, fc.acceptedStats.Breakdown, test.ShouldResemble, map[string]int{"dog": 1, "cat": 1})
+	// matches are ordered best first
+	test.That(t, annotations.Classifications[0].Label, test.ShouldEqual, "cat")
+
+	// with the best policy only the highest scoring match is counted
+	fc = newCamera(statsAttributionBest)
+	res, _, err = fc.shouldSend(context.Background(), namedA, time.Now())
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res, test.ShouldBeTrue)
+	test.That(t, fc.acceptedStats.Total, test.ShouldEqual, 1)
+	test.That(t, fc.acceptedStats.Breakdown, test.ShouldResemble, map[string]int{"cat": 1})
+}
+
+func TestStatGroups(t *testing.T) {
+	labels := []string{"sedan", "truck"}
+	visionSvc := inject.NewVisionService("test_vision")
+	visionSvc.ClassificationsFunc = func(ctx context.Context, img *camera.NamedImage, n int, extra map[string]interface{}) (classification.Classifications, error) {
+		res := classification.Classifications{}
+		for _, label := range labels {
+			res = append(res, classification.NewClassification(0.9, label))
+		}
+		return res, nil
+	}
+
+	groups := map[string]string{"sedan": "vehicle", "truck": "vehicle", "suv": "vehicle"}
+	fc := &filteredCamera{
+		conf:                    &Config{StatGroups: groups},
+		logger:                  logging.NewTestLogger(t),
+		otherVisionServices:     []vision.Service{visionSvc},
+		acceptedClassifications: map[string]map[string]float64{"test_vision": {"sedan": 0.8, "truck": 0.8, "suv": 0.8, "dog": 0.8}},
+		acceptedStats:           imagestats.Stats{Groups: groups},
+	}
+
+	// labels still match individually but are counted under their group
+	for _, frame := range [][]string{{"sedan", "truck"}, {"suv"}, {"dog"}} {
+		labels = frame
+		res, _, err := fc.shouldSend(context.Background(), namedA, time.Now())
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, res, test.ShouldBeTrue)
+	}
+	test.That(t, fc.acceptedStats.Total, test.ShouldEqual, 4)
+	test.That(t, fc.acceptedStats.Breakdown, test.ShouldResemble, map[string]int{"vehicle": 3, "dog": 1})
+
+	// grouping survives resetting the stats
+	fc.resetStats()
+	labels = []string{"truck"}
+	_, _, err := fc.shouldSend(context.Background(), namedA, time.Now())
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, fc.acceptedStats.Breakdown, test.ShouldResemble, map[string]int{"vehicle": 1})
+}
+
+func TestMaxStatLabels(t *testing.T) {
+	label := ""
+	visionSvc := inject.NewVisionService("test_vision")
+	visionSvc.ClassificationsFunc = func(ctx context.Context, img *camera.NamedImage, n int, extra map[string]interface{}) (classification.Classifications, error) {
+		return classification.Classifications{classification.NewClassification(0.9, label)}, nil
+	}
+	fc := &filteredCamera{
+		conf:                    &Config{MaxStatLabels: 3},
+		logger:                  logging.NewTestLogger(t),
+		otherVisionServices:     []vision.Service{visionSvc},
+		acceptedClassifications: map[string]map[string]float64{"test_vision": {"*": 0.8}},
+		acceptedStats:           imagestats.Stats{MaxLabels: 3},
+	}
+
+	// the first three labels are tracked, the rest go under "other"
+	for i := 0; i < 50; i++ {
+		label = fmt.Sprintf("label_%d", i)
+		res, _, err := fc.shouldSend(context.Background(), namedA, time.Now())
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, res, test.ShouldBeTrue)
+	}
+	// labels already tracked keep their own count
+	label = "label_1"
+	_, _, err := fc.shouldSend(context.Background(), namedA, time.Now())
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, fc.acceptedStats.Total, test.ShouldEqual, 51)
+	test.That(t, fc.acceptedStats.Breakdown, test.ShouldResemble,
+		map[string]int{"label_0": 1, "label_1": 2, "label_2": 1, "other": 47})
+
+	// the cap survives resetting the stats
+	fc.resetStats()
+	for i := 0; i < 5; i++ {
+		label = fmt.Sprintf("label_%d", i)
+		_, _, err = fc.shouldSend(context.Background(), namedA, time.Now())
+		test.That(t, err, test.ShouldBeNil)
+	}
+	test.That(t, len(fc.acceptedStats.Breakdown), test.ShouldEqual, 4)
+	test.That(t, fc.acceptedStats.Breakdown["other"], test.ShouldEqual, 2)
+}
+
+func TestLabelAliases(t *testing.T) {
+	visionSvc := inject.NewVisionService("test_vision")
+	visionSvc.ClassificationsFunc = func(ctx context.Context, img *camera.NamedImage, n int, extra map[string]interface{}) (classification.Classifications, error) {
+		return classification.Classifications{classification.NewClassification(0.9, "c_0042")}, nil
+	}
+	aliases := map[string]string{"c_0042": "forklift"}
+	fc := &filteredCamera{
+		conf:                    &Config{LabelAliases: aliases},
+		logger:                  logging.NewTestLogger(t),
+		otherVisionServices:     []vision.Service{visionSvc},
+		acceptedClassifications: map[string]map[string]float64{"test_vision": {"c_0042": 0.8}},
+		acceptedStats:           imagestats.Stats{Aliases: aliases},
+	}
+
+	// the threshold is keyed on the model label, the annotation and the stats use the alias
+	res, annotations, err := fc.shouldSend(context.Background(), namedA, time.Now())
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res, test.ShouldBeTrue)
+	test.That(t, annotations.Classifications[0].Label, test.ShouldEqual, "forklift")
+	test.That(t, fc.acceptedStats.Breakdown, test.ShouldResemble, map[string]int{"forklift": 1})
+
+	// aliases survive resetting the stats
+	fc.resetStats()
+	_, _, err = fc.shouldSend(context.Background(), namedA, time.Now())
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, fc.acceptedStats.Breakdown, test.ShouldResemble, map[string]int{"forklift": 1})
+}
+
+func TestBufferOnVisionFailure(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	ctx := context.Background()
+	baseTime := time.Now()
+
+	captureCount := 0
+	imagesCam := inject.NewCamera("test_camera")
+	imagesCam.ImagesFunc = func(ctx context.Context, filterSourceNames []string, extra map[string]interface{}) (
+		[]camera.NamedImage, resource.ResponseMetadata, error) {
+		captureCount++
+		img, _ := camera.NamedImageFromImage(image.NewRGBA(image.Rect(0, 0, 10, 10)), fmt.Sprintf("img_%d", captureCount), "image/jpeg", data.Annotations{})
+		return []camera.NamedImage{img}, resource.ResponseMetadata{CapturedAt: baseTime.Add(time.Duration(captureCount) * time.Second)}, nil
+	}
+
+	visionErr := errors.New("vision service down")
+	newFailingService := func(name string) vision.Service {
+		svc := inject.NewVisionService(name)
+		svc.ClassificationsFunc = func(ctx context.Context, img *camera.NamedImage, n int, extra map[string]interface{}) (classification.Classifications, error) {
+			return nil, visionErr
+		}
+		svc.DetectionsFunc = func(ctx context.Context, img *camera.NamedImage, extra map[string]interface{}) ([]objectdetection.Detection, error) {
+			return nil, visionErr
+		}
+		return svc
+	}
+
+	fc := &filteredCamera{
+		conf: &Config{
+			WindowSecondsBefore:   2,
+			WindowSecondsAfter:    2,
+			ImageFrequency:        1.0,
+			BufferOnVisionFailure: true,
+		},
+		logger:                  logger,
+		cam:                     imagesCam,
+		otherVisionServices:     []vision.Service{newFailingService("classifier"), newFailingService("detector")},
+		acceptedClassifications: map[string]map[string]float64{"classifier": {"person": 0.8}},
+		acceptedObjects:         map[string]map[string]float64{"detector": {"car": 0.8}},
+		buf:                     imagebuffer.NewImageBuffer(0, 1.0, 2, 2, logger, true, 0),
+	}
+
+	for i := 0; i < 3; i++ {
+		fc.captureImageInBackground(ctx)
+		imgs, _, err := fc.Images(ctx, nil, map[string]interface{}{data.FromDMString: true})
+		test.That(t, err, test.ShouldEqual, data.ErrNoCaptureToStore)
+		test.That(t, imgs, test.ShouldBeNil)
+	}
+	// buffering continued while vision was down, and the outage counts as a single period
+	test.That(t, fc.buf.GetRingBufferLength(), test.ShouldEqual, 3)
+	stats, err := fc.DoCommand(ctx, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, stats["vision_unavailable_periods"], test.ShouldEqual, 1)
+
+	// without the flag the vision error is returned
+	fc.conf.BufferOnVisionFailure = false
+	_, _, err = fc.Images(ctx, nil, map[string]interface{}{data.FromDMString: true})
+	test.That(t, err, test.ShouldBeError, visionErr)
+}
+
+func TestContextCancelledMidLoop(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	img, err := camera.NamedImageFromImage(image.NewRGBA(image.Rect(0, 0, 10, 10)), "color", "image/jpeg", data.Annotations{})
+	test.That(t, err, test.ShouldBeNil)
+
+	for _, bufferOnFailure := range []bool{false, true} {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		// the first service is slow enough that the call is cancelled while it runs
+		first := inject.NewVisionService("first")
+		first.ClassificationsFunc = func(ctx context.Context, img *camera.NamedImage, n int, extra map[string]interface{}) (classification.Classifications, error) {
+			cancel()
+			return nil, ctx.Err()
+		}
+		secondCalls := 0
+		second := inject.NewVisionService("second")
+		second.ClassificationsFunc = func(ctx context.Context, img *camera.NamedImage, n int, extra map[string]interface{}) (classification.Classifications, error) {
+			secondCalls++
+			return classification.Classifications{classification.NewClassification(0.9, "person")}, nil
+		}
+		fc := &filteredCamera{
+			conf:                &Config{BufferOnVisionFailure: bufferOnFailure},
+			logger:              logger,
+			otherVisionServices: []vision.Service{first, second},
+			acceptedClassifications: map[string]map[string]float64{
+				"first":  {"person": 0.5},
+				"second": {"person": 0.5},
+			},
+		}
+
+		send, _, err := fc.shouldSend(ctx, img, time.Now())
+		test.That(t, err, test.ShouldEqual, context.Canceled)
+		test.That(t, send, test.ShouldBeFalse)
+		test.That(t, secondCalls, test.ShouldEqual, 0)
+		test.That(t, fc.visionUnavailable, test.ShouldBeFalse)
+	}
+
+	// the background worker doesn't read the camera once it is being stopped
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	cameraCalls := 0
+	cam := inject.NewCamera("cam")
+	cam.ImagesFunc = func(ctx context.Context, filterSourceNames []string, extra map[string]interface{}) (
+		[]camera.NamedImage, resource.ResponseMetadata, error) {
+		cameraCalls++
+		return []camera.NamedImage{img}, resource.ResponseMetadata{CapturedAt: time.Now()}, nil
+	}
+	fc := &filteredCamera{
+		conf:   &Config{},
+		logger: logger,
+		cam:    cam,
+		buf:    imagebuffer.NewImageBuffer(10, 1.0, 0, 0, logger, false, 0),
+	}
+	fc.captureImageInBackground(ctx)
+	test.That(t, cameraCalls, test.ShouldEqual, 0)
+	test.That(t, fc.buf.GetRingBufferLength(), test.ShouldEqual, 0)
+}
+
+func TestAnyLabelMinCount(t *testing.T) {
+	bounds := image.Rect(0, 0, 100, 100)
+	box := image.Rect(10, 10, 20, 20)
+	var detections []objectdetection.Detection
+	visionSvc := inject.NewVisionService("crowd")
+	visionSvc.DetectionsFunc = func(ctx context.Context, img *camera.NamedImage, extra map[string]interface{}) ([]objectdetection.Detection, error) {
+		return detections, nil
+	}
+
+	fc := &filteredCamera{
+		conf:                &Config{},
+		logger:              logging.NewTestLogger(t),
+		otherVisionServices: []vision.Service{visionSvc},
+		acceptedObjects:     map[string]map[string]float64{},
+		serviceConfigs: map[string]VisionServiceConfig{
+			"crowd": {Vision: "crowd", AnyLabelMinCount: 3, AnyLabelMinScore: 0.5},
+		},
+	}
+
+	// only two detections clear the score floor, the low confidence ones don't count
+	detections = []objectdetection.Detection{
+		objectdetection.NewDetection(bounds, box, 0.9, "person"),
+		objectdetection.NewDetection(bounds, box, 0.7, "dog"),
+		objectdetection.NewDetection(bounds, box, 0.2, "person"),
+		objectdetection.NewDetection(bounds, box, 0.1, "cat"),
+		objectdetection.NewDetection(bounds, box, 0.3, "bike"),
+	}
+	res, _, err := fc.shouldSend(context.Background(), namedA, time.Now())
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res, test.ShouldBeFalse)
+
+	// a third confident detection of any label crosses the count threshold
+	detections = append(detections, objectdetection.NewDetection(bounds, box, 0.6, "car"))
+	res, annotations, err := fc.shouldSend(context.Background(), namedA, time.Now())
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res, test.ShouldBeTrue)
+	test.That(t, len(annotations.BoundingBoxes), test.ShouldEqual, 3)
+	test.That(t, fc.acceptedStats.Breakdown["any_label_min_count"], test.ShouldEqual, 1)
+}
+
+func TestMinTopMargin(t *testing.T) {
+	var classifications classification.Classifications
+	visionSvc := inject.NewVisionService("classifier")
+	visionSvc.ClassificationsFunc = func(ctx context.Context, img *camera.NamedImage, n int, extra map[string]interface{}) (classification.Classifications, error) {
+		return classifications, nil
+	}
+
+	fc := &filteredCamera{
+		conf:                    &Config{},
+		logger:                  logging.NewTestLogger(t),
+		otherVisionServices:     []vision.Service{visionSvc},
+		acceptedClassifications: map[string]map[string]float64{"classifier": {"cat": 0.5}},
+		serviceConfigs: map[string]VisionServiceConfig{
+			"classifier": {Vision: "classifier", MinTopMargin: 0.3},
+		},
+	}
+
+	// the top label clears its threshold but the runner-up is too close
+	classifications = classification.Classifications{
+		classification.NewClassification(0.5, "dog"),
+		classification.NewClassification(0.6, "cat"),
+	}
+	res, _, err := fc.shouldSend(context.Background(), namedA, time.Now())
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res, test.ShouldBeFalse)
+
+	// a well separated top label triggers
+	classifications = classification.Classifications{
+		classification.NewClassification(0.1, "dog"),
+		classification.NewClassification(0.9, "cat"),
+	}
+	res, annotations, err := fc.shouldSend(context.Background(), namedA, time.Now())
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res, test.ShouldBeTrue)
+	test.That(t, annotations.Classifications[0].Label, test.ShouldEqual, "cat")
+
+	// a match that isn't the top label doesn't trigger, however far ahead the top label is
+	classifications = classification.Classifications{
+		classification.NewClassification(0.95, "dog"),
+		classification.NewClassification(0.55, "cat"),
+	}
+	res, _, err = fc.shouldSend(context.Background(), namedA, time.Now())
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res, test.ShouldBeFalse)
+}
+
+func TestSeparateClassificationAndObjectThresholds(t *testing.T) {
+	r := image.Rect(0, 0, 5, 5)
+	visionSvc := inject.NewVisionService("both")
+	visionSvc.ClassificationsFunc = func(ctx context.Context, img *camera.NamedImage, n int, extra map[string]interface{}) (classification.Classifications, error) {
+		return classification.Classifications{classification.NewClassification(0.5, "person")}, nil
+	}
+	visionSvc.DetectionsFunc = func(ctx context.Context, img *camera.NamedImage, extra map[string]interface{}) ([]objectdetection.Detection, error) {
+		return []objectdetection.Detection{objectdetection.NewDetection(r, r, 0.5, "person")}, nil
+	}
+
+	for _, tc := range []struct {
+		name                  string
+		classificationMin     float64
+		objectMin             float64
+		expectClassifications bool
+		expectObjects         bool
+	}{
+		{"only the object threshold is met", 0.9, 0.3, false, true},
+		{"only the classification threshold is met", 0.3, 0.9, true, false},
+		{"neither threshold is met", 0.9, 0.9, false, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fc := &filteredCamera{
+				conf:                     &Config{},
+				logger:                   logging.NewTestLogger(t),
+				inhibitors:               []vision.Service{},
+				otherVisionServices:      []vision.Service{visionSvc},
+				acceptedClassifications:  map[string]map[string]float64{"both": {"person": tc.classificationMin}},
+				acceptedObjects:          map[string]map[string]float64{"both": {"person": tc.objectMin}},
+				inhibitedClassifications: map[string]map[string]float64{},
+				inhibitedObjects:         map[string]map[string]float64{},
+			}
+
+			test.That(t, fc.classificationMatches("both", classification.NewClassification(0.5, "person"), false, 0),
+				test.ShouldEqual, tc.expectClassifications)
+			test.That(t, fc.detectionMatches("both", objectdetection.NewDetection(r, r, 0.5, "person"), false),
+				test.ShouldEqual, tc.expectObjects)
+
+			res, annotations, err := fc.shouldSend(context.Background(), namedA, time.Now())
+			test.That(t, err, test.ShouldBeNil)
+			test.That(t, res, test.ShouldEqual, tc.expectClassifications || tc.expectObjects)
+			// the annotations come from whichever kind actually matched
+			test.That(t, len(annotations.Classifications) > 0, test.ShouldEqual, tc.expectClassifications)
+			test.That(t, len(annotations.BoundingBoxes) > 0, test.ShouldEqual, !tc.expectClassifications && tc.expectObjects)
+		})
+	}
+}
+
+func TestUnlabeledInhibitor(t *testing.T) {
+	ctx := context.Background()
+	r := image.Rect(0, 0, 5, 5)
+	inhibitor := inject.NewVisionService("inhibitor")
+	inhibitor.GetPropertiesFunc = func(ctx context.Context, extra map[string]interface{}) (*vision.Properties, error) {
+		return &vision.Properties{DetectionSupported: true}, nil
+	}
+	detectionScore := 0.7
+	inhibitor.DetectionsFunc = func(ctx context.Context, img *camera.NamedImage, extra map[string]interface{}) ([]objectdetection.Detection, error) {
+		return []objectdetection.Detection{objectdetection.NewDetection(r, r, detectionScore, "cat")}, nil
+	}
+	inhibitor.ClassificationsFunc = func(ctx context.Context, img *camera.NamedImage, n int, extra map[string]interface{}) (classification.Classifications, error) {
+		return nil, errors.New("classifications not supported")
+	}
+	classifier := inject.NewVisionService("classifier")
+	classifier.ClassificationsFunc = func(ctx context.Context, img *camera.NamedImage, n int, extra map[string]interface{}) (classification.Classifications, error) {
+		return classification.Classifications{classification.NewClassification(0.9, "person")}, nil
+	}
+
+	fc := &filteredCamera{
+		conf:                     &Config{},
+		logger:                   logging.NewTestLogger(t),
+		inhibitors:               []vision.Service{inhibitor},
+		otherVisionServices:      []vision.Service{classifier},
+		inhibitedClassifications: map[string]map[string]float64{},
+		inhibitedObjects:         map[string]map[string]float64{},
+		acceptedClassifications:  map[string]map[string]float64{"classifier": {"person": 0.5}},
+	}
+
+	// by default an inhibitor without labels is ignored
+	res, _, err := fc.shouldSend(ctx, namedA, time.Now())
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res, test.ShouldBeTrue)
+
+	// with a threshold it inhibits on any label it detects above it, and isn't asked for classifications
+	test.That(t, fc.inhibitAllLabels(ctx, inhibitor, 0.5), test.ShouldBeNil)
+	test.That(t, fc.inhibitedObjects["inhibitor"], test.ShouldResemble, map[string]float64{"*": 0.5})
+	test.That(t, fc.inhibitedClassifications["inhibitor"], test.ShouldBeNil)
+	res, _, err = fc.shouldSend(ctx, namedA, time.Now())
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res, test.ShouldBeFalse)
+
+	// but not below it
+	detectionScore = 0.3
+	res, _, err = fc.shouldSend(ctx, namedA, time.Now())
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res, test.ShouldBeTrue)
+}
+
+func TestBurstVisionStride(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	ctx := context.Background()
+	baseTime := time.Now()
+
+	imagesCam := inject.NewCamera("test_camera")
+	imagesCam.ImagesFunc = func(ctx context.Context, filterSourceNames []string, extra map[string]interface{}) (
+		[]camera.NamedImage, resource.ResponseMetadata, error) {
+		burst := []camera.NamedImage{}
+		for i := 0; i < 5; i++ {
+			img, _ := camera.NamedImageFromImage(image.NewRGBA(image.Rect(0, 0, 10, 10)), fmt.Sprintf("img_%d", i), "image/jpeg", data.Annotations{})
+			burst = append(burst, img)
+		}
+		return burst, resource.ResponseMetadata{CapturedAt: baseTime}, nil
+	}
+	var evaluated []string
+	visionSvc := inject.NewVisionService("classifier")
+	visionSvc.ClassificationsFunc = func(ctx context.Context, img *camera.NamedImage, n int, extra map[string]interface{}) (classification.Classifications, error) {
+		evaluated = append(evaluated, img.SourceName)
+		return classification.Classifications{classification.NewClassification(0.1, "person")}, nil
+	}
+
+	for _, tc := range []struct {
+		stride   int
+		expected []string
+	}{
+		{0, []string{"img_0", "img_1", "img_2", "img_3", "img_4"}},
+		{2, []string{"img_0", "img_2", "img_4"}},
+		{3, []string{"img_0", "img_3"}},
+	} {
+		evaluated = nil
+		fc := &filteredCamera{
+			conf:                    &Config{WindowSeconds: 1, ImageFrequency: 1.0, BurstVisionStride: tc.stride},
+			logger:                  logger,
+			cam:                     imagesCam,
+			otherVisionServices:     []vision.Service{visionSvc},
+			acceptedClassifications: map[string]map[string]float64{"classifier": {"person": 0.8}},
+			buf:                     imagebuffer.NewImageBuffer(1, 1.0, 0, 0, logger, false, 0),
+		}
+		// every image of the burst is still buffered
+		fc.captureImageInBackground(ctx)
+		test.That(t, len(fc.buf.GetRingBufferSlice()[0].Imgs), test.ShouldEqual, 5)
+
+		_, _, err := fc.Images(ctx, nil, map[string]interface{}{data.FromDMString: true})
+		test.That(t, err, test.ShouldEqual, data.ErrNoCaptureToStore)
+		test.That(t, evaluated, test.ShouldResemble, tc.expected)
+	}
+}
+
+func TestClassificationsTopN(t *testing.T) {
+	var requested []int
+	visionSvc := inject.NewVisionService("classifier")
+	visionSvc.ClassificationsFunc = func(ctx context.Context, img *camera.NamedImage, n int, extra map[string]interface{}) (classification.Classifications, error) {
+		requested = append(requested, n)
+		return classification.Classifications{classification.NewClassification(0.9, "person")}, nil
+	}
+	inhibitor := inject.NewVisionService("inhibitor")
+	inhibitor.ClassificationsFunc = visionSvc.ClassificationsFunc
+
+	for _, tc := range []struct {
+		topN     int
+		expected int
+	}{
+		{0, 100},
+		{5, 5},
+	} {
+		requested = nil
+		fc := &filteredCamera{
+			conf:                     &Config{ClassificationsTopN: tc.topN},
+			logger:                   logging.NewTestLogger(t),
+			inhibitors:               []vision.Service{inhibitor},
+			otherVisionServices:      []vision.Service{visionSvc},
+			inhibitedClassifications: map[string]map[string]float64{"inhibitor": {"cat": 0.5}},
+			acceptedClassifications:  map[string]map[string]float64{"classifier": {"person": 0.5}},
+		}
+		res, _, err := fc.shouldSend(context.Background(), namedA, time.Now())
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, res, test.ShouldBeTrue)
+		// both the inhibitor and the accepting service are asked for the configured number
+		test.That(t, requested, test.ShouldResemble, []int{tc.expected, tc.expected})
+	}
+}
+
+func TestCaptureTimeout(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	ctx := context.Background()
+	baseTime := time.Now()
+
+	hang := make(chan struct{})
+	defer close(hang)
+	var calls atomic.Int32
+	imagesCam := inject.NewCamera("test_camera")
+	imagesCam.ImagesFunc = func(ctx context.Context, filterSourceNames []string, extra map[string]interface{}) (
+		[]camera.NamedImage, resource.ResponseMetadata, error) {
+		call := calls.Add(1)
+		if call == 1 {
+			// the first call hangs, ignoring its context
+			<-hang
+		}
+		img, _ := camera.NamedImageFromImage(image.NewRGBA(image.Rect(0, 0, 10, 10)), "color", "image/jpeg", data.Annotations{})
+		return []camera.NamedImage{img}, resource.ResponseMetadata{CapturedAt: baseTime.Add(time.Duration(call) * time.Second)}, nil
+	}
+	fc := &filteredCamera{
+		conf:           &Config{WindowSeconds: 1, ImageFrequency: 1.0},
+		logger:         logger,
+		cam:            imagesCam,
+		captureTimeout: 50 * time.Millisecond,
+		buf:            imagebuffer.NewImageBuffer(1, 1.0, 0, 0, logger, false, 0),
+	}
+
+	// the hung call is abandoned and nothing is stored
+	start := time.Now()
+	fc.captureImageInBackground(ctx)
+	test.That(t, time.Since(start), test.ShouldBeLessThan, time.Second)
+	test.That(t, fc.buf.GetRingBufferLength(), test.ShouldEqual, 0)
+
+	// the next tick captures normally
+	fc.captureImageInBackground(ctx)
+	test.That(t, fc.buf.GetRingBufferLength(), test.ShouldEqual, 1)
+}
+
+func TestCaptureInterval(t *testing.T) {
+	for _, tc := range []struct {
+		conf     Config
+		expected time.Duration
+	}{
+		{Config{}, time.Second},
+		{Config{ImageFrequency: 2}, 500 * time.Millisecond},
+		// the worker can run faster than the frequency the buffer is sized for
+		{Config{ImageFrequency: 2, CaptureFrequency: 10}, 100 * time.Millisecond},
+		{Config{CaptureFrequency: 4}, 250 * time.Millisecond},
+	} {
+		test.That(t, tc.conf.captureInterval(), test.ShouldEqual, tc.expected)
+	}
+}
+
+func TestRetroactiveInhibit(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	ctx := context.Background()
+	baseTime := time.Now()
+
+	captureCount := 0
+	imagesCam := inject.NewCamera("test_camera")
+	imagesCam.ImagesFunc = func(ctx context.Context, filterSourceNames []string, extra map[string]interface{}) (
+		[]camera.NamedImage, resource.ResponseMetadata, error) {
+		captureCount++
+		img, _ := camera.NamedImageFromImage(image.NewRGBA(image.Rect(0, 0, 10, 10)), fmt.Sprintf("img_%d", captureCount), "image/jpeg", data.Annotations{})
+		return []camera.NamedImage{img}, resource.ResponseMetadata{CapturedAt: baseTime.Add(time.Duration(captureCount) * time.Second)}, nil
+	}
+
+	accept := inject.NewVisionService("detector")
+	accept.ClassificationsFunc = func(ctx context.Context, img *camera.NamedImage, n int, extra map[string]interface{}) (classification.Classifications, error) {
+		return classification.Classifications{classification.NewClassification(0.9, "person")}, nil
+	}
+	authorized := false
+	guard := inject.NewVisionService("guard")
+	guard.ClassificationsFunc = func(ctx context.Context, img *camera.NamedImage, n int, extra map[string]interface{}) (classification.Classifications, error) {
+		if authorized {
+			return classification.Classifications{classification.NewClassification(0.9, "authorized")}, nil
+		}
+		return classification.Classifications{}, nil
+	}
+
+	fc := &filteredCamera{
+		conf: &Config{
+			WindowSecondsBefore:       0,
+			WindowSecondsAfter:        10,
+			ImageFrequency:            1.0,
+			RetroactiveInhibitSeconds: 2.5,
+		},
+		logger:                   logger,
+		cam:                      imagesCam,
+		inhibitors:               []vision.Service{guard},
+		otherVisionServices:      []vision.Service{accept},
+		inhibitedClassifications: map[string]map[string]float64{"guard": {"authorized": 0.5}},
+		acceptedClassifications:  map[string]map[string]float64{"detector": {"person": 0.5}},
+		buf:                      imagebuffer.NewImageBuffer(0, 1.0, 0, 10, logger, true, 0),
+	}
+
+	// a false positive opens a window at t=1, and frames keep being queued
+	imgs, _, err := fc.Images(ctx, nil, map[string]interface{}{data.FromDMString: true})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, len(imgs), test.ShouldEqual, 1)
+	for i := 0; i < 4; i++ {
+		fc.captureImageInBackground(ctx)
+	}
+	test.That(t, fc.buf.GetToSendLength(), test.ShouldEqual, 4)
+
+	// the inhibitor fires at t=6, dropping the frames queued since t=3.5 and cancelling the window
+	authorized = true
+	imgs, _, err = fc.Images(ctx, nil, map[string]interface{}{data.FromDMString: true})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, len(imgs), test.ShouldEqual, 2)
+	test.That(t, strings.HasSuffix(imgs[0].SourceName, "_img_2"), test.ShouldBeTrue)
+	test.That(t, strings.HasSuffix(imgs[1].SourceName, "_img_3"), test.ShouldBeTrue)
+	test.That(t, fc.buf.IsWithinCaptureWindow(baseTime.Add(7*time.Second)), test.ShouldBeFalse)
+	test.That(t, fc.rejectedStats.Breakdown["authorized"], test.ShouldEqual, 1)
+
+	// without the setting, inhibitors aren't consulted while a window is open
+	authorized = false
+	fc.conf.RetroactiveInhibitSeconds = 0
+	_, _, err = fc.Images(ctx, nil, map[string]interface{}{data.FromDMString: true})
+	test.That(t, err, test.ShouldBeNil)
+	authorized = true
+	fc.captureImageInBackground(ctx)
+	_, _, err = fc.Images(ctx, nil, map[string]interface{}{data.FromDMString: true})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, fc.buf.IsWithinCaptureWindow(baseTime.Add(10*time.Second)), test.ShouldBeTrue)
+}
+
+func TestInhibitIncomingAnnotations(t *testing.T) {
+	visionCalls := 0
+	visionSvc := inject.NewVisionService("classifier")
+	visionSvc.ClassificationsFunc = func(ctx context.Context, img *camera.NamedImage, n int, extra map[string]interface{}) (classification.Classifications, error) {
+		visionCalls++
+		return classification.Classifications{classification.NewClassification(0.9, "person")}, nil
+	}
+
+	fc := &filteredCamera{
+		conf:                    &Config{InhibitIncomingAnnotations: []string{"redacted"}},
+		logger:                  logging.NewTestLogger(t),
+		otherVisionServices:     []vision.Service{visionSvc},
+		acceptedClassifications: map[string]map[string]float64{"classifier": {"person": 0.8}},
+	}
+
+	// a frame the camera marked as redacted is rejected without running vision
+	redacted, err := camera.NamedImageFromImage(image.NewRGBA(image.Rect(0, 0, 10, 10)), "color", "image/jpeg",
+		data.Annotations{Classifications: []data.Classification{{Label: "redacted"}}})
+	test.That(t, err, test.ShouldBeNil)
+	res, _, err := fc.shouldSend(context.Background(), redacted, time.Now())
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res, test.ShouldBeFalse)
+	test.That(t, visionCalls, test.ShouldEqual, 0)
+	test.That(t, fc.rejectedStats.Breakdown["redacted"], test.ShouldEqual, 1)
+
+	// so is one with a matching bounding box label
+	boxed, err := camera.NamedImageFromImage(image.NewRGBA(image.Rect(0, 0, 10, 10)), "color", "image/jpeg",
+		data.Annotations{BoundingBoxes: []data.BoundingBox{{Label: "redacted", XMaxNormalized: 1, YMaxNormalized: 1}}})
+	test.That(t, err, test.ShouldBeNil)
+	res, _, err = fc.shouldSend(context.Background(), boxed, time.Now())
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res, test.ShouldBeFalse)
+
+	// other incoming annotations don't inhibit
+	other, err := camera.NamedImageFromImage(image.NewRGBA(image.Rect(0, 0, 10, 10)), "color", "image/jpeg",
+		data.Annotations{Classifications: []data.Classification{{Label: "reviewed"}}})
+	test.That(t, err, test.ShouldBeNil)
+	res, _, err = fc.shouldSend(context.Background(), other, time.Now())
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res, test.ShouldBeTrue)
+	test.That(t, visionCalls, test.ShouldEqual, 1)
+}
+
+func TestAnnotateAllDetections(t *testing.T) {
+	bounds := image.Rect(0, 0, 100, 100)
+	visionSvc := inject.NewVisionService("detector")
+	visionSvc.DetectionsFunc = func(ctx context.Context, img *camera.NamedImage, extra map[string]interface{}) ([]objectdetection.Detection, error) {
+		return []objectdetection.Detection{
+			objectdetection.NewDetection(bounds, image.Rect(10, 10, 20, 20), 0.9, "person"),
+			objectdetection.NewDetection(bounds, image.Rect(30, 30, 50, 50), 0.4, "dog"),
+			objectdetection.NewDetection(bounds, image.Rect(60, 60, 90, 90), 0.6, "car"),
+		}, nil
+	}
+
+	fc := &filteredCamera{
+		conf:                &Config{},
+		logger:              logging.NewTestLogger(t),
+		otherVisionServices: []vision.Service{visionSvc},
+		acceptedObjects:     map[string]map[string]float64{"detector": {"person": 0.8}},
+	}
+
+	// by default only the matching detection is attached
+	res, annotations, err := fc.shouldSend(context.Background(), namedA, time.Now())
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res, test.ShouldBeTrue)
+	test.That(t, len(annotations.BoundingBoxes), test.ShouldEqual, 1)
+	test.That(t, annotations.BoundingBoxes[0].Label, test.ShouldEqual, "person")
+
+	// with annotate_all_detections every detection from the service is attached
+	fc.conf.AnnotateAllDetections = true
+	res, annotations, err = fc.shouldSend(context.Background(), namedA, time.Now())
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res, test.ShouldBeTrue)
+	test.That(t, len(annotations.BoundingBoxes), test.ShouldEqual, 3)
+	labels := []string{}
+	for _, bbox := range annotations.BoundingBoxes {
+		labels = append(labels, bbox.Label)
+	}
+	test.That(t, labels, test.ShouldResemble, []string{"person", "dog", "car"})
+	test.That(t, annotations.BoundingBoxes[2].XMinNormalized, test.ShouldEqual, 0.6)
+}
+
+func TestAdaptiveThreshold(t *testing.T) {
+	visionSvc := inject.NewVisionService("classifier")
+	visionSvc.ClassificationsFunc = func(ctx context.Context, img *camera.NamedImage, n int, extra map[string]interface{}) (classification.Classifications, error) {
+		return classification.Classifications{classification.NewClassification(0.75, "person")}, nil
+	}
+
+	fc := &filteredCamera{
+		conf: &Config{
+			AdaptiveThreshold: &AdaptiveThresholdConfig{IdleSeconds: 60, DecayPerMinute: 0.1, Floor: 0.5},
+		},
+		logger:                  logging.NewTestLogger(t),
+		otherVisionServices:     []vision.Service{visionSvc},
+		acceptedClassifications: map[string]map[string]float64{"classifier": {"person": 0.9}},
+	}
+	ctx := context.Background()
+	start := time.Now()
+
+	// the first evaluation starts the idle clock
+	res, _, err := fc.shouldSend(ctx, namedA, start)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res, test.ShouldBeFalse)
+
+	// one minute past the idle period the threshold has only dropped to 0.8
+	res, _, err = fc.shouldSend(ctx, namedA, start.Add(2*time.Minute))
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res, test.ShouldBeFalse)
+
+	// three minutes past the idle period it has dropped to 0.6, low enough to trigger
+	res, _, err = fc.shouldSend(ctx, namedA, start.Add(4*time.Minute))
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res, test.ShouldBeTrue)
+
+	// the trigger resets the threshold
+	res, _, err = fc.shouldSend(ctx, namedA, start.Add(4*time.Minute+time.Second))
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res, test.ShouldBeFalse)
+
+	// thresholds never relax below the floor
+	relaxation := fc.thresholdRelaxation(start.Add(100 * time.Minute))
+	test.That(t, fc.effectiveThreshold(0.9, relaxation), test.ShouldEqual, 0.5)
+	test.That(t, fc.effectiveThreshold(0.4, relaxation), test.ShouldEqual, 0.4)
+	// inhibit thresholds are never relaxed
+	fc.inhibitedClassifications = map[string]map[string]float64{"classifier": {"person": 0.9}}
+	test.That(t, fc.classificationMatches("classifier", classification.NewClassification(0.75, "person"), true, relaxation), test.ShouldBeFalse)
+	test.That(t, fc.classificationMatches("classifier", classification.NewClassification(0.75, "person"), false, relaxation), test.ShouldBeTrue)
+}
+
+func TestDoCommandRescore(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	ctx := context.Background()
+
+	scores := map[string]float64{"img_0": 0.5, "img_1": 0.7, "img_2": 0.9}
+	visionSvc := inject.NewVisionService("classifier")
+	visionSvc.ClassificationsFunc = func(ctx context.Context, img *camera.NamedImage, n int, extra map[string]interface{}) (classification.Classifications, error) {
+		return classification.Classifications{classification.NewClassification(scores[img.SourceName], "person")}, nil
+	}
+
+	fc := &filteredCamera{
+		conf:                    &Config{WindowSecondsBefore: 2, WindowSecondsAfter: 2, ImageFrequency: 1.0},
+		logger:                  logger,
+		otherVisionServices:     []vision.Service{visionSvc},
+		acceptedClassifications: map[string]map[string]float64{"classifier": {"person": 0.8}},
+		buf:                     imagebuffer.NewImageBuffer(0, 1.0, 2, 2, logger, true, 0),
+	}
+	baseTime := time.Now()
+	for i := 0; i < len(scores); i++ {
+		img, err := camera.NamedImageFromImage(image.NewRGBA(image.Rect(0, 0, 10, 10)), fmt.Sprintf("img_%d", i), "image/jpeg", data.Annotations{})
+		test.That(t, err, test.ShouldBeNil)
+		fc.buf.AddToRingBuffer([]camera.NamedImage{img}, resource.ResponseMetadata{CapturedAt: baseTime.Add(time.Duration(i) * time.Second)})
+	}
+
+	res, err := fc.DoCommand(ctx, map[string]interface{}{"cmd": "rescore"})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res["frames"], test.ShouldEqual, 3)
+	test.That(t, res["would_trigger"], test.ShouldEqual, 1)
+
+	// lowering the threshold lets more of the same frames through
+	fc.acceptedClassifications["classifier"]["person"] = 0.6
+	res, err = fc.DoCommand(ctx, map[string]interface{}{"cmd": "rescore"})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res["would_trigger"], test.ShouldEqual, 2)
+
+	// rescoring stops once the context is done
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = fc.DoCommand(cancelled, map[string]interface{}{"cmd": "rescore"})
+	test.That(t, err, test.ShouldEqual, context.Canceled)
+
+	// rescoring leaves the buffer and the stats alone
+	test.That(t, fc.buf.GetRingBufferLength(), test.ShouldEqual, 3)
+	test.That(t, fc.acceptedStats.Total, test.ShouldEqual, 0)
+	test.That(t, fc.rejectedStats.Total, test.ShouldEqual, 0)
+}
+
+func TestDoCommandGetRange(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	ctx := context.Background()
+
+	fc := &filteredCamera{
+		conf:   &Config{},
+		logger: logger,
+		buf:    imagebuffer.NewImageBuffer(10, 1.0, 0, 0, logger, false, 0),
+	}
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 4; i++ {
+		img, err := camera.NamedImageFromBytes([]byte(fmt.Sprintf("frame_%d", i)), "color", utils.MimeTypeJPEG, data.Annotations{})
+		test.That(t, err, test.ShouldBeNil)
+		fc.buf.AddToRingBuffer([]camera.NamedImage{img}, resource.ResponseMetadata{CapturedAt: base.Add(time.Duration(i) * time.Second)})
+	}
+
+	res, err := fc.DoCommand(ctx, map[string]interface{}{
+		"cmd":  "get_range",
+		"from": base.Add(1 * time.Second).Format(time.RFC3339),
+		"to":   base.Add(2 * time.Second).Format(time.RFC3339),
+	})
+	test.That(t, err, test.ShouldBeNil)
+	frames := res["frames"].([]interface{})
+	test.That(t, len(frames), test.ShouldEqual, 2)
+	for i, f := range frames {
+		frame := f.(map[string]interface{})
+		test.That(t, frame["captured_at"], test.ShouldEqual, base.Add(time.Duration(i+1)*time.Second).Format(time.RFC3339Nano))
+		images := frame["images"].([]interface{})
+		decoded, err := base64.StdEncoding.DecodeString(images[0].(map[string]interface{})["image"].(string))
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, string(decoded), test.ShouldEqual, fmt.Sprintf("frame_%d", i+1))
+	}
+	test.That(t, fc.buf.GetRingBufferLength(), test.ShouldEqual, 4)
+
+	// invalid ranges are rejected
+	_, err = fc.DoCommand(ctx, map[string]interface{}{"cmd": "get_range", "from": base.Format(time.RFC3339)})
+	test.That(t, err, test.ShouldNotBeNil)
+	_, err = fc.DoCommand(ctx, map[string]interface{}{"cmd": "get_range", "from": "yesterday", "to": base.Format(time.RFC3339)})
+	test.That(t, err, test.ShouldNotBeNil)
+	_, err = fc.DoCommand(ctx, map[string]interface{}{
+		"cmd":  "get_range",
+		"from": base.Add(2 * time.Second).Format(time.RFC3339),
+		"to":   base.Format(time.RFC3339),
+	})
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, err.Error(), test.ShouldContainSubstring, "is before")
+}
+
+func TestDoCommandExport(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	ctx := context.Background()
+
+	fc := &filteredCamera{
+		conf:   &Config{},
+		logger: logger,
+		buf:    imagebuffer.NewImageBuffer(10, 1.0, 0, 0, logger, false, 0),
+	}
+	for i := 0; i < 5; i++ {
+		img, err := camera.NamedImageFromBytes([]byte(fmt.Sprintf("frame_%d", i)), "color", utils.MimeTypeJPEG, data.Annotations{})
+		test.That(t, err, test.ShouldBeNil)
+		fc.buf.AddToRingBuffer([]camera.NamedImage{img}, resource.ResponseMetadata{CapturedAt: time.Now()})
+	}
+
+	// pages of 2 return every frame exactly once, in order
+	exported := []string{}
+	cmd := map[string]interface{}{"cmd": "export", "limit": 2.0}
+	for {
+		res, err := fc.DoCommand(ctx, cmd)
+		test.That(t, err, test.ShouldBeNil)
+		for _, f := range res["frames"].([]interface{}) {
+			images := f.(map[string]interface{})["images"].([]interface{})
+			decoded, err := base64.StdEncoding.DecodeString(images[0].(map[string]interface{})["image"].(string))
+			test.That(t, err, test.ShouldBeNil)
+			exported = append(exported, string(decoded))
+		}
+		if res["next_cursor"] == "" {
+			break
+		}
+		cmd["cursor"] = res["next_cursor"]
+	}
+	test.That(t, exported, test.ShouldResemble, []string{"frame_0", "frame_1", "frame_2", "frame_3", "frame_4"})
+
+	_, err := fc.DoCommand(ctx, map[string]interface{}{"cmd": "export", "limit": "all"})
+	test.That(t, err, test.ShouldNotBeNil)
+	_, err = fc.DoCommand(ctx, map[string]interface{}{"cmd": "export", "cursor": "bogus"})
+	test.That(t, err, test.ShouldNotBeNil)
+}
+
+func TestWarmup(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	ctx := context.Background()
+
+	imagesCam := inject.NewCamera("test_camera")
+	imagesCam.ImagesFunc = func(ctx context.Context, filterSourceNames []string, extra map[string]interface{}) (
+		[]camera.NamedImage, resource.ResponseMetadata, error) {
+		img, _ := camera.NamedImageFromImage(image.NewRGBA(image.Rect(0, 0, 10, 10)), "color", "image/jpeg", data.Annotations{})
+		return []camera.NamedImage{img}, resource.ResponseMetadata{CapturedAt: time.Now()}, nil
+	}
+	fc := &filteredCamera{
+		conf:      &Config{WindowSeconds: 1, ImageFrequency: 1.0, WarmupSecs: 60},
+		logger:    logger,
+		cam:       imagesCam,
+		buf:       imagebuffer.NewImageBuffer(1, 1.0, 0, 0, logger, false, 0),
+		warmUntil: time.Now().Add(time.Minute),
+	}
+	fc.captureImageInBackground(ctx)
+
+	// while warming up, data management gets nothing to store but no error, and nothing is evaluated
+	images, _, err := fc.Images(ctx, nil, map[string]interface{}{data.FromDMString: true})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, images, test.ShouldBeEmpty)
+	test.That(t, fc.evaluations, test.ShouldEqual, 0)
+	test.That(t, fc.buf.GetRingBufferLength(), test.ShouldEqual, 1)
+
+	// other callers are served as usual
+	images, _, err = fc.Images(ctx, nil, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, len(images), test.ShouldEqual, 1)
+
+	// once warm, the filter runs
+	fc.warmUntil = time.Now().Add(-time.Second)
+	_, _, err = fc.Images(ctx, nil, map[string]interface{}{data.FromDMString: true})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, fc.evaluations, test.ShouldEqual, 1)
+}
+
+func TestOutageGrace(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		name          string
+		grace         float64
+		expectedQueue int
+	}{
+		{"grace covers the outage", 10, 2},
+		{"grace too short", 1, 1},
+		{"no grace", 0, 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			baseTime := time.Now()
+			captureCount := 0
+			failing := false
+			imagesCam := inject.NewCamera("test_camera")
+			imagesCam.ImagesFunc = func(ctx context.Context, filterSourceNames []string, extra map[string]interface{}) (
+				[]camera.NamedImage, resource.ResponseMetadata, error) {
+				captureCount++
+				if failing {
+					return nil, resource.ResponseMetadata{}, errors.New("camera unplugged")
+				}
+				img, _ := camera.NamedImageFromImage(image.NewRGBA(image.Rect(0, 0, 10, 10)), fmt.Sprintf("img_%d", captureCount), "image/jpeg", data.Annotations{})
+				return []camera.NamedImage{img}, resource.ResponseMetadata{CapturedAt: baseTime.Add(time.Duration(captureCount) * time.Second)}, nil
+			}
+			visionSvc := inject.NewVisionService("classifier")
+			visionSvc.ClassificationsFunc = func(ctx context.Context, img *camera.NamedImage, n int, extra map[string]interface{}) (classification.Classifications, error) {
+				return classification.Classifications{classification.NewClassification(0.9, "person")}, nil
+			}
+
+			fc := &filteredCamera{
+				conf:                    &Config{WindowSecondsAfter: 3, ImageFrequency: 1.0, OutageGraceSeconds: tc.grace},
+				logger:                  logger,
+				cam:                     imagesCam,
+				otherVisionServices:     []vision.Service{visionSvc},
+				acceptedClassifications: map[string]map[string]float64{"classifier": {"person": 0.8}},
+				buf:                     imagebuffer.NewImageBuffer(0, 1.0, 0, 3, logger, true, 0),
+			}
+
+			// trigger at t=1 opens a window until t=4, and t=2 is queued
+			_, _, err := fc.Images(ctx, nil, map[string]interface{}{data.FromDMString: true})
+			test.That(t, err, test.ShouldBeNil)
+			fc.captureImageInBackground(ctx)
+
+			// the camera is down for t=3 to t=5, and back at t=6
+			failing = true
+			for i := 0; i < 3; i++ {
+				fc.captureImageInBackground(ctx)
+			}
+			failing = false
+			fc.captureImageInBackground(ctx)
+
+			test.That(t, fc.buf.GetToSendLength(), test.ShouldEqual, tc.expectedQueue)
+		})
+	}
+}
+
+func TestEmptyCameraImages(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	ctx := context.Background()
+	baseTime := time.Now()
+	captureCount := 0
+	empty := false
+	imagesCam := inject.NewCamera("test_camera")
+	imagesCam.ImagesFunc = func(ctx context.Context, filterSourceNames []string, extra map[string]interface{}) (
+		[]camera.NamedImage, resource.ResponseMetadata, error) {
+		captureCount++
+		meta := resource.ResponseMetadata{CapturedAt: baseTime.Add(time.Duration(captureCount) * time.Second)}
+		if empty {
+			return []camera.NamedImage{}, meta, nil
+		}
+		img, _ := camera.NamedImageFromImage(image.NewRGBA(image.Rect(0, 0, 10, 10)), fmt.Sprintf("img_%d", captureCount), "image/jpeg", data.Annotations{})
+		return []camera.NamedImage{img}, meta, nil
+	}
+	visionCalls := 0
+	visionSvc := inject.NewVisionService("classifier")
+	visionSvc.ClassificationsFunc = func(ctx context.Context, img *camera.NamedImage, n int, extra map[string]interface{}) (classification.Classifications, error) {
+		visionCalls++
+		return classification.Classifications{classification.NewClassification(0.9, "person")}, nil
+	}
+
+	fc := &filteredCamera{
+		conf:                    &Config{WindowSecondsAfter: 10, ImageFrequency: 1.0},
+		logger:                  logger,
+		cam:                     imagesCam,
+		otherVisionServices:     []vision.Service{visionSvc},
+		acceptedClassifications: map[string]map[string]float64{"classifier": {"person": 0.8}},
+		buf:                     imagebuffer.NewImageBuffer(0, 1.0, 0, 10, logger, false, 0),
+	}
+	fromDM := map[string]interface{}{data.FromDMString: true}
+
+	// a trigger at t=1 opens a window, and t=2 is queued
+	_, _, err := fc.Images(ctx, nil, fromDM)
+	test.That(t, err, test.ShouldBeNil)
+	fc.captureImageInBackground(ctx)
+	test.That(t, fc.buf.GetToSendLength(), test.ShouldEqual, 1)
+
+	// empty batches are not stored
+	empty = true
+	fc.captureImageInBackground(ctx)
+	test.That(t, fc.buf.GetToSendLength(), test.ShouldEqual, 1)
+	test.That(t, fc.buf.GetRingBufferLength(), test.ShouldEqual, 0)
+
+	// an empty batch still returns what was buffered
+	images, _, err := fc.Images(ctx, nil, fromDM)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, len(images), test.ShouldEqual, 1)
+
+	// with nothing buffered there is nothing to capture, and nothing is run through vision
+	calls, evaluations := visionCalls, fc.evaluations
+	_, _, err = fc.Images(ctx, nil, fromDM)
+	test.That(t, err, test.ShouldEqual, data.ErrNoCaptureToStore)
+	test.That(t, visionCalls, test.ShouldEqual, calls)
+	test.That(t, fc.evaluations, test.ShouldEqual, evaluations)
+}
+
+func TestMaxOutputLatency(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		name          string
+		failCamera    bool
+		latencyMs     int
+		expectFlushed bool
+	}{
+		{"camera failure flushes aged images", true, 500, true},
+		{"vision failure flushes aged images", false, 500, true},
+		{"images not old enough", true, 60000, false},
+		{"no latency target", true, 0, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			// the queued frame was captured two seconds ago
+			baseTime := time.Now().Add(-2 * time.Second)
+			imagesCam := inject.NewCamera("test_camera")
+			imagesCam.ImagesFunc = func(ctx context.Context, filterSourceNames []string, extra map[string]interface{}) (
+				[]camera.NamedImage, resource.ResponseMetadata, error) {
+				if tc.failCamera {
+					return nil, resource.ResponseMetadata{}, errors.New("camera unplugged")
+				}
+				img, _ := camera.NamedImageFromImage(image.NewRGBA(image.Rect(0, 0, 10, 10)), "color", "image/jpeg", data.Annotations{})
+				return []camera.NamedImage{img}, resource.ResponseMetadata{CapturedAt: baseTime.Add(10 * time.Second)}, nil
+			}
+			visionSvc := inject.NewVisionService("classifier")
+			visionSvc.ClassificationsFunc = func(ctx context.Context, img *camera.NamedImage, n int, extra map[string]interface{}) (classification.Classifications, error) {
+				return nil, errors.New("model crashed")
+			}
+
+			fc := &filteredCamera{
+				conf:                    &Config{WindowSecondsAfter: 1, ImageFrequency: 1.0, MaxOutputLatencyMs: tc.latencyMs},
+				logger:                  logger,
+				cam:                     imagesCam,
+				otherVisionServices:     []vision.Service{visionSvc},
+				acceptedClassifications: map[string]map[string]float64{"classifier": {"person": 0.8}},
+				buf:                     imagebuffer.NewImageBuffer(0, 1.0, 0, 1, logger, true, 0),
+			}
+			img, _ := camera.NamedImageFromImage(image.NewRGBA(image.Rect(0, 0, 10, 10)), "color", "image/jpeg", data.Annotations{})
+			fc.buf.AddToRingBuffer([]camera.NamedImage{img}, resource.ResponseMetadata{CapturedAt: baseTime})
+			fc.buf.MarkShouldSend(baseTime)
+			test.That(t, fc.buf.GetToSendLength(), test.ShouldEqual, 1)
+
+			res, meta, err := fc.Images(ctx, nil, map[string]interface{}{data.FromDMString: true})
+			if tc.expectFlushed {
+				test.That(t, err, test.ShouldBeNil)
+				test.That(t, len(res), test.ShouldEqual, 1)
+				test.That(t, meta.CapturedAt.Equal(baseTime), test.ShouldBeTrue)
+				assertTimestampsMatch(t, res[0].SourceName, baseTime)
+				test.That(t, fc.buf.GetToSendLength(), test.ShouldEqual, 0)
+			} else {
+				test.That(t, err, test.ShouldNotBeNil)
+				test.That(t, fc.buf.GetToSendLength(), test.ShouldEqual, 1)
+			}
+		})
+	}
+}
+
+func TestDoCommandBufferStatus(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		name                string
+		windowSeconds       int
+		windowSecondsBefore int
+		windowSecondsAfter  int
+		imageFrequency      float64
+		expectedBefore      int
+		expectedAfter       int
+	}{
+		{"window_seconds", 5, 0, 0, 2.0, 5, 5},
+		{"before and after", 0, 2, 4, 0.5, 2, 4},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fc := &filteredCamera{
+				conf:   &Config{},
+				logger: logger,
+				buf:    imagebuffer.NewImageBuffer(tc.windowSeconds, tc.imageFrequency, tc.windowSecondsBefore, tc.windowSecondsAfter, logger, false, 0),
+			}
+			fc.buf.AddToRingBuffer(nil, resource.ResponseMetadata{CapturedAt: time.Now()})
+
+			res, err := fc.DoCommand(ctx, map[string]interface{}{"cmd": "buffer_status"})
+			test.That(t, err, test.ShouldBeNil)
+			expectedMax := int(3 * float64(tc.expectedBefore+tc.expectedAfter) * tc.imageFrequency)
+			if tc.windowSeconds > 0 {
+				expectedMax = int(3 * float64(tc.windowSeconds) * tc.imageFrequency)
+			}
+			test.That(t, res["max_images"], test.ShouldEqual, expectedMax)
+			test.That(t, res["window_seconds_before"], test.ShouldEqual, tc.expectedBefore)
+			test.That(t, res["window_seconds_after"], test.ShouldEqual, tc.expectedAfter)
+			test.That(t, res["frames_before"], test.ShouldEqual, int(float64(tc.expectedBefore)*tc.imageFrequency))
+			test.That(t, res["frames_after"], test.ShouldEqual, int(float64(tc.expectedAfter)*tc.imageFrequency))
+			test.That(t, res["ring_buffer_size"], test.ShouldEqual, 1)
+			test.That(t, res["to_send_size"], test.ShouldEqual, 0)
+			test.That(t, res["capture_from"], test.ShouldEqual, "")
+			test.That(t, res["capture_till"], test.ShouldEqual, "")
+
+			// once triggered, the capture window is reported
+			trigger := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+			fc.buf.MarkShouldSend(trigger)
+			res, err = fc.DoCommand(ctx, map[string]interface{}{"cmd": "buffer_status"})
+			test.That(t, err, test.ShouldBeNil)
+			test.That(t, res["capture_from"], test.ShouldEqual,
+				trigger.Add(-time.Duration(tc.expectedBefore)*time.Second).Format(time.RFC3339Nano))
+			test.That(t, res["capture_till"], test.ShouldEqual,
+				trigger.Add(time.Duration(tc.expectedAfter)*time.Second).Format(time.RFC3339Nano))
+		})
+	}
+}
+
+func TestRequeueOnSendFailure(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	ctx := context.Background()
+	baseTime := time.Now()
+
+	captureCount := 0
+	imagesCam := inject.NewCamera("test_camera")
+	imagesCam.ImagesFunc = func(ctx context.Context, filterSourceNames []string, extra map[string]interface{}) (
+		[]camera.NamedImage, resource.ResponseMetadata, error) {
+		captureCount++
+		img, _ := camera.NamedImageFromImage(image.NewRGBA(image.Rect(0, 0, 10, 10)), fmt.Sprintf("img_%d", captureCount), "image/jpeg", data.Annotations{})
+		return []camera.NamedImage{img}, resource.ResponseMetadata{CapturedAt: baseTime.Add(time.Duration(captureCount) * time.Second)}, nil
+	}
+
+	fc := &filteredCamera{
+		conf:   &Config{WindowSecondsAfter: 10, ImageFrequency: 1.0, EncodeWorkers: 2, RequeueOnSendFailure: true},
+		logger: logger,
+		cam:    imagesCam,
+		buf:    imagebuffer.NewImageBuffer(0, 1.0, 0, 10, logger, true, 0),
+	}
+
+	// a window is open, holding a good frame and one that can't be encoded
+	fc.buf.MarkShouldSend(baseTime)
+	good, err := camera.NamedImageFromImage(image.NewRGBA(image.Rect(0, 0, 10, 10)), "good", "image/jpeg", data.Annotations{})
+	test.That(t, err, test.ShouldBeNil)
+	fc.buf.StoreImages([]camera.NamedImage{good}, resource.ResponseMetadata{CapturedAt: baseTime}, baseTime)
+	fc.buf.StoreImages([]camera.NamedImage{{SourceName: "broken"}}, resource.ResponseMetadata{CapturedAt: baseTime.Add(500 * time.Millisecond)},
+		baseTime.Add(500*time.Millisecond))
+
+	// sending fails, so the frames are put back rather than lost
+	_, _, err = fc.Images(ctx, nil, map[string]interface{}{data.FromDMString: true})
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, fc.buf.GetToSendLength(), test.ShouldEqual, 2)
+
+	// without requeueing the failure is only logged and the frames are gone
+	fc.conf.RequeueOnSendFailure = false
+	imgs, _, err := fc.Images(ctx, nil, map[string]interface{}{data.FromDMString: true})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, len(imgs), test.ShouldEqual, 2)
+	test.That(t, fc.buf.GetToSendLength(), test.ShouldEqual, 0)
+
+	// successful sends are committed and come back encoded
+	fc.conf.RequeueOnSendFailure = true
+	fc.captureImageInBackground(ctx)
+	imgs, _, err = fc.Images(ctx, nil, map[string]interface{}{data.FromDMString: true})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, len(imgs), test.ShouldEqual, 1)
+	_, err = imgs[0].Bytes(ctx)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, fc.buf.GetToSendLength(), test.ShouldEqual, 0)
+}
+
+func TestDoCommandSetDebug(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	ctx := context.Background()
+	fc := &filteredCamera{
+		conf:   &Config{},
+		logger: logger,
+		buf:    imagebuffer.NewImageBuffer(10, 1.0, 0, 0, logger, false, 0),
+	}
+
+	res, err := fc.DoCommand(ctx, map[string]interface{}{"cmd": "set_debug"})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res["debug"], test.ShouldBeFalse)
+
+	res, err = fc.DoCommand(ctx, map[string]interface{}{"cmd": "set_debug", "value": true})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res["debug"], test.ShouldBeTrue)
+	test.That(t, fc.conf.Debug, test.ShouldBeFalse)
+	test.That(t, fc.buf.Debug(), test.ShouldBeTrue)
+
+	res, err = fc.DoCommand(ctx, map[string]interface{}{"cmd": "set_debug", "value": false})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res["debug"], test.ShouldBeFalse)
+	test.That(t, fc.buf.Debug(), test.ShouldBeFalse)
+
+	_, err = fc.DoCommand(ctx, map[string]interface{}{"cmd": "set_debug", "value": "yes"})
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, fc.buf.Debug(), test.ShouldBeFalse)
+}
+
+func TestDoCommandSetWindow(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	ctx := context.Background()
+	fc := &filteredCamera{
+		conf:   &Config{WindowSeconds: 10},
+		logger: logger,
+		buf:    imagebuffer.NewImageBuffer(10, 1.0, 0, 0, logger, false, 0),
+	}
+
+	res, err := fc.DoCommand(ctx, map[string]interface{}{"cmd": "set_window"})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res["window_seconds_before"], test.ShouldEqual, 10)
+	test.That(t, res["window_seconds_after"], test.ShouldEqual, 10)
+	test.That(t, res["max_images"], test.ShouldEqual, 30)
+
+	// an omitted side keeps its current length
+	res, err = fc.DoCommand(ctx, map[string]interface{}{"cmd": "set_window", "after": 5.0})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res["window_seconds_before"], test.ShouldEqual, 10)
+	test.That(t, res["window_seconds_after"], test.ShouldEqual, 5)
+	test.That(t, res["max_images"], test.ShouldEqual, 45)
+	test.That(t, fc.conf.WindowSeconds, test.ShouldEqual, 10)
+	test.That(t, fc.windowOverridden, test.ShouldBeTrue)
+	test.That(t, fc.buf.Status().WindowSecondsAfter, test.ShouldEqual, 5)
+
+	res, err = fc.DoCommand(ctx, map[string]interface{}{"cmd": "set_window", "window": 2.0})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res["window_seconds_before"], test.ShouldEqual, 2)
+	test.That(t, res["window_seconds_after"], test.ShouldEqual, 2)
+	test.That(t, res["max_images"], test.ShouldEqual, 6)
+
+	for _, bad := range []map[string]interface{}{
+		{"cmd": "set_window", "window": 2.0, "after": 5.0},
+		{"cmd": "set_window", "before": -1.0},
+		{"cmd": "set_window", "before": 1.5},
+		{"cmd": "set_window", "after": "5"},
+		{"cmd": "set_window", "window": 0.0},
+	} {
+		_, err = fc.DoCommand(ctx, bad)
+		test.That(t, err, test.ShouldNotBeNil)
+	}
+	test.That(t, fc.conf.WindowSeconds, test.ShouldEqual, 10)
+	test.That(t, fc.buf.Status().WindowSecondsBefore, test.ShouldEqual, 2)
+}
+
+func TestDoCommandResetStats(t *testing.T) {
+	ctx := context.Background()
+	before := time.Now().Add(-time.Hour)
+	fc := &filteredCamera{
+		conf:          &Config{},
+		logger:        logging.NewTestLogger(t),
+		acceptedStats: imagestats.Stats{Total: 1, Breakdown: map[string]int{"foo": 1}, StartTime: before},
+		rejectedStats: imagestats.Stats{Total: 2, Breakdown: map[string]int{"bar": 2}, StartTime: before},
+	}
+
+	res, err := fc.DoCommand(ctx, map[string]interface{}{"command": "reset_stats"})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res["reset"], test.ShouldBeTrue)
+	test.That(t, fc.acceptedStats.StartTime.After(before), test.ShouldBeTrue)
+	test.That(t, fc.rejectedStats.StartTime, test.ShouldEqual, fc.acceptedStats.StartTime)
+
+	// the default command reports the cleared counts
+	res, err = fc.DoCommand(ctx, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res["accepted"].(map[string]interface{})["total"], test.ShouldEqual, 0)
+	test.That(t, res["accepted"].(map[string]interface{})["vision"], test.ShouldBeNil)
+	test.That(t, res["rejected"].(map[string]interface{})["total"], test.ShouldEqual, 0)
+	test.That(t, res["rejected"].(map[string]interface{})["vision"], test.ShouldBeNil)
+
+	// a command that isn't known fails rather than falling back to the stats
+	_, err = fc.DoCommand(ctx, map[string]interface{}{"command": "reset_stat"})
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, err.Error(), test.ShouldContainSubstring, "unknown command")
+	_, err = fc.DoCommand(ctx, map[string]interface{}{"command": 1})
+	test.That(t, err, test.ShouldNotBeNil)
+}
+
+func TestEvaluationsTotal(t *testing.T) {
+	ctx := context.Background()
+	fc := &filteredCamera{
+		conf: &Config{
+			Classifications: map[string]Threshold{"a": {Min: .8}},
+			WindowSeconds:   10,
+			ImageFrequency:  1.0,
+		},
+		logger:                  logging.NewTestLogger(t),
+		otherVisionServices:     []vision.Service{getDummyVisionService()},
+		acceptedClassifications: map[string]map[string]float64{"": {"a": .8}},
+		acceptedObjects:         map[string]map[string]float64{},
+		buf:                     imagebuffer.NewImageBuffer(10, 1.0, 0, 0, logging.NewTestLogger(t), false, 0),
+	}
+
+	stats, err := fc.DoCommand(ctx, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, stats["evaluations_total"], test.ShouldEqual, 0)
+
+	// every evaluation counts, whether it is accepted or rejected
+	for i, img := range []camera.NamedImage{namedA, namedD, namedD} {
+		_, _, err := fc.shouldSend(ctx, img, time.Now())
+		test.That(t, err, test.ShouldBeNil)
+		stats, err = fc.DoCommand(ctx, nil)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, stats["evaluations_total"], test.ShouldEqual, i+1)
+	}
+	test.That(t, fc.acceptedStats.Total, test.ShouldEqual, 1)
+	test.That(t, fc.rejectedStats.Total, test.ShouldEqual, 2)
+
+	_, err = fc.DoCommand(ctx, map[string]interface{}{"cmd": "reset_stats"})
+	test.That(t, err, test.ShouldBeNil)
+	stats, err = fc.DoCommand(ctx, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, stats["evaluations_total"], test.ShouldEqual, 0)
+}
+
+func TestDoCommandTriggerAt(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	ctx := context.Background()
+	baseTime := time.Now()
+
+	imagesCam := inject.NewCamera("test_camera")
+	imagesCam.ImagesFunc = func(ctx context.Context, filterSourceNames []string, extra map[string]interface{}) (
+		[]camera.NamedImage, resource.ResponseMetadata, error) {
+		img, _ := camera.NamedImageFromImage(image.NewRGBA(image.Rect(0, 0, 10, 10)), "color", "image/jpeg", data.Annotations{})
+		return []camera.NamedImage{img}, resource.ResponseMetadata{CapturedAt: baseTime.Add(time.Second)}, nil
+	}
+	fc := &filteredCamera{
+		conf:   &Config{WindowSecondsBefore: 3, WindowSecondsAfter: 3, ImageFrequency: 1.0},
+		logger: logger,
+		cam:    imagesCam,
+		buf:    imagebuffer.NewImageBuffer(0, 1.0, 3, 3, logger, false, 0),
+	}
+	for _, offset := range []time.Duration{-2 * time.Second, -time.Second} {
+		img, _ := camera.NamedImageFromImage(image.NewRGBA(image.Rect(0, 0, 10, 10)), "color", "image/jpeg", data.Annotations{})
+		fc.buf.AddToRingBuffer([]camera.NamedImage{img}, resource.ResponseMetadata{CapturedAt: baseTime.Add(offset)})
+	}
+
+	_, err := fc.DoCommand(ctx, map[string]interface{}{"cmd": "trigger_at", "id": 1234})
+	test.That(t, err, test.ShouldNotBeNil)
+	_, err = fc.DoCommand(ctx, map[string]interface{}{"cmd": "trigger_at", "time": "yesterday"})
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, fc.buf.GetToSendLength(), test.ShouldEqual, 0)
+
+	res, err := fc.DoCommand(ctx, map[string]interface{}{
+		"cmd":  "trigger_at",
+		"time": baseTime.Format(time.RFC3339Nano),
+		"id":   "order-1234",
+	})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res["triggered"], test.ShouldBeTrue)
+	test.That(t, res["id"], test.ShouldEqual, "order-1234")
+
+	// the pre-roll and the frame captured during the window all carry the correlation id
+	fc.captureImageInBackground(ctx)
+	imgs, _, err := fc.Images(ctx, nil, map[string]interface{}{data.FromDMString: true})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, len(imgs), test.ShouldEqual, 3)
+	for _, img := range imgs {
+		test.That(t, img.Annotations.Classifications, test.ShouldResemble,
+			[]data.Classification{{Label: imagebuffer.CorrelationIDLabelPrefix + "order-1234"}})
+	}
+}
+
+func TestTriggerAtTolerance(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	ctx := context.Background()
+	baseTime := time.Now().Add(-time.Minute)
+
+	fc := &filteredCamera{
+		conf:   &Config{WindowSecondsBefore: 0, WindowSecondsAfter: 1, ImageFrequency: 1.0, TriggerAtToleranceMs: 500},
+		logger: logger,
+		buf:    imagebuffer.NewImageBuffer(0, 1.0, 0, 1, logger, false, 0),
+	}
+	for _, offset := range []time.Duration{0, time.Second, 2 * time.Second} {
+		img, _ := camera.NamedImageFromImage(image.NewRGBA(image.Rect(0, 0, 10, 10)), "color", "image/jpeg", data.Annotations{})
+		fc.buf.AddToRingBuffer([]camera.NamedImage{img}, resource.ResponseMetadata{CapturedAt: baseTime.Add(offset)})
+	}
+
+	// the external timestamp falls between the first two frames, closer to the first, which anchors the window
+	res, err := fc.DoCommand(ctx, map[string]interface{}{
+		"cmd":  "trigger_at",
+		"time": baseTime.Add(300 * time.Millisecond).Format(time.RFC3339Nano),
+	})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res["triggered"], test.ShouldBeTrue)
+	test.That(t, res["time"], test.ShouldEqual, baseTime.Format(time.RFC3339Nano))
+	queued := fc.buf.GetToSendSlice()
+	test.That(t, len(queued), test.ShouldEqual, 2)
+	test.That(t, queued[0].Meta.CapturedAt.Equal(baseTime), test.ShouldBeTrue)
+}
+
+func TestForceTrigger(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	ctx := context.Background()
+	baseTime := time.Now()
+
+	fc := &filteredCamera{
+		conf:   &Config{WindowSecondsBefore: 3, WindowSecondsAfter: 3, ImageFrequency: 1.0},
+		logger: logger,
+		buf:    imagebuffer.NewImageBuffer(0, 1.0, 3, 3, logger, false, 0),
+	}
+	for _, offset := range []time.Duration{-10 * time.Second, -2 * time.Second, -time.Second} {
+		img, _ := camera.NamedImageFromImage(image.NewRGBA(image.Rect(0, 0, 10, 10)), "color", "image/jpeg", data.Annotations{})
+		fc.buf.AddToRingBuffer([]camera.NamedImage{img}, resource.ResponseMetadata{CapturedAt: baseTime.Add(offset)})
+	}
+
+	// the frames within the pre-roll are queued, whatever vision would say
+	res, err := fc.DoCommand(ctx, map[string]interface{}{"cmd": "force_trigger"})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res["triggered"], test.ShouldBeTrue)
+	test.That(t, res["to_send"], test.ShouldEqual, 2)
+	test.That(t, fc.buf.IsWithinCaptureWindow(time.Now()), test.ShouldBeTrue)
+	test.That(t, fc.acceptedStats.Total, test.ShouldEqual, 1)
+	test.That(t, fc.acceptedStats.Breakdown[manualTriggerLabel], test.ShouldEqual, 1)
+}
+
+func TestSingleImageSource(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	baseTime := time.Now()
+
+	fc := &filteredCamera{
+		conf:   &Config{WindowSecondsBefore: 3, WindowSecondsAfter: 3, ImageFrequency: 1.0, SingleImageSource: "depth"},
+		logger: logger,
+		buf:    imagebuffer.NewImageBuffer(0, 1.0, 3, 3, logger, false, 0),
+	}
+	for _, offset := range []time.Duration{-2 * time.Second, -time.Second} {
+		color, _ := camera.NamedImageFromImage(image.NewRGBA(image.Rect(0, 0, 10, 10)), "color", "image/jpeg", data.Annotations{})
+		depth, _ := camera.NamedImageFromImage(image.NewGray16(image.Rect(0, 0, 10, 10)), "depth", "image/png", data.Annotations{})
+		fc.buf.AddToRingBuffer([]camera.NamedImage{color, depth}, resource.ResponseMetadata{CapturedAt: baseTime.Add(offset)})
+	}
+	fc.buf.MarkShouldSend(baseTime)
+
+	// a single image request gets the configured source of the group, not its first image
+	imgs, meta, ok := fc.getBufferedImages(true)
+	test.That(t, ok, test.ShouldBeTrue)
+	test.That(t, len(imgs), test.ShouldEqual, 1)
+	test.That(t, strings.HasSuffix(imgs[0].SourceName, "_depth"), test.ShouldBeTrue)
+	test.That(t, meta.CapturedAt.Equal(baseTime.Add(-2*time.Second)), test.ShouldBeTrue)
+
+	// without a match, the first image is returned
+	fc.conf.SingleImageSource = "ir"
+	imgs, _, ok = fc.getBufferedImages(true)
+	test.That(t, ok, test.ShouldBeTrue)
+	test.That(t, len(imgs), test.ShouldEqual, 1)
+	test.That(t, strings.HasSuffix(imgs[0].SourceName, "_color"), test.ShouldBeTrue)
+}
+
+func TestBufferedImagesOrderedAndDeduped(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	ctx := context.Background()
+	baseTime := time.Now()
+
+	imagesCam := inject.NewCamera("test_camera")
+	imagesCam.ImagesFunc = func(ctx context.Context, filterSourceNames []string, extra map[string]interface{}) (
+		[]camera.NamedImage, resource.ResponseMetadata, error) {
+		img, _ := camera.NamedImageFromImage(image.NewRGBA(image.Rect(0, 0, 10, 10)), "color", "image/jpeg", data.Annotations{})
+		return []camera.NamedImage{img}, resource.ResponseMetadata{CapturedAt: baseTime.Add(4 * time.Second)}, nil
+	}
+
+	fc := &filteredCamera{
+		conf:   &Config{WindowSeconds: 5, ImageFrequency: 1.0},
+		logger: logger,
+		cam:    imagesCam,
+		buf:    imagebuffer.NewImageBuffer(5, 1.0, 0, 0, logger, true, 0),
+	}
+
+	// the same out of order and duplicated frames as the conditional camera test
+	frame := func(offset time.Duration) ([]camera.NamedImage, resource.ResponseMetadata) {
+		img, _ := camera.NamedImageFromImage(image.NewRGBA(image.Rect(0, 0, 10, 10)), "color", "image/jpeg", data.Annotations{})
+		return []camera.NamedImage{img}, resource.ResponseMetadata{CapturedAt: baseTime.Add(offset)}
+	}
+	fc.buf.AddToRingBuffer(frame(2 * time.Second))
+	fc.buf.AddToRingBuffer(frame(time.Second))
+	fc.buf.MarkShouldSend(baseTime.Add(2 * time.Second))
+	imgs, meta := frame(time.Second)
+	fc.buf.StoreImages(imgs, meta, meta.CapturedAt)
+
+	res, batchMeta, err := fc.Images(ctx, nil, map[string]interface{}{data.FromDMString: true})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, len(res), test.ShouldEqual, 2)
+	test.That(t, batchMeta.CapturedAt.Equal(baseTime.Add(time.Second)), test.ShouldBeTrue)
+	assertTimestampsMatch(t, res[0].SourceName, baseTime.Add(time.Second))
+	assertTimestampsMatch(t, res[1].SourceName, baseTime.Add(2*time.Second))
+}
+
+// streamOnlyCamera is a camera that fails Images but can serve frames through Stream
+type streamOnlyCamera struct {
+	*inject.Camera
+	frame image.Image
+}
+
+func (c *streamOnlyCamera) Stream(ctx context.Context, errHandlers ...gostream.ErrorHandler) (gostream.VideoStream, error) {
+	return &singleFrameStream{frame: c.frame}, nil
+}
+
+type singleFrameStream struct {
+	frame image.Image
+}
+
+func (s *singleFrameStream) Next(ctx context.Context) (image.Image, func(), error) {
+	return s.frame, func() {}, nil
+}
+
+func (s *singleFrameStream) Close(ctx context.Context) error {
+	return nil
+}
+
+func TestStreamFallback(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	ctx := context.Background()
+
+	cam := &streamOnlyCamera{Camera: inject.NewCamera("legacy"), frame: image.NewRGBA(image.Rect(0, 0, 8, 6))}
+	cam.ImagesFunc = func(ctx context.Context, filterSourceNames []string, extra map[string]interface{}) ([]camera.NamedImage, resource.ResponseMetadata, error) {
+		return nil, resource.ResponseMetadata{}, errors.New("Images unimplemented")
+	}
+
+	visionSvc := inject.NewVisionService("classifier")
+	visionSvc.ClassificationsFunc = func(ctx context.Context, img *camera.NamedImage, n int, extra map[string]interface{}) (classification.Classifications, error) {
+		return classification.Classifications{classification.NewClassification(0.9, "person")}, nil
+	}
+
+	fc := &filteredCamera{
+		conf:                    &Config{WindowSecondsBefore: 2, WindowSecondsAfter: 2, ImageFrequency: 1.0},
+		logger:                  logger,
+		cam:                     cam,
+		otherVisionServices:     []vision.Service{visionSvc},
+		acceptedClassifications: map[string]map[string]float64{"classifier": {"person": 0.8}},
+		buf:                     imagebuffer.NewImageBuffer(0, 1.0, 2, 2, logger, true, 0),
+	}
+	fc.detectImagesSupport(ctx)
+	test.That(t, fc.streamFallback, test.ShouldBeTrue)
+
+	// the background worker buffers frames read from the stream
+	fc.captureImageInBackground(ctx)
+	test.That(t, fc.buf.GetRingBufferLength(), test.ShouldEqual, 1)
+
+	// and filtering works on them too
+	imgs, _, err := fc.Images(ctx, nil, map[string]interface{}{data.FromDMString: true})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, len(imgs), test.ShouldEqual, 1)
+	frame, err := imgs[0].Image(ctx)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, frame.Bounds(), test.ShouldResemble, image.Rect(0, 0, 8, 6))
+
+	// cameras that support Images are used directly
+	modernCam := inject.NewCamera("modern")
+	modernCam.ImagesFunc = func(ctx context.Context, filterSourceNames []string, extra map[string]interface{}) ([]camera.NamedImage, resource.ResponseMetadata, error) {
+		return nil, resource.ResponseMetadata{}, nil
+	}
+	fc.cam = modernCam
+	fc.streamFallback = false
+	fc.detectImagesSupport(ctx)
+	test.That(t, fc.streamFallback, test.ShouldBeFalse)
 }
 
 func TestValidate(t *testing.T) {
 	conf := &Config{
-		Classifications: map[string]float64{"a": .8},
-		Objects:         map[string]float64{"b": .8},
+		Classifications: map[string]Threshold{"a": {Min: .8}},
+		Objects:         map[string]Threshold{"b": {Min: .8}},
 		WindowSeconds:   10,
 		ImageFrequency:  1.0,
 	}
@@ -303,11 +1931,11 @@ func TestValidate(t *testing.T) {
 	conf.VisionServices = []VisionServiceConfig{
 		{
 			Vision:          "foo",
-			Classifications: map[string]float64{"a": .8},
+			Classifications: map[string]Threshold{"a": {Min: .8}},
 		},
 		{
 			Vision:  "bar",
-			Objects: map[string]float64{"b": .8},
+			Objects: map[string]Threshold{"b": {Min: .8}},
 		},
 	}
 	res, _, err = conf.Validate(".")
@@ -327,8 +1955,8 @@ func TestValidate(t *testing.T) {
 	conf.VisionServices = []VisionServiceConfig{
 		{
 			Vision:          "foo",
-			Classifications: map[string]float64{"a": .8},
-			Objects:         map[string]float64{"a": .8},
+			Classifications: map[string]Threshold{"a": {Min: .8}},
+			Objects:         map[string]Threshold{"a": {Min: .8}},
 		},
 	}
 	res, _, err = conf.Validate(".")
@@ -368,6 +1996,22 @@ func TestValidate(t *testing.T) {
 	test.That(t, err, test.ShouldBeNil)
 	test.That(t, res, test.ShouldResemble, []string{"foo", "baz", "foo", "bar"})
 
+	// a vision service can be both an inhibitor and an accepting service, with a warning unless allow_dual_role is set
+	conf.VisionServices = []VisionServiceConfig{
+		{Vision: "foo", Classifications: map[string]Threshold{"person": {Min: .8}}},
+		{Vision: "foo", Inhibit: true, Classifications: map[string]Threshold{"cat": {Min: .8}}},
+		{Vision: "bar", Inhibit: true},
+	}
+	res, _, err = conf.Validate(".")
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res, test.ShouldResemble, []string{"foo", "foo", "bar", "foo"})
+	test.That(t, dualRoleServices([]string{"foo", "bar"}, []string{"foo"}), test.ShouldResemble, []string{"foo"})
+	test.That(t, dualRoleServices([]string{"bar"}, []string{"foo"}), test.ShouldBeNil)
+	conf.AllowDualRole = true
+	_, _, err = conf.Validate(".")
+	test.That(t, err, test.ShouldBeNil)
+	conf.AllowDualRole = false
+
 	// if WindowSeconds is set, WindowSecondsBefore and WindowSecondsAfter should be 0
 	conf.WindowSeconds = 15
 	conf.WindowSecondsAfter = 10
@@ -393,6 +2037,27 @@ func TestValidate(t *testing.T) {
 	test.That(t, res, test.ShouldBeNil)
 	test.That(t, err, test.ShouldNotBeNil)
 	test.That(t, err.Error(), test.ShouldContainSubstring, "one of window_seconds, window_seconds_after, or window_seconds_before can be negative")
+
+	// out of range thresholds report the path of the offending vision service and label
+	conf.WindowSeconds = 10
+	conf.WindowSecondsAfter = 0
+	conf.WindowSecondsBefore = 0
+	conf.VisionServices = []VisionServiceConfig{
+		{Vision: "foo", Classifications: map[string]Threshold{"a": {Min: .8}}},
+		{Vision: "bar", Objects: map[string]Threshold{"b": {Min: .8}}},
+		{Vision: "baz", Objects: map[string]Threshold{"car": {Min: .5}, "person": {Min: 1.5}}},
+	}
+	res, _, err = conf.Validate("camera")
+	test.That(t, res, test.ShouldBeNil)
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, err.Error(), test.ShouldContainSubstring, "camera.vision_services.2.objects.person")
+	test.That(t, err.Error(), test.ShouldContainSubstring, "must be between 0 and 1")
+
+	conf.VisionServices[2].Objects["person"] = Threshold{Min: .9}
+	conf.VisionServices[0].Classifications["a"] = Threshold{Min: -.1}
+	_, _, err = conf.Validate("camera")
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, err.Error(), test.ShouldContainSubstring, "camera.vision_services.0.classifications.a")
 }
 
 func TestImages(t *testing.T) {
@@ -407,8 +2072,8 @@ func TestImages(t *testing.T) {
 
 	fc := &filteredCamera{
 		conf: &Config{
-			Classifications: map[string]float64{"a": .8},
-			Objects:         map[string]float64{"b": .8},
+			Classifications: map[string]Threshold{"a": {Min: .8}},
+			Objects:         map[string]Threshold{"b": {Min: .8}},
 			WindowSeconds:   10,
 			ImageFrequency:  1.0,
 		},
@@ -441,8 +2106,8 @@ func TestImageWithBufferedImages(t *testing.T) {
 
 	fc := &filteredCamera{
 		conf: &Config{
-			Classifications: map[string]float64{"a": .8},
-			Objects:         map[string]float64{"b": .8},
+			Classifications: map[string]Threshold{"a": {Min: .8}},
+			Objects:         map[string]Threshold{"b": {Min: .8}},
 			WindowSeconds:   10,
 			ImageFrequency:  1.0,
 		},
@@ -475,8 +2140,8 @@ func TestImagesWithBufferedImages(t *testing.T) {
 
 	fc := &filteredCamera{
 		conf: &Config{
-			Classifications: map[string]float64{"a": .8},
-			Objects:         map[string]float64{"b": .8},
+			Classifications: map[string]Threshold{"a": {Min: .8}},
+			Objects:         map[string]Threshold{"b": {Min: .8}},
 			WindowSeconds:   10,
 			ImageFrequency:  1.0,
 		},
@@ -540,6 +2205,109 @@ func TestImagesWithBufferedImages(t *testing.T) {
 	test.That(t, meta, test.ShouldNotBeNil)
 }
 
+func TestAnnotateTriggerReason(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+
+	fc := &filteredCamera{
+		conf: &Config{
+			Classifications:       map[string]Threshold{"a": {Min: .8}},
+			WindowSeconds:         10,
+			ImageFrequency:        1.0,
+			AnnotateTriggerReason: true,
+		},
+		logger:              logger,
+		otherVisionServices: []vision.Service{getDummyVisionService()},
+		buf:                 imagebuffer.NewImageBuffer(10, 1.0, 0, 0, logger, false, 0),
+		cam: &inject.Camera{
+			ImagesFunc: func(ctx context.Context, filterSourceNames []string, extra map[string]interface{}) ([]camera.NamedImage, resource.ResponseMetadata, error) {
+				img, _ := camera.NamedImageFromImage(a, "trigger_img", "image/jpeg", data.Annotations{})
+				return []camera.NamedImage{img}, resource.ResponseMetadata{CapturedAt: time.Now()}, nil
+			},
+		},
+		acceptedClassifications: map[string]map[string]float64{"": {"a": .8}},
+		acceptedObjects:         map[string]map[string]float64{},
+	}
+	fc.buf.SetAnnotateReason(fc.conf.AnnotateTriggerReason)
+	buffered, _ := camera.NamedImageFromImage(b, "buffered_img", "image/jpeg", data.Annotations{})
+	fc.buf.AddToRingBuffer([]camera.NamedImage{buffered}, resource.ResponseMetadata{CapturedAt: time.Now().Add(-time.Second)})
+
+	res, _, err := fc.Images(context.Background(), nil, map[string]interface{}{data.FromDMString: true})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, len(res), test.ShouldEqual, 2)
+	// the buffered frame and the trigger frame both carry the label and score that caused the capture
+	for _, img := range res {
+		reason := img.Annotations.Classifications[len(img.Annotations.Classifications)-1]
+		test.That(t, reason.Label, test.ShouldEqual, imagebuffer.TriggerReasonLabelPrefix+"a")
+		test.That(t, *reason.Confidence, test.ShouldAlmostEqual, 0.9)
+	}
+}
+
+func TestReconfigure(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	ctx := context.Background()
+
+	imagesCam := inject.NewCamera("test_camera")
+	imagesCam.ImagesFunc = func(ctx context.Context, filterSourceNames []string, extra map[string]interface{}) (
+		[]camera.NamedImage, resource.ResponseMetadata, error) {
+		return []camera.NamedImage{namedA}, resource.ResponseMetadata{CapturedAt: time.Now()}, nil
+	}
+	deps := resource.Dependencies{
+		camera.Named("test_camera"): imagesCam,
+		vision.Named("vs"):          getDummyVisionService(),
+	}
+	conf := &Config{
+		Camera:         "test_camera",
+		VisionServices: []VisionServiceConfig{{Vision: "vs", Classifications: map[string]Threshold{"a": {Min: .8}}}},
+		WindowSeconds:  10,
+		ImageFrequency: 0.2,
+	}
+	resourceConf := func(conf *Config) resource.Config {
+		return resource.Config{Name: "fc", API: camera.API, Model: Model, ConvertedAttributes: conf}
+	}
+
+	fc := &filteredCamera{Named: camera.Named("fc").AsNamed(), logger: logger}
+	test.That(t, fc.Reconfigure(ctx, deps, resourceConf(conf)), test.ShouldBeNil)
+	defer fc.Close(ctx)
+	buf := fc.buf
+	fc.frameIntervals = []time.Duration{time.Second}
+	for i := 0; i < 3; i++ {
+		fc.buf.AddToRingBuffer([]camera.NamedImage{namedA}, resource.ResponseMetadata{CapturedAt: time.Now()})
+	}
+	fc.acceptedStats.Update("vs")
+
+	// new thresholds apply in place, keeping the buffered frames and the stats
+	tuned := *conf
+	tuned.VisionServices = []VisionServiceConfig{{Vision: "vs", Classifications: map[string]Threshold{"a": {Min: .95}}}}
+	test.That(t, fc.Reconfigure(ctx, deps, resourceConf(&tuned)), test.ShouldBeNil)
+	test.That(t, fc.acceptedClassifications["vs"]["a"], test.ShouldEqual, .95)
+	test.That(t, fc.buf, test.ShouldEqual, buf)
+	test.That(t, fc.frameIntervals, test.ShouldHaveLength, 1)
+	test.That(t, fc.buf.GetRingBufferLength(), test.ShouldEqual, 3)
+	test.That(t, fc.acceptedStats.Total, test.ShouldEqual, 1)
+
+	// a new window resizes the buffer without dropping what it holds
+	tuned.WindowSeconds = 20
+	test.That(t, fc.Reconfigure(ctx, deps, resourceConf(&tuned)), test.ShouldBeNil)
+	test.That(t, fc.buf.Status().WindowSecondsAfter, test.ShouldEqual, 20)
+	test.That(t, fc.buf.Status().MaxImages, test.ShouldEqual, 12)
+	test.That(t, fc.buf.GetRingBufferLength(), test.ShouldEqual, 3)
+	test.That(t, fc.frameIntervals, test.ShouldHaveLength, 1)
+
+	// a new frequency starts over observing the frame rate
+	tuned.ImageFrequency = 0.1
+	test.That(t, fc.Reconfigure(ctx, deps, resourceConf(&tuned)), test.ShouldBeNil)
+	test.That(t, fc.frameIntervals, test.ShouldBeEmpty)
+	test.That(t, fc.buf.Status().MaxImages, test.ShouldEqual, 6)
+	test.That(t, fc.buf.GetRingBufferLength(), test.ShouldEqual, 3)
+
+	// a config that can't be applied leaves the running one in place
+	broken := tuned
+	broken.VisionServices = []VisionServiceConfig{{Vision: "missing", Classifications: map[string]Threshold{"a": {Min: .5}}}}
+	test.That(t, fc.Reconfigure(ctx, deps, resourceConf(&broken)), test.ShouldNotBeNil)
+	test.That(t, fc.conf, test.ShouldEqual, &tuned)
+	test.That(t, fc.acceptedClassifications["vs"]["a"], test.ShouldEqual, .95)
+}
+
 func TestProperties(t *testing.T) {
 	logger := logging.NewTestLogger(t)
 
@@ -551,8 +2319,8 @@ func TestProperties(t *testing.T) {
 
 	fc := &filteredCamera{
 		conf: &Config{
-			Classifications: map[string]float64{"a": .8},
-			Objects:         map[string]float64{"b": .8},
+			Classifications: map[string]Threshold{"a": {Min: .8}},
+			Objects:         map[string]Threshold{"b": {Min: .8}},
 			WindowSeconds:   10,
 			ImageFrequency:  1.0,
 		},
@@ -575,11 +2343,79 @@ func TestProperties(t *testing.T) {
 	test.That(t, res, test.ShouldResemble, properties)
 }
 
+func TestPropertiesIntrinsics(t *testing.T) {
+	intrinsics := &transform.PinholeCameraIntrinsics{Width: 640, Height: 480, Fx: 500, Fy: 505, Ppx: 320, Ppy: 240}
+	distortion := &transform.BrownConrady{RadialK1: 0.1, RadialK2: -0.05, TangentialP1: 0.001}
+	fc := &filteredCamera{
+		conf:   &Config{},
+		logger: logging.NewTestLogger(t),
+		cam: &inject.Camera{
+			PropertiesFunc: func(ctx context.Context) (camera.Properties, error) {
+				return camera.Properties{
+					SupportsPCD:      true,
+					ImageType:        camera.ColorStream,
+					IntrinsicParams:  intrinsics,
+					DistortionParams: distortion,
+					MimeTypes:        []string{utils.MimeTypeJPEG},
+				}, nil
+			},
+		},
+	}
+
+	// projection parameters and point cloud support pass through untouched
+	res, err := fc.Properties(context.Background())
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res.SupportsPCD, test.ShouldBeTrue)
+	test.That(t, res.IntrinsicParams, test.ShouldResemble, intrinsics)
+	test.That(t, res.DistortionParams, test.ShouldResemble, distortion)
+	test.That(t, res.MimeTypes, test.ShouldResemble, []string{utils.MimeTypeJPEG})
+}
+
+func TestNextPointCloud(t *testing.T) {
+	ctx := context.Background()
+	supportsPCD := false
+	var propsErr error
+	pc := pointcloud.NewBasicEmpty()
+	fc := &filteredCamera{
+		conf:   &Config{},
+		logger: logging.NewTestLogger(t),
+		cam: &inject.Camera{
+			PropertiesFunc: func(ctx context.Context) (camera.Properties, error) {
+				return camera.Properties{SupportsPCD: supportsPCD}, propsErr
+			},
+			NextPointCloudFunc: func(ctx context.Context, extra map[string]interface{}) (pointcloud.PointCloud, error) {
+				return pc, nil
+			},
+		},
+	}
+
+	_, err := fc.NextPointCloud(ctx, nil)
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, err.Error(), test.ShouldContainSubstring, "doesn't support pointclouds")
+
+	// a failure to get the properties is passed on rather than reported as missing support
+	propsErr = errors.New("camera offline")
+	_, err = fc.NextPointCloud(ctx, nil)
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, errors.Is(err, propsErr), test.ShouldBeTrue)
+	test.That(t, err.Error(), test.ShouldNotContainSubstring, "doesn't support pointclouds")
+	propsErr = nil
+
+	// point clouds pass through from a camera that supports them
+	supportsPCD = true
+	res, err := fc.NextPointCloud(ctx, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res, test.ShouldEqual, pc)
+	props, err := fc.Properties(ctx)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, props.SupportsPCD, test.ShouldBeTrue)
+}
+
 func TestDoCommand(t *testing.T) {
 	fc := &filteredCamera{
 		conf: &Config{
-			Classifications: map[string]float64{"a": .8},
-			Objects:         map[string]float64{"b": .8},
+			Classifications: map[string]Threshold{"a": {Min: .8}},
+			Objects:         map[string]Threshold{"b": {Min: .8}},
 			WindowSeconds:   10,
 			ImageFrequency:  1.0,
 		},
@@ -611,8 +2447,8 @@ func TestDoCommand(t *testing.T) {
 	test.That(t, rejectedStats["total"], test.ShouldEqual, 0)
 	test.That(t, rejectedStats["vision"], test.ShouldBeNil)
 
-	fc.acceptedStats = imageStats{total: 1, breakdown: map[string]int{"foo": 1}}
-	fc.rejectedStats = imageStats{total: 2, breakdown: map[string]int{"bar": 2}}
+	fc.acceptedStats = imagestats.Stats{Total: 1, Breakdown: map[string]int{"foo": 1}}
+	fc.rejectedStats = imagestats.Stats{Total: 2, Breakdown: map[string]int{"bar": 2}}
 	res, err = fc.DoCommand(ctx, nil)
 	test.That(t, err, test.ShouldBeNil)
 	test.That(t, res, test.ShouldNotBeNil)
@@ -630,6 +2466,88 @@ func TestDoCommand(t *testing.T) {
 	test.That(t, visionBreakdown, test.ShouldResemble, map[string]int{"bar": 2})
 }
 
+func TestDoCommandLatestFrame(t *testing.T) {
+	fc := &filteredCamera{
+		conf: &Config{WindowSeconds: 10, ImageFrequency: 1.0},
+		buf:  imagebuffer.NewImageBuffer(10, 1.0, 0, 0, logging.NewTestLogger(t), true, 0),
+	}
+	ctx := context.Background()
+
+	// errors when nothing has been captured yet
+	_, err := fc.DoCommand(ctx, map[string]interface{}{"cmd": "latest_frame"})
+	test.That(t, err, test.ShouldNotBeNil)
+
+	baseTime := time.Now()
+	for i := 0; i < 3; i++ {
+		img, err := camera.NamedImageFromBytes([]byte(fmt.Sprintf("frame_%d", i)), "color", utils.MimeTypeJPEG, data.Annotations{})
+		test.That(t, err, test.ShouldBeNil)
+		fc.buf.StoreImages([]camera.NamedImage{img}, resource.ResponseMetadata{CapturedAt: baseTime.Add(time.Duration(i) * time.Second)},
+			baseTime.Add(time.Duration(i)*time.Second))
+	}
+
+	res, err := fc.DoCommand(ctx, map[string]interface{}{"cmd": "latest_frame"})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res["captured_at"], test.ShouldEqual, baseTime.Add(2*time.Second).Format(time.RFC3339Nano))
+	images := res["images"].([]interface{})
+	test.That(t, len(images), test.ShouldEqual, 1)
+	latest := images[0].(map[string]interface{})
+	test.That(t, latest["source_name"], test.ShouldEqual, "color")
+	test.That(t, latest["mime_type"], test.ShouldEqual, utils.MimeTypeJPEG)
+	test.That(t, latest["image"], test.ShouldEqual, base64.StdEncoding.EncodeToString([]byte("frame_2")))
+}
+
+func TestLiveFromBuffer(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	ctx := context.Background()
+	baseTime := time.Now()
+
+	calls := 0
+	imagesCam := inject.NewCamera("test_camera")
+	imagesCam.ImagesFunc = func(ctx context.Context, filterSourceNames []string, extra map[string]interface{}) (
+		[]camera.NamedImage, resource.ResponseMetadata, error) {
+		calls++
+		color, _ := camera.NamedImageFromImage(image.NewRGBA(image.Rect(0, 0, 10, 10)), "color", "image/jpeg", data.Annotations{})
+		depth, _ := camera.NamedImageFromImage(image.NewGray(image.Rect(0, 0, 10, 10)), "depth", "image/jpeg", data.Annotations{})
+		return []camera.NamedImage{color, depth}, resource.ResponseMetadata{CapturedAt: baseTime.Add(time.Duration(calls) * time.Second)}, nil
+	}
+	fc := &filteredCamera{
+		conf:   &Config{WindowSeconds: 10, ImageFrequency: 1.0, LiveFromBuffer: true},
+		logger: logger,
+		cam:    imagesCam,
+		buf:    imagebuffer.NewImageBuffer(10, 1.0, 0, 0, logger, false, 0),
+	}
+
+	// with nothing captured yet the underlying camera is used
+	imgs, meta, err := fc.Images(ctx, nil, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, calls, test.ShouldEqual, 1)
+	test.That(t, len(imgs), test.ShouldEqual, 2)
+	test.That(t, meta.CapturedAt.Equal(baseTime.Add(time.Second)), test.ShouldBeTrue)
+
+	// once the background worker has captured a frame, it is returned without calling the camera again
+	fc.captureImageInBackground(ctx)
+	test.That(t, calls, test.ShouldEqual, 2)
+	for i := 0; i < 3; i++ {
+		imgs, meta, err = fc.Images(ctx, nil, nil)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, len(imgs), test.ShouldEqual, 2)
+		test.That(t, meta.CapturedAt.Equal(baseTime.Add(2*time.Second)), test.ShouldBeTrue)
+	}
+	test.That(t, calls, test.ShouldEqual, 2)
+
+	// source filters are applied to the cached frame
+	imgs, _, err = fc.Images(ctx, []string{"depth"}, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, len(imgs), test.ShouldEqual, 1)
+	test.That(t, imgs[0].SourceName, test.ShouldEqual, "depth")
+	test.That(t, calls, test.ShouldEqual, 2)
+
+	// data management requests still go to the camera
+	_, _, err = fc.Images(ctx, nil, map[string]interface{}{data.FromDMString: true})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, calls, test.ShouldEqual, 3)
+}
+
 func TestRingBufferTriggerWindows(t *testing.T) {
 	// This test verifies that the ring buffer correctly captures images within trigger windows
 	// It simulates image capture at 1 Hz with 2-second windows around triggers
@@ -656,8 +2574,8 @@ func TestRingBufferTriggerWindows(t *testing.T) {
 
 	fc := &filteredCamera{
 		conf: &Config{
-			Classifications: map[string]float64{"a": .8},
-			Objects:         map[string]float64{"b": .8},
+			Classifications: map[string]Threshold{"a": {Min: .8}},
+			Objects:         map[string]Threshold{"b": {Min: .8}},
 			WindowSeconds:   2,
 			ImageFrequency:  1.0, // 1 Hz
 		},
@@ -775,7 +2693,7 @@ func TestBatchingWithFrequencyMismatch(t *testing.T) {
 
 	fc := &filteredCamera{
 		conf: &Config{
-			Classifications:     map[string]float64{"person": 0.8},
+			Classifications:     map[string]Threshold{"person": {Min: 0.8}},
 			WindowSecondsBefore: 3,   // 3 seconds before trigger
 			WindowSecondsAfter:  2,   // 2 seconds after trigger
 			ImageFrequency:      1.0, // 1 Hz for buffer size calculation
@@ -934,7 +2852,7 @@ func TestOverlappingTriggerWindows(t *testing.T) {
 
 	fc := &filteredCamera{
 		conf: &Config{
-			Classifications:     map[string]float64{"person": 0.8},
+			Classifications:     map[string]Threshold{"person": {Min: 0.8}},
 			WindowSecondsBefore: 10, // Long before window
 			WindowSecondsAfter:  2,  // Short after window
 			ImageFrequency:      1.0,
@@ -1077,7 +2995,7 @@ func TestCurrentImageTimestampingInCaptureWindow(t *testing.T) {
 
 	fc := &filteredCamera{
 		conf: &Config{
-			Classifications:     map[string]float64{"person": 0.8},
+			Classifications:     map[string]Threshold{"person": {Min: 0.8}},
 			WindowSecondsBefore: 2,   // 2 seconds before trigger
 			WindowSecondsAfter:  3,   // 3 seconds after trigger
 			ImageFrequency:      1.0, // 1 Hz
@@ -1161,8 +3079,8 @@ func TestMultipleTriggerWindows(t *testing.T) {
 
 	fc := &filteredCamera{
 		conf: &Config{
-			Classifications: map[string]float64{"a": .8},
-			Objects:         map[string]float64{"b": .8},
+			Classifications: map[string]Threshold{"a": {Min: .8}},
+			Objects:         map[string]Threshold{"b": {Min: .8}},
 			WindowSeconds:   2,
 			ImageFrequency:  1.0, // 1 Hz
 		},
@@ -1251,7 +3169,7 @@ func TestNoDuplicateImagesAcrossGetImagesCalls(t *testing.T) {
 
 	fc := &filteredCamera{
 		conf: &Config{
-			Classifications:     map[string]float64{"person": 0.8},
+			Classifications:     map[string]Threshold{"person": {Min: 0.8}},
 			WindowSecondsBefore: 15, // 15 seconds before
 			WindowSecondsAfter:  2,  // 2 seconds after
 			ImageFrequency:      1.0,
@@ -1376,7 +3294,7 @@ func TestCooldownSuppressesNewTrigger(t *testing.T) {
 
 	fc := &filteredCamera{
 		conf: &Config{
-			Classifications:     map[string]float64{"person": 0.8},
+			Classifications:     map[string]Threshold{"person": {Min: 0.8}},
 			WindowSecondsBefore: 2,
 			WindowSecondsAfter:  2,
 			CooldownSecs:        10,
@@ -1446,7 +3364,7 @@ func TestCooldownAllowsTriggerAfterExpiry(t *testing.T) {
 
 	fc := &filteredCamera{
 		conf: &Config{
-			Classifications:     map[string]float64{"person": 0.8},
+			Classifications:     map[string]Threshold{"person": {Min: 0.8}},
 			WindowSecondsBefore: 2,
 			WindowSecondsAfter:  2,
 			CooldownSecs:        5,
@@ -1490,3 +3408,60 @@ func TestCooldownAllowsTriggerAfterExpiry(t *testing.T) {
 	test.That(t, err2, test.ShouldBeNil)
 	test.That(t, len(images2), test.ShouldBeGreaterThan, 0)
 }
+
+func TestCooldownStats(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	ctx := context.Background()
+
+	imagesCam := inject.NewCamera("test_camera")
+	imagesCam.ImagesFunc = func(ctx context.Context, filterSourceNames []string, extra map[string]interface{}) (
+		[]camera.NamedImage, resource.ResponseMetadata, error) {
+		img, _ := camera.NamedImageFromImage(image.NewRGBA(image.Rect(0, 0, 10, 10)), "color", "image/jpeg", data.Annotations{})
+		return []camera.NamedImage{img}, resource.ResponseMetadata{CapturedAt: time.Now()}, nil
+	}
+
+	score := 0.9
+	visionSvc := inject.NewVisionService("test_vision")
+	visionSvc.ClassificationsFunc = func(ctx context.Context, img *camera.NamedImage, n int, extra map[string]interface{}) (classification.Classifications, error) {
+		return classification.Classifications{
+			classification.NewClassification(score, "person"),
+		}, nil
+	}
+
+	fc := &filteredCamera{
+		conf: &Config{
+			Classifications:     map[string]Threshold{"person": {Min: 0.8}},
+			WindowSecondsBefore: 2,
+			WindowSecondsAfter:  2,
+			CooldownSecs:        30,
+			ImageFrequency:      1.0,
+		},
+		logger:                   logger,
+		cam:                      imagesCam,
+		otherVisionServices:      []vision.Service{visionSvc},
+		acceptedClassifications:  map[string]map[string]float64{"test_vision": {"person": 0.8}},
+		acceptedObjects:          map[string]map[string]float64{},
+		inhibitedClassifications: map[string]map[string]float64{},
+		inhibitedObjects:         map[string]map[string]float64{},
+		inhibitors:               []vision.Service{},
+	}
+	fc.buf = imagebuffer.NewImageBuffer(0, fc.conf.ImageFrequency, fc.conf.WindowSecondsBefore, fc.conf.WindowSecondsAfter, logger, false, fc.conf.CooldownSecs)
+
+	fc.captureImageInBackground(ctx)
+	_, _, err := fc.Images(ctx, nil, map[string]interface{}{data.FromDMString: true})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, fc.acceptedStats.Total, test.ShouldEqual, 1)
+
+	// end the window early; the cooldown still runs from the original window end
+	fc.buf.ClearToSend()
+	fc.buf.SetCaptureTill(time.Now().Add(-time.Second))
+
+	// only the frames that would have triggered count as suppressed by the cooldown
+	for _, s := range []float64{0.9, 0.5, 0.9} {
+		score = s
+		_, _, err = fc.Images(ctx, nil, map[string]interface{}{data.FromDMString: true})
+		test.That(t, err, test.ShouldEqual, data.ErrNoCaptureToStore)
+	}
+	test.That(t, fc.acceptedStats.Total, test.ShouldEqual, 1)
+	test.That(t, fc.rejectedStats.Breakdown, test.ShouldResemble, map[string]int{"cooldown": 2, "no vision services triggered": 1})
+}
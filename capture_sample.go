@@ -0,0 +1,24 @@
+package filtered_camera
+
+import "math/rand/v2"
+
+// sampledOutRejection is the rejected stats label of triggering frames dropped by capture_sample_rate
+const sampledOutRejection = "sampled out"
+
+// sampleVerdict applies capture_sample_rate to a verdict: a frame that triggers is only kept with that probability,
+// and one that isn't is rejected under sampledOutRejection instead. It is decided before the verdict is counted, so
+// that a sampled out frame never shows up in the accepted stats.
+func (fc *filteredCamera) sampleVerdict(v verdict) verdict {
+	rate := fc.conf.CaptureSampleRate
+	if !v.send || rate <= 0 || rate >= 1 {
+		return v
+	}
+	sample := rand.Float64
+	if fc.captureSampler != nil {
+		sample = fc.captureSampler
+	}
+	if sample() < rate {
+		return v
+	}
+	return rejectedVerdict(sampledOutRejection)
+}
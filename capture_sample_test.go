@@ -0,0 +1,63 @@
+package filtered_camera
+
+import (
+	"context"
+	"image"
+	"math/rand/v2"
+	"testing"
+	"time"
+
+	"go.viam.com/rdk/components/camera"
+	"go.viam.com/rdk/data"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/services/vision"
+	"go.viam.com/rdk/testutils/inject"
+	"go.viam.com/rdk/vision/classification"
+	"go.viam.com/test"
+)
+
+func TestCaptureSampleRate(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	ctx := context.Background()
+
+	visionSvc := inject.NewVisionService("classifier")
+	visionSvc.ClassificationsFunc = func(ctx context.Context, img *camera.NamedImage, n int, extra map[string]interface{}) (classification.Classifications, error) {
+		return classification.Classifications{classification.NewClassification(0.9, "person")}, nil
+	}
+	img, err := camera.NamedImageFromImage(image.NewRGBA(image.Rect(0, 0, 10, 10)), "color", "image/jpeg", data.Annotations{})
+	test.That(t, err, test.ShouldBeNil)
+
+	for _, rate := range []float64{0, 0.3, 1} {
+		fc := &filteredCamera{
+			conf:                    &Config{CaptureSampleRate: rate},
+			logger:                  logger,
+			otherVisionServices:     []vision.Service{visionSvc},
+			acceptedClassifications: map[string]map[string]float64{"classifier": {"person": 0.8}},
+			captureSampler:          rand.New(rand.NewPCG(1, 2)).Float64,
+		}
+
+		const attempts = 1000
+		kept := 0
+		for i := 0; i < attempts; i++ {
+			send, _, err := fc.shouldSend(ctx, img, time.Now())
+			test.That(t, err, test.ShouldBeNil)
+			if send {
+				kept++
+			}
+		}
+		want := rate
+		if rate == 0 {
+			want = 1
+		}
+		test.That(t, float64(kept)/attempts, test.ShouldAlmostEqual, want, 0.05)
+		// frames dropped by sampling are counted as rejected rather than accepted
+		test.That(t, fc.acceptedStats.Total, test.ShouldEqual, kept)
+		test.That(t, fc.acceptedStats.Breakdown["person"], test.ShouldEqual, kept)
+		test.That(t, fc.rejectedStats.Total, test.ShouldEqual, attempts-kept)
+		test.That(t, fc.rejectedStats.Breakdown[sampledOutRejection], test.ShouldEqual, attempts-kept)
+	}
+
+	cfg := &Config{Camera: "cam", VisionServices: []VisionServiceConfig{{Vision: "vs"}}, WindowSeconds: 10, CaptureSampleRate: 1.5}
+	_, _, err = cfg.Validate("path")
+	test.That(t, err, test.ShouldNotBeNil)
+}
@@ -2,6 +2,7 @@ package filtered_camera
 
 import (
 	"context"
+	"fmt"
 
 	"go.viam.com/rdk/data"
 	"go.viam.com/rdk/resource"
@@ -9,10 +10,48 @@ import (
 
 var Family = resource.ModelNamespace("viam").WithFamily("camera")
 
+// fromDataMgmtKey is the context key set by WithFromDataMgmt.
+type fromDataMgmtKey struct{}
+
+// WithFromDataMgmt marks requests made with the returned context as coming from data management, for capture
+// integrations that can't set data.FromDMString in extra.
+func WithFromDataMgmt(ctx context.Context) context.Context {
+	return context.WithValue(ctx, fromDataMgmtKey{}, true)
+}
+
 func IsFromDataMgmt(ctx context.Context, extra map[string]interface{}) bool {
 	if extra != nil && extra[data.FromDMString] == true {
 		return true
 	}
 
+	if fromDM, ok := ctx.Value(fromDataMgmtKey{}).(bool); ok && fromDM {
+		return true
+	}
+
 	return false
 }
+
+// IsFromDataMgmtWithKey is IsFromDataMgmt that also accepts requests whose extra sets a custom key to true.
+func IsFromDataMgmtWithKey(ctx context.Context, extra map[string]interface{}, key string) bool {
+	if key != "" && extra != nil && extra[key] == true {
+		return true
+	}
+	return IsFromDataMgmt(ctx, extra)
+}
+
+// CommandName returns the command a DoCommand request names under the "command" key, or the "cmd" key it is also
+// accepted under, or "" if it names none.
+func CommandName(cmd map[string]interface{}) (string, error) {
+	for _, key := range []string{"command", "cmd"} {
+		raw, ok := cmd[key]
+		if !ok {
+			continue
+		}
+		name, ok := raw.(string)
+		if !ok {
+			return "", fmt.Errorf("%q must be a string, got %T", key, raw)
+		}
+		return name, nil
+	}
+	return "", nil
+}
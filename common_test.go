@@ -39,4 +39,34 @@ func TestIsFromDataMgmt(t *testing.T) {
 		result := IsFromDataMgmt(ctx, extra)
 		test.That(t, result, test.ShouldBeFalse)
 	})
+
+	t.Run("context marked as from data management", func(t *testing.T) {
+		ctx := WithFromDataMgmt(context.Background())
+		result := IsFromDataMgmt(ctx, nil)
+		test.That(t, result, test.ShouldBeTrue)
+	})
+}
+
+func TestIsFromDataMgmtWithKey(t *testing.T) {
+	t.Run("custom key true", func(t *testing.T) {
+		extra := map[string]interface{}{"from_my_capture": true}
+		test.That(t, IsFromDataMgmtWithKey(context.Background(), extra, "from_my_capture"), test.ShouldBeTrue)
+		// the custom key means nothing without the config
+		test.That(t, IsFromDataMgmt(context.Background(), extra), test.ShouldBeFalse)
+	})
+
+	t.Run("custom key false", func(t *testing.T) {
+		extra := map[string]interface{}{"from_my_capture": false}
+		test.That(t, IsFromDataMgmtWithKey(context.Background(), extra, "from_my_capture"), test.ShouldBeFalse)
+	})
+
+	t.Run("standard key still works", func(t *testing.T) {
+		extra := map[string]interface{}{data.FromDMString: true}
+		test.That(t, IsFromDataMgmtWithKey(context.Background(), extra, "from_my_capture"), test.ShouldBeTrue)
+	})
+
+	t.Run("empty key", func(t *testing.T) {
+		extra := map[string]interface{}{"": true}
+		test.That(t, IsFromDataMgmtWithKey(context.Background(), extra, ""), test.ShouldBeFalse)
+	})
 }
@@ -5,6 +5,9 @@ package conditional_camera
 
 import (
 	"context"
+	"encoding/base64"
+	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 	"go.viam.com/rdk/components/camera"
@@ -17,6 +20,7 @@ import (
 	"go.viam.com/utils"
 
 	imagebuffer "github.com/viam-modules/filtered_camera/image_buffer"
+	imagestats "github.com/viam-modules/filtered_camera/image_stats"
 
 	"github.com/viam-modules/filtered_camera"
 )
@@ -26,6 +30,10 @@ var (
 	errUnimplemented = errors.New("unimplemented")
 )
 
+// defaultResultKey is the key of the filter service's DoCommand response that holds whether to capture, unless
+// result_key is set
+const defaultResultKey = "result"
+
 type Config struct {
 	Camera              string  `json:"camera"`
 	FilterSvc           string  `json:"filter_service"`
@@ -35,6 +43,22 @@ type Config struct {
 	WindowSecondsAfter  int     `json:"window_seconds_after"`
 	CooldownSecs        int     `json:"cooldown_s"`
 	Debug               bool    `json:"debug"`
+	// FilterPollIntervalMs is the minimum time between calls to the filter service; in between the last result is reused
+	FilterPollIntervalMs int `json:"filter_poll_interval_ms"`
+	// SkipFailedFilter treats an error from the filter service as "don't capture" instead of failing the request
+	SkipFailedFilter bool `json:"skip_failed_filter"`
+	// ResultKey is the key of the filter service's DoCommand response holding whether to capture, "result" by default
+	ResultKey string `json:"result_key"`
+	// SendImage passes the first image of each batch, base64 encoded, to the filter service's DoCommand
+	SendImage bool `json:"send_image"`
+}
+
+// resultKey returns the key of the filter service's response holding whether to capture.
+func (cfg *Config) resultKey() string {
+	if cfg.ResultKey == "" {
+		return defaultResultKey
+	}
+	return cfg.ResultKey
 }
 
 func (cfg *Config) Validate(path string) ([]string, []string, error) {
@@ -62,6 +86,10 @@ func (cfg *Config) Validate(path string) ([]string, []string, error) {
 		return nil, nil, utils.NewConfigValidationError(path, errors.New("cooldown_s cannot be negative"))
 	}
 
+	if cfg.FilterPollIntervalMs < 0 {
+		return nil, nil, utils.NewConfigValidationError(path, errors.New("filter_poll_interval_ms cannot be negative"))
+	}
+
 	return []string{cfg.Camera, cfg.FilterSvc}, nil, nil
 }
 
@@ -74,6 +102,8 @@ func init() {
 			}
 
 			cc := &conditionalCamera{Named: conf.ResourceName().AsNamed(), conf: newConf, logger: logger}
+			cc.acceptedStats.StartTime = time.Now()
+			cc.rejectedStats.StartTime = time.Now()
 
 			cc.cam, err = camera.FromDependencies(deps, newConf.Camera)
 			if err != nil {
@@ -109,6 +139,17 @@ type conditionalCamera struct {
 	cam     camera.Camera
 	filtSvc resource.Resource
 	buf     *imagebuffer.ImageBuffer
+
+	// pollMu guards lastPoll and lastResult, which cache the filter service's answer between polls. It is held for
+	// the whole poll, so that concurrent Images calls don't poll the service more often than filter_poll_interval_ms
+	pollMu     sync.Mutex
+	lastPoll   time.Time
+	lastResult bool
+
+	// statsMu guards the stats, which DoCommand reads while Images updates them
+	statsMu       sync.Mutex
+	acceptedStats imagestats.Stats
+	rejectedStats imagestats.Stats
 }
 
 func (cc *conditionalCamera) Name() resource.Name {
@@ -116,7 +157,18 @@ func (cc *conditionalCamera) Name() resource.Name {
 }
 
 func (cc *conditionalCamera) DoCommand(ctx context.Context, cmd map[string]interface{}) (map[string]interface{}, error) {
-	return nil, resource.ErrDoUnimplemented
+	name, err := filtered_camera.CommandName(cmd)
+	if err != nil {
+		return nil, err
+	}
+	switch name {
+	case "":
+		return cc.formatStats(), nil
+	case "reset_stats":
+		return cc.resetStats(), nil
+	default:
+		return nil, errors.Errorf("unknown command %q", name)
+	}
 }
 
 func (cc *conditionalCamera) Status(ctx context.Context) (map[string]interface{}, error) {
@@ -124,20 +176,37 @@ func (cc *conditionalCamera) Status(ctx context.Context) (map[string]interface{}
 }
 
 func (cc *conditionalCamera) Images(ctx context.Context, filterSourceNames []string, extra map[string]interface{}) ([]camera.NamedImage, resource.ResponseMetadata, error) {
-	return cc.images(ctx, extra, false) // false indicates multiple images mode
+	images, meta, err := cc.images(ctx, extra, false) // false indicates multiple images mode
+	if err != nil {
+		return images, meta, err
+	}
+	images, err = cc.encodeAs(ctx, images, filtered_camera.RequestedMimeType(extra))
+	return images, meta, err
 }
 
-func (cc *conditionalCamera) getBufferedImages(singleImageMode bool) ([]camera.NamedImage, resource.ResponseMetadata, bool) {
-	if singleImageMode {
-		if x, ok := cc.buf.PopFirstToSend(); ok {
-			return x.Imgs, x.Meta, true
-		}
-	} else {
-		if allImages, batchMeta, ok := cc.buf.PopAllToSend(); ok {
-			return allImages, batchMeta, true
+// encodeAs re-encodes the images that aren't in the mime type requested by the client. Images are returned in
+// the type they were stored in if no type was requested, or if it is one they can't be re-encoded to.
+func (cc *conditionalCamera) encodeAs(ctx context.Context, images []camera.NamedImage, mimeType string) ([]camera.NamedImage, error) {
+	if mimeType == "" {
+		return images, nil
+	}
+	if !filtered_camera.CanTranscode(mimeType) {
+		cc.logger.Debugf("cannot encode images as %q, returning them as stored", mimeType)
+		return images, nil
+	}
+	encoded := make([]camera.NamedImage, 0, len(images))
+	for _, img := range images {
+		img, err := filtered_camera.Transcode(ctx, img, mimeType)
+		if err != nil {
+			return nil, err
 		}
+		encoded = append(encoded, img)
 	}
-	return nil, resource.ResponseMetadata{}, false
+	return encoded, nil
+}
+
+func (cc *conditionalCamera) getBufferedImages(singleImageMode bool) ([]camera.NamedImage, resource.ResponseMetadata, bool) {
+	return cc.buf.PopBatch(singleImageMode)
 }
 
 func (cc *conditionalCamera) images(ctx context.Context, extra map[string]interface{}, singleImageMode bool) ([]camera.NamedImage, resource.ResponseMetadata, error) {
@@ -171,14 +240,19 @@ func (cc *conditionalCamera) images(ctx context.Context, extra map[string]interf
 	// We're outside capture window, add to ring buffer and run filter checks
 	cc.buf.AddToRingBuffer(images, meta)
 
-	for range images {
-		shouldSend, err := cc.shouldSend(ctx)
-		if err != nil {
+	// The filter decides for the whole batch, so it is only evaluated once per call
+	shouldSend, err := cc.shouldSend(ctx, images, meta)
+	if err != nil {
+		if !cc.conf.SkipFailedFilter {
 			return nil, meta, err
 		}
-		if shouldSend {
-			cc.buf.MarkShouldSend(meta.CapturedAt)
-		}
+		// the images stay in the ring buffer, so a trigger once the service recovers still has its pre-roll
+		cc.logger.Warnf("filter service failed, not capturing: %v", err)
+		cc.recordDecision(false, filterFailedLabel)
+		shouldSend = false
+	}
+	if shouldSend {
+		cc.buf.MarkShouldSend(meta.CapturedAt)
 	}
 
 	// Try to get buffered images
@@ -188,12 +262,62 @@ func (cc *conditionalCamera) images(ctx context.Context, extra map[string]interf
 	return nil, meta, data.ErrNoCaptureToStore
 }
 
-func (cc *conditionalCamera) shouldSend(ctx context.Context) (bool, error) {
-	ans, err := cc.filtSvc.DoCommand(ctx, nil)
+// shouldSend asks the filter service whether to capture images, reusing its last answer if it was polled
+// less than filter_poll_interval_ms before they were captured. Each answer, reused or not, is counted in the stats.
+func (cc *conditionalCamera) shouldSend(ctx context.Context, images []camera.NamedImage, meta resource.ResponseMetadata) (bool, error) {
+	cc.pollMu.Lock()
+	defer cc.pollMu.Unlock()
+	now := meta.CapturedAt
+	pollInterval := time.Duration(cc.conf.FilterPollIntervalMs) * time.Millisecond
+	if pollInterval > 0 && !cc.lastPoll.IsZero() && now.Sub(cc.lastPoll) < pollInterval {
+		cc.recordDecision(cc.lastResult, filterServiceLabel)
+		return cc.lastResult, nil
+	}
+
+	cmd, err := cc.filterCommand(ctx, images, meta)
 	if err != nil {
 		return false, err
 	}
-	return ans["result"].(bool), nil
+	ans, err := cc.filtSvc.DoCommand(ctx, cmd)
+	if err != nil {
+		return false, err
+	}
+	key := cc.conf.resultKey()
+	raw, ok := ans[key]
+	if !ok {
+		return false, errors.Errorf("filter service %s response has no %q key: %v", cc.conf.FilterSvc, key, ans)
+	}
+	result, ok := raw.(bool)
+	if !ok {
+		return false, errors.Errorf("filter service %s response %q must be a bool, got %T", cc.conf.FilterSvc, key, raw)
+	}
+	cc.lastPoll = now
+	cc.lastResult = result
+	cc.recordDecision(result, filterServiceLabel)
+	return cc.lastResult, nil
+}
+
+// filterCommand builds the DoCommand sent to the filter service. It is nil unless send_image is set, in which case
+// it holds the capture time and source names of the batch, and the first image base64 encoded.
+func (cc *conditionalCamera) filterCommand(ctx context.Context, images []camera.NamedImage, meta resource.ResponseMetadata) (map[string]interface{}, error) {
+	if !cc.conf.SendImage || len(images) == 0 {
+		return nil, nil
+	}
+	sourceNames := make([]interface{}, 0, len(images))
+	for _, img := range images {
+		sourceNames = append(sourceNames, img.SourceName)
+	}
+	imgBytes, err := images[0].Bytes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"captured_at":  meta.CapturedAt.Format(time.RFC3339Nano),
+		"source_names": sourceNames,
+		"source_name":  images[0].SourceName,
+		"mime_type":    images[0].MimeType(),
+		"image":        base64.StdEncoding.EncodeToString(imgBytes),
+	}, nil
 }
 
 func (cc *conditionalCamera) NextPointCloud(ctx context.Context, extra map[string]interface{}) (pointcloud.PointCloud, error) {
@@ -0,0 +1,330 @@
+package conditional_camera
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"image"
+	"image/png"
+	"strings"
+	"testing"
+	"time"
+
+	"go.viam.com/rdk/components/camera"
+	"go.viam.com/rdk/data"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/resource"
+	"go.viam.com/rdk/testutils/inject"
+	rutils "go.viam.com/rdk/utils"
+	"go.viam.com/test"
+
+	"github.com/viam-modules/filtered_camera"
+	imagebuffer "github.com/viam-modules/filtered_camera/image_buffer"
+)
+
+func TestFilterEvaluatedOncePerBatch(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	ctx := context.Background()
+	baseTime := time.Now()
+
+	calls := 0
+	cam := inject.NewCamera("test_camera")
+	cam.ImagesFunc = func(ctx context.Context, filterSourceNames []string, extra map[string]interface{}) (
+		[]camera.NamedImage, resource.ResponseMetadata, error) {
+		calls++
+		color, _ := camera.NamedImageFromImage(image.NewRGBA(image.Rect(0, 0, 10, 10)), "color", "image/jpeg", data.Annotations{})
+		depth, _ := camera.NamedImageFromImage(image.NewGray(image.Rect(0, 0, 10, 10)), "depth", "image/jpeg", data.Annotations{})
+		ir, _ := camera.NamedImageFromImage(image.NewGray(image.Rect(0, 0, 10, 10)), "ir", "image/jpeg", data.Annotations{})
+		return []camera.NamedImage{color, depth, ir}, resource.ResponseMetadata{CapturedAt: baseTime.Add(time.Duration(calls) * 100 * time.Millisecond)}, nil
+	}
+
+	filterCalls := 0
+	filterSvc := inject.NewGenericService("filter")
+	filterSvc.DoFunc = func(ctx context.Context, cmd map[string]interface{}) (map[string]interface{}, error) {
+		filterCalls++
+		return map[string]interface{}{"result": false}, nil
+	}
+
+	cc := &conditionalCamera{
+		conf:    &Config{WindowSeconds: 1},
+		logger:  logger,
+		cam:     cam,
+		filtSvc: filterSvc,
+		buf:     imagebuffer.NewImageBuffer(1, 1.0, 0, 0, logger, true, 0),
+	}
+	extra := map[string]interface{}{data.FromDMString: true}
+
+	// a batch of three images only asks the filter service once
+	_, _, err := cc.Images(ctx, nil, extra)
+	test.That(t, err, test.ShouldEqual, data.ErrNoCaptureToStore)
+	test.That(t, filterCalls, test.ShouldEqual, 1)
+
+	_, _, err = cc.Images(ctx, nil, extra)
+	test.That(t, err, test.ShouldEqual, data.ErrNoCaptureToStore)
+	test.That(t, filterCalls, test.ShouldEqual, 2)
+
+	// with a poll interval the last answer is reused until the interval passes
+	cc.conf.FilterPollIntervalMs = 250
+	for i := 0; i < 3; i++ {
+		_, _, err = cc.Images(ctx, nil, extra)
+		test.That(t, err, test.ShouldEqual, data.ErrNoCaptureToStore)
+	}
+	// images are 100ms apart, so only the third call (300ms after the last poll) reaches the service
+	test.That(t, filterCalls, test.ShouldEqual, 3)
+}
+
+func TestSkipFailedFilter(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	ctx := context.Background()
+	baseTime := time.Now()
+
+	calls := 0
+	cam := inject.NewCamera("test_camera")
+	cam.ImagesFunc = func(ctx context.Context, filterSourceNames []string, extra map[string]interface{}) (
+		[]camera.NamedImage, resource.ResponseMetadata, error) {
+		calls++
+		color, _ := camera.NamedImageFromImage(image.NewRGBA(image.Rect(0, 0, 10, 10)), "color", "image/jpeg", data.Annotations{})
+		return []camera.NamedImage{color}, resource.ResponseMetadata{CapturedAt: baseTime.Add(time.Duration(calls) * time.Second)}, nil
+	}
+
+	var filterErr error
+	filterSvc := inject.NewGenericService("filter")
+	filterSvc.DoFunc = func(ctx context.Context, cmd map[string]interface{}) (map[string]interface{}, error) {
+		if filterErr != nil {
+			return nil, filterErr
+		}
+		return map[string]interface{}{"result": true}, nil
+	}
+
+	cc := &conditionalCamera{
+		conf:    &Config{WindowSecondsBefore: 5, WindowSecondsAfter: 1},
+		logger:  logger,
+		cam:     cam,
+		filtSvc: filterSvc,
+		buf:     imagebuffer.NewImageBuffer(0, 1.0, 5, 1, logger, false, 0),
+	}
+	extra := map[string]interface{}{data.FromDMString: true}
+
+	// by default a failing filter fails the request
+	filterErr = errors.New("filter unavailable")
+	_, _, err := cc.Images(ctx, nil, extra)
+	test.That(t, err, test.ShouldEqual, filterErr)
+
+	// with skip_failed_filter nothing is captured, but the images are still buffered
+	cc.conf.SkipFailedFilter = true
+	_, _, err = cc.Images(ctx, nil, extra)
+	test.That(t, err, test.ShouldEqual, data.ErrNoCaptureToStore)
+
+	// once the filter recovers, the capture includes the frames buffered while it was failing
+	filterErr = nil
+	imgs, _, err := cc.Images(ctx, nil, extra)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, len(imgs), test.ShouldEqual, 3)
+}
+
+func TestResultKey(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	ctx := context.Background()
+
+	var ans map[string]interface{}
+	filterSvc := inject.NewGenericService("filter")
+	filterSvc.DoFunc = func(ctx context.Context, cmd map[string]interface{}) (map[string]interface{}, error) {
+		return ans, nil
+	}
+	cc := &conditionalCamera{
+		conf:    &Config{FilterSvc: "filter", ResultKey: "capture"},
+		logger:  logger,
+		filtSvc: filterSvc,
+	}
+
+	ans = map[string]interface{}{"capture": true}
+	shouldSend, err := cc.shouldSend(ctx, nil, resource.ResponseMetadata{CapturedAt: time.Now()})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, shouldSend, test.ShouldBeTrue)
+
+	// a response of another shape is an error rather than a panic
+	ans = map[string]interface{}{"result": true}
+	_, err = cc.shouldSend(ctx, nil, resource.ResponseMetadata{CapturedAt: time.Now()})
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, err.Error(), test.ShouldContainSubstring, `no "capture" key`)
+
+	ans = map[string]interface{}{"capture": "yes"}
+	_, err = cc.shouldSend(ctx, nil, resource.ResponseMetadata{CapturedAt: time.Now()})
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, err.Error(), test.ShouldContainSubstring, "must be a bool")
+
+	// without result_key the answer is under "result"
+	cc.conf.ResultKey = ""
+	ans = map[string]interface{}{"result": false}
+	shouldSend, err = cc.shouldSend(ctx, nil, resource.ResponseMetadata{CapturedAt: time.Now()})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, shouldSend, test.ShouldBeFalse)
+}
+
+func TestSendImage(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	ctx := context.Background()
+
+	var sent map[string]interface{}
+	filterSvc := inject.NewGenericService("filter")
+	filterSvc.DoFunc = func(ctx context.Context, cmd map[string]interface{}) (map[string]interface{}, error) {
+		sent = cmd
+		return map[string]interface{}{"result": true}, nil
+	}
+	cc := &conditionalCamera{
+		conf:    &Config{FilterSvc: "filter"},
+		logger:  logger,
+		filtSvc: filterSvc,
+	}
+	color, _ := camera.NamedImageFromImage(image.NewRGBA(image.Rect(0, 0, 10, 10)), "color", "image/png", data.Annotations{})
+	depth, _ := camera.NamedImageFromImage(image.NewGray(image.Rect(0, 0, 10, 10)), "depth", "image/png", data.Annotations{})
+	capturedAt := time.Now()
+	meta := resource.ResponseMetadata{CapturedAt: capturedAt}
+
+	// by default the filter service is called without a payload
+	_, err := cc.shouldSend(ctx, []camera.NamedImage{color, depth}, meta)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, sent, test.ShouldBeNil)
+
+	cc.conf.SendImage = true
+	_, err = cc.shouldSend(ctx, []camera.NamedImage{color, depth}, meta)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, sent["captured_at"], test.ShouldEqual, capturedAt.Format(time.RFC3339Nano))
+	test.That(t, sent["source_names"], test.ShouldResemble, []interface{}{"color", "depth"})
+	test.That(t, sent["source_name"], test.ShouldEqual, "color")
+	test.That(t, sent["mime_type"], test.ShouldEqual, "image/png")
+	imgBytes, err := base64.StdEncoding.DecodeString(sent["image"].(string))
+	test.That(t, err, test.ShouldBeNil)
+	decoded, err := png.Decode(bytes.NewReader(imgBytes))
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, decoded.Bounds(), test.ShouldResemble, image.Rect(0, 0, 10, 10))
+}
+
+func TestBufferedImagesOrderedAndDeduped(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	ctx := context.Background()
+	baseTime := time.Now()
+
+	cam := inject.NewCamera("test_camera")
+	cam.ImagesFunc = func(ctx context.Context, filterSourceNames []string, extra map[string]interface{}) (
+		[]camera.NamedImage, resource.ResponseMetadata, error) {
+		img, _ := camera.NamedImageFromImage(image.NewRGBA(image.Rect(0, 0, 10, 10)), "color", "image/jpeg", data.Annotations{})
+		return []camera.NamedImage{img}, resource.ResponseMetadata{CapturedAt: baseTime.Add(4 * time.Second)}, nil
+	}
+
+	cc := &conditionalCamera{
+		conf:   &Config{WindowSeconds: 5},
+		logger: logger,
+		cam:    cam,
+		buf:    imagebuffer.NewImageBuffer(5, 1.0, 0, 0, logger, true, 0),
+	}
+
+	// frames reach the ring buffer out of order, and one is queued again directly
+	frame := func(offset time.Duration) ([]camera.NamedImage, resource.ResponseMetadata) {
+		img, _ := camera.NamedImageFromImage(image.NewRGBA(image.Rect(0, 0, 10, 10)), "color", "image/jpeg", data.Annotations{})
+		return []camera.NamedImage{img}, resource.ResponseMetadata{CapturedAt: baseTime.Add(offset)}
+	}
+	cc.buf.AddToRingBuffer(frame(2 * time.Second))
+	cc.buf.AddToRingBuffer(frame(time.Second))
+	cc.buf.MarkShouldSend(baseTime.Add(2 * time.Second))
+	imgs, meta := frame(time.Second)
+	cc.buf.StoreImages(imgs, meta, meta.CapturedAt)
+
+	res, batchMeta, err := cc.Images(ctx, nil, map[string]interface{}{data.FromDMString: true})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, len(res), test.ShouldEqual, 2)
+	test.That(t, batchMeta.CapturedAt.Equal(baseTime.Add(time.Second)), test.ShouldBeTrue)
+	test.That(t, strings.HasPrefix(res[0].SourceName, baseTime.Add(time.Second).Format("2006-01-02T15:04:05.000Z07:00")), test.ShouldBeTrue)
+	test.That(t, strings.HasPrefix(res[1].SourceName, baseTime.Add(2*time.Second).Format("2006-01-02T15:04:05.000Z07:00")), test.ShouldBeTrue)
+}
+
+func TestRequestedMimeType(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	ctx := context.Background()
+
+	cam := inject.NewCamera("test_camera")
+	cam.ImagesFunc = func(ctx context.Context, filterSourceNames []string, extra map[string]interface{}) (
+		[]camera.NamedImage, resource.ResponseMetadata, error) {
+		color, _ := camera.NamedImageFromImage(image.NewRGBA(image.Rect(0, 0, 10, 10)), "color", rutils.MimeTypeJPEG, data.Annotations{})
+		return []camera.NamedImage{color}, resource.ResponseMetadata{CapturedAt: time.Now()}, nil
+	}
+	cc := &conditionalCamera{
+		conf:   &Config{WindowSeconds: 1},
+		logger: logger,
+		cam:    cam,
+		buf:    imagebuffer.NewImageBuffer(1, 1.0, 0, 0, logger, false, 0),
+	}
+
+	imgs, _, err := cc.Images(ctx, nil, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, imgs[0].MimeType(), test.ShouldEqual, rutils.MimeTypeJPEG)
+
+	// a stored JPEG is re-encoded when PNG is requested
+	imgs, _, err = cc.Images(ctx, nil, map[string]interface{}{filtered_camera.MimeTypeExtraKey: rutils.MimeTypePNG})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, imgs[0].MimeType(), test.ShouldEqual, rutils.MimeTypePNG)
+	raw, err := imgs[0].Bytes(ctx)
+	test.That(t, err, test.ShouldBeNil)
+	_, err = png.Decode(bytes.NewReader(raw))
+	test.That(t, err, test.ShouldBeNil)
+
+	// types that can't be encoded fall back to the stored one
+	imgs, _, err = cc.Images(ctx, nil, map[string]interface{}{filtered_camera.MimeTypeExtraKey: "image/unknown"})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, imgs[0].MimeType(), test.ShouldEqual, rutils.MimeTypeJPEG)
+}
+
+func TestStats(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	ctx := context.Background()
+
+	var ans map[string]interface{}
+	var filterErr error
+	filterSvc := inject.NewGenericService("filter")
+	filterSvc.DoFunc = func(ctx context.Context, cmd map[string]interface{}) (map[string]interface{}, error) {
+		return ans, filterErr
+	}
+	cam := inject.NewCamera("test_camera")
+	cam.ImagesFunc = func(ctx context.Context, filterSourceNames []string, extra map[string]interface{}) (
+		[]camera.NamedImage, resource.ResponseMetadata, error) {
+		return nil, resource.ResponseMetadata{CapturedAt: time.Now()}, nil
+	}
+	cc := &conditionalCamera{
+		conf:    &Config{FilterSvc: "filter", SkipFailedFilter: true},
+		logger:  logger,
+		cam:     cam,
+		filtSvc: filterSvc,
+		buf:     imagebuffer.NewImageBuffer(0, 1.0, 0, 1, logger, false, 0),
+	}
+
+	for _, result := range []bool{true, false, false} {
+		ans = map[string]interface{}{"result": result}
+		_, err := cc.shouldSend(ctx, nil, resource.ResponseMetadata{CapturedAt: time.Now()})
+		test.That(t, err, test.ShouldBeNil)
+	}
+	// with skip_failed_filter, a failing filter service counts as a rejection of its own
+	filterErr = errors.New("filter down")
+	_, _, err := cc.Images(ctx, nil, map[string]interface{}{data.FromDMString: true})
+	test.That(t, err, test.ShouldEqual, data.ErrNoCaptureToStore)
+
+	stats, err := cc.DoCommand(ctx, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, stats["accepted"], test.ShouldResemble, map[string]interface{}{
+		"total": 1, "vision": map[string]int{"filter_service": 1},
+	})
+	test.That(t, stats["rejected"], test.ShouldResemble, map[string]interface{}{
+		"total": 3, "vision": map[string]int{"filter_service": 2, "filter_service_failed": 1},
+	})
+
+	// commands are named like the filtered camera's, and unknown ones are errors
+	_, err = cc.DoCommand(ctx, map[string]interface{}{"cmd": "rescore"})
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, err.Error(), test.ShouldContainSubstring, "unknown command")
+	res, err := cc.DoCommand(ctx, map[string]interface{}{"command": "reset_stats"})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res["reset"], test.ShouldBeTrue)
+	stats, err = cc.DoCommand(ctx, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, stats["accepted"], test.ShouldResemble, map[string]interface{}{"total": 0, "vision": map[string]int(nil)})
+}
@@ -0,0 +1,46 @@
+package conditional_camera
+
+import (
+	"time"
+)
+
+const (
+	// filterServiceLabel is the stats label of the filter service's decisions, which have no labels of their own
+	filterServiceLabel = "filter_service"
+	// filterFailedLabel is the rejected stats label of batches not captured because the filter service failed,
+	// with skip_failed_filter
+	filterFailedLabel = "filter_service_failed"
+)
+
+// recordDecision counts a filter decision in the accepted or rejected stats.
+func (cc *conditionalCamera) recordDecision(accepted bool, label string) {
+	cc.statsMu.Lock()
+	defer cc.statsMu.Unlock()
+	if accepted {
+		cc.acceptedStats.Update(label)
+	} else {
+		cc.rejectedStats.Update(label)
+	}
+}
+
+// formatStats reports the accepted and rejected stats in the same shape as the filtered camera's.
+func (cc *conditionalCamera) formatStats() map[string]interface{} {
+	cc.statsMu.Lock()
+	defer cc.statsMu.Unlock()
+	return map[string]interface{}{
+		"accepted":   cc.acceptedStats.Summary(),
+		"rejected":   cc.rejectedStats.Summary(),
+		"start_time": cc.acceptedStats.StartTime.Format(time.RFC1123),
+	}
+}
+
+// resetStats zeroes the accepted and rejected counts, restarting them from now.
+func (cc *conditionalCamera) resetStats() map[string]interface{} {
+	cc.statsMu.Lock()
+	defer cc.statsMu.Unlock()
+	now := time.Now()
+	cc.acceptedStats = cc.acceptedStats.Cleared(now)
+	cc.rejectedStats = cc.rejectedStats.Cleared(now)
+	cc.logger.Infof("stats reset")
+	return map[string]interface{}{"reset": true, "start_time": now.Format(time.RFC1123)}
+}
@@ -0,0 +1,87 @@
+package filtered_camera
+
+import (
+	"image"
+	"sort"
+
+	"go.viam.com/rdk/components/camera"
+	"go.viam.com/rdk/vision/objectdetection"
+)
+
+const (
+	// degenerateBoxesKeep passes zero-area and inverted boxes through unchanged
+	degenerateBoxesKeep = "keep"
+	// degenerateBoxesSkip drops detections with zero-area or inverted boxes
+	degenerateBoxesSkip = "skip"
+	// degenerateBoxesWholeFrame treats zero-area or inverted boxes as covering the whole frame
+	degenerateBoxesWholeFrame = "whole_frame"
+)
+
+// isDegenerate returns true if the detection's bounding box has no area or is inverted.
+func isDegenerate(d objectdetection.Detection) bool {
+	box := d.BoundingBox()
+	if box == nil || box.Dx() <= 0 || box.Dy() <= 0 {
+		return true
+	}
+	if norm := d.NormalizedBoundingBox(); len(norm) == 4 && (norm[2] <= norm[0] || norm[3] <= norm[1]) {
+		return true
+	}
+	return false
+}
+
+// normalizeDetections handles detections with zero-area or inverted boxes as configured by degenerate_boxes.
+// img is the image the detections were made on, used as the box when treating them as whole-frame.
+func (fc *filteredCamera) normalizeDetections(img *camera.NamedImage, ds []objectdetection.Detection) []objectdetection.Detection {
+	if fc.conf.DegenerateBoxes == "" || fc.conf.DegenerateBoxes == degenerateBoxesKeep {
+		return ds
+	}
+
+	var frame image.Rectangle
+	res := make([]objectdetection.Detection, 0, len(ds))
+	for _, d := range ds {
+		if !isDegenerate(d) {
+			res = append(res, d)
+			continue
+		}
+		if fc.conf.DegenerateBoxes == degenerateBoxesSkip {
+			fc.logger.Debugf("skipping detection %q with degenerate box %v", d.Label(), d.BoundingBox())
+			continue
+		}
+		if frame.Empty() {
+			bounds, err := img.Bounds()
+			if err != nil {
+				fc.logger.Warnf("could not get image bounds for whole-frame detection, skipping it: %v", err)
+				continue
+			}
+			frame = bounds
+		}
+		res = append(res, objectdetection.NewDetection(frame, frame, d.Score(), d.Label()))
+	}
+	return res
+}
+
+// aboveScoreFloor drops detections scoring below detection_score_floor, so that they are never matched,
+// counted towards any_label_min_count or annotated.
+func (fc *filteredCamera) aboveScoreFloor(ds []objectdetection.Detection) []objectdetection.Detection {
+	if fc.conf.DetectionScoreFloor <= 0 {
+		return ds
+	}
+	res := make([]objectdetection.Detection, 0, len(ds))
+	for _, d := range ds {
+		if d.Score() >= fc.conf.DetectionScoreFloor {
+			res = append(res, d)
+		}
+	}
+	return res
+}
+
+// topDetections keeps only the detections_top_n highest scoring detections, if set. When it truncates the list,
+// the detections are returned highest scoring first.
+func (fc *filteredCamera) topDetections(ds []objectdetection.Detection) []objectdetection.Detection {
+	if fc.conf.DetectionsTopN <= 0 || len(ds) <= fc.conf.DetectionsTopN {
+		return ds
+	}
+	sorted := append([]objectdetection.Detection{}, ds...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Score() > sorted[j].Score() })
+	return sorted[:fc.conf.DetectionsTopN]
+}
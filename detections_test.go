@@ -0,0 +1,161 @@
+package filtered_camera
+
+import (
+	"context"
+	"image"
+	"testing"
+	"time"
+
+	"go.viam.com/rdk/components/camera"
+	"go.viam.com/rdk/data"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/services/vision"
+	"go.viam.com/rdk/testutils/inject"
+	"go.viam.com/rdk/vision/objectdetection"
+	"go.viam.com/test"
+)
+
+func TestDegenerateBoxes(t *testing.T) {
+	bounds := image.Rect(0, 0, 100, 50)
+	visionSvc := inject.NewVisionService("detector")
+	visionSvc.DetectionsFunc = func(ctx context.Context, img *camera.NamedImage, extra map[string]interface{}) ([]objectdetection.Detection, error) {
+		return []objectdetection.Detection{
+			objectdetection.NewDetection(bounds, image.Rect(1, 1, 1, 1), 0.9, "person"),
+			objectdetection.NewDetection(bounds, image.Rect(20, 20, 10, 10), 0.8, "person"),
+		}, nil
+	}
+	frame, err := camera.NamedImageFromImage(image.NewRGBA(bounds), "color", "image/jpeg", data.Annotations{})
+	test.That(t, err, test.ShouldBeNil)
+
+	newCamera := func(mode string) *filteredCamera {
+		return &filteredCamera{
+			conf:                &Config{DegenerateBoxes: mode},
+			logger:              logging.NewTestLogger(t),
+			otherVisionServices: []vision.Service{visionSvc},
+			acceptedObjects:     map[string]map[string]float64{"detector": {"person": 0.5}},
+		}
+	}
+
+	// by default degenerate boxes are passed through as they are
+	res, annotations, err := newCamera("").shouldSend(context.Background(), frame, time.Now())
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res, test.ShouldBeTrue)
+	test.That(t, annotations.BoundingBoxes[0].XMinNormalized, test.ShouldEqual, annotations.BoundingBoxes[0].XMaxNormalized)
+
+	// skipped, they can't trigger
+	res, _, err = newCamera(degenerateBoxesSkip).shouldSend(context.Background(), frame, time.Now())
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res, test.ShouldBeFalse)
+
+	// as whole-frame detections they trigger with a box covering the frame
+	res, annotations, err = newCamera(degenerateBoxesWholeFrame).shouldSend(context.Background(), frame, time.Now())
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res, test.ShouldBeTrue)
+	test.That(t, len(annotations.BoundingBoxes), test.ShouldEqual, 2)
+	for _, bb := range annotations.BoundingBoxes {
+		test.That(t, []float64{bb.XMinNormalized, bb.YMinNormalized, bb.XMaxNormalized, bb.YMaxNormalized},
+			test.ShouldResemble, []float64{0, 0, 1, 1})
+	}
+}
+
+func TestDetectionScoreFloor(t *testing.T) {
+	bounds := image.Rect(0, 0, 100, 50)
+	box := image.Rect(10, 10, 20, 20)
+	visionSvc := inject.NewVisionService("detector")
+	visionSvc.DetectionsFunc = func(ctx context.Context, img *camera.NamedImage, extra map[string]interface{}) ([]objectdetection.Detection, error) {
+		return []objectdetection.Detection{
+			objectdetection.NewDetection(bounds, box, 0.05, "person"),
+			objectdetection.NewDetection(bounds, box, 0.06, "car"),
+			objectdetection.NewDetection(bounds, box, 0.3, "dog"),
+		}, nil
+	}
+	frame, err := camera.NamedImageFromImage(image.NewRGBA(bounds), "color", "image/jpeg", data.Annotations{})
+	test.That(t, err, test.ShouldBeNil)
+
+	newCamera := func(floor float64, objects map[string]float64, minCount int) *filteredCamera {
+		return &filteredCamera{
+			conf:                &Config{DetectionScoreFloor: floor},
+			logger:              logging.NewTestLogger(t),
+			otherVisionServices: []vision.Service{visionSvc},
+			acceptedObjects:     map[string]map[string]float64{"detector": objects},
+			serviceConfigs: map[string]VisionServiceConfig{
+				"detector": {Vision: "detector", AnyLabelMinCount: minCount, AnyLabelMinScore: 0.01},
+			},
+		}
+	}
+
+	// without a floor the wildcard matches every detection, and all three are counted
+	res, annotations, err := newCamera(0, map[string]float64{"*": 0.01}, 0).shouldSend(context.Background(), frame, time.Now())
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res, test.ShouldBeTrue)
+	test.That(t, len(annotations.BoundingBoxes), test.ShouldEqual, 3)
+	res, _, err = newCamera(0, nil, 3).shouldSend(context.Background(), frame, time.Now())
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res, test.ShouldBeTrue)
+
+	// with a floor only the detection above it matches
+	res, annotations, err = newCamera(0.1, map[string]float64{"*": 0.01}, 0).shouldSend(context.Background(), frame, time.Now())
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res, test.ShouldBeTrue)
+	test.That(t, len(annotations.BoundingBoxes), test.ShouldEqual, 1)
+	test.That(t, annotations.BoundingBoxes[0].Label, test.ShouldEqual, "dog")
+
+	// and the sub-floor detections don't count towards any_label_min_count
+	res, _, err = newCamera(0.1, nil, 2).shouldSend(context.Background(), frame, time.Now())
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res, test.ShouldBeFalse)
+}
+
+func TestDetectionsTopN(t *testing.T) {
+	bounds := image.Rect(0, 0, 100, 50)
+	box := image.Rect(10, 10, 20, 20)
+	visionSvc := inject.NewVisionService("detector")
+	visionSvc.DetectionsFunc = func(ctx context.Context, img *camera.NamedImage, extra map[string]interface{}) ([]objectdetection.Detection, error) {
+		return []objectdetection.Detection{
+			objectdetection.NewDetection(bounds, box, 0.6, "car"),
+			objectdetection.NewDetection(bounds, box, 0.9, "dog"),
+			objectdetection.NewDetection(bounds, box, 0.7, "person"),
+			objectdetection.NewDetection(bounds, box, 0.8, "cat"),
+		}, nil
+	}
+	frame, err := camera.NamedImageFromImage(image.NewRGBA(bounds), "color", "image/jpeg", data.Annotations{})
+	test.That(t, err, test.ShouldBeNil)
+
+	newCamera := func(topN int, objects map[string]float64, minCount int) *filteredCamera {
+		return &filteredCamera{
+			conf:                &Config{DetectionsTopN: topN, AnnotateAllDetections: true},
+			logger:              logging.NewTestLogger(t),
+			otherVisionServices: []vision.Service{visionSvc},
+			acceptedObjects:     map[string]map[string]float64{"detector": objects},
+			serviceConfigs: map[string]VisionServiceConfig{
+				"detector": {Vision: "detector", AnyLabelMinCount: minCount},
+			},
+		}
+	}
+
+	// without a limit every detection is considered
+	res, annotations, err := newCamera(0, map[string]float64{"car": 0.5}, 0).shouldSend(context.Background(), frame, time.Now())
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res, test.ShouldBeTrue)
+	test.That(t, len(annotations.BoundingBoxes), test.ShouldEqual, 4)
+
+	// with a limit of 2 only the two best are, so the lowest scoring car can't match
+	res, _, err = newCamera(2, map[string]float64{"car": 0.5}, 0).shouldSend(context.Background(), frame, time.Now())
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res, test.ShouldBeFalse)
+
+	res, annotations, err = newCamera(2, map[string]float64{"cat": 0.5}, 0).shouldSend(context.Background(), frame, time.Now())
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res, test.ShouldBeTrue)
+	test.That(t, len(annotations.BoundingBoxes), test.ShouldEqual, 2)
+	test.That(t, annotations.BoundingBoxes[0].Label, test.ShouldEqual, "dog")
+	test.That(t, annotations.BoundingBoxes[1].Label, test.ShouldEqual, "cat")
+
+	// and only they are counted
+	res, _, err = newCamera(2, nil, 3).shouldSend(context.Background(), frame, time.Now())
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res, test.ShouldBeFalse)
+	res, _, err = newCamera(3, nil, 3).shouldSend(context.Background(), frame, time.Now())
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res, test.ShouldBeTrue)
+}
@@ -0,0 +1,29 @@
+package filtered_camera
+
+import (
+	"context"
+
+	"go.viam.com/rdk/components/camera"
+	"go.viam.com/rdk/data"
+	"go.viam.com/rdk/resource"
+)
+
+// dryRun runs every image through the filter as a data management request would, updating the accepted and
+// rejected stats and logging each decision, but never opens a capture window. It returns data.ErrNoCaptureToStore
+// unless the filter itself fails.
+func (fc *filteredCamera) dryRun(ctx context.Context, images []camera.NamedImage, meta resource.ResponseMetadata) error {
+	for _, i := range fc.visionIndexes(images) {
+		img := images[i]
+		shouldSend, annotations, err := fc.shouldSend(ctx, img, meta.CapturedAt)
+		if err != nil {
+			return err
+		}
+		if shouldSend {
+			label, score := triggerReason(annotations)
+			fc.logger.Infof("dry run: would capture %s at %s (label %q, score %.2f)", img.SourceName, meta.CapturedAt, label, score)
+		} else {
+			fc.logger.Debugf("dry run: would not capture %s at %s", img.SourceName, meta.CapturedAt)
+		}
+	}
+	return data.ErrNoCaptureToStore
+}
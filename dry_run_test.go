@@ -0,0 +1,67 @@
+package filtered_camera
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.viam.com/rdk/components/camera"
+	"go.viam.com/rdk/data"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/resource"
+	"go.viam.com/rdk/services/vision"
+	"go.viam.com/rdk/testutils/inject"
+	"go.viam.com/test"
+
+	imagebuffer "github.com/viam-modules/filtered_camera/image_buffer"
+)
+
+func TestDryRun(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	ctx := context.Background()
+
+	frame := namedA
+	imagesCam := inject.NewCamera("test_camera")
+	imagesCam.ImagesFunc = func(ctx context.Context, filterSourceNames []string, extra map[string]interface{}) (
+		[]camera.NamedImage, resource.ResponseMetadata, error) {
+		return []camera.NamedImage{frame}, resource.ResponseMetadata{CapturedAt: time.Now()}, nil
+	}
+
+	fc := &filteredCamera{
+		conf: &Config{
+			Classifications: map[string]Threshold{"a": {Min: .8}},
+			WindowSeconds:   10,
+			ImageFrequency:  1.0,
+			DryRun:          true,
+		},
+		logger:                   logger,
+		cam:                      imagesCam,
+		otherVisionServices:      []vision.Service{getDummyVisionService()},
+		acceptedClassifications:  map[string]map[string]float64{"": {"a": .8}},
+		acceptedObjects:          map[string]map[string]float64{},
+		inhibitors:               []vision.Service{getDummyVisionService()},
+		inhibitedClassifications: map[string]map[string]float64{},
+		inhibitedObjects:         map[string]map[string]float64{"": {"b": .8}},
+		buf:                      imagebuffer.NewImageBuffer(10, 1.0, 0, 0, logger, false, 0),
+	}
+	fc.captureImageInBackground(ctx)
+
+	// a triggering frame is counted but nothing is captured
+	images, _, err := fc.Images(ctx, nil, map[string]interface{}{data.FromDMString: true})
+	test.That(t, err, test.ShouldEqual, data.ErrNoCaptureToStore)
+	test.That(t, images, test.ShouldBeNil)
+	test.That(t, fc.acceptedStats.Total, test.ShouldEqual, 1)
+	test.That(t, fc.buf.GetToSendLength(), test.ShouldEqual, 0)
+
+	// inhibitors still run
+	frame = namedB
+	_, _, err = fc.Images(ctx, nil, map[string]interface{}{data.FromDMString: true})
+	test.That(t, err, test.ShouldEqual, data.ErrNoCaptureToStore)
+	test.That(t, fc.rejectedStats.Breakdown, test.ShouldResemble, map[string]int{"b": 1})
+	test.That(t, fc.buf.GetToSendLength(), test.ShouldEqual, 0)
+
+	// requests from outside data management are served as usual
+	images, _, err = fc.Images(ctx, nil, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, len(images), test.ShouldEqual, 1)
+}
@@ -0,0 +1,61 @@
+package filtered_camera
+
+import (
+	"context"
+	"sync"
+
+	"go.viam.com/rdk/components/camera"
+)
+
+// encodeImages encodes any images that aren't backed by bytes yet using up to workers goroutines.
+// NamedImage caches its encoded bytes, so callers downstream of this get them without re-encoding.
+func encodeImages(ctx context.Context, images []camera.NamedImage, workers int) error {
+	if workers > len(images) {
+		workers = len(images)
+	}
+	if workers <= 1 {
+		for i := range images {
+			if _, err := images[i].Bytes(ctx); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	indexes := make(chan int)
+	errs := make(chan error, workers)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				// each worker only touches its own element of the slice
+				if _, err := images[i].Bytes(ctx); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+
+	var err error
+feed:
+	for i := range images {
+		select {
+		case indexes <- i:
+		case err = <-errs:
+			break feed
+		case <-ctx.Done():
+			err = ctx.Err()
+			break feed
+		}
+	}
+	close(indexes)
+	wg.Wait()
+	close(errs)
+	if err != nil {
+		return err
+	}
+	return <-errs
+}
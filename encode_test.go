@@ -0,0 +1,68 @@
+package filtered_camera
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"testing"
+
+	"go.viam.com/rdk/components/camera"
+	"go.viam.com/rdk/data"
+	"go.viam.com/rdk/utils"
+	"go.viam.com/test"
+)
+
+func newEncodeBatch(t testing.TB, n, size int) []camera.NamedImage {
+	images := make([]camera.NamedImage, 0, n)
+	for i := 0; i < n; i++ {
+		img := image.NewRGBA(image.Rect(0, 0, size, size))
+		for x := 0; x < size; x++ {
+			img.Set(x, x, color.RGBA{R: uint8(i), G: uint8(x), B: 255, A: 255})
+		}
+		named, err := camera.NamedImageFromImage(img, fmt.Sprintf("img_%d", i), utils.MimeTypeJPEG, data.Annotations{})
+		test.That(t, err, test.ShouldBeNil)
+		images = append(images, named)
+	}
+	return images
+}
+
+func TestEncodeImages(t *testing.T) {
+	ctx := context.Background()
+
+	serial := newEncodeBatch(t, 12, 32)
+	test.That(t, encodeImages(ctx, serial, 1), test.ShouldBeNil)
+	parallel := newEncodeBatch(t, 12, 32)
+	test.That(t, encodeImages(ctx, parallel, 4), test.ShouldBeNil)
+
+	// the parallel output is identical to the serial output, in the same order
+	for i := range serial {
+		test.That(t, parallel[i].SourceName, test.ShouldEqual, serial[i].SourceName)
+		want, err := serial[i].Bytes(ctx)
+		test.That(t, err, test.ShouldBeNil)
+		got, err := parallel[i].Bytes(ctx)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, got, test.ShouldResemble, want)
+	}
+
+	// encoding errors are reported
+	broken := append(newEncodeBatch(t, 3, 8), camera.NamedImage{SourceName: "empty"})
+	test.That(t, encodeImages(ctx, broken, 2), test.ShouldNotBeNil)
+	test.That(t, encodeImages(ctx, broken, 1), test.ShouldNotBeNil)
+}
+
+func BenchmarkEncodeImages(b *testing.B) {
+	ctx := context.Background()
+	for _, workers := range []int{1, 4, 8} {
+		b.Run(fmt.Sprintf("workers_%d", workers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				images := newEncodeBatch(b, 60, 320)
+				b.StartTimer()
+				if err := encodeImages(ctx, images, workers); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
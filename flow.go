@@ -0,0 +1,139 @@
+package filtered_camera
+
+import (
+	"context"
+	"image"
+	"math"
+
+	"go.viam.com/rdk/components/camera"
+	"golang.org/x/image/draw"
+)
+
+const (
+	// flowAnalysisWidth is the width frames are downscaled to before estimating flow
+	flowAnalysisWidth = 64
+	// flowBlockSize is the side of the square blocks that are matched between frames
+	flowBlockSize = 8
+	// flowSearchRadius is how far, in analysis pixels, each block is searched for in the other frame
+	flowSearchRadius = 4
+)
+
+// flowTriggered estimates the optical flow between the most recent ring buffer frame and img, returning true
+// if its average magnitude reaches min_flow_magnitude. It returns false if there's no earlier frame to compare with.
+func (fc *filteredCamera) flowTriggered(ctx context.Context, img camera.NamedImage) (bool, error) {
+	previous, ok := fc.buf.LastRingBufferFrame()
+	if !ok {
+		return false, nil
+	}
+	prevImg, ok := findSource(previous.Imgs, img.SourceName)
+	if !ok {
+		return false, nil
+	}
+
+	prev, err := prevImg.Image(ctx)
+	if err != nil {
+		return false, err
+	}
+	cur, err := img.Image(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	magnitude := flowMagnitude(prev, cur)
+	if fc.debug() {
+		fc.logger.Infow("Optical flow estimate", "source", img.SourceName, "magnitude", magnitude, "min", fc.conf.MinFlowMagnitude)
+	}
+	return magnitude >= fc.conf.MinFlowMagnitude, nil
+}
+
+// findSource returns the image from the given source, or the only image if there is just one.
+func findSource(images []camera.NamedImage, sourceName string) (camera.NamedImage, bool) {
+	for _, img := range images {
+		if img.SourceName == sourceName {
+			return img, true
+		}
+	}
+	if len(images) == 1 {
+		return images[0], true
+	}
+	return camera.NamedImage{}, false
+}
+
+// flowMagnitude estimates how far the content moved between prev and cur as the average block displacement,
+// expressed as a fraction of the frame width. Blocks are compared after removing their mean brightness,
+// so flickering light doesn't register as motion.
+func flowMagnitude(prev, cur image.Image) float64 {
+	a := toAnalysisGray(prev)
+	b := toAnalysisGray(cur)
+	if a.Bounds() != b.Bounds() {
+		return 0
+	}
+
+	bounds := a.Bounds()
+	total, blocks := 0.0, 0
+	for y := 0; y+flowBlockSize <= bounds.Dy(); y += flowBlockSize {
+		for x := 0; x+flowBlockSize <= bounds.Dx(); x += flowBlockSize {
+			dx, dy := matchBlock(a, b, x, y)
+			total += math.Hypot(float64(dx), float64(dy))
+			blocks++
+		}
+	}
+	if blocks == 0 {
+		return 0
+	}
+	return total / float64(blocks) / float64(bounds.Dx())
+}
+
+// matchBlock finds the displacement of the block at (x, y) in a that best matches b, preferring no displacement on ties.
+func matchBlock(a, b *image.Gray, x, y int) (int, int) {
+	bounds := b.Bounds()
+	aMean := blockMean(a, x, y)
+	best := blockSAD(a, b, x, y, x, y, aMean, blockMean(b, x, y))
+	bestDx, bestDy := 0, 0
+	for dy := -flowSearchRadius; dy <= flowSearchRadius; dy++ {
+		for dx := -flowSearchRadius; dx <= flowSearchRadius; dx++ {
+			bx, by := x+dx, y+dy
+			if (dx == 0 && dy == 0) || bx < 0 || by < 0 || bx+flowBlockSize > bounds.Dx() || by+flowBlockSize > bounds.Dy() {
+				continue
+			}
+			if sad := blockSAD(a, b, x, y, bx, by, aMean, blockMean(b, bx, by)); sad < best {
+				best, bestDx, bestDy = sad, dx, dy
+			}
+		}
+	}
+	return bestDx, bestDy
+}
+
+func blockMean(img *image.Gray, x, y int) float64 {
+	sum := 0
+	for j := 0; j < flowBlockSize; j++ {
+		for i := 0; i < flowBlockSize; i++ {
+			sum += int(img.GrayAt(x+i, y+j).Y)
+		}
+	}
+	return float64(sum) / float64(flowBlockSize*flowBlockSize)
+}
+
+// blockSAD is the sum of absolute differences between two blocks with their means removed.
+func blockSAD(a, b *image.Gray, ax, ay, bx, by int, aMean, bMean float64) float64 {
+	sad := 0.0
+	for j := 0; j < flowBlockSize; j++ {
+		for i := 0; i < flowBlockSize; i++ {
+			sad += math.Abs((float64(a.GrayAt(ax+i, ay+j).Y) - aMean) - (float64(b.GrayAt(bx+i, by+j).Y) - bMean))
+		}
+	}
+	return sad
+}
+
+// toAnalysisGray converts img to grayscale, downscaling it to flowAnalysisWidth if it is wider.
+func toAnalysisGray(img image.Image) *image.Gray {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width > flowAnalysisWidth {
+		height = int(math.Max(1, math.Round(float64(height)*flowAnalysisWidth/float64(width))))
+		width = flowAnalysisWidth
+	}
+	dst := image.NewGray(image.Rect(0, 0, width, height))
+	draw.ApproxBiLinear.Scale(dst, dst.Bounds(), img, bounds, draw.Src, nil)
+	return dst
+}
@@ -0,0 +1,91 @@
+package filtered_camera
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+	"time"
+
+	"go.viam.com/rdk/components/camera"
+	"go.viam.com/rdk/data"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/resource"
+	"go.viam.com/test"
+
+	imagebuffer "github.com/viam-modules/filtered_camera/image_buffer"
+)
+
+// texturedScene returns a random texture, so that block matching has something to lock on to
+func texturedScene(width, height int) *image.Gray {
+	rng := rand.New(rand.NewSource(1))
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(rng.Intn(200))
+	}
+	return img
+}
+
+// viewOf returns a width x height view of scene starting at column x, with brightness added
+func viewOf(scene *image.Gray, x, width, height int, brightness uint8) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for j := 0; j < height; j++ {
+		for i := 0; i < width; i++ {
+			img.SetGray(i, j, color.Gray{Y: scene.GrayAt(x+i, j).Y + brightness})
+		}
+	}
+	return img
+}
+
+func TestFlowMagnitude(t *testing.T) {
+	scene := texturedScene(128, 48)
+
+	// a pan of 3 pixels is about 3/64 of the frame
+	panning := flowMagnitude(viewOf(scene, 10, 64, 48, 0), viewOf(scene, 13, 64, 48, 0))
+	test.That(t, panning, test.ShouldBeGreaterThan, 0.03)
+
+	// the same view under flickering light doesn't move
+	flicker := flowMagnitude(viewOf(scene, 10, 64, 48, 0), viewOf(scene, 10, 64, 48, 40))
+	test.That(t, flicker, test.ShouldEqual, 0)
+}
+
+func TestMinFlowMagnitude(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	scene := texturedScene(128, 48)
+	named := func(img image.Image) camera.NamedImage {
+		ni, err := camera.NamedImageFromImage(img, "color", "image/png", data.Annotations{})
+		test.That(t, err, test.ShouldBeNil)
+		return ni
+	}
+
+	fc := &filteredCamera{
+		conf:   &Config{MinFlowMagnitude: 0.02},
+		logger: logger,
+		buf:    imagebuffer.NewImageBuffer(10, 1.0, 0, 0, logger, false, 0),
+	}
+	now := time.Now()
+
+	// nothing to compare the first frame with
+	res, _, err := fc.shouldSend(context.Background(), named(viewOf(scene, 0, 64, 48, 0)), now)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res, test.ShouldBeFalse)
+
+	// a static sequence, with flickering light, doesn't trigger
+	for i := 0; i < 3; i++ {
+		fc.buf.AddToRingBuffer([]camera.NamedImage{named(viewOf(scene, 0, 64, 48, uint8(20*i)))}, resource.ResponseMetadata{CapturedAt: now})
+		res, _, err = fc.shouldSend(context.Background(), named(viewOf(scene, 0, 64, 48, uint8(20*i+10))), now)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, res, test.ShouldBeFalse)
+	}
+	test.That(t, fc.rejectedStats.Breakdown["no motion"], test.ShouldEqual, 4)
+
+	// a panning sequence does
+	for x := 0; x < 9; x += 3 {
+		fc.buf.AddToRingBuffer([]camera.NamedImage{named(viewOf(scene, x, 64, 48, 0))}, resource.ResponseMetadata{CapturedAt: now})
+		res, _, err = fc.shouldSend(context.Background(), named(viewOf(scene, x+3, 64, 48, 0)), now)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, res, test.ShouldBeTrue)
+	}
+	test.That(t, fc.acceptedStats.Breakdown["optical_flow"], test.ShouldEqual, 3)
+}
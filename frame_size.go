@@ -0,0 +1,84 @@
+package filtered_camera
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"go.viam.com/rdk/components/camera"
+)
+
+// checkImageSize returns an error if the image is narrower than min_image_width or shorter than min_image_height,
+// or if its size can't be read, as happens with corrupt or empty frames.
+func (fc *filteredCamera) checkImageSize(img camera.NamedImage) error {
+	if fc.conf.MinImageWidth <= 0 && fc.conf.MinImageHeight <= 0 {
+		return nil
+	}
+	bounds, err := img.Bounds()
+	if err != nil {
+		return fmt.Errorf("could not read size of image %q: %w", img.SourceName, err)
+	}
+	if bounds.Dx() < fc.conf.MinImageWidth || bounds.Dy() < fc.conf.MinImageHeight {
+		return fmt.Errorf("image %q is %dx%d, smaller than the minimum %dx%d",
+			img.SourceName, bounds.Dx(), bounds.Dy(), fc.conf.MinImageWidth, fc.conf.MinImageHeight)
+	}
+	return nil
+}
+
+// undersizedLogInterval is the shortest time between two errors logged for undersized frames.
+const undersizedLogInterval = time.Minute
+
+// undersizedLog tracks the undersized frames rejected since the last error about them was logged.
+type undersizedLog struct {
+	mu         sync.Mutex
+	undersized bool
+	lastLogged time.Time
+	unlogged   int
+}
+
+// logImageSize logs the result of checkImageSize. Undersized frames are logged as errors, but at most once per
+// undersizedLogInterval, with the number of frames rejected since the last error, so that a camera stuck on tiny
+// frames doesn't flood the logs. Frames coming back to size are logged once.
+func (fc *filteredCamera) logImageSize(err error) {
+	l := &fc.sizeLog
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err == nil {
+		if l.undersized {
+			l.undersized = false
+			l.unlogged = 0
+			fc.logger.Infof("frames are back above the minimum image size")
+		}
+		return
+	}
+	now := time.Now()
+	if l.undersized && now.Sub(l.lastLogged) < undersizedLogInterval {
+		l.unlogged++
+		return
+	}
+	if l.unlogged > 0 {
+		fc.logger.Errorf("rejecting frame: %v (%d more undersized frames rejected since the last error)", err, l.unlogged)
+	} else {
+		fc.logger.Errorf("rejecting frame: %v", err)
+	}
+	l.undersized = true
+	l.lastLogged = now
+	l.unlogged = 0
+}
+
+// sizedImages returns the images that pass checkImageSize, logging the rest through logImageSize.
+func (fc *filteredCamera) sizedImages(images []camera.NamedImage) []camera.NamedImage {
+	if fc.conf.MinImageWidth <= 0 && fc.conf.MinImageHeight <= 0 {
+		return images
+	}
+	res := make([]camera.NamedImage, 0, len(images))
+	for _, img := range images {
+		err := fc.checkImageSize(img)
+		fc.logImageSize(err)
+		if err != nil {
+			continue
+		}
+		res = append(res, img)
+	}
+	return res
+}
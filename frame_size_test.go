@@ -0,0 +1,59 @@
+package filtered_camera
+
+import (
+	"context"
+	"image"
+	"testing"
+	"time"
+
+	"go.viam.com/rdk/components/camera"
+	"go.viam.com/rdk/data"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/resource"
+	"go.viam.com/rdk/testutils/inject"
+	"go.viam.com/test"
+
+	imagebuffer "github.com/viam-modules/filtered_camera/image_buffer"
+)
+
+func TestMinImageSize(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	ctx := context.Background()
+
+	size := 1
+	imagesCam := inject.NewCamera("test_camera")
+	imagesCam.ImagesFunc = func(ctx context.Context, filterSourceNames []string, extra map[string]interface{}) (
+		[]camera.NamedImage, resource.ResponseMetadata, error) {
+		img, _ := camera.NamedImageFromImage(image.NewGray(image.Rect(0, 0, size, size)), "color", "image/jpeg", data.Annotations{})
+		return []camera.NamedImage{img}, resource.ResponseMetadata{CapturedAt: time.Now()}, nil
+	}
+	fc := &filteredCamera{
+		conf:   &Config{WindowSeconds: 1, ImageFrequency: 1.0, MinImageWidth: 8, MinImageHeight: 4},
+		logger: logger,
+		cam:    imagesCam,
+		buf:    imagebuffer.NewImageBuffer(1, 1.0, 0, 0, logger, false, 0),
+	}
+
+	// a frame below the minimum never reaches the buffer or vision
+	fc.captureImageInBackground(ctx)
+	test.That(t, fc.buf.GetRingBufferLength(), test.ShouldEqual, 0)
+	images, _, err := imagesCam.Images(ctx, nil, nil)
+	test.That(t, err, test.ShouldBeNil)
+	send, _, err := fc.shouldSend(ctx, images[0], time.Now())
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, send, test.ShouldBeFalse)
+	test.That(t, fc.rejectedStats.Breakdown, test.ShouldResemble, map[string]int{"undersized": 1})
+
+	// a large enough frame is buffered, and with no vision services it is sent
+	size = 10
+	fc.captureImageInBackground(ctx)
+	test.That(t, fc.buf.GetRingBufferLength(), test.ShouldEqual, 1)
+	images, _, err = imagesCam.Images(ctx, nil, nil)
+	test.That(t, err, test.ShouldBeNil)
+	send, _, err = fc.shouldSend(ctx, images[0], time.Now())
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, send, test.ShouldBeTrue)
+
+	// undecodable frames are skipped too
+	test.That(t, fc.checkImageSize(camera.NamedImage{SourceName: "empty"}), test.ShouldNotBeNil)
+}
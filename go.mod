@@ -9,6 +9,7 @@ require (
 	go.viam.com/rdk v0.124.0-rc0.0.20260428155858-62da9535aca4
 	go.viam.com/test v1.2.4
 	go.viam.com/utils v0.4.19
+	golang.org/x/image v0.25.0
 )
 
 require (
@@ -222,7 +223,6 @@ require (
 	goji.io v2.0.2+incompatible // indirect
 	golang.org/x/crypto v0.47.0 // indirect
 	golang.org/x/exp v0.0.0-20251113190631-e25ba8c21ef6 // indirect
-	golang.org/x/image v0.25.0 // indirect
 	golang.org/x/mod v0.31.0 // indirect
 	golang.org/x/net v0.49.0 // indirect
 	golang.org/x/oauth2 v0.34.0 // indirect
@@ -0,0 +1,174 @@
+package filtered_camera
+
+import (
+	"context"
+
+	"go.viam.com/rdk/components/camera"
+	"go.viam.com/rdk/resource"
+	"go.viam.com/rdk/vision/classification"
+)
+
+// hasSustain returns true if any accepting vision service has a sustain threshold, so that frames captured while a
+// capture window is open are run through it.
+func (fc *filteredCamera) hasSustain() bool {
+	for _, byService := range []map[string]map[string]float64{fc.sustainClassifications, fc.sustainObjects} {
+		for _, scores := range byService {
+			if len(scores) > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sustainWindow extends the open capture window from a frame captured while it is open, if the frame scores above
+// the sustain threshold of one of its labels. Only the vision services with sustain thresholds and the inhibitors run,
+// so this is lighter than the filter that opened the window, and nothing is counted in the stats. A vision error
+// leaves the window as it is.
+func (fc *filteredCamera) sustainWindow(ctx context.Context, images []camera.NamedImage, meta resource.ResponseMetadata) {
+	label, score, ok, err := fc.sustained(ctx, images)
+	if err != nil {
+		fc.logger.Debugf("could not check sustain thresholds, not extending the capture window: %v", err)
+		return
+	}
+	if ok && fc.buf.MarkShouldSendForReason(meta.CapturedAt, label, score) {
+		fc.logger.Debugf("%q scored %.2f, above its sustain threshold, extending the capture window from %s", label, score, meta.CapturedAt)
+	}
+}
+
+// extendSameLabel runs the filter over a frame captured while the capture window is open, with extend_same_label_only,
+// so that a trigger for the label that opened the window extends it while one for any other label doesn't. Like
+// sustainWindow, nothing is counted in the stats and a vision error leaves the window as it is.
+func (fc *filteredCamera) extendSameLabel(ctx context.Context, images []camera.NamedImage, meta resource.ResponseMetadata) {
+	for _, i := range fc.visionIndexes(images) {
+		v, err := fc.evaluateFrame(ctx, images[i], meta.CapturedAt)
+		if err != nil {
+			fc.logger.Debugf("could not run the filter, not extending the capture window: %v", err)
+			return
+		}
+		if !v.send {
+			continue
+		}
+		label, score := triggerReason(v.annotations)
+		if fc.buf.MarkShouldSendForReason(meta.CapturedAt, label, score) {
+			fc.logger.Debugf("%q triggered again, extending the capture window from %s", label, meta.CapturedAt)
+			return
+		}
+	}
+}
+
+// sustained runs the accepting vision services that have sustain thresholds over the vision sources among images,
+// returning the first label that scores above its sustain threshold along with its score. Results are filtered as
+// they are for opening a window: detections are normalized and cut down to the score floor and top_n, and ceilings,
+// min_area and min_top_margin apply. A frame vetoed by an inhibitor, or a service vetoed by a scoped one, doesn't
+// sustain the window.
+func (fc *filteredCamera) sustained(ctx context.Context, images []camera.NamedImage) (string, float64, bool, error) {
+	for _, i := range fc.visionIndexes(images) {
+		frame, err := fc.newVisionFrame(ctx, images[i])
+		if err != nil {
+			return "", 0, false, err
+		}
+		inhibited, err := fc.inhibitedFrame(ctx, frame)
+		if err != nil {
+			return "", 0, false, err
+		}
+		if inhibited {
+			continue
+		}
+		scoped := map[string]inhibitorResult{}
+		for _, vs := range fc.otherVisionServices {
+			if err := ctx.Err(); err != nil {
+				return "", 0, false, err
+			}
+			name := vs.Name().Name
+			if len(fc.sustainClassifications[name]) == 0 && len(fc.sustainObjects[name]) == 0 {
+				continue
+			}
+			_, vetoed, err := fc.vetoedFor(ctx, name, frame, scoped)
+			if err != nil {
+				return "", 0, false, err
+			}
+			if vetoed {
+				continue
+			}
+			img, err := fc.serviceImage(ctx, name, frame)
+			if err != nil {
+				return "", 0, false, err
+			}
+			if scores := fc.sustainClassifications[name]; len(scores) > 0 {
+				res, err := vs.Classifications(ctx, img, fc.classificationsTopN(), nil)
+				if err != nil {
+					return "", 0, false, err
+				}
+				if c, ok := fc.sustainingClassification(name, scores, res); ok {
+					return c.Label(), c.Score(), true, nil
+				}
+			}
+			if scores := fc.sustainObjects[name]; len(scores) > 0 {
+				res, err := vs.Detections(ctx, img, nil)
+				if err != nil {
+					return "", 0, false, err
+				}
+				res = fc.topDetections(fc.aboveScoreFloor(fc.normalizeDetections(img, res)))
+				for _, d := range res {
+					fits := func(key string) bool { return largeEnough(fc.objectMinAreas[name], key, d) }
+					if fc.sustainMatches(scores, fc.objectCeilings[name], d.Label(), d.Score(), fits) {
+						return d.Label(), d.Score(), true, nil
+					}
+				}
+			}
+		}
+	}
+	return "", 0, false, nil
+}
+
+// inhibitedFrame returns true if any of the inhibitors that veto the whole frame matches frame.
+func (fc *filteredCamera) inhibitedFrame(ctx context.Context, frame *visionFrame) (bool, error) {
+	for _, vs := range fc.globalInhibitors() {
+		inhibited, _, err := fc.inhibitedBy(ctx, vs, frame)
+		if err != nil || inhibited {
+			return inhibited, err
+		}
+	}
+	return false, nil
+}
+
+// sustainingClassification returns the best scoring of cs that clears its sustain threshold in scores, as long as it
+// beats the runner-up by the min_top_margin of visionService.
+func (fc *filteredCamera) sustainingClassification(
+	visionService string, scores map[string]float64, cs []classification.Classification,
+) (classification.Classification, bool) {
+	var best classification.Classification
+	for _, c := range cs {
+		if !fc.sustainMatches(scores, fc.classificationCeilings[visionService], c.Label(), c.Score(), nil) {
+			continue
+		}
+		if best == nil || c.Score() > best.Score() {
+			best = c
+		}
+	}
+	if best == nil || !hasTopMargin(cs, best, fc.serviceConfigs[visionService].MinTopMargin) {
+		return nil, false
+	}
+	return best, true
+}
+
+// sustainMatches returns true if score is above the sustain threshold for label and no higher than the ceiling of
+// the same key, looked up by exact label, by pattern and then by wildcard. If fits is set, the key must also pass it.
+func (fc *filteredCamera) sustainMatches(
+	scores, ceilings map[string]float64, label string, score float64, fits func(key string) bool,
+) bool {
+	matches := func(key string) bool {
+		return fc.clears(score, scores[key]) && belowCeiling(ceilings, key, score) && (fits == nil || fits(key))
+	}
+	if _, has := scores[label]; has && matches(label) {
+		return true
+	}
+	for _, key := range fc.matchingPatterns(scores, label) {
+		if matches(key) {
+			return true
+		}
+	}
+	_, has := scores["*"]
+	return has && matches("*")
+}
@@ -0,0 +1,199 @@
+package filtered_camera
+
+import (
+	"context"
+	"image"
+	"testing"
+	"time"
+
+	"go.viam.com/rdk/components/camera"
+	"go.viam.com/rdk/data"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/resource"
+	"go.viam.com/rdk/services/vision"
+	"go.viam.com/rdk/testutils/inject"
+	rutils "go.viam.com/rdk/utils"
+	"go.viam.com/rdk/vision/classification"
+	"go.viam.com/test"
+
+	imagebuffer "github.com/viam-modules/filtered_camera/image_buffer"
+)
+
+func TestSustainThreshold(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	ctx := context.Background()
+	baseTime := time.Now()
+
+	captures := 0
+	cam := inject.NewCamera("cam")
+	cam.ImagesFunc = func(ctx context.Context, filterSourceNames []string, extra map[string]interface{}) ([]camera.NamedImage, resource.ResponseMetadata, error) {
+		captures++
+		img, _ := camera.NamedImageFromImage(image.NewRGBA(image.Rect(0, 0, 10, 10)), "color", "image/jpeg", data.Annotations{})
+		return []camera.NamedImage{img}, resource.ResponseMetadata{CapturedAt: baseTime.Add(time.Duration(captures) * time.Second)}, nil
+	}
+	score := 0.0
+	visionSvc := inject.NewVisionService("classifier")
+	visionSvc.ClassificationsFunc = func(ctx context.Context, img *camera.NamedImage, n int, extra map[string]interface{}) (classification.Classifications, error) {
+		return classification.Classifications{classification.NewClassification(score, "person")}, nil
+	}
+
+	fc := &filteredCamera{
+		conf:                    &Config{WindowSecondsAfter: 2, ImageFrequency: 1.0},
+		logger:                  logger,
+		cam:                     cam,
+		otherVisionServices:     []vision.Service{visionSvc},
+		acceptedClassifications: map[string]map[string]float64{"classifier": {"person": 0.9}},
+		sustainClassifications:  map[string]map[string]float64{"classifier": {"person": 0.6}},
+		buf:                     imagebuffer.NewImageBuffer(0, 1.0, 0, 2, logger, false, 0),
+	}
+	capture := func(s float64) time.Time {
+		score = s
+		_, _, err := fc.Images(ctx, nil, map[string]interface{}{data.FromDMString: true})
+		if err != nil {
+			test.That(t, err, test.ShouldEqual, data.ErrNoCaptureToStore)
+		}
+		return fc.buf.Status().CaptureTill
+	}
+	at := func(seconds int) time.Time { return baseTime.Add(time.Duration(seconds) * time.Second) }
+
+	// the enter threshold opens the window, the lower sustain threshold keeps extending it
+	test.That(t, capture(0.95).Equal(at(3)), test.ShouldBeTrue)
+	test.That(t, capture(0.7).Equal(at(4)), test.ShouldBeTrue)
+	test.That(t, capture(0.7).Equal(at(5)), test.ShouldBeTrue)
+	test.That(t, capture(0.5).Equal(at(5)), test.ShouldBeTrue)
+	test.That(t, capture(0.5).Equal(at(5)), test.ShouldBeTrue)
+
+	// once the window has closed it takes the enter threshold to open a new one
+	test.That(t, capture(0.7).Equal(at(5)), test.ShouldBeTrue)
+	test.That(t, capture(0.95).Equal(at(9)), test.ShouldBeTrue)
+	test.That(t, fc.acceptedStats.Total, test.ShouldEqual, 2)
+}
+
+func TestExtendSameLabelOnly(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	ctx := context.Background()
+	baseTime := time.Now()
+
+	captures := 0
+	cam := inject.NewCamera("cam")
+	cam.ImagesFunc = func(ctx context.Context, filterSourceNames []string, extra map[string]interface{}) ([]camera.NamedImage, resource.ResponseMetadata, error) {
+		captures++
+		img, _ := camera.NamedImageFromImage(image.NewRGBA(image.Rect(0, 0, 10, 10)), "color", "image/jpeg", data.Annotations{})
+		return []camera.NamedImage{img}, resource.ResponseMetadata{CapturedAt: baseTime.Add(time.Duration(captures) * time.Second)}, nil
+	}
+	label := ""
+	visionSvc := inject.NewVisionService("classifier")
+	visionSvc.ClassificationsFunc = func(ctx context.Context, img *camera.NamedImage, n int, extra map[string]interface{}) (classification.Classifications, error) {
+		return classification.Classifications{classification.NewClassification(0.9, label)}, nil
+	}
+
+	fc := &filteredCamera{
+		conf:                    &Config{WindowSecondsAfter: 3, ImageFrequency: 1.0, ExtendSameLabelOnly: true},
+		logger:                  logger,
+		cam:                     cam,
+		otherVisionServices:     []vision.Service{visionSvc},
+		acceptedClassifications: map[string]map[string]float64{"classifier": {"person": 0.5, "vehicle": 0.5}},
+		buf:                     imagebuffer.NewImageBuffer(0, 1.0, 0, 3, logger, false, 0),
+	}
+	fc.buf.SetExtendSameLabelOnly(true)
+	capture := func(l string) time.Time {
+		label = l
+		_, _, err := fc.Images(ctx, nil, map[string]interface{}{data.FromDMString: true})
+		if err != nil {
+			test.That(t, err, test.ShouldEqual, data.ErrNoCaptureToStore)
+		}
+		return fc.buf.Status().CaptureTill
+	}
+	at := func(seconds int) time.Time { return baseTime.Add(time.Duration(seconds) * time.Second) }
+
+	// person opens the window, vehicle triggering inside it doesn't extend it, and person does
+	test.That(t, capture("person").Equal(at(4)), test.ShouldBeTrue)
+	test.That(t, capture("vehicle").Equal(at(4)), test.ShouldBeTrue)
+	test.That(t, capture("person").Equal(at(6)), test.ShouldBeTrue)
+	// frames run through the filter inside the window aren't counted
+	test.That(t, fc.acceptedStats.Total, test.ShouldEqual, 1)
+}
+
+func TestSustainConfig(t *testing.T) {
+	attributes := func(person interface{}, inhibit bool) rutils.AttributeMap {
+		return rutils.AttributeMap{
+			"camera":         "cam",
+			"window_seconds": 10,
+			"vision_services": []interface{}{
+				map[string]interface{}{
+					"vision":          "classifier",
+					"inhibit":         inhibit,
+					"classifications": map[string]interface{}{"person": person},
+				},
+			},
+		}
+	}
+
+	conf, err := configFromAttributes(attributes(map[string]interface{}{"enter": 0.9, "sustain": 0.6}, false))
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, conf.VisionServices[0].Classifications["person"], test.ShouldResemble, Threshold{Min: 0.9, Sustain: 0.6})
+	_, _, err = conf.Validate("camera")
+	test.That(t, err, test.ShouldBeNil)
+
+	// sustaining takes less than entering
+	conf, err = configFromAttributes(attributes(map[string]interface{}{"enter": 0.6, "sustain": 0.9}, false))
+	test.That(t, err, test.ShouldBeNil)
+	_, _, err = conf.Validate("camera")
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, err.Error(), test.ShouldContainSubstring, "sustain")
+
+	conf, err = configFromAttributes(attributes(map[string]interface{}{"enter": 0.9, "sustain": 0.6}, true))
+	test.That(t, err, test.ShouldBeNil)
+	_, _, err = conf.Validate("camera")
+	test.That(t, err, test.ShouldNotBeNil)
+
+	_, err = configFromAttributes(attributes(map[string]interface{}{"enter": 0.9, "min": 0.8}, false))
+	test.That(t, err, test.ShouldNotBeNil)
+}
+
+func TestSustainFiltered(t *testing.T) {
+	ctx := context.Background()
+	img, err := camera.NamedImageFromImage(image.NewRGBA(image.Rect(0, 0, 10, 10)), "color", "image/jpeg", data.Annotations{})
+	test.That(t, err, test.ShouldBeNil)
+
+	score := 0.7
+	classifier := inject.NewVisionService("classifier")
+	classifier.ClassificationsFunc = func(ctx context.Context, img *camera.NamedImage, n int, extra map[string]interface{}) (classification.Classifications, error) {
+		return classification.Classifications{classification.NewClassification(score, "person")}, nil
+	}
+	inhibited := false
+	inhibitor := inject.NewVisionService("inhibitor")
+	inhibitor.ClassificationsFunc = func(ctx context.Context, img *camera.NamedImage, n int, extra map[string]interface{}) (classification.Classifications, error) {
+		if inhibited {
+			return classification.Classifications{classification.NewClassification(0.9, "staff")}, nil
+		}
+		return classification.Classifications{}, nil
+	}
+	fc := &filteredCamera{
+		conf:                     &Config{},
+		logger:                   logging.NewTestLogger(t),
+		otherVisionServices:      []vision.Service{classifier},
+		inhibitors:               []vision.Service{inhibitor},
+		acceptedClassifications:  map[string]map[string]float64{"classifier": {"person": 0.9}},
+		inhibitedClassifications: map[string]map[string]float64{"inhibitor": {"staff": 0.5}},
+		sustainClassifications:   map[string]map[string]float64{"classifier": {"person": 0.6}},
+		classificationCeilings:   map[string]map[string]float64{"classifier": {"person": 0.8}},
+	}
+
+	_, _, ok, err := fc.sustained(ctx, []camera.NamedImage{img})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, ok, test.ShouldBeTrue)
+
+	// a score over the ceiling doesn't sustain the window any more than it would open one
+	score = 0.85
+	_, _, ok, err = fc.sustained(ctx, []camera.NamedImage{img})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, ok, test.ShouldBeFalse)
+
+	// neither does a frame an inhibitor matches
+	score = 0.7
+	inhibited = true
+	_, _, ok, err = fc.sustained(ctx, []camera.NamedImage{img})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, ok, test.ShouldBeFalse)
+}
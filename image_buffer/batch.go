@@ -0,0 +1,50 @@
+package imagebuffer
+
+import (
+	"sort"
+	"strings"
+
+	"go.viam.com/rdk/components/camera"
+	"go.viam.com/rdk/resource"
+)
+
+// queueToSend adds frames to ToSend, keeping it sorted by capture time, oldest first. A frame goes after any
+// already queued with the same capture time, so frames usually land at the end without moving anything. Frames
+// are not deduplicated here: markShouldSend already skips ring buffer frames that are in ToSend.
+// Must be called with the mutex held.
+func (ib *ImageBuffer) queueToSend(frames ...CachedData) {
+	for _, frame := range frames {
+		i := sort.Search(len(ib.toSend), func(i int) bool {
+			return ib.toSend[i].Meta.CapturedAt.After(frame.Meta.CapturedAt)
+		})
+		ib.toSend = append(ib.toSend, CachedData{})
+		copy(ib.toSend[i+1:], ib.toSend[i:])
+		ib.toSend[i] = frame
+	}
+}
+
+// PopBatch returns the next batch of images to emit from ToSend, oldest first: just the first frame in
+// single image mode, otherwise every queued frame as one batch. It returns false if ToSend is empty.
+func (ib *ImageBuffer) PopBatch(singleImageMode bool) ([]camera.NamedImage, resource.ResponseMetadata, bool) {
+	if singleImageMode {
+		if x, ok := ib.PopFirstToSend(); ok {
+			return x.Imgs, x.Meta, true
+		}
+		return nil, resource.ResponseMetadata{}, false
+	}
+	return ib.PopAllToSend()
+}
+
+// SourceImage returns the image of images that came from source, which may carry the timestamp prefix added by
+// TimestampImagesToNames, or the first image if source is empty. It returns false if no image came from source.
+func SourceImage(images []camera.NamedImage, source string) (camera.NamedImage, bool) {
+	for _, img := range images {
+		if source == "" || img.SourceName == source {
+			return img, true
+		}
+		if _, name, ok := strings.Cut(img.SourceName, "_"); ok && name == source {
+			return img, true
+		}
+	}
+	return camera.NamedImage{}, false
+}
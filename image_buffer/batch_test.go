@@ -0,0 +1,103 @@
+package imagebuffer
+
+import (
+	"testing"
+	"time"
+
+	"go.viam.com/rdk/components/camera"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/resource"
+	"go.viam.com/test"
+)
+
+func frameAt(t time.Time, sources ...string) CachedData {
+	imgs := make([]camera.NamedImage, 0, len(sources))
+	for _, source := range sources {
+		imgs = append(imgs, camera.NamedImage{SourceName: source})
+	}
+	return CachedData{Imgs: imgs, Meta: resource.ResponseMetadata{CapturedAt: t}}
+}
+
+func TestQueueToSend(t *testing.T) {
+	base := time.Now()
+	buf := NewImageBuffer(10, 1.0, 0, 0, logging.NewTestLogger(t), false, 0)
+	frames := []CachedData{
+		frameAt(base.Add(2*time.Second), "color"),
+		frameAt(base, "color"),
+		frameAt(base.Add(time.Second), "color", "depth"),
+		frameAt(base.Add(time.Millisecond), "color"),
+		frameAt(base.Add(time.Second), "color", "ir"), // same time, queued after the depth frame
+	}
+	buf.queueToSend(frames[:2]...)
+	buf.queueToSend(frames[2:]...)
+
+	test.That(t, len(buf.toSend), test.ShouldEqual, 5)
+	expected := []CachedData{frames[1], frames[3], frames[2], frames[4], frames[0]}
+	for i := range expected {
+		test.That(t, buf.toSend[i].Meta.CapturedAt.Equal(expected[i].Meta.CapturedAt), test.ShouldBeTrue)
+		test.That(t, buf.toSend[i].Imgs, test.ShouldResemble, expected[i].Imgs)
+	}
+	oldest, ok := buf.OldestToSend()
+	test.That(t, ok, test.ShouldBeTrue)
+	test.That(t, oldest.Equal(base), test.ShouldBeTrue)
+}
+
+func TestPopBatch(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	base := time.Now()
+	queue := func() *ImageBuffer {
+		buf := NewImageBuffer(10, 1.0, 0, 0, logger, true, 0)
+		buf.queueToSend(
+			frameAt(base.Add(2*time.Second), "color"),
+			frameAt(base, "color"),
+			frameAt(base.Add(time.Second), "color"),
+		)
+		return buf
+	}
+
+	// all frames come out as one ordered batch
+	buf := queue()
+	imgs, meta, ok := buf.PopBatch(false)
+	test.That(t, ok, test.ShouldBeTrue)
+	test.That(t, meta.CapturedAt.Equal(base), test.ShouldBeTrue)
+	test.That(t, len(imgs), test.ShouldEqual, 3)
+	for i, img := range imgs {
+		test.That(t, img.SourceName, test.ShouldEqual, base.Add(time.Duration(i)*time.Second).Format(timestampFormat)+"_color")
+	}
+	_, _, ok = buf.PopBatch(false)
+	test.That(t, ok, test.ShouldBeFalse)
+
+	// or one at a time, in the same order
+	buf = queue()
+	for i := 0; i < 3; i++ {
+		imgs, meta, ok := buf.PopBatch(true)
+		test.That(t, ok, test.ShouldBeTrue)
+		test.That(t, len(imgs), test.ShouldEqual, 1)
+		test.That(t, meta.CapturedAt.Equal(base.Add(time.Duration(i)*time.Second)), test.ShouldBeTrue)
+	}
+	_, _, ok = buf.PopBatch(true)
+	test.That(t, ok, test.ShouldBeFalse)
+}
+
+func TestSourceImage(t *testing.T) {
+	base := time.Now()
+	frame := frameAt(base, "color", "depth")
+	named := TimestampImagesToNames(frame.Imgs, frame.Meta)
+
+	img, ok := SourceImage(named, "depth")
+	test.That(t, ok, test.ShouldBeTrue)
+	test.That(t, img.SourceName, test.ShouldEqual, base.Format(timestampFormat)+"_depth")
+	img, ok = SourceImage(frame.Imgs, "depth")
+	test.That(t, ok, test.ShouldBeTrue)
+	test.That(t, img.SourceName, test.ShouldEqual, "depth")
+
+	// without a source, the first image is returned
+	img, ok = SourceImage(named, "")
+	test.That(t, ok, test.ShouldBeTrue)
+	test.That(t, img.SourceName, test.ShouldEqual, base.Format(timestampFormat)+"_color")
+
+	_, ok = SourceImage(named, "ir")
+	test.That(t, ok, test.ShouldBeFalse)
+	_, ok = SourceImage(nil, "")
+	test.That(t, ok, test.ShouldBeFalse)
+}
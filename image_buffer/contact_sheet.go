@@ -0,0 +1,98 @@
+package imagebuffer
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/pkg/errors"
+	"go.viam.com/rdk/components/camera"
+	"go.viam.com/rdk/data"
+	"golang.org/x/image/draw"
+)
+
+const (
+	// ContactSheetSourceName is the source name of the contact sheet image, after the batch's timestamp
+	ContactSheetSourceName = "contact_sheet"
+	// contactSheetTileWidth is the width each frame is downscaled to on the contact sheet
+	contactSheetTileWidth = 160
+)
+
+var errNoContactSheetFrames = errors.New("no frames with images for the contact sheet")
+
+// SetContactSheet controls whether PopAllToSend adds a single downscaled contact sheet of the batch's frames,
+// named "[timestamp]_contact_sheet", after the full resolution images.
+func (ib *ImageBuffer) SetContactSheet(contactSheet bool) {
+	ib.mu.Lock()
+	defer ib.mu.Unlock()
+	ib.contactSheet = contactSheet
+}
+
+// appendContactSheet adds the contact sheet of frames to images. Frames that can't be decoded are left blank,
+// and if none can the images are returned unchanged.
+func (ib *ImageBuffer) appendContactSheet(images []camera.NamedImage, frames []CachedData) []camera.NamedImage {
+	if len(frames) == 0 {
+		return images
+	}
+	sheet, err := ContactSheet(context.Background(), frames)
+	if err != nil {
+		ib.logger.Warnf("could not build contact sheet: %v", err)
+		return images
+	}
+	named, err := camera.NamedImageFromImage(sheet, ContactSheetSourceName, "image/jpeg", data.Annotations{})
+	if err != nil {
+		ib.logger.Warnf("could not build contact sheet: %v", err)
+		return images
+	}
+	_, meta := combineFrames(frames)
+	return append(images, TimestampImagesToNames([]camera.NamedImage{named}, meta)...)
+}
+
+// ContactSheet tiles the first image of each frame, in order, into a roughly square grid. Each tile is
+// contactSheetTileWidth pixels wide, with the aspect ratio of the first frame.
+func ContactSheet(ctx context.Context, frames []CachedData) (image.Image, error) {
+	decoded := make([]image.Image, len(frames))
+	var firstErr error
+	var first image.Image
+	for i, frame := range frames {
+		if len(frame.Imgs) == 0 {
+			continue
+		}
+		img, err := frame.Imgs[0].Image(ctx)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		decoded[i] = img
+		if first == nil {
+			first = img
+		}
+	}
+	if first == nil {
+		if firstErr == nil {
+			firstErr = errNoContactSheetFrames
+		}
+		return nil, firstErr
+	}
+
+	bounds := first.Bounds()
+	tileWidth := contactSheetTileWidth
+	tileHeight := int(math.Max(1, math.Round(float64(tileWidth*bounds.Dy())/float64(bounds.Dx()))))
+	cols := int(math.Ceil(math.Sqrt(float64(len(frames)))))
+	rows := (len(frames) + cols - 1) / cols
+
+	sheet := image.NewRGBA(image.Rect(0, 0, cols*tileWidth, rows*tileHeight))
+	draw.Draw(sheet, sheet.Bounds(), image.NewUniform(color.Black), image.Point{}, draw.Src)
+	for i, img := range decoded {
+		if img == nil {
+			continue
+		}
+		x, y := (i%cols)*tileWidth, (i/cols)*tileHeight
+		tile := image.Rect(x, y, x+tileWidth, y+tileHeight)
+		draw.ApproxBiLinear.Scale(sheet, tile, img, img.Bounds(), draw.Src, nil)
+	}
+	return sheet, nil
+}
@@ -0,0 +1,86 @@
+package imagebuffer
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"testing"
+	"time"
+
+	"go.viam.com/rdk/components/camera"
+	"go.viam.com/rdk/data"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/resource"
+	"go.viam.com/test"
+)
+
+func solidFrame(t *testing.T, c color.RGBA, capturedAt time.Time) CachedData {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, 320, 240))
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = c.R, c.G, c.B, c.A
+	}
+	named, err := camera.NamedImageFromImage(img, "color", "image/jpeg", data.Annotations{})
+	test.That(t, err, test.ShouldBeNil)
+	return CachedData{Imgs: []camera.NamedImage{named}, Meta: resource.ResponseMetadata{CapturedAt: capturedAt}}
+}
+
+func TestContactSheet(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	base := time.Now()
+	red := color.RGBA{R: 255, A: 255}
+	green := color.RGBA{G: 255, A: 255}
+	blue := color.RGBA{B: 255, A: 255}
+
+	buf := NewImageBuffer(10, 1.0, 0, 0, logger, false, 0)
+	buf.SetContactSheet(true)
+	buf.toSend = []CachedData{
+		solidFrame(t, red, base),
+		solidFrame(t, green, base.Add(time.Second)),
+		solidFrame(t, blue, base.Add(2*time.Second)),
+	}
+
+	imgs, meta, ok := buf.PopAllToSend()
+	test.That(t, ok, test.ShouldBeTrue)
+	test.That(t, meta.CapturedAt.Equal(base), test.ShouldBeTrue)
+
+	// the full frames come first, followed by the contact sheet
+	test.That(t, len(imgs), test.ShouldEqual, 4)
+	for i := 0; i < 3; i++ {
+		test.That(t, imgs[i].SourceName, test.ShouldEqual, base.Add(time.Duration(i)*time.Second).Format(timestampFormat)+"_color")
+		bounds, err := imgs[i].Bounds()
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, bounds.Dx(), test.ShouldEqual, 320)
+	}
+	test.That(t, imgs[3].SourceName, test.ShouldEqual, base.Format(timestampFormat)+"_"+ContactSheetSourceName)
+
+	// three frames are tiled 2x2 at 160x120 each, in capture order
+	sheet, err := imgs[3].Image(context.Background())
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, sheet.Bounds(), test.ShouldResemble, image.Rect(0, 0, 320, 240))
+	for _, tc := range []struct {
+		x, y     int
+		expected color.RGBA
+	}{
+		{80, 60, red},
+		{240, 60, green},
+		{80, 180, blue},
+		{240, 180, color.RGBA{A: 255}},
+	} {
+		test.That(t, color.RGBAModel.Convert(sheet.At(tc.x, tc.y)), test.ShouldResemble, tc.expected)
+	}
+
+	// the transactional pop includes it too, and nothing is added without the option
+	buf.toSend = []CachedData{solidFrame(t, red, base)}
+	imgs, _, pop, ok := buf.PopAllToSendTx()
+	test.That(t, ok, test.ShouldBeTrue)
+	buf.CommitPop(pop)
+	test.That(t, len(imgs), test.ShouldEqual, 2)
+	test.That(t, imgs[1].SourceName, test.ShouldEqual, base.Format(timestampFormat)+"_"+ContactSheetSourceName)
+
+	buf.SetContactSheet(false)
+	buf.toSend = []CachedData{solidFrame(t, red, base)}
+	imgs, _, ok = buf.PopAllToSend()
+	test.That(t, ok, test.ShouldBeTrue)
+	test.That(t, len(imgs), test.ShouldEqual, 1)
+}
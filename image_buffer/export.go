@@ -0,0 +1,45 @@
+package imagebuffer
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// ExportPage returns up to limit ring buffer frames, oldest first, along with the cursor of the next page. An empty
+// cursor starts from the oldest frame, and the returned cursor is empty once every frame has been returned.
+// Paging covers the frames buffered when the first page was read, each exactly once: frames stored since are left
+// out, and frames evicted since are skipped. Capture windows are not affected.
+func (ib *ImageBuffer) ExportPage(cursor string, limit int) ([]CachedData, string, error) {
+	if limit <= 0 {
+		return nil, "", errors.Errorf("limit must be positive, got %d", limit)
+	}
+
+	ib.mu.Lock()
+	defer ib.mu.Unlock()
+
+	// the cursor holds the ID of the last frame returned and of the last frame in the snapshot
+	var after, upTo uint64
+	if cursor == "" {
+		upTo = ib.lastID
+	} else if _, err := fmt.Sscanf(cursor, "%d-%d", &after, &upTo); err != nil {
+		return nil, "", errors.Wrapf(err, "invalid export cursor %q", cursor)
+	}
+
+	page := []CachedData{}
+	remaining := false
+	for _, cached := range ib.ringBuffer {
+		if cached.ID <= after || cached.ID > upTo {
+			continue
+		}
+		if len(page) == limit {
+			remaining = true
+			break
+		}
+		page = append(page, cached)
+	}
+	if !remaining {
+		return ib.loadedFrames(page), "", nil
+	}
+	return ib.loadedFrames(page), fmt.Sprintf("%d-%d", page[len(page)-1].ID, upTo), nil
+}
@@ -0,0 +1,54 @@
+package imagebuffer
+
+import (
+	"testing"
+	"time"
+
+	"go.viam.com/rdk/components/camera"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/resource"
+	"go.viam.com/test"
+)
+
+func TestExportPage(t *testing.T) {
+	buf := NewImageBuffer(0, 1.0, 5, 5, logging.NewTestLogger(t), false, 0)
+	base := time.Now()
+	add := func(i int) {
+		buf.AddToRingBuffer([]camera.NamedImage{{SourceName: "color"}}, resource.ResponseMetadata{CapturedAt: base.Add(time.Duration(i) * time.Second)})
+	}
+	for i := 0; i < 7; i++ {
+		add(i)
+	}
+
+	_, _, err := buf.ExportPage("", 0)
+	test.That(t, err, test.ShouldNotBeNil)
+	_, _, err = buf.ExportPage("nonsense", 3)
+	test.That(t, err, test.ShouldNotBeNil)
+
+	// pages of 3 cover every frame exactly once, ignoring frames stored while paging
+	seen := []time.Time{}
+	cursor := ""
+	for pages := 0; ; pages++ {
+		test.That(t, pages, test.ShouldBeLessThan, 3)
+		frames, next, err := buf.ExportPage(cursor, 3)
+		test.That(t, err, test.ShouldBeNil)
+		for _, frame := range frames {
+			seen = append(seen, frame.Meta.CapturedAt)
+		}
+		add(10 + pages)
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	test.That(t, len(seen), test.ShouldEqual, 7)
+	for i, capturedAt := range seen {
+		test.That(t, capturedAt.Equal(base.Add(time.Duration(i)*time.Second)), test.ShouldBeTrue)
+	}
+
+	// a new export picks up everything buffered now
+	frames, next, err := buf.ExportPage("", 100)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, next, test.ShouldEqual, "")
+	test.That(t, len(frames), test.ShouldEqual, 10)
+}
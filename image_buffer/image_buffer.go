@@ -1,10 +1,13 @@
 package imagebuffer
 
 import (
+	"sort"
+	"strconv"
 	"sync"
 	"time"
 
 	"go.viam.com/rdk/components/camera"
+	"go.viam.com/rdk/data"
 	"go.viam.com/rdk/logging"
 	"go.viam.com/rdk/resource"
 )
@@ -14,15 +17,122 @@ const (
 	noDateString    = "no-date"
 )
 
+// SeqLabelPrefix prefixes the classification label that carries a frame's sequence number within its capture window,
+// e.g. "seq:3".
+const SeqLabelPrefix = "seq:"
+
+// CorrelationIDLabelPrefix prefixes the classification label that carries the external correlation ID of a frame's
+// capture window, e.g. "correlation_id:order-1234".
+const CorrelationIDLabelPrefix = "correlation_id:"
+
+// WindowIDLabelPrefix prefixes the classification label that carries the ID of a frame's capture window, or of its
+// segment when long windows are split (see SetSplitWindowEveryN), e.g. "window_id:7".
+const WindowIDLabelPrefix = "window_id:"
+
+// TriggerReasonLabelPrefix prefixes the classification label that carries the label that caused a frame's capture
+// window to be kept, e.g. "trigger_reason:person". The classification's confidence is the score of that label.
+const TriggerReasonLabelPrefix = "trigger_reason:"
+
+// TriggerFrameLabel is the classification label added to the frame of each capture window captured nearest to the
+// trigger that opened it.
+const TriggerFrameLabel = "trigger:true"
+
+// Messages of the structured log events logged as capture windows open and close, see SetEmitEvents.
+const (
+	WindowOpenEvent  = "filtered_camera.window_open"
+	WindowCloseEvent = "filtered_camera.window_close"
+)
+
+// Reasons passed to an EvictionFunc.
+const (
+	// EvictedRingBufferFull is an old frame pushed out of the full ring buffer
+	EvictedRingBufferFull = "ring_buffer_full"
+	// EvictedCompacted is a frame kept out of the ring buffer by compaction, see SetCompact
+	EvictedCompacted = "compacted"
+	// DroppedDuplicate is a ring buffer frame not added to ToSend because it, or a frame with its timestamp, was already queued
+	DroppedDuplicate = "duplicate"
+	// DroppedBurstDuplicate is a frame not added to ToSend because of burst dedupe, see SetBurstDedupe
+	DroppedBurstDuplicate = "burst_duplicate"
+	// DroppedFrameGap is a frame not stored because it was captured too close to the previous one, see SetMinFrameGap
+	DroppedFrameGap = "frame_gap"
+	// DroppedCancelled is a frame removed from ToSend by CancelSince
+	DroppedCancelled = "cancelled"
+	// DroppedToSendFull is an old frame pushed out of a full ToSend, see SetMaxToSend
+	DroppedToSendFull = "to_send_full"
+	// EvictedSpillFull is an old frame dropped from the ring buffer because the spilled frames exceed their budget, see SetSpill
+	EvictedSpillFull = "spill_full"
+	// EvictedSpillFailed is a spilled frame that couldn't be read back from disk
+	EvictedSpillFailed = "spill_failed"
+)
+
+// EvictionFunc is called whenever the buffer discards a frame, with the frame's capture time and the reason.
+// It is called with the buffer locked, so it must not call back into the buffer.
+type EvictionFunc func(capturedAt time.Time, reason string)
+
 type CachedData struct {
 	Imgs []camera.NamedImage
 	Meta resource.ResponseMetadata
+	// ID identifies the frame from when it was stored in the buffer, increasing with every frame stored and unaffected by
+	// its capture time. It is 0 for frames that weren't stored through the buffer.
+	ID uint64
+	// Seq is the position of the frame within its capture window, starting at 0. Only set once the frame is in ToSend.
+	Seq int
+	// CorrelationID is the external ID of the frame's capture window, if it was triggered with one
+	CorrelationID string
+	// Trigger is set on the frame of its capture window captured nearest to the trigger that opened the window
+	Trigger bool
+	// Reason is the label and score that opened or last extended the frame's capture window, if it was given one
+	Reason *data.Classification
+	// window identifies the capture window the frame was queued for, or its segment if the window is split.
+	// opened identifies the whole window.
+	window int
+	opened int
+	// spill is the file holding the frame's images while it is spilled to disk, spillSize its size in bytes
+	spill     string
+	spillSize int64
+}
+
+// WindowSummary describes a capture window once it has closed.
+type WindowSummary struct {
+	Start    time.Time
+	End      time.Time
+	Frames   int
+	Labels   []string
+	MaxScore float64
+}
+
+// Duration returns how long the capture window was open.
+func (ws WindowSummary) Duration() time.Duration {
+	return ws.End.Sub(ws.Start)
+}
+
+// Status describes how the buffer is sized and how full it currently is.
+type Status struct {
+	// MaxImages is the ring buffer capacity, 3 * window seconds * image frequency
+	MaxImages           int
+	WindowSecondsBefore int
+	WindowSecondsAfter  int
+	ImageFrequency      float64
+	// FramesBefore and FramesAfter are how many frames a capture window is expected to hold either side of its trigger
+	FramesBefore   int
+	FramesAfter    int
+	RingBufferSize int
+	ToSendSize     int
+	// CaptureFrom and CaptureTill bound the current or most recent capture window, zero if there hasn't been one
+	CaptureFrom time.Time
+	CaptureTill time.Time
+}
+
+// Pop is a batch of frames taken from ToSend that can be put back with RollbackPop if delivering them fails.
+type Pop struct {
+	frames []CachedData
+	done   bool
 }
 
 type ImageBuffer struct {
 	mu                  sync.Mutex
 	ringBuffer          []CachedData
-	toSend              []CachedData
+	toSend              []CachedData // sorted by capture time, see queueToSend
 	captureFrom         time.Time
 	captureTill         time.Time
 	cooldownTill        time.Time
@@ -33,21 +143,103 @@ type ImageBuffer struct {
 	maxImages           int
 	logger              logging.Logger
 	debug               bool
+	// bufferSeconds is how many seconds of frames, times 3, the ring buffer holds at imageFrequency
+	bufferSeconds int
 	// toSendMaxWarningThreshold is the threshold for warning about ToSend buffer size
 	toSendMaxWarningThreshold int
+	// maxToSend, if positive, caps ToSend, dropping the oldest frames beyond it
+	maxToSend int
+
+	// latest is the most recently stored frame, regardless of which buffer it went to
+	latest CachedData
+
+	// extendSameLabelOnly restricts extending an open window to triggers for the label that opened it
+	extendSameLabelOnly bool
+	windowLabel         string
+
+	// burstDedupe drops frames captured this close to a frame already in ToSend
+	burstDedupe time.Duration
+	// minFrameGap drops frames captured this close to the previously stored frame
+	minFrameGap time.Duration
+	// lastStoredAt is when the last frame passed to StoreImages was captured, zero before the first
+	lastStoredAt time.Time
+
+	// compact drops frames arriving much sooner than imageFrequency after the previous ring buffer frame
+	compact bool
+
+	// contactSheet adds a downscaled contact sheet of each batch returned by PopAllToSend
+	contactSheet bool
+
+	// minWindow is the shortest time a capture window stays open after a trigger
+	minWindow time.Duration
+
+	// annotateSeq adds each frame's sequence number within its window to the annotations of popped images
+	annotateSeq bool
+
+	// annotateTrigger adds TriggerFrameLabel to the popped images of each window's trigger frame
+	annotateTrigger bool
+
+	// annotateReason adds each frame's Reason to the annotations of popped images
+	annotateReason bool
+
+	// emitEvents logs WindowOpenEvent and WindowCloseEvent as windows open and close
+	emitEvents bool
+
+	// state of the currently open capture window, used to build a WindowSummary when it closes
+	windowOpen     bool
+	windowFrames   int
+	windowSeq      int
+	windowLabels   map[string]bool
+	windowMaxScore float64
+	lastSummary    *WindowSummary
+
+	// windowCorrelationID is attached to every frame queued while it is set
+	windowCorrelationID string
+	// windowReason is attached to every frame queued while it is set
+	windowReason *data.Classification
+
+	// onEvict, if set, is told about every frame the buffer discards
+	onEvict EvictionFunc
+
+	// maxPendingWindows, if positive, is how many capture windows can have frames waiting in ToSend before new
+	// windows are refused. windowID identifies the current window, and pendingFull is set while triggers are refused.
+	maxPendingWindows int
+	windowID          int
+	pendingFull       bool
+
+	// splitEveryN, if positive, starts a new segment of the open window, with its own window ID, every this many frames
+	splitEveryN int
+
+	// windowsOpened counts capture windows, identifying the open one. windowTrigger is when it was triggered, and
+	// triggerMarked is set once one of its frames has been flagged as the trigger frame.
+	windowsOpened int
+	windowTrigger time.Time
+	triggerMarked bool
+
+	// lastID is the ID of the most recently stored frame
+	lastID uint64
+
+	// spillDir, if set, is the directory older ring buffer frames are written to, created in spillRoot. spillBytes is
+	// how much they take, up to spillMaxBytes, and spillFailing is set while they can't be written.
+	spillRoot     string
+	spillDir      string
+	spillBytes    int64
+	spillMaxBytes int64
+	spillFailing  bool
+	// spilling holds the IDs of the frames being written to disk outside the mutex
+	spilling map[uint64]bool
 }
 
 func NewImageBuffer(windowSeconds int, imageFrequency float64, windowSecondsBefore int, windowSecondsAfter int, logger logging.Logger, debug bool, cooldownSecs int) *ImageBuffer {
 	// Calculate the maximum number of images to keep in the ring buffer
 	// Keep images for 2 * windowSeconds (before and after trigger)
-	var maxImages int
+	bufferSeconds := windowSecondsBefore + windowSecondsAfter
 	if windowSeconds > 0 {
-		maxImages = int(3 * float64(windowSeconds) * imageFrequency)
+		bufferSeconds = windowSeconds
 		windowSecondsBefore = windowSeconds
 		windowSecondsAfter = windowSeconds
-	} else {
-		maxImages = int(3 * float64(windowSecondsBefore+windowSecondsAfter) * imageFrequency)
 	}
+	maxImages := int(3 * float64(bufferSeconds) * imageFrequency)
 	return &ImageBuffer{
 		ringBuffer:          []CachedData{},
 		toSend:              []CachedData{},
@@ -56,6 +248,7 @@ func NewImageBuffer(windowSeconds int, imageFrequency float64, windowSecondsBefo
 		cooldownSecs:        cooldownSecs,
 		imageFrequency:      imageFrequency,
 		maxImages:           maxImages,
+		bufferSeconds:       bufferSeconds,
 		logger:              logger,
 		debug:               debug,
 		// Set warning threshold to 2x expected buffer size to detect when consumption is lagging
@@ -64,8 +257,62 @@ func NewImageBuffer(windowSeconds int, imageFrequency float64, windowSecondsBefo
 }
 
 func (ib *ImageBuffer) MarkShouldSend(triggerTime time.Time) {
+	ib.MarkShouldSendForLabel(triggerTime, "")
+}
+
+// MarkShouldSendForLabel opens a capture window around triggerTime, or extends the open one, recording
+// label as the reason for the trigger. When extension is restricted to the same label (see SetExtendSameLabelOnly),
+// a trigger for a different label than the one that opened the window is ignored and false is returned.
+func (ib *ImageBuffer) MarkShouldSendForLabel(triggerTime time.Time, label string) bool {
+	ib.mu.Lock()
+	defer ib.mu.Unlock()
+	return ib.markShouldSend(triggerTime, label, "", nil)
+}
+
+// MarkShouldSendForReason is MarkShouldSendForLabel, additionally recording label and score as the Reason of the
+// frames of the window from now on. With SetAnnotateReason, they are added to the frames' annotations as a
+// classification labelled TriggerReasonLabelPrefix followed by the label.
+func (ib *ImageBuffer) MarkShouldSendForReason(triggerTime time.Time, label string, score float64) bool {
 	ib.mu.Lock()
 	defer ib.mu.Unlock()
+	var reason *data.Classification
+	if label != "" {
+		reason = &data.Classification{Label: label, Confidence: &score}
+	}
+	return ib.markShouldSend(triggerTime, label, "", reason)
+}
+
+// MarkShouldSendWithCorrelationID is MarkShouldSendForLabel, additionally attaching correlationID to the frames
+// of the window from now on, as a classification labelled CorrelationIDLabelPrefix followed by the ID.
+func (ib *ImageBuffer) MarkShouldSendWithCorrelationID(triggerTime time.Time, label, correlationID string) bool {
+	ib.mu.Lock()
+	defer ib.mu.Unlock()
+	return ib.markShouldSend(triggerTime, label, correlationID, nil)
+}
+
+// markShouldSend opens or extends the capture window. Must be called with the mutex held.
+func (ib *ImageBuffer) markShouldSend(triggerTime time.Time, label, correlationID string, reason *data.Classification) bool {
+	windowOpen := !ib.captureTill.Before(triggerTime)
+	if windowOpen && ib.extendSameLabelOnly && label != ib.windowLabel {
+		if ib.debug {
+			ib.logger.Infow("MarkShouldSend ignored trigger for a different label",
+				"method", "MarkShouldSend",
+				"triggerTime", triggerTime.Format(timestampFormat),
+				"label", label,
+				"windowLabel", ib.windowLabel)
+		}
+		return false
+	}
+	if !windowOpen && ib.maxPendingWindows > 0 {
+		if pending := ib.pendingWindows(); pending >= ib.maxPendingWindows {
+			if !ib.pendingFull {
+				ib.logger.Warnf("%d capture windows are waiting to be consumed, which is max_pending_windows, so new triggers are dropped until they are", pending)
+				ib.pendingFull = true
+			}
+			return false
+		}
+		ib.pendingFull = false
+	}
 
 	// Add images from the ring buffer that are within the window
 	beforeTimeBoundary := time.Second * time.Duration(ib.windowSecondsBefore)
@@ -73,31 +320,76 @@ func (ib *ImageBuffer) MarkShouldSend(triggerTime time.Time) {
 
 	newCaptureFrom := triggerTime.Add(-beforeTimeBoundary)
 	newCaptureTill := triggerTime.Add(afterTimeBoundary)
+	if afterTimeBoundary < ib.minWindow {
+		newCaptureTill = triggerTime.Add(ib.minWindow)
+	}
 	// If we are in the middle of capturing new images, we want to keep the left boundary, i.e. the old captureFrom's value
-	if ib.captureTill.Before(triggerTime) {
+	opening := ib.captureTill.Before(triggerTime)
+	if opening {
+		// A previous window may have expired without anything noticing, so close it before opening the new one
+		ib.closeExpiredWindow(triggerTime)
 		ib.captureFrom = newCaptureFrom
+		ib.openWindow()
+		ib.windowLabel = label
+		ib.windowTrigger = triggerTime
+	}
+	if correlationID != "" {
+		ib.windowCorrelationID = correlationID
+	}
+	if reason != nil {
+		ib.windowReason = reason
 	}
 	ib.captureTill = newCaptureTill
 	ib.cooldownTill = newCaptureTill.Add(time.Duration(ib.cooldownSecs) * time.Second)
+	if opening && ib.emitEvents {
+		ib.logger.Infow(WindowOpenEvent,
+			"event", WindowOpenEvent,
+			"window", ib.windowsOpened,
+			"trigger", triggerTime.Format(timestampFormat),
+			"label", label,
+			"correlationID", correlationID,
+			"captureFrom", ib.captureFrom.Format(timestampFormat),
+			"captureTill", ib.captureTill.Format(timestampFormat))
+	}
 
 	// Send images from the ring buffer and continue collecting for windowDuration
 	var imagesToSend []CachedData
 	var remainingRingBuffer []CachedData
 
-	// Create a map of existing timestamps in ToSend for O(1) lookup
+	// Create maps of the frames and timestamps already in ToSend for O(1) lookup. Timestamps catch the same capture
+	// stored twice, IDs catch the same stored frame even if timestamps are skewed.
 	existingTimes := make(map[int64]bool)
+	existingIDs := make(map[uint64]bool)
 	for _, existing := range ib.toSend {
 		existingTimes[existing.Meta.CapturedAt.UnixNano()] = true
+		if existing.ID != 0 {
+			existingIDs[existing.ID] = true
+		}
 	}
 
 	for _, cached := range ib.ringBuffer {
 		// Include images within captureFrom and captureTill boundaries, inclusive. Thus we have the not symbol here.
 		if !cached.Meta.CapturedAt.Before(ib.captureFrom) && !cached.Meta.CapturedAt.After(ib.captureTill) {
 			// Check if this image is already in ToSend to avoid duplicates
-			if !existingTimes[cached.Meta.CapturedAt.UnixNano()] {
-				imagesToSend = append(imagesToSend, cached)
-			}
 			// if its a duplicate, then discard it
+			switch {
+			case existingTimes[cached.Meta.CapturedAt.UnixNano()] || (cached.ID != 0 && existingIDs[cached.ID]):
+				ib.evicted(cached, DroppedDuplicate)
+				ib.unspill(cached)
+			case ib.isBurstDuplicate(cached.Meta.CapturedAt, ib.toSend) ||
+				ib.isBurstDuplicate(cached.Meta.CapturedAt, imagesToSend):
+				ib.evicted(cached, DroppedBurstDuplicate)
+				ib.unspill(cached)
+			default:
+				restored, err := ib.restore(cached)
+				if err != nil {
+					ib.logger.Warnf("cannot read spilled frame captured at %s: %v", cached.Meta.CapturedAt.Format(timestampFormat), err)
+					ib.evicted(cached, EvictedSpillFailed)
+					ib.unspill(cached)
+					continue
+				}
+				imagesToSend = append(imagesToSend, restored)
+			}
 		} else {
 			// Outside capture window, keep in ring buffer
 			remainingRingBuffer = append(remainingRingBuffer, cached)
@@ -108,7 +400,17 @@ func (ib *ImageBuffer) MarkShouldSend(triggerTime time.Time) {
 	ib.ringBuffer = remainingRingBuffer
 
 	// Add the images to send
-	ib.toSend = append(ib.toSend, imagesToSend...)
+	for i := range imagesToSend {
+		imagesToSend[i].Seq = ib.nextSeq()
+		imagesToSend[i].CorrelationID = ib.windowCorrelationID
+		imagesToSend[i].Reason = ib.windowReason
+		imagesToSend[i].window = ib.windowID
+		imagesToSend[i].opened = ib.windowsOpened
+	}
+	ib.queueToSend(imagesToSend...)
+	ib.windowFrames += len(imagesToSend)
+	ib.markTriggerFrame(false)
+	ib.capToSend()
 
 	toSendLen := len(ib.toSend)
 	if ib.debug {
@@ -128,20 +430,338 @@ func (ib *ImageBuffer) MarkShouldSend(triggerTime time.Time) {
 		ib.logger.Warnf("ToSend buffer size (%d) exceeds warning threshold (%d). Images may be filling buffer faster than they are being consumed. Consider changing attribute \"image_frequency\" to match data capture frequency or slower.",
 			toSendLen, ib.toSendMaxWarningThreshold)
 	}
+	return true
 }
 
 func (ib *ImageBuffer) AddToRingBuffer(imgs []camera.NamedImage, meta resource.ResponseMetadata) {
 	ib.mu.Lock()
-	defer ib.mu.Unlock()
+	ib.latest = ib.ingest(imgs, meta)
+	ib.insertRingBuffer(ib.latest)
+	ib.mu.Unlock()
+	ib.spillOld()
+}
+
+// ingest wraps newly stored images in a CachedData with the next frame ID. Must be called with the mutex held.
+func (ib *ImageBuffer) ingest(imgs []camera.NamedImage, meta resource.ResponseMetadata) CachedData {
+	ib.lastID++
+	return CachedData{Imgs: imgs, Meta: meta, ID: ib.lastID}
+}
 
-	ib.ringBuffer = append(ib.ringBuffer, CachedData{imgs, meta})
+// insertRingBuffer appends to the ring buffer, compacting it if enabled and dropping the oldest images
+// if it exceeds the max. Older frames are spilled once the caller releases the mutex. Must be called with the mutex
+// held.
+func (ib *ImageBuffer) insertRingBuffer(cd CachedData) {
+	if ib.compact && len(ib.ringBuffer) > 0 && ib.imageFrequency > 0 {
+		// frames spaced at image_frequency are kept even with some jitter, bursts in between are dropped
+		minSpacing := time.Duration(float64(time.Second) / ib.imageFrequency / 2)
+		previous := ib.ringBuffer[len(ib.ringBuffer)-1].Meta.CapturedAt
+		if cd.Meta.CapturedAt.Sub(previous) < minSpacing {
+			if ib.debug {
+				ib.logger.Infow("Compacted burst frame out of RingBuffer",
+					"method", "insertRingBuffer",
+					"capturedAt", cd.Meta.CapturedAt.Format(timestampFormat),
+					"previousCapturedAt", previous.Format(timestampFormat))
+			}
+			ib.evicted(cd, EvictedCompacted)
+			return
+		}
+	}
+
+	ib.ringBuffer = append(ib.ringBuffer, cd)
+	ib.trimRingBuffer()
+}
 
-	// Remove oldest images if we exceed the max
+// trimRingBuffer drops the oldest images if the ring buffer exceeds the max. Must be called with the mutex held.
+func (ib *ImageBuffer) trimRingBuffer() {
 	if len(ib.ringBuffer) > ib.maxImages {
+		for _, old := range ib.ringBuffer[:len(ib.ringBuffer)-ib.maxImages] {
+			ib.evicted(old, EvictedRingBufferFull)
+			ib.unspill(old)
+		}
 		ib.ringBuffer = ib.ringBuffer[len(ib.ringBuffer)-ib.maxImages:]
 	}
 }
 
+// SetImageFrequency resizes the buffer for frames arriving at imageFrequency, as if it had been given to NewImageBuffer.
+// If the ring buffer holds more than the new max, the oldest frames are dropped.
+func (ib *ImageBuffer) SetImageFrequency(imageFrequency float64) {
+	ib.mu.Lock()
+	defer ib.mu.Unlock()
+	ib.imageFrequency = imageFrequency
+	ib.maxImages = int(3 * float64(ib.bufferSeconds) * imageFrequency)
+	ib.toSendMaxWarningThreshold = ib.maxImages * 2
+	ib.trimRingBuffer()
+}
+
+// SetWindow changes how many seconds a capture window spans before and after a trigger, with windowSeconds
+// overriding both when positive as in NewImageBuffer. The buffer is resized to match, dropping the oldest frames of
+// the ring buffer if it holds more than the new max. A capture window that is already open keeps its bounds.
+func (ib *ImageBuffer) SetWindow(windowSeconds, windowSecondsBefore, windowSecondsAfter int) {
+	ib.mu.Lock()
+	defer ib.mu.Unlock()
+	bufferSeconds := windowSecondsBefore + windowSecondsAfter
+	if windowSeconds > 0 {
+		bufferSeconds = windowSeconds
+		windowSecondsBefore = windowSeconds
+		windowSecondsAfter = windowSeconds
+	}
+	ib.windowSecondsBefore = windowSecondsBefore
+	ib.windowSecondsAfter = windowSecondsAfter
+	ib.bufferSeconds = bufferSeconds
+	ib.maxImages = int(3 * float64(bufferSeconds) * ib.imageFrequency)
+	ib.toSendMaxWarningThreshold = ib.maxImages * 2
+	ib.trimRingBuffer()
+}
+
+// SetCooldown changes how many seconds triggers are suppressed for after a capture window closes. A cooldown that has
+// already started keeps its end.
+func (ib *ImageBuffer) SetCooldown(cooldownSecs int) {
+	ib.mu.Lock()
+	defer ib.mu.Unlock()
+	ib.cooldownSecs = cooldownSecs
+}
+
+// SetEmitEvents logs a structured WindowOpenEvent when a capture window opens and a WindowCloseEvent when it closes,
+// with stable field names, so that log-based analytics can count windows without parsing the stats.
+func (ib *ImageBuffer) SetEmitEvents(emit bool) {
+	ib.mu.Lock()
+	defer ib.mu.Unlock()
+	ib.emitEvents = emit
+}
+
+// SetMaxPendingWindows limits how many capture windows can have frames waiting in ToSend. Once that many do, triggers
+// that would open a new window are dropped until the frames are consumed. Triggers extending the open window are
+// unaffected. A max of 0 disables the limit.
+func (ib *ImageBuffer) SetMaxPendingWindows(maxPending int) {
+	ib.mu.Lock()
+	defer ib.mu.Unlock()
+	ib.maxPendingWindows = maxPending
+}
+
+// SetSplitWindowEveryN splits capture windows into segments of n frames, each with its own window ID and sequence
+// numbers starting from 0. Popped images are annotated with a classification labelled WindowIDLabelPrefix followed by
+// the ID. An n of 0 disables splitting.
+func (ib *ImageBuffer) SetSplitWindowEveryN(n int) {
+	ib.mu.Lock()
+	defer ib.mu.Unlock()
+	ib.splitEveryN = n
+}
+
+// SetMaxToSend caps the number of frames waiting in ToSend. Once a frame is queued beyond the cap, the oldest frames
+// are dropped and reported to the eviction callback as DroppedToSendFull. A max of 0 leaves ToSend unbounded.
+func (ib *ImageBuffer) SetMaxToSend(max int) {
+	ib.mu.Lock()
+	defer ib.mu.Unlock()
+	ib.maxToSend = max
+	ib.capToSend()
+}
+
+// capToSend drops the oldest frames from ToSend while it holds more than maxToSend. Must be called with the mutex held.
+func (ib *ImageBuffer) capToSend() {
+	if ib.maxToSend <= 0 || len(ib.toSend) <= ib.maxToSend {
+		return
+	}
+	excess := len(ib.toSend) - ib.maxToSend
+	for _, dropped := range ib.toSend[:excess] {
+		ib.evicted(dropped, DroppedToSendFull)
+	}
+	ib.toSend = append([]CachedData{}, ib.toSend[excess:]...)
+	if ib.debug {
+		ib.logger.Infow("Dropped oldest frames from full ToSend buffer",
+			"method", "capToSend",
+			"dropped", excess,
+			"toSendSize", len(ib.toSend))
+	}
+}
+
+// pendingWindows returns the number of capture windows with frames in ToSend. Must be called with the mutex held.
+func (ib *ImageBuffer) pendingWindows() int {
+	windows := make(map[int]bool)
+	for _, cached := range ib.toSend {
+		windows[cached.window] = true
+	}
+	return len(windows)
+}
+
+// SetEvictionCallback registers f to be called whenever the buffer discards a frame. A nil f disables it.
+func (ib *ImageBuffer) SetEvictionCallback(f EvictionFunc) {
+	ib.mu.Lock()
+	defer ib.mu.Unlock()
+	ib.onEvict = f
+}
+
+// evicted reports a discarded frame to the eviction callback, if any. Must be called with the mutex held.
+func (ib *ImageBuffer) evicted(cd CachedData, reason string) {
+	if ib.onEvict != nil {
+		ib.onEvict(cd.Meta.CapturedAt, reason)
+	}
+}
+
+// SetExtendSameLabelOnly controls whether an open capture window is only extended by triggers
+// for the same label that opened it.
+func (ib *ImageBuffer) SetExtendSameLabelOnly(sameLabelOnly bool) {
+	ib.mu.Lock()
+	defer ib.mu.Unlock()
+	ib.extendSameLabelOnly = sameLabelOnly
+}
+
+// CancelSince removes the frames in ToSend captured at or after since and ends the open capture window,
+// if any, at now without a cooldown. It returns the number of frames removed.
+func (ib *ImageBuffer) CancelSince(since, now time.Time) int {
+	ib.mu.Lock()
+	defer ib.mu.Unlock()
+
+	kept := []CachedData{}
+	for _, cached := range ib.toSend {
+		if cached.Meta.CapturedAt.Before(since) {
+			kept = append(kept, cached)
+		} else {
+			ib.evicted(cached, DroppedCancelled)
+		}
+	}
+	dropped := len(ib.toSend) - len(kept)
+	ib.toSend = kept
+
+	if !ib.captureTill.Before(now) {
+		ib.captureTill = now.Add(-time.Nanosecond)
+		ib.cooldownTill = ib.captureTill
+		ib.windowFrames -= dropped
+		if ib.windowFrames < 0 {
+			ib.windowFrames = 0
+		}
+	}
+
+	if ib.debug {
+		ib.logger.Infow("CancelSince completed",
+			"method", "CancelSince",
+			"since", since.Format(timestampFormat),
+			"imagesDropped", dropped,
+			"toSendSize", len(ib.toSend))
+	}
+	return dropped
+}
+
+// ExtendWindow pushes back the end of the capture window, and its cooldown, by d if the window was open at t.
+// It returns whether the window was extended.
+func (ib *ImageBuffer) ExtendWindow(t time.Time, d time.Duration) bool {
+	ib.mu.Lock()
+	defer ib.mu.Unlock()
+	if t.Before(ib.captureFrom) || t.After(ib.captureTill) {
+		return false
+	}
+	ib.captureTill = ib.captureTill.Add(d)
+	ib.cooldownTill = ib.cooldownTill.Add(d)
+	if ib.debug {
+		ib.logger.Infow("ExtendWindow completed",
+			"method", "ExtendWindow",
+			"extendedBy", d.String(),
+			"captureTill", ib.captureTill.Format(timestampFormat),
+			"cooldownTill", ib.cooldownTill.Format(timestampFormat))
+	}
+	return true
+}
+
+// SetCompact controls whether frames arriving less than half an image_frequency interval after the previous
+// ring buffer frame are dropped, keeping the ring buffer roughly evenly spaced when the camera delivers bursts.
+func (ib *ImageBuffer) SetCompact(compact bool) {
+	ib.mu.Lock()
+	defer ib.mu.Unlock()
+	ib.compact = compact
+}
+
+// SetMinWindow sets the minimum time a capture window stays open after a trigger, extending windows
+// whose configured after duration is shorter.
+func (ib *ImageBuffer) SetMinWindow(d time.Duration) {
+	ib.mu.Lock()
+	defer ib.mu.Unlock()
+	ib.minWindow = d
+}
+
+// SetAnnotateSeq controls whether popped images get a classification labelled SeqLabelPrefix followed by
+// their sequence number within the capture window.
+func (ib *ImageBuffer) SetAnnotateSeq(annotate bool) {
+	ib.mu.Lock()
+	defer ib.mu.Unlock()
+	ib.annotateSeq = annotate
+}
+
+// SetAnnotateTrigger controls whether the popped images of the frame nearest to each window's trigger get a
+// classification labelled TriggerFrameLabel. CachedData.Trigger is set either way.
+func (ib *ImageBuffer) SetAnnotateTrigger(annotate bool) {
+	ib.mu.Lock()
+	defer ib.mu.Unlock()
+	ib.annotateTrigger = annotate
+}
+
+// SetAnnotateReason controls whether popped images get a classification labelled TriggerReasonLabelPrefix followed by
+// the label that caused their capture window, with its score as the confidence. CachedData.Reason is set either way.
+func (ib *ImageBuffer) SetAnnotateReason(annotate bool) {
+	ib.mu.Lock()
+	defer ib.mu.Unlock()
+	ib.annotateReason = annotate
+}
+
+// SetBurstDedupe sets how close in time a frame can be to one already queued in ToSend before it is
+// dropped as a burst duplicate. Zero disables burst deduplication.
+func (ib *ImageBuffer) SetBurstDedupe(d time.Duration) {
+	ib.mu.Lock()
+	defer ib.mu.Unlock()
+	ib.burstDedupe = d
+}
+
+// SetMinFrameGap sets how close in time a frame passed to StoreImages can be to the previously stored frame before
+// it is dropped, wherever it would have gone. Zero disables the check.
+func (ib *ImageBuffer) SetMinFrameGap(d time.Duration) {
+	ib.mu.Lock()
+	defer ib.mu.Unlock()
+	ib.minFrameGap = d
+}
+
+// withinFrameGap returns true if t is within the minimum frame gap of the previously stored frame.
+// Must be called with the mutex held.
+func (ib *ImageBuffer) withinFrameGap(t time.Time) bool {
+	if ib.minFrameGap <= 0 || ib.lastStoredAt.IsZero() {
+		return false
+	}
+	diff := t.Sub(ib.lastStoredAt)
+	if diff < 0 {
+		diff = -diff
+	}
+	return diff < ib.minFrameGap
+}
+
+// isBurstDuplicate returns true if t is within the burst dedupe window of any of the queued frames.
+// Must be called with the mutex held.
+func (ib *ImageBuffer) isBurstDuplicate(t time.Time, queued []CachedData) bool {
+	if ib.burstDedupe <= 0 {
+		return false
+	}
+	for _, cached := range queued {
+		diff := t.Sub(cached.Meta.CapturedAt)
+		if diff < 0 {
+			diff = -diff
+		}
+		if diff < ib.burstDedupe {
+			return true
+		}
+	}
+	return false
+}
+
+// SetDebug turns debug logging of buffer operations on or off.
+func (ib *ImageBuffer) SetDebug(debug bool) {
+	ib.mu.Lock()
+	defer ib.mu.Unlock()
+	ib.debug = debug
+}
+
+// Debug returns whether debug logging of buffer operations is on.
+func (ib *ImageBuffer) Debug() bool {
+	ib.mu.Lock()
+	defer ib.mu.Unlock()
+	return ib.debug
+}
+
 // SetCaptureTill sets the captureTill time
 // This method is only used for testing purposes in cam_test.go
 func (ib *ImageBuffer) SetCaptureTill(t time.Time) {
@@ -158,6 +778,16 @@ func (ib *ImageBuffer) SetCooldownTill(t time.Time) {
 	ib.cooldownTill = t
 }
 
+// OldestToSend returns the capture time of the oldest frame in ToSend, or false if it is empty.
+func (ib *ImageBuffer) OldestToSend() (time.Time, bool) {
+	ib.mu.Lock()
+	defer ib.mu.Unlock()
+	if len(ib.toSend) == 0 {
+		return time.Time{}, false
+	}
+	return ib.toSend[0].Meta.CapturedAt, true
+}
+
 // GetToSendLength returns the length of the toSend slice
 func (ib *ImageBuffer) GetToSendLength() int {
 	ib.mu.Lock()
@@ -180,8 +810,8 @@ func (ib *ImageBuffer) PopFirstToSend() (CachedData, bool) {
 	x := ib.toSend[0]
 	ib.toSend = ib.toSend[1:]
 
-	// Apply timestamp naming to the images
-	x.Imgs = TimestampImagesToNames(x.Imgs, x.Meta)
+	// Apply timestamp naming and the window sequence number to the images
+	x.Imgs = ib.emitImages(x)
 
 	if ib.debug {
 		remainingLen := len(ib.toSend)
@@ -211,45 +841,186 @@ func TimestampImagesToNames(images []camera.NamedImage, meta resource.ResponseMe
 	return result
 }
 
+// withSeq adds a classification carrying the window sequence number to each of the images, which must already be copies,
+// if sequence annotations are enabled. Must be called with the mutex held.
+func (ib *ImageBuffer) withSeq(images []camera.NamedImage, seq int) []camera.NamedImage {
+	if !ib.annotateSeq {
+		return images
+	}
+	return withLabel(images, SeqLabelPrefix+strconv.Itoa(seq))
+}
+
+// withCorrelationID adds a classification carrying the window's correlation ID to each of the images, which must
+// already be copies, if it has one.
+func withCorrelationID(images []camera.NamedImage, correlationID string) []camera.NamedImage {
+	if correlationID == "" {
+		return images
+	}
+	return withLabel(images, CorrelationIDLabelPrefix+correlationID)
+}
+
+// withReason adds a classification carrying the label and score of the window's reason to each of the images, which
+// must already be copies.
+func withReason(images []camera.NamedImage, reason data.Classification) []camera.NamedImage {
+	for i := range images {
+		classifications := make([]data.Classification, 0, len(images[i].Annotations.Classifications)+1)
+		classifications = append(classifications, images[i].Annotations.Classifications...)
+		images[i].Annotations.Classifications = append(classifications, data.Classification{
+			Label:      TriggerReasonLabelPrefix + reason.Label,
+			Confidence: reason.Confidence,
+		})
+	}
+	return images
+}
+
+// withLabel adds a classification with label to each of the images, which must already be copies.
+func withLabel(images []camera.NamedImage, label string) []camera.NamedImage {
+	for i := range images {
+		classifications := make([]data.Classification, 0, len(images[i].Annotations.Classifications)+1)
+		classifications = append(classifications, images[i].Annotations.Classifications...)
+		images[i].Annotations.Classifications = append(classifications, data.Classification{Label: label})
+	}
+	return images
+}
+
+// emitImages returns copies of the frame's images named and annotated for output. Must be called with the mutex held.
+func (ib *ImageBuffer) emitImages(cached CachedData) []camera.NamedImage {
+	images := ib.withSeq(TimestampImagesToNames(cached.Imgs, cached.Meta), cached.Seq)
+	if ib.splitEveryN > 0 {
+		images = withLabel(images, WindowIDLabelPrefix+strconv.Itoa(cached.window))
+	}
+	if ib.annotateTrigger && cached.Trigger {
+		images = withLabel(images, TriggerFrameLabel)
+	}
+	if ib.annotateReason && cached.Reason != nil {
+		images = withReason(images, *cached.Reason)
+	}
+	return withCorrelationID(images, cached.CorrelationID)
+}
+
+// nextSeq returns the sequence number for the next frame added to ToSend, starting a new segment of the window first
+// if the current one is full. Must be called with the mutex held.
+func (ib *ImageBuffer) nextSeq() int {
+	if ib.splitEveryN > 0 && ib.windowSeq >= ib.splitEveryN {
+		ib.windowID++
+		ib.windowSeq = 0
+		if ib.debug {
+			ib.logger.Infow("Split capture window into a new segment",
+				"method", "nextSeq",
+				"windowID", ib.windowID)
+		}
+	}
+	seq := ib.windowSeq
+	ib.windowSeq++
+	return seq
+}
+
 // PopAllToSend removes and returns all elements from toSend slice as multiple images
 func (ib *ImageBuffer) PopAllToSend() ([]camera.NamedImage, resource.ResponseMetadata, bool) {
+	ib.mu.Lock()
+	frames, ok := ib.popAllToSend("PopAllToSend")
+	contactSheet := ib.contactSheet
+	ib.mu.Unlock()
+	if !ok {
+		return nil, resource.ResponseMetadata{}, false
+	}
+	allImages, earliestMeta := combineFrames(frames)
+	if contactSheet {
+		// built outside the lock, since it decodes every frame
+		allImages = ib.appendContactSheet(allImages, frames)
+	}
+	return allImages, earliestMeta, true
+}
+
+// PopAllToSendTx is PopAllToSend, additionally returning a Pop that must be passed to CommitPop once the images
+// have been delivered, or to RollbackPop to put the frames back in ToSend.
+func (ib *ImageBuffer) PopAllToSendTx() ([]camera.NamedImage, resource.ResponseMetadata, *Pop, bool) {
+	ib.mu.Lock()
+	original := ib.toSend
+	frames, ok := ib.popAllToSend("PopAllToSendTx")
+	contactSheet := ib.contactSheet
+	ib.mu.Unlock()
+	if !ok {
+		return nil, resource.ResponseMetadata{}, nil, false
+	}
+	allImages, earliestMeta := combineFrames(frames)
+	if contactSheet {
+		allImages = ib.appendContactSheet(allImages, frames)
+	}
+	return allImages, earliestMeta, &Pop{frames: original}, true
+}
+
+// CommitPop marks the frames of a Pop as delivered, so they can no longer be rolled back.
+func (ib *ImageBuffer) CommitPop(p *Pop) {
 	ib.mu.Lock()
 	defer ib.mu.Unlock()
+	p.done = true
+	p.frames = nil
+}
+
+// RollbackPop puts the frames of a Pop back in ToSend, in capture order with anything queued since.
+// A Pop can only be committed or rolled back once.
+func (ib *ImageBuffer) RollbackPop(p *Pop) {
+	ib.mu.Lock()
+	defer ib.mu.Unlock()
+	if p.done {
+		return
+	}
+	p.done = true
+	ib.queueToSend(p.frames...)
+	ib.capToSend()
+	if ib.debug {
+		ib.logger.Infow("RollbackPop restored images",
+			"method", "RollbackPop",
+			"batchesRestored", len(p.frames),
+			"toSendSize", len(ib.toSend))
+	}
+	p.frames = nil
+}
+
+// combineFrames flattens frames into a single batch of images, using the earliest timestamp as the metadata for the batch.
+func combineFrames(frames []CachedData) ([]camera.NamedImage, resource.ResponseMetadata) {
+	var allImages []camera.NamedImage
+	var earliestMeta resource.ResponseMetadata
+	for i, frame := range frames {
+		allImages = append(allImages, frame.Imgs...)
+		if i == 0 || frame.Meta.CapturedAt.Before(earliestMeta.CapturedAt) {
+			earliestMeta = frame.Meta
+		}
+	}
+	return allImages, earliestMeta
+}
+
+// popAllToSend empties the toSend slice, returning its frames with timestamped names. Must be called with the mutex held.
+func (ib *ImageBuffer) popAllToSend(method string) ([]CachedData, bool) {
 	if len(ib.toSend) == 0 {
 		if ib.debug {
-			ib.logger.Infow("PopAllToSend buffer empty",
-				"method", "PopAllToSend",
+			ib.logger.Infow(method+" buffer empty",
+				"method", method,
 				"toSendSize", 0)
 		}
-		return nil, resource.ResponseMetadata{}, false
+		return nil, false
 	}
 
-	// Combine all images from the ToSend buffer with individual timestamps
-	var allImages []camera.NamedImage
-	var earliestMeta resource.ResponseMetadata
-
-	for i, cached := range ib.toSend {
+	frames := make([]CachedData, 0, len(ib.toSend))
+	totalImages := 0
+	for _, cached := range ib.toSend {
 		// Apply timestamp to each image in this cached data
-		timestampedImages := TimestampImagesToNames(cached.Imgs, cached.Meta)
-		allImages = append(allImages, timestampedImages...)
-
-		// Use the earliest timestamp as the metadata for the batch
-		if i == 0 || cached.Meta.CapturedAt.Before(earliestMeta.CapturedAt) {
-			earliestMeta = cached.Meta
-		}
+		cached.Imgs = ib.emitImages(cached)
+		totalImages += len(cached.Imgs)
+		frames = append(frames, cached)
 	}
 
 	if ib.debug {
-		consumed := len(ib.toSend)
-		ib.logger.Infow("PopAllToSend consumed images",
-			"method", "PopAllToSend",
-			"batchesConsumed", consumed,
-			"totalImagesConsumed", len(allImages))
+		ib.logger.Infow(method+" consumed images",
+			"method", method,
+			"batchesConsumed", len(frames),
+			"totalImagesConsumed", totalImages)
 	}
 	// Clear the ToSend buffer
 	ib.toSend = []CachedData{}
 
-	return allImages, earliestMeta, true
+	return frames, true
 }
 
 // ClearToSend clears the toSend slice
@@ -271,9 +1042,69 @@ func (ib *ImageBuffer) GetRingBufferLength() int {
 // GetRingBufferSlice returns a copy of the RingBuffer slice for testing
 // Only used for testing purposes
 func (ib *ImageBuffer) GetRingBufferSlice() []CachedData {
+	return ib.RingBufferFrames()
+}
+
+// RingBufferFrames returns a snapshot of the frames in the ring buffer, oldest first, with any spilled images read
+// back. Later changes to the buffer don't affect it.
+func (ib *ImageBuffer) RingBufferFrames() []CachedData {
+	ib.mu.Lock()
+	defer ib.mu.Unlock()
+	return ib.loadedFrames(append([]CachedData{}, ib.ringBuffer...))
+}
+
+// Status returns the buffer's sizing and current occupancy.
+func (ib *ImageBuffer) Status() Status {
+	ib.mu.Lock()
+	defer ib.mu.Unlock()
+	return Status{
+		MaxImages:           ib.maxImages,
+		WindowSecondsBefore: ib.windowSecondsBefore,
+		WindowSecondsAfter:  ib.windowSecondsAfter,
+		ImageFrequency:      ib.imageFrequency,
+		FramesBefore:        int(float64(ib.windowSecondsBefore) * ib.imageFrequency),
+		FramesAfter:         int(float64(ib.windowSecondsAfter) * ib.imageFrequency),
+		RingBufferSize:      len(ib.ringBuffer),
+		ToSendSize:          len(ib.toSend),
+		CaptureFrom:         ib.captureFrom,
+		CaptureTill:         ib.captureTill,
+	}
+}
+
+// GetRange returns the frames in the ring buffer captured between from and to, inclusive, oldest first.
+// The ring buffer is left untouched.
+func (ib *ImageBuffer) GetRange(from, to time.Time) []CachedData {
 	ib.mu.Lock()
 	defer ib.mu.Unlock()
-	return append([]CachedData{}, ib.ringBuffer...)
+	res := []CachedData{}
+	for _, cached := range ib.ringBuffer {
+		if !cached.Meta.CapturedAt.Before(from) && !cached.Meta.CapturedAt.After(to) {
+			res = append(res, cached)
+		}
+	}
+	sort.SliceStable(res, func(i, j int) bool { return res[i].Meta.CapturedAt.Before(res[j].Meta.CapturedAt) })
+	return ib.loadedFrames(res)
+}
+
+// NearestFrameTime returns the capture time of the buffered frame closest to t, in the ring buffer or ToSend, if it
+// is within tolerance of t. Otherwise t is returned unchanged. Of two frames equally close, the earlier is used.
+func (ib *ImageBuffer) NearestFrameTime(t time.Time, tolerance time.Duration) time.Time {
+	ib.mu.Lock()
+	defer ib.mu.Unlock()
+	nearest, found := t, false
+	for _, frames := range [][]CachedData{ib.ringBuffer, ib.toSend} {
+		for _, cached := range frames {
+			at := cached.Meta.CapturedAt
+			diff := at.Sub(t).Abs()
+			if diff > tolerance {
+				continue
+			}
+			if best := nearest.Sub(t).Abs(); !found || diff < best || (diff == best && at.Before(nearest)) {
+				nearest, found = at, true
+			}
+		}
+	}
+	return nearest
 }
 
 // GetToSendSlice returns a copy of the toSend slice for testing
@@ -328,13 +1159,49 @@ func (ib *ImageBuffer) IsWithinCaptureWindow(now time.Time) bool {
 // or in the RingBuffer (if outside CaptureTill time)
 func (ib *ImageBuffer) StoreImages(images []camera.NamedImage, meta resource.ResponseMetadata, now time.Time) {
 	ib.mu.Lock()
-	defer ib.mu.Unlock()
+	ib.storeImages(images, meta, now)
+	ib.mu.Unlock()
+	ib.spillOld()
+}
+
+// storeImages is StoreImages without spilling. Must be called with the mutex held.
+func (ib *ImageBuffer) storeImages(images []camera.NamedImage, meta resource.ResponseMetadata, now time.Time) {
+
+	if ib.withinFrameGap(meta.CapturedAt) {
+		if ib.debug {
+			ib.logger.Infow("StoreImages: dropped frame within min frame gap",
+				"method", "StoreImages",
+				"capturedAt", meta.CapturedAt.Format(timestampFormat),
+				"previousCapturedAt", ib.lastStoredAt.Format(timestampFormat))
+		}
+		ib.evicted(CachedData{Imgs: images, Meta: meta}, DroppedFrameGap)
+		return
+	}
+	ib.lastStoredAt = meta.CapturedAt
+	ib.latest = ib.ingest(images, meta)
 
 	// if we're within the CaptureTill trigger time still, directly add the images to ToSend buffer
 	// else then store them in the ring buffer
 	if (now.Before(ib.captureTill) && now.After(ib.captureFrom)) || now.Equal(ib.captureTill) || now.Equal(ib.captureFrom) {
-		cd := CachedData{Imgs: images, Meta: meta}
-		ib.toSend = append(ib.toSend, cd)
+		if ib.isBurstDuplicate(meta.CapturedAt, ib.toSend) {
+			if ib.debug {
+				ib.logger.Infow("StoreImages: dropped burst duplicate",
+					"method", "StoreImages",
+					"capturedAt", meta.CapturedAt.Format(timestampFormat))
+			}
+			ib.evicted(ib.latest, DroppedBurstDuplicate)
+			return
+		}
+		cd := ib.latest
+		cd.Seq = ib.nextSeq()
+		cd.CorrelationID = ib.windowCorrelationID
+		cd.Reason = ib.windowReason
+		cd.window = ib.windowID
+		cd.opened = ib.windowsOpened
+		ib.queueToSend(cd)
+		ib.windowFrames++
+		ib.markTriggerFrame(false)
+		ib.capToSend()
 		toSendLen := len(ib.toSend)
 		if ib.debug {
 			ib.logger.Infow("StoreImages: stored image to ToSend buffer",
@@ -349,13 +1216,10 @@ func (ib *ImageBuffer) StoreImages(images []camera.NamedImage, meta resource.Res
 				toSendLen, ib.toSendMaxWarningThreshold)
 		}
 	} else {
-		// Add to ring buffer (reuse existing logic)
-		ib.ringBuffer = append(ib.ringBuffer, CachedData{Imgs: images, Meta: meta})
+		ib.closeExpiredWindow(now)
 
-		// Remove oldest images if we exceed the max
-		if len(ib.ringBuffer) > ib.maxImages {
-			ib.ringBuffer = ib.ringBuffer[len(ib.ringBuffer)-ib.maxImages:]
-		}
+		// Add to ring buffer (reuse existing logic)
+		ib.insertRingBuffer(ib.latest)
 		if ib.debug {
 			ib.logger.Infow("StoreImages: stored image to RingBuffer",
 				"method", "StoreImages",
@@ -364,3 +1228,146 @@ func (ib *ImageBuffer) StoreImages(images []camera.NamedImage, meta resource.Res
 		}
 	}
 }
+
+// LatestFrame returns the most recently stored frame, whether it went to the ring buffer or the ToSend buffer.
+// It returns false if nothing has been stored yet.
+func (ib *ImageBuffer) LatestFrame() (CachedData, bool) {
+	ib.mu.Lock()
+	defer ib.mu.Unlock()
+	if ib.latest.Imgs == nil {
+		return CachedData{}, false
+	}
+	return ib.latest, true
+}
+
+// LastRingBufferFrame returns the most recent frame in the ring buffer, or false if it is empty.
+func (ib *ImageBuffer) LastRingBufferFrame() (CachedData, bool) {
+	ib.mu.Lock()
+	defer ib.mu.Unlock()
+	if len(ib.ringBuffer) == 0 {
+		return CachedData{}, false
+	}
+	return ib.ringBuffer[len(ib.ringBuffer)-1], true
+}
+
+// RecordTrigger notes a label and score that caused the current capture window to be opened or extended.
+// They are reported in the WindowSummary once the window closes.
+func (ib *ImageBuffer) RecordTrigger(label string, score float64) {
+	ib.mu.Lock()
+	defer ib.mu.Unlock()
+	if !ib.windowOpen {
+		return
+	}
+	ib.windowLabels[label] = true
+	if score > ib.windowMaxScore {
+		ib.windowMaxScore = score
+	}
+}
+
+// CloseExpiredWindow closes the current capture window if the given time is past its end,
+// logging and returning the summary of the window.
+func (ib *ImageBuffer) CloseExpiredWindow(now time.Time) (WindowSummary, bool) {
+	ib.mu.Lock()
+	defer ib.mu.Unlock()
+	return ib.closeExpiredWindow(now)
+}
+
+// LastWindowSummary returns the summary of the most recently closed capture window
+func (ib *ImageBuffer) LastWindowSummary() (WindowSummary, bool) {
+	ib.mu.Lock()
+	defer ib.mu.Unlock()
+	if ib.lastSummary == nil {
+		return WindowSummary{}, false
+	}
+	return *ib.lastSummary, true
+}
+
+// openWindow resets the per-window summary state. Must be called with the mutex held.
+func (ib *ImageBuffer) openWindow() {
+	ib.windowOpen = true
+	ib.windowFrames = 0
+	ib.windowSeq = 0
+	ib.windowCorrelationID = ""
+	ib.windowReason = nil
+	ib.windowID++
+	ib.windowsOpened++
+	ib.triggerMarked = false
+	ib.windowLabels = make(map[string]bool)
+	ib.windowMaxScore = 0
+}
+
+// markTriggerFrame flags the queued frame of the open window captured nearest to its trigger. This waits until a frame
+// captured at or after the trigger has been queued, or until the window closes if none is. Must be called with the
+// mutex held.
+func (ib *ImageBuffer) markTriggerFrame(closing bool) {
+	if !ib.windowOpen || ib.triggerMarked {
+		return
+	}
+	nearest := -1
+	var nearestDiff time.Duration
+	reached := false
+	for i, cached := range ib.toSend {
+		if cached.opened != ib.windowsOpened {
+			continue
+		}
+		diff := cached.Meta.CapturedAt.Sub(ib.windowTrigger)
+		if diff >= 0 {
+			reached = true
+		} else {
+			diff = -diff
+		}
+		if nearest < 0 || diff < nearestDiff {
+			nearest, nearestDiff = i, diff
+		}
+	}
+	if nearest < 0 || (!reached && !closing) {
+		return
+	}
+	ib.toSend[nearest].Trigger = true
+	ib.triggerMarked = true
+}
+
+// closeExpiredWindow builds and logs the summary of the open window if it has ended. Must be called with the mutex held.
+func (ib *ImageBuffer) closeExpiredWindow(now time.Time) (WindowSummary, bool) {
+	if !ib.windowOpen || !now.After(ib.captureTill) {
+		return WindowSummary{}, false
+	}
+	ib.markTriggerFrame(true)
+	ib.windowOpen = false
+
+	labels := make([]string, 0, len(ib.windowLabels))
+	for label := range ib.windowLabels {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+
+	summary := WindowSummary{
+		Start:    ib.captureFrom,
+		End:      ib.captureTill,
+		Frames:   ib.windowFrames,
+		Labels:   labels,
+		MaxScore: ib.windowMaxScore,
+	}
+	ib.lastSummary = &summary
+
+	ib.logger.Infow("Capture window closed",
+		"start", summary.Start.Format(timestampFormat),
+		"end", summary.End.Format(timestampFormat),
+		"durationSeconds", summary.Duration().Seconds(),
+		"frames", summary.Frames,
+		"labels", summary.Labels,
+		"maxScore", summary.MaxScore)
+	if ib.emitEvents {
+		ib.logger.Infow(WindowCloseEvent,
+			"event", WindowCloseEvent,
+			"window", ib.windowsOpened,
+			"start", summary.Start.Format(timestampFormat),
+			"end", summary.End.Format(timestampFormat),
+			"durationSeconds", summary.Duration().Seconds(),
+			"frames", summary.Frames,
+			"labels", summary.Labels,
+			"maxScore", summary.MaxScore)
+	}
+
+	return summary, true
+}
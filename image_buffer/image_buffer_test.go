@@ -1,9 +1,12 @@
 package imagebuffer
 
 import (
+	"fmt"
+	"strings"
 	"testing"
 	"time"
 
+	"go.viam.com/rdk/components/camera"
 	"go.viam.com/rdk/logging"
 	"go.viam.com/rdk/resource"
 
@@ -159,3 +162,778 @@ func TestCooldownExtendsWithRetrigger(t *testing.T) {
 	test.That(t, buf.IsInCooldown(newCooldownTill), test.ShouldBeTrue)             // at boundary
 	test.That(t, buf.IsInCooldown(newCooldownTill.Add(1*time.Second)), test.ShouldBeFalse)
 }
+
+func TestWindowSummary(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	buf := NewImageBuffer(2, 1.0, 0, 0, logger, true, 0)
+
+	triggerTime := time.Now()
+	buf.ringBuffer = []CachedData{
+		{Meta: resource.ResponseMetadata{CapturedAt: triggerTime.Add(-3 * time.Second)}},
+		{Meta: resource.ResponseMetadata{CapturedAt: triggerTime.Add(-1 * time.Second)}},
+	}
+
+	buf.MarkShouldSend(triggerTime)
+	buf.RecordTrigger("person", 0.9)
+	buf.RecordTrigger("car", 0.7)
+	buf.RecordTrigger("person", 0.95)
+
+	// No summary while the window is still open
+	_, ok := buf.LastWindowSummary()
+	test.That(t, ok, test.ShouldBeFalse)
+
+	buf.StoreImages(nil, resource.ResponseMetadata{CapturedAt: triggerTime.Add(1 * time.Second)}, triggerTime.Add(1*time.Second))
+	buf.StoreImages(nil, resource.ResponseMetadata{CapturedAt: triggerTime.Add(2 * time.Second)}, triggerTime.Add(2*time.Second))
+	_, ok = buf.LastWindowSummary()
+	test.That(t, ok, test.ShouldBeFalse)
+
+	// The first image stored after the window ends closes it
+	buf.StoreImages(nil, resource.ResponseMetadata{CapturedAt: triggerTime.Add(3 * time.Second)}, triggerTime.Add(3*time.Second))
+	summary, ok := buf.LastWindowSummary()
+	test.That(t, ok, test.ShouldBeTrue)
+	test.That(t, summary.Frames, test.ShouldEqual, 3)
+	test.That(t, summary.Labels, test.ShouldResemble, []string{"car", "person"})
+	test.That(t, summary.MaxScore, test.ShouldEqual, 0.95)
+	test.That(t, summary.Duration(), test.ShouldEqual, 4*time.Second)
+
+	// The window is only summarized once
+	_, ok = buf.CloseExpiredWindow(triggerTime.Add(10 * time.Second))
+	test.That(t, ok, test.ShouldBeFalse)
+}
+
+func TestExtendSameLabelOnly(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	buf := NewImageBuffer(2, 1.0, 0, 0, logger, true, 0)
+	buf.SetExtendSameLabelOnly(true)
+
+	trigger := time.Now()
+	test.That(t, buf.MarkShouldSendForLabel(trigger, "person"), test.ShouldBeTrue)
+	// window is trigger-2s to trigger+2s
+	test.That(t, buf.IsWithinCaptureWindow(trigger.Add(2*time.Second)), test.ShouldBeTrue)
+	test.That(t, buf.IsWithinCaptureWindow(trigger.Add(3*time.Second)), test.ShouldBeFalse)
+
+	// a different label does not extend the window
+	test.That(t, buf.MarkShouldSendForLabel(trigger.Add(1*time.Second), "vehicle"), test.ShouldBeFalse)
+	test.That(t, buf.IsWithinCaptureWindow(trigger.Add(3*time.Second)), test.ShouldBeFalse)
+
+	// the same label does
+	test.That(t, buf.MarkShouldSendForLabel(trigger.Add(1*time.Second), "person"), test.ShouldBeTrue)
+	test.That(t, buf.IsWithinCaptureWindow(trigger.Add(3*time.Second)), test.ShouldBeTrue)
+
+	// once the window has closed, any label can open a new one
+	test.That(t, buf.MarkShouldSendForLabel(trigger.Add(10*time.Second), "vehicle"), test.ShouldBeTrue)
+	test.That(t, buf.IsWithinCaptureWindow(trigger.Add(12*time.Second)), test.ShouldBeTrue)
+}
+
+func TestBurstDedupe(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	buf := NewImageBuffer(2, 1.0, 0, 0, logger, true, 0)
+	buf.SetBurstDedupe(100 * time.Millisecond)
+
+	// a burst of near-simultaneous frames lands in the ring buffer before the trigger
+	triggerTime := time.Now()
+	burstStart := triggerTime.Add(-1 * time.Second)
+	for i := 0; i < 5; i++ {
+		buf.AddToRingBuffer(nil, resource.ResponseMetadata{CapturedAt: burstStart.Add(time.Duration(i) * 10 * time.Millisecond)})
+	}
+
+	buf.MarkShouldSend(triggerTime)
+	toSend := buf.GetToSendSlice()
+	test.That(t, len(toSend), test.ShouldEqual, 1)
+	test.That(t, toSend[0].Meta.CapturedAt, test.ShouldEqual, burstStart)
+
+	// another burst while the window is open only keeps its first frame
+	for i := 0; i < 5; i++ {
+		capturedAt := triggerTime.Add(time.Duration(i) * time.Millisecond)
+		buf.StoreImages(nil, resource.ResponseMetadata{CapturedAt: capturedAt}, capturedAt)
+	}
+	toSend = buf.GetToSendSlice()
+	test.That(t, len(toSend), test.ShouldEqual, 2)
+	test.That(t, toSend[1].Meta.CapturedAt, test.ShouldEqual, triggerTime)
+
+	// frames spaced further apart than the dedupe window are all kept
+	buf.StoreImages(nil, resource.ResponseMetadata{CapturedAt: triggerTime.Add(500 * time.Millisecond)}, triggerTime.Add(500*time.Millisecond))
+	test.That(t, buf.GetToSendLength(), test.ShouldEqual, 3)
+}
+
+func TestMinFrameGap(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	buf := NewImageBuffer(2, 1.0, 0, 0, logger, true, 0)
+	buf.SetMinFrameGap(5 * time.Millisecond)
+	evictions := map[string]int{}
+	buf.SetEvictionCallback(func(capturedAt time.Time, reason string) { evictions[reason]++ })
+
+	// a frame returned twice by the camera only reaches the ring buffer once
+	start := time.Now()
+	buf.StoreImages(nil, resource.ResponseMetadata{CapturedAt: start}, start)
+	buf.StoreImages(nil, resource.ResponseMetadata{CapturedAt: start.Add(500 * time.Microsecond)}, start)
+	test.That(t, buf.GetRingBufferLength(), test.ShouldEqual, 1)
+	test.That(t, evictions[DroppedFrameGap], test.ShouldEqual, 1)
+
+	// the gap applies within a capture window too
+	triggerTime := start.Add(time.Second)
+	buf.MarkShouldSend(triggerTime)
+	buf.StoreImages(nil, resource.ResponseMetadata{CapturedAt: triggerTime}, triggerTime)
+	buf.StoreImages(nil, resource.ResponseMetadata{CapturedAt: triggerTime.Add(time.Millisecond)}, triggerTime)
+	test.That(t, buf.GetToSendLength(), test.ShouldEqual, 2)
+	test.That(t, evictions[DroppedFrameGap], test.ShouldEqual, 2)
+
+	// frames spaced further apart than the gap are all kept
+	later := triggerTime.Add(10 * time.Millisecond)
+	buf.StoreImages(nil, resource.ResponseMetadata{CapturedAt: later}, later)
+	test.That(t, buf.GetToSendLength(), test.ShouldEqual, 3)
+}
+
+func TestWindowSeq(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	buf := NewImageBuffer(2, 1.0, 0, 0, logger, true, 0)
+	buf.SetAnnotateSeq(true)
+
+	seqs := func(imgs []camera.NamedImage) []string {
+		res := []string{}
+		for _, img := range imgs {
+			for _, c := range img.Annotations.Classifications {
+				if strings.HasPrefix(c.Label, SeqLabelPrefix) {
+					res = append(res, c.Label)
+				}
+			}
+		}
+		return res
+	}
+	frame := func(name string) []camera.NamedImage {
+		return []camera.NamedImage{{SourceName: name}}
+	}
+
+	// two pre-roll frames with colliding timestamps, then the trigger frame and one more captured during the window
+	trigger := time.Now()
+	buf.AddToRingBuffer(frame("a"), resource.ResponseMetadata{CapturedAt: trigger.Add(-1 * time.Second)})
+	buf.AddToRingBuffer(frame("b"), resource.ResponseMetadata{CapturedAt: trigger.Add(-1 * time.Second)})
+	buf.MarkShouldSend(trigger)
+	buf.StoreImages(frame("c"), resource.ResponseMetadata{CapturedAt: trigger}, trigger)
+	buf.StoreImages(frame("d"), resource.ResponseMetadata{CapturedAt: trigger.Add(time.Second)}, trigger.Add(time.Second))
+
+	imgs, _, ok := buf.PopAllToSend()
+	test.That(t, ok, test.ShouldBeTrue)
+	test.That(t, seqs(imgs), test.ShouldResemble, []string{"seq:0", "seq:1", "seq:2", "seq:3"})
+
+	// the sequence restarts with the next window
+	next := trigger.Add(10 * time.Second)
+	buf.MarkShouldSend(next)
+	buf.StoreImages(frame("e"), resource.ResponseMetadata{CapturedAt: next}, next)
+	buf.StoreImages(frame("f"), resource.ResponseMetadata{CapturedAt: next.Add(time.Second)}, next.Add(time.Second))
+	first, ok := buf.PopFirstToSend()
+	test.That(t, ok, test.ShouldBeTrue)
+	test.That(t, seqs(first.Imgs), test.ShouldResemble, []string{"seq:0"})
+	second, ok := buf.PopFirstToSend()
+	test.That(t, ok, test.ShouldBeTrue)
+	test.That(t, seqs(second.Imgs), test.ShouldResemble, []string{"seq:1"})
+
+	// without the option nothing is added
+	buf.SetAnnotateSeq(false)
+	buf.StoreImages(frame("g"), resource.ResponseMetadata{CapturedAt: next.Add(2 * time.Second)}, next.Add(2*time.Second))
+	third, ok := buf.PopFirstToSend()
+	test.That(t, ok, test.ShouldBeTrue)
+	test.That(t, len(third.Imgs[0].Annotations.Classifications), test.ShouldEqual, 0)
+}
+
+func TestMinWindow(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	buf := NewImageBuffer(0, 1.0, 0, 1, logger, true, 0)
+	buf.SetMinWindow(5 * time.Second)
+
+	// the configured 1s after the trigger is extended to 5s
+	trigger := time.Now()
+	buf.MarkShouldSend(trigger)
+	test.That(t, buf.IsWithinCaptureWindow(trigger.Add(5*time.Second)), test.ShouldBeTrue)
+	test.That(t, buf.IsWithinCaptureWindow(trigger.Add(6*time.Second)), test.ShouldBeFalse)
+
+	// windows already longer than the minimum are left alone
+	buf = NewImageBuffer(0, 1.0, 0, 10, logger, true, 0)
+	buf.SetMinWindow(5 * time.Second)
+	buf.MarkShouldSend(trigger)
+	test.That(t, buf.IsWithinCaptureWindow(trigger.Add(10*time.Second)), test.ShouldBeTrue)
+	test.That(t, buf.IsWithinCaptureWindow(trigger.Add(11*time.Second)), test.ShouldBeFalse)
+}
+
+// popAllToSendFrames empties ToSend like PopAllToSend, returning the frames themselves for inspection.
+func popAllToSendFrames(buf *ImageBuffer) ([]CachedData, bool) {
+	buf.mu.Lock()
+	defer buf.mu.Unlock()
+	return buf.popAllToSend("popAllToSendFrames")
+}
+
+func TestPopAllToSendCaptureTimes(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	buf := NewImageBuffer(2, 1.0, 0, 0, logger, true, 0)
+
+	_, _, ok := buf.PopAllToSend()
+	test.That(t, ok, test.ShouldBeFalse)
+
+	trigger := time.Now()
+	capturedAt := []time.Time{trigger.Add(-1 * time.Second), trigger, trigger.Add(1 * time.Second)}
+	buf.AddToRingBuffer([]camera.NamedImage{{SourceName: "color"}}, resource.ResponseMetadata{CapturedAt: capturedAt[0]})
+	buf.MarkShouldSend(trigger)
+	buf.StoreImages([]camera.NamedImage{{SourceName: "color"}}, resource.ResponseMetadata{CapturedAt: capturedAt[1]}, capturedAt[1])
+	buf.StoreImages([]camera.NamedImage{{SourceName: "color"}}, resource.ResponseMetadata{CapturedAt: capturedAt[2]}, capturedAt[2])
+
+	images, meta, ok := buf.PopAllToSend()
+	test.That(t, ok, test.ShouldBeTrue)
+	test.That(t, meta.CapturedAt.Equal(capturedAt[0]), test.ShouldBeTrue)
+	test.That(t, len(images), test.ShouldEqual, 3)
+	for i, img := range images {
+		// the batch has the earliest capture time, while each image's name keeps its own
+		test.That(t, img.SourceName, test.ShouldEqual, capturedAt[i].Format(timestampFormat)+"_color")
+	}
+	test.That(t, buf.GetToSendLength(), test.ShouldEqual, 0)
+}
+
+func TestGetRange(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	buf := NewImageBuffer(2, 1.0, 0, 0, logger, true, 0)
+
+	base := time.Now()
+	for i := 0; i < 5; i++ {
+		buf.AddToRingBuffer(nil, resource.ResponseMetadata{CapturedAt: base.Add(time.Duration(i) * time.Second)})
+	}
+
+	frames := buf.GetRange(base.Add(1*time.Second), base.Add(3*time.Second))
+	test.That(t, len(frames), test.ShouldEqual, 3)
+	for i, frame := range frames {
+		test.That(t, frame.Meta.CapturedAt.Equal(base.Add(time.Duration(i+1)*time.Second)), test.ShouldBeTrue)
+	}
+	test.That(t, len(buf.GetRange(base.Add(10*time.Second), base.Add(20*time.Second))), test.ShouldEqual, 0)
+
+	// the ring buffer is untouched
+	test.That(t, buf.GetRingBufferLength(), test.ShouldEqual, 5)
+}
+
+func TestPopRollback(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	buf := NewImageBuffer(10, 1.0, 0, 0, logger, true, 0)
+
+	trigger := time.Now()
+	buf.MarkShouldSend(trigger)
+	buf.StoreImages([]camera.NamedImage{{SourceName: "a"}}, resource.ResponseMetadata{CapturedAt: trigger}, trigger)
+	buf.StoreImages([]camera.NamedImage{{SourceName: "b"}}, resource.ResponseMetadata{CapturedAt: trigger.Add(time.Second)}, trigger.Add(time.Second))
+
+	imgs, meta, pop, ok := buf.PopAllToSendTx()
+	test.That(t, ok, test.ShouldBeTrue)
+	test.That(t, len(imgs), test.ShouldEqual, 2)
+	test.That(t, meta.CapturedAt.Equal(trigger), test.ShouldBeTrue)
+	test.That(t, buf.GetToSendLength(), test.ShouldEqual, 0)
+
+	// a frame queued while the batch was being sent stays behind the restored ones
+	buf.StoreImages([]camera.NamedImage{{SourceName: "c"}}, resource.ResponseMetadata{CapturedAt: trigger.Add(2 * time.Second)}, trigger.Add(2*time.Second))
+	buf.RollbackPop(pop)
+	toSend := buf.GetToSendSlice()
+	test.That(t, len(toSend), test.ShouldEqual, 3)
+	test.That(t, []string{toSend[0].Imgs[0].SourceName, toSend[1].Imgs[0].SourceName, toSend[2].Imgs[0].SourceName},
+		test.ShouldResemble, []string{"a", "b", "c"})
+
+	// rolling back twice doesn't duplicate frames
+	buf.RollbackPop(pop)
+	test.That(t, buf.GetToSendLength(), test.ShouldEqual, 3)
+
+	// committed pops can't be rolled back
+	_, _, pop, ok = buf.PopAllToSendTx()
+	test.That(t, ok, test.ShouldBeTrue)
+	buf.CommitPop(pop)
+	buf.RollbackPop(pop)
+	test.That(t, buf.GetToSendLength(), test.ShouldEqual, 0)
+
+	_, _, _, ok = buf.PopAllToSendTx()
+	test.That(t, ok, test.ShouldBeFalse)
+}
+
+func TestCompactRingBuffer(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	buf := NewImageBuffer(10, 1.0, 0, 0, logger, true, 0)
+	buf.SetCompact(true)
+
+	// bursts around each second, with a little jitter in the spacing
+	base := time.Now()
+	for _, offset := range []time.Duration{
+		0, 100 * time.Millisecond, 200 * time.Millisecond,
+		time.Second, 1050 * time.Millisecond,
+		2 * time.Second,
+		2900 * time.Millisecond, 3 * time.Second, 3010 * time.Millisecond,
+	} {
+		buf.StoreImages(nil, resource.ResponseMetadata{CapturedAt: base.Add(offset)}, base.Add(offset))
+	}
+
+	frames := buf.GetRingBufferSlice()
+	test.That(t, len(frames), test.ShouldEqual, 4)
+	for i := 1; i < len(frames); i++ {
+		gap := frames[i].Meta.CapturedAt.Sub(frames[i-1].Meta.CapturedAt)
+		test.That(t, gap, test.ShouldBeGreaterThanOrEqualTo, 900*time.Millisecond)
+		test.That(t, gap, test.ShouldBeLessThanOrEqualTo, 1100*time.Millisecond)
+	}
+
+	// without compaction every frame is kept
+	buf = NewImageBuffer(10, 1.0, 0, 0, logger, true, 0)
+	for i := 0; i < 5; i++ {
+		buf.AddToRingBuffer(nil, resource.ResponseMetadata{CapturedAt: base.Add(time.Duration(i) * time.Millisecond)})
+	}
+	test.That(t, buf.GetRingBufferLength(), test.ShouldEqual, 5)
+}
+
+func TestCorrelationID(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	buf := NewImageBuffer(2, 1.0, 0, 0, logger, true, 0)
+	frame := func(name string) []camera.NamedImage {
+		return []camera.NamedImage{{SourceName: name}}
+	}
+	ids := func(imgs []camera.NamedImage) []string {
+		res := []string{}
+		for _, img := range imgs {
+			for _, c := range img.Annotations.Classifications {
+				if strings.HasPrefix(c.Label, CorrelationIDLabelPrefix) {
+					res = append(res, strings.TrimPrefix(c.Label, CorrelationIDLabelPrefix))
+				}
+			}
+		}
+		return res
+	}
+
+	trigger := time.Now()
+	buf.AddToRingBuffer(frame("a"), resource.ResponseMetadata{CapturedAt: trigger.Add(-1 * time.Second)})
+	test.That(t, buf.MarkShouldSendWithCorrelationID(trigger, "external", "event-1"), test.ShouldBeTrue)
+	buf.StoreImages(frame("b"), resource.ResponseMetadata{CapturedAt: trigger.Add(time.Second)}, trigger.Add(time.Second))
+
+	imgs, _, ok := buf.PopAllToSend()
+	test.That(t, ok, test.ShouldBeTrue)
+	test.That(t, ids(imgs), test.ShouldResemble, []string{"event-1", "event-1"})
+
+	// the next window doesn't inherit the id
+	next := trigger.Add(10 * time.Second)
+	buf.MarkShouldSend(next)
+	buf.StoreImages(frame("c"), resource.ResponseMetadata{CapturedAt: next}, next)
+	imgs, _, ok = buf.PopAllToSend()
+	test.That(t, ok, test.ShouldBeTrue)
+	test.That(t, ids(imgs), test.ShouldResemble, []string{})
+}
+
+func TestEvictionCallback(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	// window_seconds of 1 at 1 image/s keeps 3 frames in the ring buffer
+	buf := NewImageBuffer(1, 1.0, 0, 0, logger, false, 0)
+	type eviction struct {
+		capturedAt time.Time
+		reason     string
+	}
+	var evictions []eviction
+	buf.SetEvictionCallback(func(capturedAt time.Time, reason string) {
+		evictions = append(evictions, eviction{capturedAt, reason})
+	})
+
+	base := time.Now()
+	for i := 0; i < 5; i++ {
+		buf.AddToRingBuffer([]camera.NamedImage{{SourceName: "color"}}, resource.ResponseMetadata{CapturedAt: base.Add(time.Duration(i) * time.Second)})
+	}
+	test.That(t, buf.GetRingBufferLength(), test.ShouldEqual, 3)
+	test.That(t, evictions, test.ShouldResemble, []eviction{
+		{base, EvictedRingBufferFull},
+		{base.Add(time.Second), EvictedRingBufferFull},
+	})
+
+	// frames dropped from ToSend are reported too
+	evictions = nil
+	buf.MarkShouldSend(base.Add(4 * time.Second))
+	test.That(t, buf.GetToSendLength(), test.ShouldEqual, 2)
+	buf.CancelSince(base.Add(3*time.Second), base.Add(4*time.Second))
+	test.That(t, evictions, test.ShouldResemble, []eviction{
+		{base.Add(3 * time.Second), DroppedCancelled},
+		{base.Add(4 * time.Second), DroppedCancelled},
+	})
+
+	// and nothing is reported once the callback is removed
+	evictions = nil
+	buf.SetEvictionCallback(nil)
+	for i := 5; i < 10; i++ {
+		buf.AddToRingBuffer([]camera.NamedImage{{SourceName: "color"}}, resource.ResponseMetadata{CapturedAt: base.Add(time.Duration(i) * time.Second)})
+	}
+	test.That(t, len(evictions), test.ShouldEqual, 0)
+}
+
+func TestMaxPendingWindows(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	buf := NewImageBuffer(0, 1.0, 0, 1, logger, false, 0)
+	buf.SetMaxPendingWindows(2)
+	frame := []camera.NamedImage{{SourceName: "color"}}
+
+	// open two windows whose frames aren't consumed
+	base := time.Now()
+	for i := 0; i < 2; i++ {
+		trigger := base.Add(time.Duration(i*5) * time.Second)
+		test.That(t, buf.MarkShouldSendForLabel(trigger, "person"), test.ShouldBeTrue)
+		buf.StoreImages(frame, resource.ResponseMetadata{CapturedAt: trigger}, trigger)
+	}
+	test.That(t, buf.GetToSendLength(), test.ShouldEqual, 2)
+
+	// a third is refused, and no window is opened
+	third := base.Add(10 * time.Second)
+	test.That(t, buf.MarkShouldSendForLabel(third, "person"), test.ShouldBeFalse)
+	test.That(t, buf.IsWithinCaptureWindow(third), test.ShouldBeFalse)
+
+	// while the second window is open it can still be extended
+	test.That(t, buf.MarkShouldSendForLabel(base.Add(5500*time.Millisecond), "person"), test.ShouldBeTrue)
+
+	// once the first window's frames are consumed, a new window can open
+	_, ok := buf.PopFirstToSend()
+	test.That(t, ok, test.ShouldBeTrue)
+	fourth := base.Add(12 * time.Second)
+	test.That(t, buf.MarkShouldSendForLabel(fourth, "person"), test.ShouldBeTrue)
+	test.That(t, buf.IsWithinCaptureWindow(fourth), test.ShouldBeTrue)
+
+	// without a limit triggers are never refused
+	buf.SetMaxPendingWindows(0)
+	buf.StoreImages(frame, resource.ResponseMetadata{CapturedAt: fourth}, fourth)
+	test.That(t, buf.MarkShouldSendForLabel(base.Add(20*time.Second), "person"), test.ShouldBeTrue)
+}
+
+func TestSplitWindowEveryN(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	buf := NewImageBuffer(0, 1.0, 0, 10, logger, false, 0)
+	buf.SetSplitWindowEveryN(3)
+	buf.SetAnnotateSeq(true)
+	labels := func(img camera.NamedImage, prefix string) []string {
+		res := []string{}
+		for _, c := range img.Annotations.Classifications {
+			if strings.HasPrefix(c.Label, prefix) {
+				res = append(res, strings.TrimPrefix(c.Label, prefix))
+			}
+		}
+		return res
+	}
+
+	// one long window of 7 frames
+	trigger := time.Now()
+	buf.MarkShouldSend(trigger)
+	for i := 0; i < 7; i++ {
+		capturedAt := trigger.Add(time.Duration(i) * time.Second)
+		buf.StoreImages([]camera.NamedImage{{SourceName: "color"}}, resource.ResponseMetadata{CapturedAt: capturedAt}, capturedAt)
+	}
+	imgs, _, ok := buf.PopAllToSend()
+	test.That(t, ok, test.ShouldBeTrue)
+	test.That(t, len(imgs), test.ShouldEqual, 7)
+
+	// comes out as segments of 3, 3 and 1 frames with distinct IDs
+	ids := []string{}
+	seqs := []string{}
+	for _, img := range imgs {
+		id := labels(img, WindowIDLabelPrefix)
+		test.That(t, len(id), test.ShouldEqual, 1)
+		ids = append(ids, id[0])
+		seqs = append(seqs, labels(img, SeqLabelPrefix)...)
+	}
+	test.That(t, ids[0], test.ShouldEqual, ids[1])
+	test.That(t, ids[1], test.ShouldEqual, ids[2])
+	test.That(t, ids[3], test.ShouldEqual, ids[4])
+	test.That(t, ids[4], test.ShouldEqual, ids[5])
+	test.That(t, ids[0], test.ShouldNotEqual, ids[3])
+	test.That(t, ids[6], test.ShouldNotEqual, ids[3])
+	test.That(t, ids[6], test.ShouldNotEqual, ids[0])
+	test.That(t, seqs, test.ShouldResemble, []string{"0", "1", "2", "0", "1", "2", "0"})
+
+	// without splitting there is no window ID
+	buf.SetSplitWindowEveryN(0)
+	capturedAt := trigger.Add(8 * time.Second)
+	buf.StoreImages([]camera.NamedImage{{SourceName: "color"}}, resource.ResponseMetadata{CapturedAt: capturedAt}, capturedAt)
+	imgs, _, ok = buf.PopAllToSend()
+	test.That(t, ok, test.ShouldBeTrue)
+	test.That(t, len(labels(imgs[0], WindowIDLabelPrefix)), test.ShouldEqual, 0)
+}
+
+func TestFrameIDsAcrossOverlappingWindows(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	buf := NewImageBuffer(0, 1.0, 2, 2, logger, false, 0)
+	dropped := 0
+	buf.SetEvictionCallback(func(capturedAt time.Time, reason string) {
+		if reason == DroppedDuplicate {
+			dropped++
+		}
+	})
+	base := time.Now()
+	store := func(capturedAt time.Time) {
+		buf.StoreImages([]camera.NamedImage{{SourceName: "color"}}, resource.ResponseMetadata{CapturedAt: capturedAt}, capturedAt)
+	}
+
+	// frames a second apart with up to 400ms of clock jitter
+	jitter := []time.Duration{300, -400, 200, -300, 400, -200}
+	for i, j := range jitter {
+		store(base.Add(time.Duration(i)*time.Second + j*time.Millisecond))
+	}
+	test.That(t, buf.MarkShouldSendForLabel(base.Add(4*time.Second), "person"), test.ShouldBeTrue)
+	toSend := buf.GetToSendSlice()
+	test.That(t, len(toSend), test.ShouldEqual, 4)
+
+	// the same frame comes back into the ring buffer with a corrected timestamp, and another capture is
+	// stored with the exact time of a queued one
+	skewed := toSend[1]
+	skewed.Meta.CapturedAt = skewed.Meta.CapturedAt.Add(150 * time.Millisecond)
+	buf.ringBuffer = append(buf.ringBuffer, skewed)
+	buf.ringBuffer = append(buf.ringBuffer, buf.ingest([]camera.NamedImage{{SourceName: "color"}}, toSend[2].Meta))
+
+	// an overlapping trigger takes neither
+	test.That(t, buf.MarkShouldSendForLabel(base.Add(5*time.Second), "person"), test.ShouldBeTrue)
+	test.That(t, dropped, test.ShouldEqual, 2)
+	store(base.Add(6*time.Second + 100*time.Millisecond))
+
+	frames, ok := popAllToSendFrames(buf)
+	test.That(t, ok, test.ShouldBeTrue)
+	test.That(t, len(frames), test.ShouldEqual, 5)
+	seen := map[uint64]bool{}
+	for _, frame := range frames {
+		test.That(t, frame.ID, test.ShouldNotEqual, 0)
+		test.That(t, seen[frame.ID], test.ShouldBeFalse)
+		seen[frame.ID] = true
+	}
+}
+
+func TestTriggerFrame(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	buf := NewImageBuffer(0, 1.0, 2, 2, logger, false, 0)
+	buf.SetAnnotateTrigger(true)
+	base := time.Now()
+	store := func(offset time.Duration) {
+		capturedAt := base.Add(offset)
+		buf.StoreImages([]camera.NamedImage{{SourceName: "color"}}, resource.ResponseMetadata{CapturedAt: capturedAt}, capturedAt)
+	}
+	triggerFrames := func(frames []CachedData) []time.Time {
+		res := []time.Time{}
+		for _, frame := range frames {
+			flagged := false
+			for _, c := range frame.Imgs[0].Annotations.Classifications {
+				flagged = flagged || c.Label == TriggerFrameLabel
+			}
+			test.That(t, flagged, test.ShouldEqual, frame.Trigger)
+			if flagged {
+				res = append(res, frame.Meta.CapturedAt)
+			}
+		}
+		return res
+	}
+
+	// the frame captured at the trigger is flagged
+	for i := 0; i < 4; i++ {
+		store(time.Duration(i) * time.Second)
+	}
+	buf.MarkShouldSend(base.Add(4 * time.Second))
+	for i := 4; i < 7; i++ {
+		store(time.Duration(i) * time.Second)
+	}
+	// extending the window doesn't move the trigger frame
+	buf.MarkShouldSend(base.Add(6 * time.Second))
+	frames, ok := popAllToSendFrames(buf)
+	test.That(t, ok, test.ShouldBeTrue)
+	test.That(t, len(frames), test.ShouldEqual, 5)
+	test.That(t, triggerFrames(frames), test.ShouldResemble, []time.Time{base.Add(4 * time.Second)})
+
+	// if no frame was captured at the trigger, the nearest one is flagged
+	for i := 18; i < 21; i++ {
+		store(time.Duration(i) * time.Second)
+	}
+	buf.MarkShouldSend(base.Add(20400 * time.Millisecond))
+	for i := 21; i < 23; i++ {
+		store(time.Duration(i) * time.Second)
+	}
+	frames, ok = popAllToSendFrames(buf)
+	test.That(t, ok, test.ShouldBeTrue)
+	test.That(t, len(frames), test.ShouldEqual, 4)
+	test.That(t, triggerFrames(frames), test.ShouldResemble, []time.Time{base.Add(20 * time.Second)})
+
+	// including when every frame was captured before the trigger, once the window closes
+	store(38 * time.Second)
+	store(39 * time.Second)
+	buf.MarkShouldSend(base.Add(40500 * time.Millisecond))
+	test.That(t, buf.GetToSendSlice()[0].Trigger, test.ShouldBeFalse)
+	store(43 * time.Second)
+	frames, ok = popAllToSendFrames(buf)
+	test.That(t, ok, test.ShouldBeTrue)
+	test.That(t, len(frames), test.ShouldEqual, 1)
+	test.That(t, triggerFrames(frames), test.ShouldResemble, []time.Time{base.Add(39 * time.Second)})
+}
+
+func TestMaxToSend(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	buf := NewImageBuffer(0, 1.0, 2, 30, logger, false, 0)
+	var dropped []time.Time
+	buf.SetEvictionCallback(func(capturedAt time.Time, reason string) {
+		if reason == DroppedToSendFull {
+			dropped = append(dropped, capturedAt)
+		}
+	})
+	buf.SetMaxToSend(3)
+	base := time.Now()
+	store := func(i int) {
+		capturedAt := base.Add(time.Duration(i) * time.Second)
+		buf.StoreImages([]camera.NamedImage{{SourceName: "color"}}, resource.ResponseMetadata{CapturedAt: capturedAt}, capturedAt)
+	}
+
+	// the pre-roll and the frames after the trigger overflow the cap, so the oldest are dropped
+	store(0)
+	store(1)
+	buf.MarkShouldSend(base.Add(2 * time.Second))
+	for i := 2; i < 6; i++ {
+		store(i)
+	}
+	test.That(t, buf.GetToSendLength(), test.ShouldEqual, 3)
+	test.That(t, len(dropped), test.ShouldEqual, 3)
+	for i, capturedAt := range dropped {
+		test.That(t, capturedAt.Equal(base.Add(time.Duration(i)*time.Second)), test.ShouldBeTrue)
+	}
+
+	// the batch starts at the oldest remaining frame
+	imgs, meta, ok := buf.PopAllToSend()
+	test.That(t, ok, test.ShouldBeTrue)
+	test.That(t, len(imgs), test.ShouldEqual, 3)
+	test.That(t, meta.CapturedAt.Equal(base.Add(3*time.Second)), test.ShouldBeTrue)
+
+	// without a cap ToSend keeps growing
+	buf.SetMaxToSend(0)
+	for i := 6; i < 12; i++ {
+		store(i)
+	}
+	test.That(t, buf.GetToSendLength(), test.ShouldEqual, 6)
+	test.That(t, len(dropped), test.ShouldEqual, 3)
+}
+
+func TestTriggerReason(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	buf := NewImageBuffer(0, 1.0, 2, 2, logger, false, 0)
+	buf.SetAnnotateReason(true)
+	base := time.Now()
+	store := func(offset time.Duration) {
+		capturedAt := base.Add(offset)
+		buf.StoreImages([]camera.NamedImage{{SourceName: "color"}}, resource.ResponseMetadata{CapturedAt: capturedAt}, capturedAt)
+	}
+	reasons := func(frames []CachedData) []string {
+		res := []string{}
+		for _, frame := range frames {
+			for _, c := range frame.Imgs[0].Annotations.Classifications {
+				if strings.HasPrefix(c.Label, TriggerReasonLabelPrefix) {
+					test.That(t, c.Confidence, test.ShouldNotBeNil)
+					res = append(res, fmt.Sprintf("%s %.1f", c.Label, *c.Confidence))
+				}
+			}
+		}
+		return res
+	}
+
+	// the pre-roll and the frames after the trigger carry its reason, until another trigger extends the window
+	for i := 0; i < 4; i++ {
+		store(time.Duration(i) * time.Second)
+	}
+	test.That(t, buf.MarkShouldSendForReason(base.Add(4*time.Second), "person", 0.9), test.ShouldBeTrue)
+	store(4 * time.Second)
+	store(5 * time.Second)
+	test.That(t, buf.MarkShouldSendForReason(base.Add(5*time.Second), "car", 0.7), test.ShouldBeTrue)
+	store(6 * time.Second)
+	// a trigger without a reason keeps the current one
+	buf.MarkShouldSend(base.Add(6 * time.Second))
+	store(7 * time.Second)
+	frames, ok := popAllToSendFrames(buf)
+	test.That(t, ok, test.ShouldBeTrue)
+	test.That(t, reasons(frames), test.ShouldResemble, []string{
+		"trigger_reason:person 0.9", "trigger_reason:person 0.9", "trigger_reason:person 0.9", "trigger_reason:person 0.9",
+		"trigger_reason:car 0.7", "trigger_reason:car 0.7",
+	})
+	test.That(t, frames[0].Reason.Label, test.ShouldEqual, "person")
+
+	// a new window starts without a reason
+	store(20 * time.Second)
+	buf.MarkShouldSend(base.Add(20 * time.Second))
+	frames, ok = popAllToSendFrames(buf)
+	test.That(t, ok, test.ShouldBeTrue)
+	test.That(t, frames[0].Reason, test.ShouldBeNil)
+	test.That(t, reasons(frames), test.ShouldBeEmpty)
+}
+
+func TestSetWindow(t *testing.T) {
+	buf := NewImageBuffer(0, 1.0, 2, 2, logging.NewTestLogger(t), false, 0)
+	base := time.Now()
+	for i := 0; i < 12; i++ {
+		buf.AddToRingBuffer([]camera.NamedImage{{SourceName: "color"}}, resource.ResponseMetadata{CapturedAt: base.Add(time.Duration(i) * time.Second)})
+	}
+	test.That(t, buf.GetRingBufferLength(), test.ShouldEqual, 12)
+
+	// a shorter window trims the oldest frames
+	buf.SetWindow(0, 1, 1)
+	status := buf.Status()
+	test.That(t, status.MaxImages, test.ShouldEqual, 6)
+	test.That(t, status.WindowSecondsBefore, test.ShouldEqual, 1)
+	test.That(t, buf.GetRingBufferLength(), test.ShouldEqual, 6)
+	test.That(t, buf.GetRingBufferSlice()[0].Meta.CapturedAt, test.ShouldEqual, base.Add(6*time.Second))
+
+	// window_seconds overrides before and after, and the next trigger uses the new bounds
+	buf.SetWindow(3, 1, 1)
+	status = buf.Status()
+	test.That(t, status.MaxImages, test.ShouldEqual, 9)
+	test.That(t, status.WindowSecondsAfter, test.ShouldEqual, 3)
+	buf.MarkShouldSend(base.Add(11 * time.Second))
+	test.That(t, buf.IsWithinCaptureWindow(base.Add(14*time.Second)), test.ShouldBeTrue)
+	test.That(t, buf.IsWithinCaptureWindow(base.Add(15*time.Second)), test.ShouldBeFalse)
+}
+
+func TestNearestFrameTime(t *testing.T) {
+	buf := NewImageBuffer(0, 1.0, 2, 2, logging.NewTestLogger(t), false, 0)
+	base := time.Now()
+	for _, offset := range []time.Duration{0, time.Second, 2 * time.Second} {
+		buf.AddToRingBuffer([]camera.NamedImage{{SourceName: "color"}}, resource.ResponseMetadata{CapturedAt: base.Add(offset)})
+	}
+
+	test.That(t, buf.NearestFrameTime(base.Add(700*time.Millisecond), time.Second), test.ShouldEqual, base.Add(time.Second))
+	test.That(t, buf.NearestFrameTime(base.Add(300*time.Millisecond), time.Second), test.ShouldEqual, base)
+	// ties go to the earlier frame
+	test.That(t, buf.NearestFrameTime(base.Add(1500*time.Millisecond), time.Second), test.ShouldEqual, base.Add(time.Second))
+	// beyond the tolerance, the time is left alone
+	test.That(t, buf.NearestFrameTime(base.Add(300*time.Millisecond), 100*time.Millisecond), test.ShouldEqual, base.Add(300*time.Millisecond))
+	test.That(t, buf.NearestFrameTime(base.Add(10*time.Second), time.Second), test.ShouldEqual, base.Add(10*time.Second))
+}
+
+func TestEmitEvents(t *testing.T) {
+	logger, logs := logging.NewObservedTestLogger(t)
+	buf := NewImageBuffer(0, 1.0, 1, 2, logger, false, 0)
+	base := time.Now()
+	store := func(offset time.Duration) {
+		at := base.Add(offset)
+		buf.StoreImages([]camera.NamedImage{{SourceName: "color"}}, resource.ResponseMetadata{CapturedAt: at}, at)
+	}
+
+	// without the setting, no events are logged
+	store(0)
+	buf.MarkShouldSendForLabel(base, "person")
+	store(time.Second)
+	buf.CloseExpiredWindow(base.Add(3 * time.Second))
+	test.That(t, logs.FilterMessage(WindowOpenEvent).Len(), test.ShouldEqual, 0)
+	test.That(t, logs.FilterMessage(WindowCloseEvent).Len(), test.ShouldEqual, 0)
+
+	buf.SetEmitEvents(true)
+	store(10 * time.Second)
+	buf.MarkShouldSendWithCorrelationID(base.Add(10*time.Second), "person", "order-1")
+	// extending the window doesn't open another
+	store(11 * time.Second)
+	buf.MarkShouldSendForLabel(base.Add(11*time.Second), "person")
+	store(12 * time.Second)
+	buf.CloseExpiredWindow(base.Add(14 * time.Second))
+
+	opened := logs.FilterMessage(WindowOpenEvent).All()
+	test.That(t, len(opened), test.ShouldEqual, 1)
+	fields := opened[0].ContextMap()
+	test.That(t, fields["event"], test.ShouldEqual, WindowOpenEvent)
+	test.That(t, fields["window"], test.ShouldEqual, int64(2))
+	test.That(t, fields["label"], test.ShouldEqual, "person")
+	test.That(t, fields["correlationID"], test.ShouldEqual, "order-1")
+	test.That(t, fields["trigger"], test.ShouldEqual, base.Add(10*time.Second).Format(timestampFormat))
+	test.That(t, fields["captureFrom"], test.ShouldEqual, base.Add(9*time.Second).Format(timestampFormat))
+
+	closed := logs.FilterMessage(WindowCloseEvent).All()
+	test.That(t, len(closed), test.ShouldEqual, 1)
+	fields = closed[0].ContextMap()
+	test.That(t, fields["event"], test.ShouldEqual, WindowCloseEvent)
+	test.That(t, fields["window"], test.ShouldEqual, int64(2))
+	test.That(t, fields["start"], test.ShouldEqual, base.Add(9*time.Second).Format(timestampFormat))
+	test.That(t, fields["end"], test.ShouldEqual, base.Add(13*time.Second).Format(timestampFormat))
+	test.That(t, fields["durationSeconds"], test.ShouldEqual, 4.0)
+	test.That(t, fields["frames"], test.ShouldEqual, int64(3))
+}
@@ -0,0 +1,270 @@
+package imagebuffer
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/pkg/errors"
+	"go.viam.com/rdk/components/camera"
+	"go.viam.com/rdk/data"
+)
+
+// spilledImage is how each image of a spilled frame is written to disk.
+type spilledImage struct {
+	SourceName  string
+	MimeType    string
+	Annotations data.Annotations
+	Data        []byte
+}
+
+// SetSpill keeps only about the last second of the ring buffer in memory and writes older frames to a temporary
+// directory created in dir, as encoded bytes, up to maxBytes. Once the spilled frames take more than maxBytes, the
+// oldest frames of the ring buffer are dropped. Spilled frames are read back when a capture window takes them, or
+// when the ring buffer is read. An empty dir turns spilling off, reading any spilled frames back into memory.
+// Frames that can't be written stay in memory.
+func (ib *ImageBuffer) SetSpill(dir string, maxBytes int64) error {
+	if err := ib.setSpill(dir, maxBytes); err != nil {
+		return err
+	}
+	ib.spillOld()
+	return nil
+}
+
+// setSpill switches the spill directory to a new one in dir, if it changed. Must be called without the mutex held.
+func (ib *ImageBuffer) setSpill(dir string, maxBytes int64) error {
+	ib.mu.Lock()
+	defer ib.mu.Unlock()
+	ib.spillMaxBytes = maxBytes
+	if dir == ib.spillRoot {
+		return nil
+	}
+
+	ib.unspillAll()
+	ib.spillRoot = ""
+	ib.spillDir = ""
+	if dir == "" {
+		return nil
+	}
+	spillDir, err := os.MkdirTemp(dir, "filtered_camera-")
+	if err != nil {
+		return errors.Wrapf(err, "cannot create spill directory in %q", dir)
+	}
+	ib.spillRoot = dir
+	ib.spillDir = spillDir
+	return nil
+}
+
+// Close removes the spilled frames from disk. The buffer should not be used afterwards.
+func (ib *ImageBuffer) Close() error {
+	ib.mu.Lock()
+	defer ib.mu.Unlock()
+	if ib.spillDir == "" {
+		return nil
+	}
+	err := os.RemoveAll(ib.spillDir)
+	ib.spillDir = ""
+	ib.spillRoot = ""
+	ib.spillBytes = 0
+	return err
+}
+
+// spillOld writes the ring buffer frames older than the last second to disk, then drops the oldest frames of the
+// ring buffer while the spilled frames take more than the budget. The frames are picked under the mutex, but encoded
+// and written outside it, so that storing frames isn't held up by the disk. Must be called without the mutex held.
+func (ib *ImageBuffer) spillOld() {
+	ib.mu.Lock()
+	dir, picked := ib.spillDir, ib.pickSpill()
+	ib.mu.Unlock()
+
+	spilled := make([]CachedData, len(picked))
+	errs := make([]error, len(picked))
+	for i, cd := range picked {
+		spilled[i], errs[i] = spillFrame(dir, cd)
+	}
+
+	ib.mu.Lock()
+	defer ib.mu.Unlock()
+	for i, cd := range picked {
+		delete(ib.spilling, cd.ID)
+		if errs[i] != nil {
+			if !ib.spillFailing {
+				ib.logger.Warnf("cannot spill frames to %s, keeping them in memory: %v", dir, errs[i])
+				ib.spillFailing = true
+			}
+			continue
+		}
+		ib.spillFailing = false
+		ib.swapSpilled(dir, spilled[i])
+	}
+	for ib.spillBytes > ib.spillMaxBytes && len(ib.ringBuffer) > 0 {
+		old := ib.ringBuffer[0]
+		ib.evicted(old, EvictedSpillFull)
+		ib.unspill(old)
+		ib.ringBuffer = ib.ringBuffer[1:]
+	}
+}
+
+// pickSpill returns the ring buffer frames older than the last second that are neither spilled nor being spilled,
+// marking them as being spilled. Must be called with the mutex held.
+func (ib *ImageBuffer) pickSpill() []CachedData {
+	if ib.spillDir == "" {
+		return nil
+	}
+	var picked []CachedData
+	keep := max(1, int(math.Ceil(ib.imageFrequency)))
+	for i := 0; i < len(ib.ringBuffer)-keep; i++ {
+		cd := ib.ringBuffer[i]
+		if cd.spill != "" || ib.spilling[cd.ID] {
+			continue
+		}
+		if ib.spilling == nil {
+			ib.spilling = make(map[uint64]bool)
+		}
+		ib.spilling[cd.ID] = true
+		picked = append(picked, cd)
+	}
+	return picked
+}
+
+// swapSpilled replaces the in memory frame of spilled, written to dir, with the spilled one. If the frame has left
+// the ring buffer, or the spill directory changed, while it was being written, the file is removed instead. Must be
+// called with the mutex held.
+func (ib *ImageBuffer) swapSpilled(dir string, spilled CachedData) {
+	i := slices.IndexFunc(ib.ringBuffer, func(cd CachedData) bool { return cd.ID == spilled.ID })
+	if i < 0 || dir != ib.spillDir {
+		if err := os.Remove(spilled.spill); err != nil && !os.IsNotExist(err) {
+			ib.logger.Debugf("cannot remove spilled frame %s: %v", spilled.spill, err)
+		}
+		return
+	}
+	ib.ringBuffer[i].Imgs = nil
+	ib.ringBuffer[i].spill = spilled.spill
+	ib.ringBuffer[i].spillSize = spilled.spillSize
+	ib.spillBytes += spilled.spillSize
+}
+
+// spillFrame writes cd's images to a file in dir, returning cd without them. It doesn't touch the buffer, so it can
+// be called without the mutex held.
+func spillFrame(dir string, cd CachedData) (CachedData, error) {
+	images := make([]spilledImage, 0, len(cd.Imgs))
+	for _, img := range cd.Imgs {
+		encoded, err := img.Bytes(context.Background())
+		if err != nil {
+			return cd, err
+		}
+		images = append(images, spilledImage{
+			SourceName:  img.SourceName,
+			MimeType:    img.MimeType(),
+			Annotations: img.Annotations,
+			Data:        encoded,
+		})
+	}
+	var b bytes.Buffer
+	if err := gob.NewEncoder(&b).Encode(images); err != nil {
+		return cd, err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%d.gob", cd.ID))
+	if err := os.WriteFile(path, b.Bytes(), 0o600); err != nil {
+		return cd, err
+	}
+	cd.Imgs = nil
+	cd.spill = path
+	cd.spillSize = int64(b.Len())
+	return cd, nil
+}
+
+// loadSpilled returns cd with its images read back from disk if it was spilled. The file is left in place.
+func loadSpilled(cd CachedData) (CachedData, error) {
+	if cd.spill == "" {
+		return cd, nil
+	}
+	raw, err := os.ReadFile(cd.spill)
+	if err != nil {
+		return cd, err
+	}
+	var images []spilledImage
+	if err := gob.NewDecoder(bytes.NewReader(raw)).Decode(&images); err != nil {
+		return cd, errors.Wrapf(err, "cannot decode spilled frame %s", cd.spill)
+	}
+	cd.Imgs = make([]camera.NamedImage, 0, len(images))
+	for _, img := range images {
+		named, err := camera.NamedImageFromBytes(img.Data, img.SourceName, img.MimeType, img.Annotations)
+		if err != nil {
+			return cd, err
+		}
+		cd.Imgs = append(cd.Imgs, named)
+	}
+	cd.spill = ""
+	cd.spillSize = 0
+	return cd, nil
+}
+
+// restore reads a spilled frame back into memory and removes it from disk, for a frame leaving the ring buffer.
+// Must be called with the mutex held.
+func (ib *ImageBuffer) restore(cd CachedData) (CachedData, error) {
+	loaded, err := loadSpilled(cd)
+	if err != nil {
+		return cd, err
+	}
+	ib.unspill(cd)
+	return loaded, nil
+}
+
+// unspill removes a spilled frame's file, if any. Must be called with the mutex held.
+func (ib *ImageBuffer) unspill(cd CachedData) {
+	if cd.spill == "" {
+		return
+	}
+	if err := os.Remove(cd.spill); err != nil && !os.IsNotExist(err) {
+		ib.logger.Debugf("cannot remove spilled frame %s: %v", cd.spill, err)
+	}
+	ib.spillBytes -= cd.spillSize
+}
+
+// unspillAll reads every spilled frame of the ring buffer back into memory and removes the spill directory,
+// dropping the frames that can't be read. Must be called with the mutex held.
+func (ib *ImageBuffer) unspillAll() {
+	if ib.spillDir == "" {
+		return
+	}
+	kept := make([]CachedData, 0, len(ib.ringBuffer))
+	for _, cached := range ib.ringBuffer {
+		restored, err := ib.restore(cached)
+		if err != nil {
+			ib.logger.Warnf("cannot read spilled frame captured at %s: %v", cached.Meta.CapturedAt.Format(timestampFormat), err)
+			ib.evicted(cached, EvictedSpillFailed)
+			ib.unspill(cached)
+			continue
+		}
+		kept = append(kept, restored)
+	}
+	ib.ringBuffer = kept
+	if err := os.RemoveAll(ib.spillDir); err != nil {
+		ib.logger.Warnf("cannot remove spill directory %s: %v", ib.spillDir, err)
+	}
+	ib.spillBytes = 0
+}
+
+// loadedFrames returns frames with any spilled images read back, leaving out the frames that can't be read.
+// Must be called with the mutex held.
+func (ib *ImageBuffer) loadedFrames(frames []CachedData) []CachedData {
+	if ib.spillDir == "" {
+		return frames
+	}
+	res := make([]CachedData, 0, len(frames))
+	for _, cached := range frames {
+		loaded, err := loadSpilled(cached)
+		if err != nil {
+			ib.logger.Warnf("cannot read spilled frame captured at %s: %v", cached.Meta.CapturedAt.Format(timestampFormat), err)
+			continue
+		}
+		res = append(res, loaded)
+	}
+	return res
+}
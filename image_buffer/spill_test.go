@@ -0,0 +1,88 @@
+package imagebuffer
+
+import (
+	"context"
+	"image"
+	"os"
+	"testing"
+	"time"
+
+	"go.viam.com/rdk/components/camera"
+	"go.viam.com/rdk/data"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/resource"
+	"go.viam.com/test"
+)
+
+func TestSpill(t *testing.T) {
+	buf := NewImageBuffer(0, 1.0, 5, 5, logging.NewTestLogger(t), false, 0)
+	evictions := map[string]int{}
+	buf.SetEvictionCallback(func(capturedAt time.Time, reason string) { evictions[reason]++ })
+	dir := t.TempDir()
+	test.That(t, buf.SetSpill(dir, 1<<20), test.ShouldBeNil)
+
+	base := time.Now()
+	add := func(i int) {
+		img, err := camera.NamedImageFromImage(image.NewRGBA(image.Rect(0, 0, 10, 10)), "color", "image/png", data.Annotations{})
+		test.That(t, err, test.ShouldBeNil)
+		buf.AddToRingBuffer([]camera.NamedImage{img}, resource.ResponseMetadata{CapturedAt: base.Add(time.Duration(i) * time.Second)})
+	}
+	spilled := func() []os.DirEntry {
+		entries, err := os.ReadDir(buf.spillDir)
+		test.That(t, err, test.ShouldBeNil)
+		return entries
+	}
+	for i := 0; i < 6; i++ {
+		add(i)
+	}
+
+	// at 1 image/s only the newest frame stays in memory
+	test.That(t, len(spilled()), test.ShouldEqual, 5)
+	frames := buf.GetRingBufferSlice()
+	test.That(t, len(frames), test.ShouldEqual, 6)
+	for _, frame := range frames {
+		test.That(t, len(frame.Imgs), test.ShouldEqual, 1)
+		test.That(t, frame.Imgs[0].SourceName, test.ShouldEqual, "color")
+		test.That(t, frame.Imgs[0].MimeType(), test.ShouldEqual, "image/png")
+	}
+
+	// a tighter budget drops the oldest frames
+	info, err := spilled()[0].Info()
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, buf.SetSpill(dir, 2*info.Size()), test.ShouldBeNil)
+	test.That(t, len(spilled()), test.ShouldEqual, 2)
+	test.That(t, buf.GetRingBufferLength(), test.ShouldEqual, 3)
+	test.That(t, evictions[EvictedSpillFull], test.ShouldEqual, 3)
+
+	// a trigger reads the spilled frames back into ToSend
+	buf.MarkShouldSend(base.Add(5 * time.Second))
+	test.That(t, len(spilled()), test.ShouldEqual, 0)
+	test.That(t, buf.spillBytes, test.ShouldEqual, 0)
+	imgs, _, ok := buf.PopAllToSend()
+	test.That(t, ok, test.ShouldBeTrue)
+	test.That(t, len(imgs), test.ShouldEqual, 3)
+	decoded, err := imgs[0].Image(context.Background())
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, decoded.Bounds().Dx(), test.ShouldEqual, 10)
+
+	// turning spilling off keeps the frames in memory
+	buf.ClearToSend()
+	for i := 20; i < 23; i++ {
+		add(i)
+	}
+	spillDir := buf.spillDir
+	test.That(t, len(spilled()), test.ShouldEqual, 2)
+	test.That(t, buf.SetSpill("", 0), test.ShouldBeNil)
+	_, err = os.Stat(spillDir)
+	test.That(t, os.IsNotExist(err), test.ShouldBeTrue)
+	frames = buf.GetRingBufferSlice()
+	test.That(t, len(frames), test.ShouldEqual, 3)
+	test.That(t, len(frames[0].Imgs), test.ShouldEqual, 1)
+
+	// Close removes the spill directory
+	test.That(t, buf.SetSpill(dir, 1<<20), test.ShouldBeNil)
+	spillDir = buf.spillDir
+	test.That(t, buf.Close(), test.ShouldBeNil)
+	_, err = os.Stat(spillDir)
+	test.That(t, os.IsNotExist(err), test.ShouldBeTrue)
+}
@@ -0,0 +1,63 @@
+// Package imagestats counts the images a camera's filter accepted or rejected, overall and by label, for the stats
+// the filtered and conditional cameras report through DoCommand.
+package imagestats
+
+import (
+	"maps"
+	"time"
+)
+
+// OtherLabel is the breakdown key labels are counted under once MaxLabels is reached
+const OtherLabel = "other"
+
+// Stats counts images by the label that accepted or rejected them.
+type Stats struct {
+	Total     int
+	Breakdown map[string]int
+	StartTime time.Time
+	// Groups maps labels to the group they are counted under in Breakdown, if any
+	Groups map[string]string
+	// MaxLabels, if positive, is how many distinct labels Breakdown holds before new ones go under OtherLabel
+	MaxLabels int
+	// Aliases renames labels before they are grouped and counted
+	Aliases map[string]string
+}
+
+// Update counts an image under label, after renaming it per Aliases and grouping it per Groups.
+func (s *Stats) Update(label string) {
+	if alias, ok := s.Aliases[label]; ok {
+		label = alias
+	}
+	if group, ok := s.Groups[label]; ok {
+		label = group
+	}
+	s.Total++
+	if s.Breakdown == nil {
+		s.Breakdown = make(map[string]int)
+	}
+	if _, ok := s.Breakdown[label]; !ok && s.MaxLabels > 0 && s.labels() >= s.MaxLabels {
+		label = OtherLabel
+	}
+	s.Breakdown[label]++
+}
+
+// Cleared returns stats with the same settings as s but no counts, started at startTime.
+func (s *Stats) Cleared(startTime time.Time) Stats {
+	return Stats{StartTime: startTime, Groups: s.Groups, MaxLabels: s.MaxLabels, Aliases: s.Aliases}
+}
+
+// Summary returns the total and a copy of the breakdown, in the shape DoCommand reports them.
+func (s *Stats) Summary() map[string]interface{} {
+	return map[string]interface{}{
+		"total":  s.Total,
+		"vision": maps.Clone(s.Breakdown),
+	}
+}
+
+// labels returns how many distinct labels Breakdown holds, not counting OtherLabel.
+func (s *Stats) labels() int {
+	if _, ok := s.Breakdown[OtherLabel]; ok {
+		return len(s.Breakdown) - 1
+	}
+	return len(s.Breakdown)
+}
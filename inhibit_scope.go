@@ -0,0 +1,48 @@
+package filtered_camera
+
+import (
+	"context"
+
+	"go.viam.com/rdk/components/camera"
+	"go.viam.com/rdk/resource"
+	"go.viam.com/rdk/services/vision"
+)
+
+const (
+	// inhibitScopePreTrigger runs inhibitors before a trigger, so a match keeps a capture window from opening
+	inhibitScopePreTrigger = "pre_trigger"
+	// inhibitScopeInWindow runs inhibitors on the frames captured while a window is open, dropping the ones that match
+	inhibitScopeInWindow = "in_window"
+	// inhibitedEviction is the evictions reason of frames dropped by an in_window inhibitor
+	inhibitedEviction = "inhibited"
+)
+
+// preTriggerInhibitors returns the inhibitors that can stop a capture window from opening, which is none of them
+// with inhibit_scope in_window. Scoped inhibitors are left out, they are checked for each accepting vision service.
+func (fc *filteredCamera) preTriggerInhibitors() []vision.Service {
+	if fc.conf.InhibitScope == inhibitScopeInWindow {
+		return nil
+	}
+	return fc.globalInhibitors()
+}
+
+// storeImages stores a frame in the image buffer. With inhibit_scope in_window, a frame that would be queued for
+// the open capture window is first run through the inhibitors and dropped if any of them match. If the inhibitors
+// fail, the frame is kept. A frame without images is not stored.
+func (fc *filteredCamera) storeImages(ctx context.Context, images []camera.NamedImage, meta resource.ResponseMetadata) {
+	if len(images) == 0 {
+		fc.logger.Debugf("not storing empty frame captured at %s", meta.CapturedAt)
+		return
+	}
+	if fc.conf.InhibitScope == inhibitScopeInWindow && len(fc.inhibitors) > 0 && fc.buf.IsWithinCaptureWindow(meta.CapturedAt) {
+		inhibited, err := fc.inhibitedDuringWindow(ctx, images)
+		if err != nil {
+			fc.logger.Warnf("could not run inhibitors on a frame in the capture window, keeping it: %v", err)
+		} else if inhibited {
+			fc.logger.Debugf("inhibitor matched, dropping frame captured at %s from the capture window", meta.CapturedAt)
+			fc.recordEviction(meta.CapturedAt, inhibitedEviction)
+			return
+		}
+	}
+	fc.buf.StoreImages(images, meta, meta.CapturedAt)
+}
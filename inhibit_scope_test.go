@@ -0,0 +1,110 @@
+package filtered_camera
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"strings"
+	"testing"
+	"time"
+
+	"go.viam.com/rdk/components/camera"
+	"go.viam.com/rdk/data"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/resource"
+	"go.viam.com/rdk/services/vision"
+	"go.viam.com/rdk/testutils/inject"
+	"go.viam.com/rdk/vision/classification"
+	"go.viam.com/test"
+
+	imagebuffer "github.com/viam-modules/filtered_camera/image_buffer"
+)
+
+func TestInhibitScopeInWindow(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	ctx := context.Background()
+	baseTime := time.Now()
+
+	captureCount := 0
+	imagesCam := inject.NewCamera("test_camera")
+	imagesCam.ImagesFunc = func(ctx context.Context, filterSourceNames []string, extra map[string]interface{}) (
+		[]camera.NamedImage, resource.ResponseMetadata, error) {
+		captureCount++
+		img, _ := camera.NamedImageFromImage(image.NewRGBA(image.Rect(0, 0, 10, 10)), fmt.Sprintf("img_%d", captureCount), "image/jpeg", data.Annotations{})
+		return []camera.NamedImage{img}, resource.ResponseMetadata{CapturedAt: baseTime.Add(time.Duration(captureCount) * time.Second)}, nil
+	}
+
+	accept := inject.NewVisionService("detector")
+	accept.ClassificationsFunc = func(ctx context.Context, img *camera.NamedImage, n int, extra map[string]interface{}) (classification.Classifications, error) {
+		return classification.Classifications{classification.NewClassification(0.9, "person")}, nil
+	}
+	authorized := false
+	guard := inject.NewVisionService("guard")
+	guard.ClassificationsFunc = func(ctx context.Context, img *camera.NamedImage, n int, extra map[string]interface{}) (classification.Classifications, error) {
+		if authorized {
+			return classification.Classifications{classification.NewClassification(0.9, "authorized")}, nil
+		}
+		return classification.Classifications{}, nil
+	}
+
+	fc := &filteredCamera{
+		conf: &Config{
+			WindowSecondsBefore: 0,
+			WindowSecondsAfter:  10,
+			ImageFrequency:      1.0,
+			InhibitScope:        inhibitScopeInWindow,
+		},
+		logger:                   logger,
+		cam:                      imagesCam,
+		inhibitors:               []vision.Service{guard},
+		otherVisionServices:      []vision.Service{accept},
+		inhibitedClassifications: map[string]map[string]float64{"guard": {"authorized": 0.5}},
+		acceptedClassifications:  map[string]map[string]float64{"detector": {"person": 0.5}},
+		buf:                      imagebuffer.NewImageBuffer(0, 1.0, 0, 10, logger, true, 0),
+	}
+
+	// the inhibitor doesn't stop the window from opening at t=1, but the trigger frame itself is dropped
+	authorized = true
+	_, _, err := fc.Images(ctx, nil, map[string]interface{}{data.FromDMString: true})
+	test.That(t, err, test.ShouldEqual, data.ErrNoCaptureToStore)
+	test.That(t, fc.buf.IsWithinCaptureWindow(baseTime.Add(2*time.Second)), test.ShouldBeTrue)
+
+	// frames 3 and 4 are inhibited and left out of the clip, the window stays open
+	authorized = false
+	fc.captureImageInBackground(ctx)
+	authorized = true
+	fc.captureImageInBackground(ctx)
+	fc.captureImageInBackground(ctx)
+	authorized = false
+	fc.captureImageInBackground(ctx)
+	test.That(t, fc.buf.GetToSendLength(), test.ShouldEqual, 2)
+	test.That(t, fc.rejectedStats.Breakdown["authorized"], test.ShouldEqual, 3)
+	test.That(t, fc.evictions[inhibitedEviction], test.ShouldEqual, 3)
+
+	imgs, _, err := fc.Images(ctx, nil, map[string]interface{}{data.FromDMString: true})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, len(imgs), test.ShouldEqual, 2)
+	test.That(t, strings.HasSuffix(imgs[0].SourceName, "_img_2"), test.ShouldBeTrue)
+	test.That(t, strings.HasSuffix(imgs[1].SourceName, "_img_5"), test.ShouldBeTrue)
+	test.That(t, fc.buf.IsWithinCaptureWindow(baseTime.Add(7*time.Second)), test.ShouldBeTrue)
+}
+
+func TestInhibitScopeValidation(t *testing.T) {
+	cfg := &Config{
+		Camera:         "cam",
+		VisionServices: []VisionServiceConfig{{Vision: "vs", Inhibit: true}},
+		WindowSeconds:  10,
+		InhibitScope:   "always",
+	}
+	_, _, err := cfg.Validate("path")
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, err.Error(), test.ShouldContainSubstring, "inhibit_scope")
+
+	cfg.InhibitScope = inhibitScopeInWindow
+	_, _, err = cfg.Validate("path")
+	test.That(t, err, test.ShouldBeNil)
+
+	cfg.RetroactiveInhibitSeconds = 2
+	_, _, err = cfg.Validate("path")
+	test.That(t, err, test.ShouldNotBeNil)
+}
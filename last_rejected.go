@@ -0,0 +1,47 @@
+package filtered_camera
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"time"
+
+	"go.viam.com/rdk/components/camera"
+)
+
+// rejectedFrame is an image the filter rejected, along with the rejected stats label it was counted under.
+type rejectedFrame struct {
+	img        camera.NamedImage
+	capturedAt time.Time
+	label      string
+}
+
+// keepRejected replaces the frame returned by last_rejected. Only the latest rejected frame is kept.
+func (fc *filteredCamera) keepRejected(img camera.NamedImage, capturedAt time.Time, label string) {
+	fc.rejectedMu.Lock()
+	defer fc.rejectedMu.Unlock()
+	fc.lastRejected = &rejectedFrame{img: img, capturedAt: capturedAt, label: label}
+}
+
+// lastRejectedFrame returns the most recently rejected image base64 encoded, with the label it was rejected under,
+// to help tune the thresholds.
+func (fc *filteredCamera) lastRejectedFrame(ctx context.Context) (map[string]interface{}, error) {
+	fc.rejectedMu.Lock()
+	rejected := fc.lastRejected
+	fc.rejectedMu.Unlock()
+	if rejected == nil {
+		return nil, errors.New("no frames have been rejected yet")
+	}
+
+	imgBytes, err := rejected.img.Bytes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"captured_at": rejected.capturedAt.Format(time.RFC3339Nano),
+		"label":       rejected.label,
+		"source_name": rejected.img.SourceName,
+		"mime_type":   rejected.img.MimeType(),
+		"image":       base64.StdEncoding.EncodeToString(imgBytes),
+	}, nil
+}
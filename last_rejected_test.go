@@ -0,0 +1,79 @@
+package filtered_camera
+
+import (
+	"context"
+	"encoding/base64"
+	"image"
+	"testing"
+	"time"
+
+	"go.viam.com/rdk/components/camera"
+	"go.viam.com/rdk/data"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/resource"
+	"go.viam.com/rdk/services/vision"
+	"go.viam.com/rdk/testutils/inject"
+	"go.viam.com/rdk/vision/classification"
+	"go.viam.com/test"
+
+	imagebuffer "github.com/viam-modules/filtered_camera/image_buffer"
+)
+
+func TestLastRejected(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	ctx := context.Background()
+	capturedAt := time.Now()
+	cam := inject.NewCamera("cam")
+	cam.ImagesFunc = func(ctx context.Context, filterSourceNames []string, extra map[string]interface{}) (
+		[]camera.NamedImage, resource.ResponseMetadata, error) {
+		img, _ := camera.NamedImageFromImage(image.NewRGBA(image.Rect(0, 0, 10, 10)), "color", "image/png", data.Annotations{})
+		return []camera.NamedImage{img}, resource.ResponseMetadata{CapturedAt: capturedAt}, nil
+	}
+	label := "cat"
+	classifier := inject.NewVisionService("classifier")
+	classifier.ClassificationsFunc = func(ctx context.Context, img *camera.NamedImage, n int, extra map[string]interface{}) (classification.Classifications, error) {
+		return classification.Classifications{classification.NewClassification(0.9, label)}, nil
+	}
+	inhibitor := inject.NewVisionService("inhibitor")
+	inhibitor.ClassificationsFunc = func(ctx context.Context, img *camera.NamedImage, n int, extra map[string]interface{}) (classification.Classifications, error) {
+		return classification.Classifications{classification.NewClassification(0.9, label)}, nil
+	}
+
+	fc := &filteredCamera{
+		conf:                     &Config{WindowSeconds: 1, ImageFrequency: 1.0},
+		logger:                   logger,
+		cam:                      cam,
+		otherVisionServices:      []vision.Service{classifier},
+		inhibitors:               []vision.Service{inhibitor},
+		acceptedClassifications:  map[string]map[string]float64{"classifier": {"person": 0.5}},
+		inhibitedClassifications: map[string]map[string]float64{"inhibitor": {"dog": 0.5}},
+		buf:                      imagebuffer.NewImageBuffer(1, 1.0, 0, 0, logger, false, 0),
+	}
+
+	_, err := fc.DoCommand(ctx, map[string]interface{}{"cmd": "last_rejected"})
+	test.That(t, err, test.ShouldNotBeNil)
+
+	_, _, err = fc.Images(ctx, nil, map[string]interface{}{data.FromDMString: true})
+	test.That(t, err, test.ShouldEqual, data.ErrNoCaptureToStore)
+	res, err := fc.DoCommand(ctx, map[string]interface{}{"cmd": "last_rejected"})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res["label"], test.ShouldEqual, "no vision services triggered")
+	test.That(t, res["source_name"], test.ShouldEqual, "color")
+	test.That(t, res["mime_type"], test.ShouldEqual, "image/png")
+	test.That(t, res["captured_at"], test.ShouldEqual, capturedAt.Format(time.RFC3339Nano))
+	imgBytes, err := base64.StdEncoding.DecodeString(res["image"].(string))
+	test.That(t, err, test.ShouldBeNil)
+	decoded, err := camera.NamedImageFromBytes(imgBytes, "color", "image/png", data.Annotations{})
+	test.That(t, err, test.ShouldBeNil)
+	bounds, err := decoded.Bounds()
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, bounds.Dx(), test.ShouldEqual, 10)
+
+	// only the latest rejection is kept, with the label that rejected it
+	label = "dog"
+	_, _, err = fc.Images(ctx, nil, map[string]interface{}{data.FromDMString: true})
+	test.That(t, err, test.ShouldEqual, data.ErrNoCaptureToStore)
+	res, err = fc.DoCommand(ctx, map[string]interface{}{"cmd": "last_rejected"})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res["label"], test.ShouldEqual, "dog")
+}
@@ -0,0 +1,45 @@
+package filtered_camera
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.viam.com/rdk/components/camera"
+	rutils "go.viam.com/rdk/utils"
+)
+
+// writeToLocalSink saves captured images to local_sink_dir, named after their timestamped source names.
+// Failures are logged rather than returned so they never interfere with data management.
+func (fc *filteredCamera) writeToLocalSink(ctx context.Context, images []camera.NamedImage) {
+	if err := os.MkdirAll(fc.conf.LocalSinkDir, 0o755); err != nil {
+		fc.logger.Errorf("failed to create local sink directory %q: %v", fc.conf.LocalSinkDir, err)
+		return
+	}
+	for _, img := range images {
+		imgBytes, err := img.Bytes(ctx)
+		if err != nil {
+			fc.logger.Errorf("failed to encode image %q for local sink: %v", img.SourceName, err)
+			continue
+		}
+		path := filepath.Join(fc.conf.LocalSinkDir, localSinkFileName(img))
+		if err := os.WriteFile(path, imgBytes, 0o644); err != nil {
+			fc.logger.Errorf("failed to write image to local sink: %v", err)
+		}
+	}
+}
+
+// localSinkFileName builds a file name from an image's timestamped source name and mime type,
+// replacing characters that aren't valid in file names on every platform.
+func localSinkFileName(img camera.NamedImage) string {
+	name := strings.NewReplacer(":", "-", "/", "-", "\\", "-").Replace(img.SourceName)
+	switch img.MimeType() {
+	case rutils.MimeTypeJPEG:
+		return name + ".jpg"
+	case rutils.MimeTypePNG:
+		return name + ".png"
+	default:
+		return name + ".bin"
+	}
+}
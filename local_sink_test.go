@@ -0,0 +1,79 @@
+package filtered_camera
+
+import (
+	"context"
+	"image"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"go.viam.com/rdk/components/camera"
+	"go.viam.com/rdk/data"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/resource"
+	"go.viam.com/rdk/services/vision"
+	"go.viam.com/rdk/testutils/inject"
+	"go.viam.com/rdk/vision/classification"
+	"go.viam.com/test"
+
+	imagebuffer "github.com/viam-modules/filtered_camera/image_buffer"
+)
+
+func TestLocalSink(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	sinkDir := filepath.Join(t.TempDir(), "captures")
+	triggerTime := time.Date(2024, 1, 15, 10, 30, 5, 0, time.UTC)
+
+	visionSvc := inject.NewVisionService("classifier")
+	visionSvc.ClassificationsFunc = func(ctx context.Context, img *camera.NamedImage, n int, extra map[string]interface{}) (classification.Classifications, error) {
+		return classification.Classifications{classification.NewClassification(0.9, "person")}, nil
+	}
+
+	fc := &filteredCamera{
+		conf:                    &Config{WindowSeconds: 10, ImageFrequency: 1.0, LocalSinkDir: sinkDir},
+		logger:                  logger,
+		otherVisionServices:     []vision.Service{visionSvc},
+		acceptedClassifications: map[string]map[string]float64{"classifier": {"person": 0.8}},
+		buf:                     imagebuffer.NewImageBuffer(10, 1.0, 0, 0, logger, true, 0),
+		cam: &inject.Camera{
+			ImagesFunc: func(ctx context.Context, filterSourceNames []string, extra map[string]interface{}) ([]camera.NamedImage, resource.ResponseMetadata, error) {
+				img, _ := camera.NamedImageFromImage(image.NewRGBA(image.Rect(0, 0, 4, 4)), "color", "image/jpeg", data.Annotations{})
+				return []camera.NamedImage{img}, resource.ResponseMetadata{CapturedAt: triggerTime}, nil
+			},
+		},
+	}
+
+	buffered, _ := camera.NamedImageFromImage(image.NewRGBA(image.Rect(0, 0, 4, 4)), "color", "image/png", data.Annotations{})
+	fc.buf.AddToRingBuffer([]camera.NamedImage{buffered}, resource.ResponseMetadata{CapturedAt: triggerTime.Add(-time.Second)})
+
+	ctx := context.Background()
+
+	// non data management calls are not written
+	_, _, err := fc.Images(ctx, nil, nil)
+	test.That(t, err, test.ShouldBeNil)
+	_, err = os.Stat(sinkDir)
+	test.That(t, os.IsNotExist(err), test.ShouldBeTrue)
+
+	imgs, _, err := fc.Images(ctx, nil, map[string]interface{}{data.FromDMString: true})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, len(imgs), test.ShouldEqual, 2)
+
+	entries, err := os.ReadDir(sinkDir)
+	test.That(t, err, test.ShouldBeNil)
+	names := []string{}
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+	test.That(t, names, test.ShouldResemble, []string{
+		"2024-01-15T10-30-04.000Z_color.png",
+		"2024-01-15T10-30-05.000Z_color.jpg",
+	})
+
+	// the images returned to data management are unchanged
+	test.That(t, strings.HasSuffix(imgs[0].SourceName, "_color"), test.ShouldBeTrue)
+	test.That(t, strings.Contains(imgs[0].SourceName, ":"), test.ShouldBeTrue)
+}
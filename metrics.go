@@ -0,0 +1,47 @@
+package filtered_camera
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// metricsPrefix prefixes the name of every metric reported by the metrics command.
+const metricsPrefix = "filtered_camera_"
+
+// labelValueEscaper escapes a Prometheus label value.
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// metrics reports the accepted and rejected stats, overall and per label, and the buffer sizes as Prometheus
+// exposition text, for scrapers that can only reach the camera through DoCommand.
+func (fc *filteredCamera) metrics() map[string]interface{} {
+	fc.statsMu.Lock()
+	accepted, acceptedByLabel := fc.acceptedStats.Total, maps.Clone(fc.acceptedStats.Breakdown)
+	rejected, rejectedByLabel := fc.rejectedStats.Total, maps.Clone(fc.rejectedStats.Breakdown)
+	fc.statsMu.Unlock()
+
+	var b strings.Builder
+	writeHeader := func(name, kind, help string) {
+		fmt.Fprintf(&b, "# HELP %s%s %s\n# TYPE %s%s %s\n", metricsPrefix, name, help, metricsPrefix, name, kind)
+	}
+	writeMetric := func(name, kind, help string, value int) {
+		writeHeader(name, kind, help)
+		fmt.Fprintf(&b, "%s%s %d\n", metricsPrefix, name, value)
+	}
+	writeBreakdown := func(name, help string, breakdown map[string]int) {
+		writeHeader(name, "counter", help)
+		for _, label := range slices.Sorted(maps.Keys(breakdown)) {
+			fmt.Fprintf(&b, "%s%s{label=\"%s\"} %d\n", metricsPrefix, name, labelValueEscaper.Replace(label), breakdown[label])
+		}
+	}
+
+	writeMetric("accepted_total", "counter", "Images accepted by the filter.", accepted)
+	writeMetric("rejected_total", "counter", "Images rejected by the filter.", rejected)
+	writeBreakdown("accepted_by_label_total", "Images accepted by the filter, by the label that accepted them.", acceptedByLabel)
+	writeBreakdown("rejected_by_label_total", "Images rejected by the filter, by the label that rejected them.", rejectedByLabel)
+	status := fc.buf.Status()
+	writeMetric("ring_buffer_size", "gauge", "Images in the ring buffer.", status.RingBufferSize)
+	writeMetric("to_send_size", "gauge", "Images waiting to be sent.", status.ToSendSize)
+	return map[string]interface{}{"prometheus": b.String()}
+}
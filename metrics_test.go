@@ -0,0 +1,56 @@
+package filtered_camera
+
+import (
+	"context"
+	"image"
+	"strings"
+	"testing"
+	"time"
+
+	"go.viam.com/rdk/components/camera"
+	"go.viam.com/rdk/data"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/resource"
+	"go.viam.com/test"
+
+	imagebuffer "github.com/viam-modules/filtered_camera/image_buffer"
+)
+
+func TestMetrics(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	fc := &filteredCamera{
+		conf:   &Config{},
+		logger: logger,
+		buf:    imagebuffer.NewImageBuffer(0, 1.0, 3, 3, logger, false, 0),
+	}
+	img, _ := camera.NamedImageFromImage(image.NewRGBA(image.Rect(0, 0, 10, 10)), "color", "image/jpeg", data.Annotations{})
+	fc.buf.AddToRingBuffer([]camera.NamedImage{img}, resource.ResponseMetadata{CapturedAt: time.Now()})
+	fc.acceptedStats.Update("person")
+	fc.acceptedStats.Update("person")
+	fc.rejectedStats.Update("no vision services triggered")
+	fc.rejectedStats.Update("vehicle.car")
+	fc.rejectedStats.Update("vehicle-car")
+	fc.rejectedStats.Update(`say "hi"`)
+
+	res, err := fc.DoCommand(context.Background(), map[string]interface{}{"cmd": "metrics"})
+	test.That(t, err, test.ShouldBeNil)
+	text, ok := res["prometheus"].(string)
+	test.That(t, ok, test.ShouldBeTrue)
+	lines := strings.Split(text, "\n")
+	for _, want := range []string{
+		"filtered_camera_accepted_total 2",
+		"filtered_camera_rejected_total 4",
+		`filtered_camera_accepted_by_label_total{label="person"} 2`,
+		`filtered_camera_rejected_by_label_total{label="no vision services triggered"} 1`,
+		`filtered_camera_rejected_by_label_total{label="vehicle.car"} 1`,
+		`filtered_camera_rejected_by_label_total{label="vehicle-car"} 1`,
+		`filtered_camera_rejected_by_label_total{label="say \"hi\""} 1`,
+		"# TYPE filtered_camera_rejected_by_label_total counter",
+		"filtered_camera_ring_buffer_size 1",
+		"filtered_camera_to_send_size 0",
+		"# TYPE filtered_camera_ring_buffer_size gauge",
+		"# TYPE filtered_camera_accepted_total counter",
+	} {
+		test.That(t, lines, test.ShouldContain, want)
+	}
+}
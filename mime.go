@@ -0,0 +1,86 @@
+package filtered_camera
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"go.viam.com/rdk/components/camera"
+	"go.viam.com/rdk/rimage"
+	rutils "go.viam.com/rdk/utils"
+)
+
+// MimeTypeExtraKey is the extra key a client sets to ask for images in a particular mime type
+const MimeTypeExtraKey = "mime_type"
+
+// transcodableMimeTypes are the mime types any decodable image can be re-encoded to
+var transcodableMimeTypes = []string{rutils.MimeTypeJPEG, rutils.MimeTypePNG, rutils.MimeTypeQOI, rutils.MimeTypeRawRGBA}
+
+// RequestedMimeType returns the mime type asked for in extra, without any lazy suffix, or "" if none was.
+func RequestedMimeType(extra map[string]interface{}) string {
+	if extra == nil {
+		return ""
+	}
+	mimeType, _ := extra[MimeTypeExtraKey].(string)
+	mimeType, _ = rutils.CheckLazyMIMEType(mimeType)
+	return mimeType
+}
+
+// CanTranscode returns true if any decodable image can be re-encoded to mimeType.
+func CanTranscode(mimeType string) bool {
+	return slices.Contains(transcodableMimeTypes, mimeType)
+}
+
+// Transcode returns img re-encoded to mimeType with rimage.EncodeImage, or img itself if it is in mimeType already.
+func Transcode(ctx context.Context, img camera.NamedImage, mimeType string) (camera.NamedImage, error) {
+	current, _ := rutils.CheckLazyMIMEType(img.MimeType())
+	if current == mimeType {
+		return img, nil
+	}
+	if !CanTranscode(mimeType) {
+		return camera.NamedImage{}, fmt.Errorf("image %q is %q and cannot be transcoded to %q", img.SourceName, current, mimeType)
+	}
+	decoded, err := img.Image(ctx)
+	if err != nil {
+		return camera.NamedImage{}, fmt.Errorf("could not decode image %q to transcode it to %q: %w", img.SourceName, mimeType, err)
+	}
+	encoded, err := rimage.EncodeImage(ctx, decoded, mimeType)
+	if err != nil {
+		return camera.NamedImage{}, fmt.Errorf("could not encode image %q as %q: %w", img.SourceName, mimeType, err)
+	}
+	return camera.NamedImageFromBytes(encoded, img.SourceName, mimeType, img.Annotations)
+}
+
+// checkMimeType returns an error if mimeType can neither be produced by the underlying camera nor transcoded to.
+// It is checked before any images are taken from the buffer, so that an unservable request doesn't consume them.
+func (fc *filteredCamera) checkMimeType(ctx context.Context, mimeType string) error {
+	if mimeType == "" || CanTranscode(mimeType) {
+		return nil
+	}
+	props, err := fc.cam.Properties(ctx)
+	if err != nil {
+		return fmt.Errorf("could not get properties of camera %q: %w", fc.cam.Name().ShortName(), err)
+	}
+	if !slices.Contains(props.MimeTypes, mimeType) {
+		return fmt.Errorf("mime type %q is not supported by camera %q and cannot be transcoded, supported types are %v",
+			mimeType, fc.cam.Name().ShortName(), append(slices.Clone(transcodableMimeTypes), props.MimeTypes...))
+	}
+	return nil
+}
+
+// transcodeImages returns images re-encoded to mimeType where they aren't in it already. Images the underlying
+// camera returned in mimeType are passed through untouched.
+func transcodeImages(ctx context.Context, images []camera.NamedImage, mimeType string) ([]camera.NamedImage, error) {
+	if mimeType == "" {
+		return images, nil
+	}
+	transcoded := make([]camera.NamedImage, 0, len(images))
+	for _, img := range images {
+		converted, err := Transcode(ctx, img, mimeType)
+		if err != nil {
+			return nil, err
+		}
+		transcoded = append(transcoded, converted)
+	}
+	return transcoded, nil
+}
@@ -0,0 +1,72 @@
+package filtered_camera
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"testing"
+	"time"
+
+	"go.viam.com/rdk/components/camera"
+	"go.viam.com/rdk/data"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/resource"
+	"go.viam.com/rdk/testutils/inject"
+	rutils "go.viam.com/rdk/utils"
+	"go.viam.com/test"
+
+	imagebuffer "github.com/viam-modules/filtered_camera/image_buffer"
+)
+
+func TestMimeTypeNegotiation(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	ctx := context.Background()
+
+	imagesCam := inject.NewCamera("test_camera")
+	imagesCam.ImagesFunc = func(ctx context.Context, filterSourceNames []string, extra map[string]interface{}) (
+		[]camera.NamedImage, resource.ResponseMetadata, error) {
+		img, _ := camera.NamedImageFromImage(image.NewRGBA(image.Rect(0, 0, 10, 10)), "color", rutils.MimeTypeJPEG, data.Annotations{})
+		return []camera.NamedImage{img}, resource.ResponseMetadata{CapturedAt: time.Now()}, nil
+	}
+	imagesCam.PropertiesFunc = func(ctx context.Context) (camera.Properties, error) {
+		return camera.Properties{MimeTypes: []string{rutils.MimeTypeJPEG, rutils.MimeTypeH264}}, nil
+	}
+	fc := &filteredCamera{
+		conf:   &Config{WindowSeconds: 10, ImageFrequency: 1.0},
+		logger: logger,
+		cam:    imagesCam,
+		buf:    imagebuffer.NewImageBuffer(10, 1.0, 0, 0, logger, false, 0),
+	}
+
+	// the camera's own type is passed through
+	images, _, err := fc.Images(ctx, nil, map[string]interface{}{MimeTypeExtraKey: rutils.MimeTypeJPEG})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, images[0].MimeType(), test.ShouldEqual, rutils.MimeTypeJPEG)
+
+	// other image types are transcoded
+	images, _, err = fc.Images(ctx, nil, map[string]interface{}{MimeTypeExtraKey: rutils.WithLazyMIMEType(rutils.MimeTypePNG)})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, images[0].MimeType(), test.ShouldEqual, rutils.MimeTypePNG)
+	test.That(t, images[0].SourceName, test.ShouldEqual, "color")
+	raw, err := images[0].Bytes(ctx)
+	test.That(t, err, test.ShouldBeNil)
+	decoded, err := png.Decode(bytes.NewReader(raw))
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, decoded.Bounds().Dx(), test.ShouldEqual, 10)
+
+	// the camera claims h264, but these frames can't be transcoded to it
+	_, _, err = fc.Images(ctx, nil, map[string]interface{}{MimeTypeExtraKey: rutils.MimeTypeH264})
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, err.Error(), test.ShouldContainSubstring, "cannot be transcoded")
+
+	// neither the camera nor transcoding can produce mp4, so the buffer is left alone
+	fc.captureImageInBackground(ctx)
+	fc.buf.MarkShouldSend(time.Now())
+	queued := fc.buf.GetToSendLength()
+	test.That(t, queued, test.ShouldBeGreaterThan, 0)
+	_, _, err = fc.Images(ctx, nil, map[string]interface{}{data.FromDMString: true, MimeTypeExtraKey: rutils.MimeTypeVideoMP4})
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, err.Error(), test.ShouldContainSubstring, "not supported by camera")
+	test.That(t, fc.buf.GetToSendLength(), test.ShouldEqual, queued)
+}
@@ -0,0 +1,76 @@
+package filtered_camera
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"go.viam.com/rdk/components/camera"
+)
+
+// extraCameraImages reads the cameras listed in cameras, alongside the main camera, and adds their images to images
+// so that one capture holds a frame from each camera. The cameras are read in parallel to keep their frames close
+// together, and the capture time stays the main camera's. An image whose source name is already taken is renamed
+// "<camera>/<source>". A camera that fails to return images is left out of this capture.
+func (fc *filteredCamera) extraCameraImages(
+	ctx context.Context, extraCams []camera.Camera, images []camera.NamedImage,
+	filterSourceNames []string, extra map[string]interface{},
+) []camera.NamedImage {
+	results := make([][]camera.NamedImage, len(extraCams))
+	var wg sync.WaitGroup
+	for i, cam := range extraCams {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			imgs, _, err := cam.Images(ctx, nil, extra)
+			if err != nil {
+				fc.logger.Debugf("error getting images from camera %q: %v", cam.Name().ShortName(), err)
+				return
+			}
+			results[i] = imgs
+		}()
+	}
+	wg.Wait()
+
+	merged := slices.Clone(images)
+	taken := make(map[string]bool, len(images))
+	for _, img := range images {
+		taken[img.SourceName] = true
+	}
+	for i, imgs := range results {
+		for _, img := range imgs {
+			if img.SourceName == "" || taken[img.SourceName] {
+				img.SourceName = extraCams[i].Name().ShortName() + "/" + img.SourceName
+			}
+			if len(filterSourceNames) > 0 && !slices.Contains(filterSourceNames, img.SourceName) {
+				continue
+			}
+			taken[img.SourceName] = true
+			merged = append(merged, img)
+		}
+	}
+	return merged
+}
+
+// isVisionSource reports whether images from source are run through vision, which is all of them unless
+// vision_sources is set.
+func (fc *filteredCamera) isVisionSource(source string) bool {
+	return len(fc.conf.VisionSources) == 0 || slices.Contains(fc.conf.VisionSources, source)
+}
+
+// visionIndexes returns the indexes of the images of a frame that are run through vision, those from vision_sources.
+// When vision_sources names a single source, as for the color image of a camera that also returns depth, a frame
+// without an image from it runs vision on its first image instead.
+func (fc *filteredCamera) visionIndexes(images []camera.NamedImage) []int {
+	var res []int
+	for i, img := range images {
+		if fc.isVisionSource(img.SourceName) {
+			res = append(res, i)
+		}
+	}
+	if len(res) == 0 && len(fc.conf.VisionSources) == 1 && len(images) > 0 {
+		fc.logger.Debugf("no image from vision source %q in the frame, running vision on the first", fc.conf.VisionSources[0])
+		return []int{0}
+	}
+	return res
+}
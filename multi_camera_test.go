@@ -0,0 +1,147 @@
+package filtered_camera
+
+import (
+	"context"
+	"image"
+	"strings"
+	"testing"
+	"time"
+
+	"go.viam.com/rdk/components/camera"
+	"go.viam.com/rdk/data"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/resource"
+	"go.viam.com/rdk/services/vision"
+	"go.viam.com/rdk/testutils/inject"
+	"go.viam.com/rdk/vision/classification"
+	"go.viam.com/test"
+
+	imagebuffer "github.com/viam-modules/filtered_camera/image_buffer"
+)
+
+func TestMultipleCameras(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	ctx := context.Background()
+	capturedAt := time.Now()
+
+	newCamera := func(name string) *inject.Camera {
+		cam := inject.NewCamera(name)
+		cam.ImagesFunc = func(ctx context.Context, filterSourceNames []string, extra map[string]interface{}) (
+			[]camera.NamedImage, resource.ResponseMetadata, error) {
+			img, _ := camera.NamedImageFromImage(image.NewRGBA(image.Rect(0, 0, 10, 10)), "color", "image/jpeg", data.Annotations{})
+			return []camera.NamedImage{img}, resource.ResponseMetadata{CapturedAt: capturedAt}, nil
+		}
+		return cam
+	}
+
+	visionCalls := 0
+	detector := inject.NewVisionService("detector")
+	detector.ClassificationsFunc = func(ctx context.Context, img *camera.NamedImage, n int, extra map[string]interface{}) (classification.Classifications, error) {
+		visionCalls++
+		return classification.Classifications{classification.NewClassification(0.9, "person")}, nil
+	}
+
+	fc := &filteredCamera{
+		conf: &Config{
+			WindowSecondsBefore: 1,
+			WindowSecondsAfter:  1,
+			ImageFrequency:      1.0,
+			VisionSources:       []string{"color"},
+		},
+		logger:                  logger,
+		cam:                     newCamera("left"),
+		extraCams:               []camera.Camera{newCamera("right")},
+		otherVisionServices:     []vision.Service{detector},
+		acceptedClassifications: map[string]map[string]float64{"detector": {"person": 0.5}},
+		buf:                     imagebuffer.NewImageBuffer(0, 1.0, 1, 1, logger, false, 0),
+	}
+
+	// both cameras are read, the clashing source name of the second is qualified with its camera
+	imgs, _, err := fc.Images(ctx, nil, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, len(imgs), test.ShouldEqual, 2)
+	test.That(t, imgs[0].SourceName, test.ShouldEqual, "color")
+	test.That(t, imgs[1].SourceName, test.ShouldEqual, "right/color")
+	imgs, _, err = fc.Images(ctx, []string{"right/color"}, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, imgs[len(imgs)-1].SourceName, test.ShouldEqual, "right/color")
+
+	// only the vision source is run through vision, but a trigger captures the images of both cameras
+	imgs, _, err = fc.Images(ctx, nil, map[string]interface{}{data.FromDMString: true})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, visionCalls, test.ShouldEqual, 1)
+	test.That(t, len(imgs), test.ShouldEqual, 2)
+	test.That(t, strings.HasSuffix(imgs[0].SourceName, "_color"), test.ShouldBeTrue)
+	test.That(t, strings.HasSuffix(imgs[1].SourceName, "_right/color"), test.ShouldBeTrue)
+	test.That(t, len(imgs[0].Annotations.Classifications), test.ShouldEqual, 1)
+	test.That(t, imgs[1].Annotations.Classifications, test.ShouldBeEmpty)
+}
+
+func TestMultipleCamerasValidation(t *testing.T) {
+	cfg := &Config{
+		Camera:         "left",
+		Cameras:        []string{"right"},
+		VisionServices: []VisionServiceConfig{{Vision: "vs"}},
+		WindowSeconds:  10,
+	}
+	deps, _, err := cfg.Validate("path")
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, deps, test.ShouldResemble, []string{"left", "right", "vs"})
+
+	cfg.Cameras = []string{"right", "left"}
+	_, _, err = cfg.Validate("path")
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, err.Error(), test.ShouldContainSubstring, "path.cameras.1")
+}
+
+func TestVisionSource(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	ctx := context.Background()
+	sources := []string{"color", "depth"}
+	cam := inject.NewCamera("rgbd")
+	cam.ImagesFunc = func(ctx context.Context, filterSourceNames []string, extra map[string]interface{}) (
+		[]camera.NamedImage, resource.ResponseMetadata, error) {
+		imgs := []camera.NamedImage{}
+		for _, source := range sources {
+			img, _ := camera.NamedImageFromImage(image.NewRGBA(image.Rect(0, 0, 10, 10)), source, "image/jpeg", data.Annotations{})
+			imgs = append(imgs, img)
+		}
+		return imgs, resource.ResponseMetadata{CapturedAt: time.Now()}, nil
+	}
+
+	var seen []string
+	detector := inject.NewVisionService("detector")
+	detector.ClassificationsFunc = func(ctx context.Context, img *camera.NamedImage, n int, extra map[string]interface{}) (classification.Classifications, error) {
+		seen = append(seen, img.SourceName)
+		return classification.Classifications{}, nil
+	}
+
+	fc := &filteredCamera{
+		conf:                    &Config{WindowSeconds: 1, ImageFrequency: 1.0, VisionSources: []string{"depth"}},
+		logger:                  logger,
+		cam:                     cam,
+		otherVisionServices:     []vision.Service{detector},
+		acceptedClassifications: map[string]map[string]float64{"detector": {"person": 0.5}},
+		buf:                     imagebuffer.NewImageBuffer(1, 1.0, 0, 0, logger, false, 0),
+	}
+
+	// only the vision source is run through vision, while every source is still returned
+	imgs, _, err := fc.Images(ctx, nil, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, len(imgs), test.ShouldEqual, 2)
+	_, _, err = fc.Images(ctx, nil, map[string]interface{}{data.FromDMString: true})
+	test.That(t, err, test.ShouldEqual, data.ErrNoCaptureToStore)
+	test.That(t, seen, test.ShouldResemble, []string{"depth"})
+
+	// frames without the vision source fall back to their first image
+	sources = []string{"color", "ir"}
+	_, _, err = fc.Images(ctx, nil, map[string]interface{}{data.FromDMString: true})
+	test.That(t, err, test.ShouldEqual, data.ErrNoCaptureToStore)
+	test.That(t, seen, test.ShouldResemble, []string{"depth", "color"})
+
+	// with several vision sources there is no fallback, frames without any of them aren't run through vision
+	fc.conf.VisionSources = []string{"depth", "thermal"}
+	_, _, err = fc.Images(ctx, nil, map[string]interface{}{data.FromDMString: true})
+	test.That(t, err, test.ShouldEqual, data.ErrNoCaptureToStore)
+	test.That(t, seen, test.ShouldResemble, []string{"depth", "color"})
+}
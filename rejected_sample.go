@@ -0,0 +1,43 @@
+package filtered_camera
+
+import (
+	"math/rand/v2"
+
+	"go.viam.com/rdk/components/camera"
+	"go.viam.com/rdk/data"
+	"go.viam.com/rdk/resource"
+
+	imagebuffer "github.com/viam-modules/filtered_camera/image_buffer"
+)
+
+const (
+	// rejectedSampleSuffix is appended to the source name of rejected frames retained by sample_rejected_rate,
+	// so they can be told apart from triggered captures
+	rejectedSampleSuffix = "_rejected_sample"
+	// rejectedSampleLabel is the classification added to rejected frames retained by sample_rejected_rate
+	rejectedSampleLabel = "rejected_sample"
+)
+
+// sampleRejected decides whether the frames rejected by the filter are retained for review, returning them
+// timestamped, renamed with rejectedSampleSuffix and annotated with rejectedSampleLabel if so.
+func (fc *filteredCamera) sampleRejected(rejected []camera.NamedImage, meta resource.ResponseMetadata) ([]camera.NamedImage, bool) {
+	if fc.conf.SampleRejectedRate <= 0 || len(rejected) == 0 {
+		return nil, false
+	}
+	sample := rand.Float64
+	if fc.rejectedSampler != nil {
+		sample = fc.rejectedSampler
+	}
+	if sample() >= fc.conf.SampleRejectedRate {
+		return nil, false
+	}
+
+	images := imagebuffer.TimestampImagesToNames(rejected, meta)
+	for i := range images {
+		images[i].SourceName += rejectedSampleSuffix
+		classifications := make([]data.Classification, 0, len(images[i].Annotations.Classifications)+1)
+		classifications = append(classifications, images[i].Annotations.Classifications...)
+		images[i].Annotations.Classifications = append(classifications, data.Classification{Label: rejectedSampleLabel})
+	}
+	return images, true
+}
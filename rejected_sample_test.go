@@ -0,0 +1,71 @@
+package filtered_camera
+
+import (
+	"context"
+	"image"
+	"math/rand/v2"
+	"strings"
+	"testing"
+	"time"
+
+	"go.viam.com/rdk/components/camera"
+	"go.viam.com/rdk/data"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/resource"
+	"go.viam.com/rdk/services/vision"
+	"go.viam.com/rdk/testutils/inject"
+	"go.viam.com/rdk/vision/classification"
+	"go.viam.com/test"
+
+	imagebuffer "github.com/viam-modules/filtered_camera/image_buffer"
+)
+
+func TestSampleRejected(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	ctx := context.Background()
+	extra := map[string]interface{}{data.FromDMString: true}
+
+	imagesCam := inject.NewCamera("test_camera")
+	imagesCam.ImagesFunc = func(ctx context.Context, filterSourceNames []string, extra map[string]interface{}) (
+		[]camera.NamedImage, resource.ResponseMetadata, error) {
+		img, _ := camera.NamedImageFromImage(image.NewRGBA(image.Rect(0, 0, 10, 10)), "color", "image/jpeg", data.Annotations{})
+		return []camera.NamedImage{img}, resource.ResponseMetadata{CapturedAt: time.Now()}, nil
+	}
+	visionSvc := inject.NewVisionService("classifier")
+	visionSvc.ClassificationsFunc = func(ctx context.Context, img *camera.NamedImage, n int, extra map[string]interface{}) (classification.Classifications, error) {
+		return classification.Classifications{classification.NewClassification(0.1, "person")}, nil
+	}
+
+	for _, rate := range []float64{0, 0.2, 1} {
+		fc := &filteredCamera{
+			conf:                    &Config{WindowSeconds: 1, ImageFrequency: 1.0, SampleRejectedRate: rate},
+			logger:                  logger,
+			cam:                     imagesCam,
+			otherVisionServices:     []vision.Service{visionSvc},
+			acceptedClassifications: map[string]map[string]float64{"classifier": {"person": 0.8}},
+			buf:                     imagebuffer.NewImageBuffer(1, 1.0, 0, 0, logger, false, 0),
+			rejectedSampler:         rand.New(rand.NewPCG(1, 2)).Float64,
+		}
+
+		const attempts = 1000
+		retained := 0
+		for i := 0; i < attempts; i++ {
+			images, _, err := fc.Images(ctx, nil, extra)
+			if err != nil {
+				test.That(t, err, test.ShouldEqual, data.ErrNoCaptureToStore)
+				continue
+			}
+			retained++
+			test.That(t, len(images), test.ShouldEqual, 1)
+			test.That(t, strings.HasSuffix(images[0].SourceName, "_color"+rejectedSampleSuffix), test.ShouldBeTrue)
+			labels := []string{}
+			for _, c := range images[0].Annotations.Classifications {
+				labels = append(labels, c.Label)
+			}
+			test.That(t, labels, test.ShouldContain, rejectedSampleLabel)
+		}
+		// every image is still counted as rejected
+		test.That(t, fc.rejectedStats.Total, test.ShouldEqual, attempts)
+		test.That(t, float64(retained)/attempts, test.ShouldAlmostEqual, rate, 0.05)
+	}
+}
@@ -0,0 +1,95 @@
+package filtered_camera
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+
+	"go.viam.com/rdk/components/camera"
+	"go.viam.com/rdk/utils"
+	"golang.org/x/image/draw"
+)
+
+// ROI is a rectangular region of interest in a frame, in pixels from its top left corner.
+type ROI struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+	W int `json:"w"`
+	H int `json:"h"`
+}
+
+// Validate ensures the region is a non-empty rectangle inside the positive quadrant.
+func (roi *ROI) Validate(path string) error {
+	if roi.X < 0 || roi.Y < 0 {
+		return utils.NewConfigValidationError(path, errors.New("x and y cannot be negative"))
+	}
+	if roi.W <= 0 || roi.H <= 0 {
+		return utils.NewConfigValidationError(path, errors.New("w and h must be positive"))
+	}
+	return nil
+}
+
+// rect returns the region as an image.Rectangle.
+func (roi *ROI) rect() image.Rectangle {
+	return image.Rect(roi.X, roi.Y, roi.X+roi.W, roi.Y+roi.H)
+}
+
+// visionFrame is a frame prepared for the vision services: the full resolution frame that rois are cropped from, and
+// the image passed to the services without a roi, made from it once by visionImage.
+type visionFrame struct {
+	full   camera.NamedImage
+	scaled camera.NamedImage
+}
+
+// newVisionFrame prepares namedImg for the vision services.
+func (fc *filteredCamera) newVisionFrame(ctx context.Context, namedImg camera.NamedImage) (*visionFrame, error) {
+	scaled, err := fc.visionImage(ctx, namedImg)
+	if err != nil {
+		return nil, err
+	}
+	return &visionFrame{full: namedImg, scaled: scaled}, nil
+}
+
+// serviceImage returns the image to pass to visionService for frame. The roi of the service, if any, is cropped from
+// the full resolution frame before visionImage downscales it, so that it is always in the camera's pixels.
+func (fc *filteredCamera) serviceImage(ctx context.Context, visionService string, frame *visionFrame) (*camera.NamedImage, error) {
+	if fc.serviceConfigs[visionService].ROI == nil {
+		return &frame.scaled, nil
+	}
+	cropped, err := fc.roiImage(ctx, visionService, &frame.full)
+	if err != nil {
+		return nil, err
+	}
+	img, err := fc.visionImage(ctx, *cropped)
+	if err != nil {
+		return nil, err
+	}
+	return &img, nil
+}
+
+// roiImage returns img cropped to the roi of visionService, clipped to the frame, or img itself if the service has
+// none. The cropped image starts at 0,0, so detections made on it are relative to the region rather than the frame.
+func (fc *filteredCamera) roiImage(ctx context.Context, visionService string, img *camera.NamedImage) (*camera.NamedImage, error) {
+	roi := fc.serviceConfigs[visionService].ROI
+	if roi == nil {
+		return img, nil
+	}
+	decoded, err := img.Image(ctx)
+	if err != nil {
+		return nil, err
+	}
+	bounds := decoded.Bounds()
+	region := roi.rect().Add(bounds.Min).Intersect(bounds)
+	if region.Empty() {
+		return nil, fmt.Errorf("roi of %q is outside the %dx%d frame %q", visionService, bounds.Dx(), bounds.Dy(), img.SourceName)
+	}
+
+	cropped := image.NewRGBA(image.Rect(0, 0, region.Dx(), region.Dy()))
+	draw.Draw(cropped, cropped.Bounds(), decoded, region.Min, draw.Src)
+	res, err := camera.NamedImageFromImage(cropped, img.SourceName, img.MimeType(), img.Annotations)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
@@ -0,0 +1,88 @@
+package filtered_camera
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"testing"
+	"time"
+
+	"go.viam.com/rdk/components/camera"
+	"go.viam.com/rdk/data"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/services/vision"
+	"go.viam.com/rdk/testutils/inject"
+	rutils "go.viam.com/rdk/utils"
+	"go.viam.com/rdk/vision/classification"
+	"go.viam.com/test"
+)
+
+func TestROI(t *testing.T) {
+	ctx := context.Background()
+	conf, err := configFromAttributes(rutils.AttributeMap{
+		"camera":         "cam",
+		"window_seconds": 10,
+		"vision_services": []interface{}{map[string]interface{}{
+			"vision":          "classifier",
+			"classifications": map[string]interface{}{"person": 0.5},
+			"roi":             map[string]interface{}{"x": 2, "y": 3, "w": 4, "h": 5},
+		}},
+	})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, conf.VisionServices[0].ROI, test.ShouldResemble, &ROI{X: 2, Y: 3, W: 4, H: 5})
+	_, _, err = conf.Validate("camera")
+	test.That(t, err, test.ShouldBeNil)
+
+	src := image.NewRGBA(image.Rect(0, 0, 10, 10))
+	src.Set(2, 3, color.RGBA{R: 255, A: 255})
+	frame, err := camera.NamedImageFromImage(src, "color", "image/png", data.Annotations{})
+	test.That(t, err, test.ShouldBeNil)
+
+	var seen image.Image
+	classifier := inject.NewVisionService("classifier")
+	classifier.ClassificationsFunc = func(ctx context.Context, img *camera.NamedImage, n int, extra map[string]interface{}) (classification.Classifications, error) {
+		decoded, err := img.Image(ctx)
+		test.That(t, err, test.ShouldBeNil)
+		seen = decoded
+		return classification.Classifications{classification.NewClassification(0.9, "person")}, nil
+	}
+	fc := &filteredCamera{
+		conf:                    &Config{},
+		logger:                  logging.NewTestLogger(t),
+		otherVisionServices:     []vision.Service{classifier},
+		acceptedClassifications: map[string]map[string]float64{"classifier": {"person": 0.5}},
+		serviceConfigs:          map[string]VisionServiceConfig{"classifier": conf.VisionServices[0]},
+	}
+
+	// the vision service only sees the region, while the frame itself is left whole
+	send, _, err := fc.shouldSend(ctx, frame, time.Now())
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, send, test.ShouldBeTrue)
+	test.That(t, seen.Bounds(), test.ShouldResemble, image.Rect(0, 0, 4, 5))
+	test.That(t, seen.At(0, 0), test.ShouldResemble, color.RGBA{R: 255, A: 255})
+	bounds, err := frame.Bounds()
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, bounds.Dx(), test.ShouldEqual, 10)
+
+	// a region running off the frame is clipped to it, and one entirely outside fails
+	fc.serviceConfigs["classifier"] = VisionServiceConfig{Vision: "classifier", ROI: &ROI{X: 8, Y: 8, W: 5, H: 5}}
+	_, _, err = fc.shouldSend(ctx, frame, time.Now())
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, seen.Bounds(), test.ShouldResemble, image.Rect(0, 0, 2, 2))
+	fc.serviceConfigs["classifier"] = VisionServiceConfig{Vision: "classifier", ROI: &ROI{X: 20, Y: 20, W: 5, H: 5}}
+	_, _, err = fc.shouldSend(ctx, frame, time.Now())
+	test.That(t, err, test.ShouldNotBeNil)
+
+	// the region is cropped from the full resolution frame before vision_max_pixels downscales it
+	fc.conf.VisionMaxPixels = 25
+	fc.serviceConfigs["classifier"] = conf.VisionServices[0]
+	_, _, err = fc.shouldSend(ctx, frame, time.Now())
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, seen.Bounds(), test.ShouldResemble, image.Rect(0, 0, 4, 5))
+	test.That(t, seen.At(0, 0), test.ShouldResemble, color.RGBA{R: 255, A: 255})
+
+	conf.VisionServices[0].ROI = &ROI{X: 2, Y: 3, W: 0, H: 5}
+	_, _, err = conf.Validate("camera")
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, err.Error(), test.ShouldContainSubstring, "camera.vision_services.0.roi")
+}
@@ -0,0 +1,55 @@
+package filtered_camera
+
+import (
+	"context"
+	"slices"
+
+	"go.viam.com/rdk/services/vision"
+)
+
+// inhibitorResult is the outcome of running an inhibitor on a frame: whether it inhibited, and on which label.
+type inhibitorResult struct {
+	inhibited bool
+	label     string
+}
+
+// globalInhibitors returns the inhibitors that veto the whole frame, i.e. those without inhibits.
+func (fc *filteredCamera) globalInhibitors() []vision.Service {
+	if len(fc.inhibitorScopes) == 0 {
+		return fc.inhibitors
+	}
+	global := []vision.Service{}
+	for _, vs := range fc.inhibitors {
+		if _, scoped := fc.inhibitorScopes[vs.Name().Name]; !scoped {
+			global = append(global, vs)
+		}
+	}
+	return global
+}
+
+// vetoedFor runs the scoped inhibitors whose inhibits list names the accepting vision service over frame, and returns
+// the label of the first that inhibits. Results are kept in results, so each inhibitor runs at most once per frame
+// however many of the services it vetoes are checked.
+func (fc *filteredCamera) vetoedFor(
+	ctx context.Context, service string, frame *visionFrame, results map[string]inhibitorResult,
+) (string, bool, error) {
+	for _, vs := range fc.inhibitors {
+		name := vs.Name().Name
+		if !slices.Contains(fc.inhibitorScopes[name], service) {
+			continue
+		}
+		res, ok := results[name]
+		if !ok {
+			inhibited, label, err := fc.inhibitedBy(ctx, vs, frame)
+			if err != nil {
+				return "", false, err
+			}
+			res = inhibitorResult{inhibited: inhibited, label: label}
+			results[name] = res
+		}
+		if res.inhibited {
+			return res.label, true, nil
+		}
+	}
+	return "", false, nil
+}
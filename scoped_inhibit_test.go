@@ -0,0 +1,108 @@
+package filtered_camera
+
+import (
+	"context"
+	"image"
+	"testing"
+	"time"
+
+	"go.viam.com/rdk/components/camera"
+	"go.viam.com/rdk/data"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/services/vision"
+	"go.viam.com/rdk/testutils/inject"
+	"go.viam.com/rdk/vision/classification"
+	"go.viam.com/test"
+)
+
+func TestScopedInhibitors(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	ctx := context.Background()
+
+	classifier := func(name string, label *string) *inject.VisionService {
+		vs := inject.NewVisionService(name)
+		vs.ClassificationsFunc = func(ctx context.Context, img *camera.NamedImage, n int, extra map[string]interface{}) (classification.Classifications, error) {
+			if *label == "" {
+				return classification.Classifications{}, nil
+			}
+			return classification.Classifications{classification.NewClassification(0.9, *label)}, nil
+		}
+		return vs
+	}
+	xLabel, yLabel, aLabel, bLabel := "person", "", "", ""
+	aCalls := 0
+	x := classifier("x", &xLabel)
+	y := classifier("y", &yLabel)
+	a := classifier("a", &aLabel)
+	aClassifications := a.ClassificationsFunc
+	a.ClassificationsFunc = func(ctx context.Context, img *camera.NamedImage, n int, extra map[string]interface{}) (classification.Classifications, error) {
+		aCalls++
+		return aClassifications(ctx, img, n, extra)
+	}
+	b := classifier("b", &bLabel)
+
+	fc := &filteredCamera{
+		conf:                &Config{},
+		logger:              logger,
+		inhibitors:          []vision.Service{a, b},
+		otherVisionServices: []vision.Service{x, y},
+		inhibitedClassifications: map[string]map[string]float64{
+			"a": {"staff": 0.5},
+			"b": {"authorized": 0.5},
+		},
+		acceptedClassifications: map[string]map[string]float64{
+			"x": {"person": 0.5},
+			"y": {"vehicle": 0.5},
+		},
+		inhibitorScopes: map[string][]string{"a": {"x"}},
+	}
+	img, err := camera.NamedImageFromImage(image.NewRGBA(image.Rect(0, 0, 10, 10)), "color", "image/jpeg", data.Annotations{})
+	test.That(t, err, test.ShouldBeNil)
+
+	// nothing inhibits, x accepts
+	send, _, err := fc.shouldSend(ctx, img, time.Now())
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, send, test.ShouldBeTrue)
+
+	// a vetoes x only, so the frame is rejected unless y accepts it
+	aLabel = "staff"
+	send, _, err = fc.shouldSend(ctx, img, time.Now())
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, send, test.ShouldBeFalse)
+	test.That(t, fc.rejectedStats.Breakdown["staff"], test.ShouldEqual, 1)
+
+	yLabel = "vehicle"
+	send, _, err = fc.shouldSend(ctx, img, time.Now())
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, send, test.ShouldBeTrue)
+	test.That(t, aCalls, test.ShouldEqual, 3)
+
+	// b has no inhibits and still vetoes every service
+	bLabel = "authorized"
+	send, _, err = fc.shouldSend(ctx, img, time.Now())
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, send, test.ShouldBeFalse)
+	test.That(t, fc.rejectedStats.Breakdown["authorized"], test.ShouldEqual, 1)
+	test.That(t, aCalls, test.ShouldEqual, 3)
+}
+
+func TestScopedInhibitorsValidation(t *testing.T) {
+	cfg := &Config{
+		Camera: "cam",
+		VisionServices: []VisionServiceConfig{
+			{Vision: "x"},
+			{Vision: "a", Inhibit: true, Inhibits: []string{"y"}},
+		},
+	}
+	_, _, err := cfg.Validate("path")
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, err.Error(), test.ShouldContainSubstring, "inhibits")
+
+	cfg.VisionServices[1].Inhibits = []string{"x"}
+	_, _, err = cfg.Validate("path")
+	test.That(t, err, test.ShouldBeNil)
+
+	cfg.VisionServices[0].Inhibits = []string{"x"}
+	_, _, err = cfg.Validate("path")
+	test.That(t, err, test.ShouldNotBeNil)
+}
@@ -0,0 +1,26 @@
+package filtered_camera
+
+import (
+	"context"
+	"image"
+
+	"go.viam.com/rdk/components/camera"
+	"go.viam.com/rdk/gostream"
+)
+
+// Stream serves live frames of the underlying camera, unfiltered, for viewers that stream rather than call Images.
+// It delegates to the underlying camera's own stream if it has one, and otherwise reads frames from its Images.
+// Neither takes the lock held while filtering, so a live feed isn't slowed down by the vision services.
+func (fc *filteredCamera) Stream(ctx context.Context, errHandlers ...gostream.ErrorHandler) (gostream.VideoStream, error) {
+	fc.sendMu.Lock()
+	cam := fc.cam
+	fc.sendMu.Unlock()
+
+	if src, ok := cam.(camera.VideoSource); ok {
+		return src.Stream(ctx, errHandlers...)
+	}
+	return gostream.NewEmbeddedVideoStreamFromReader(gostream.VideoReaderFunc(func(ctx context.Context) (image.Image, func(), error) {
+		img, err := camera.DecodeImageFromCamera(ctx, cam, nil, nil)
+		return img, func() {}, err
+	})), nil
+}
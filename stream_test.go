@@ -0,0 +1,84 @@
+package filtered_camera
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"testing"
+	"time"
+
+	"go.viam.com/rdk/components/camera"
+	"go.viam.com/rdk/data"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/resource"
+	"go.viam.com/rdk/services/vision"
+	"go.viam.com/rdk/testutils/inject"
+	"go.viam.com/rdk/vision/classification"
+	"go.viam.com/test"
+
+	imagebuffer "github.com/viam-modules/filtered_camera/image_buffer"
+)
+
+func TestLivePassthrough(t *testing.T) {
+	logger := logging.NewTestLogger(t)
+	ctx := context.Background()
+	capturedAt := time.Now()
+
+	frame := image.NewRGBA(image.Rect(0, 0, 8, 6))
+	frame.Set(1, 1, color.RGBA{R: 255, A: 255})
+	annotations := data.Annotations{Classifications: []data.Classification{{Label: "from_camera"}}}
+	cam := inject.NewCamera("cam")
+	cam.ImagesFunc = func(ctx context.Context, filterSourceNames []string, extra map[string]interface{}) ([]camera.NamedImage, resource.ResponseMetadata, error) {
+		img, _ := camera.NamedImageFromImage(frame, "color", "image/png", annotations)
+		return []camera.NamedImage{img}, resource.ResponseMetadata{CapturedAt: capturedAt}, nil
+	}
+	visionCalls := 0
+	visionSvc := inject.NewVisionService("classifier")
+	visionSvc.ClassificationsFunc = func(ctx context.Context, img *camera.NamedImage, n int, extra map[string]interface{}) (classification.Classifications, error) {
+		visionCalls++
+		return classification.Classifications{}, nil
+	}
+
+	fc := &filteredCamera{
+		conf:                    &Config{WindowSeconds: 2, ImageFrequency: 1.0},
+		logger:                  logger,
+		cam:                     cam,
+		otherVisionServices:     []vision.Service{visionSvc},
+		acceptedClassifications: map[string]map[string]float64{"classifier": {"person": 0.8}},
+		buf:                     imagebuffer.NewImageBuffer(2, 1.0, 0, 0, logger, false, 0),
+	}
+
+	// outside data management the camera's frame is returned as is, without running the filter
+	imgs, meta, err := fc.Images(ctx, nil, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, len(imgs), test.ShouldEqual, 1)
+	test.That(t, imgs[0].SourceName, test.ShouldEqual, "color")
+	test.That(t, imgs[0].MimeType(), test.ShouldEqual, "image/png")
+	test.That(t, imgs[0].Annotations, test.ShouldResemble, annotations)
+	test.That(t, meta.CapturedAt.Equal(capturedAt), test.ShouldBeTrue)
+	img, err := imgs[0].Image(ctx)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, img, test.ShouldEqual, frame)
+	test.That(t, visionCalls, test.ShouldEqual, 0)
+	test.That(t, fc.buf.GetRingBufferLength(), test.ShouldEqual, 0)
+
+	// a stream reads the same frames through Images
+	stream, err := fc.Stream(ctx)
+	test.That(t, err, test.ShouldBeNil)
+	img, release, err := stream.Next(ctx)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, img.Bounds(), test.ShouldResemble, frame.Bounds())
+	test.That(t, img.At(1, 1), test.ShouldResemble, frame.At(1, 1))
+	release()
+	test.That(t, stream.Close(ctx), test.ShouldBeNil)
+	test.That(t, visionCalls, test.ShouldEqual, 0)
+
+	// cameras with a stream of their own are streamed from directly
+	legacy := &streamOnlyCamera{Camera: inject.NewCamera("legacy"), frame: image.NewRGBA(image.Rect(0, 0, 4, 3))}
+	fc.cam = legacy
+	stream, err = fc.Stream(ctx)
+	test.That(t, err, test.ShouldBeNil)
+	img, _, err = stream.Next(ctx)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, img, test.ShouldEqual, legacy.frame)
+}
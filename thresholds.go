@@ -0,0 +1,196 @@
+package filtered_camera
+
+import (
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strings"
+
+	rutils "go.viam.com/rdk/utils"
+	"go.viam.com/rdk/vision/objectdetection"
+)
+
+// Threshold is the confidence band within which a label matches: a score must be above Min (or equal to it with
+// inclusive_threshold) and, if Max is set, no higher than Max. For objects, MinArea additionally rejects bounding boxes smaller than that many pixels, and
+// MinCount only matches once at least that many detections clear the threshold. Sustain, if set, is the lower score
+// that keeps extending a capture window once Min has opened it.
+// In JSON it is either a bare number, the minimum, or an object like {"min": 0.8, "max": 0.98}, where "confidence"
+// or "enter" can be used instead of "min".
+type Threshold struct {
+	Min      float64 `json:"min"`
+	Max      float64 `json:"max,omitempty"`
+	MinArea  int     `json:"min_area,omitempty"`
+	MinCount int     `json:"min_count,omitempty"`
+	Sustain  float64 `json:"sustain,omitempty"`
+}
+
+// UnmarshalJSON accepts either a bare minimum score or a {"min", "max", "min_area", "min_count", "sustain"} object.
+func (t *Threshold) UnmarshalJSON(b []byte) error {
+	var min float64
+	if err := json.Unmarshal(b, &min); err == nil {
+		*t = Threshold{Min: min}
+		return nil
+	}
+	type band Threshold
+	var res struct {
+		band
+		Confidence *float64 `json:"confidence"`
+		Enter      *float64 `json:"enter"`
+	}
+	if err := json.Unmarshal(b, &res); err != nil {
+		return err
+	}
+	if res.Confidence != nil && res.Enter != nil {
+		return errors.New(`threshold can't have both "confidence" and "enter"`)
+	}
+	for _, alias := range []*float64{res.Confidence, res.Enter} {
+		if alias == nil {
+			continue
+		}
+		if res.Min != 0 {
+			return errors.New(`threshold can't have "min" along with "confidence" or "enter"`)
+		}
+		res.Min = *alias
+	}
+	*t = Threshold(res.band)
+	return nil
+}
+
+// minScores returns the minimum score of each label.
+func minScores(thresholds map[string]Threshold) map[string]float64 {
+	res := make(map[string]float64, len(thresholds))
+	for label, t := range thresholds {
+		res[label] = t.Min
+	}
+	return res
+}
+
+// maxScores returns the maximum score of each label that has one, or nil if none do.
+func maxScores(thresholds map[string]Threshold) map[string]float64 {
+	var res map[string]float64
+	for label, t := range thresholds {
+		if t.Max > 0 {
+			if res == nil {
+				res = make(map[string]float64)
+			}
+			res[label] = t.Max
+		}
+	}
+	return res
+}
+
+// sustainScores returns the sustain score of each label that has one, or nil if none do.
+func sustainScores(thresholds map[string]Threshold) map[string]float64 {
+	var res map[string]float64
+	for label, t := range thresholds {
+		if t.Sustain > 0 {
+			if res == nil {
+				res = make(map[string]float64)
+			}
+			res[label] = t.Sustain
+		}
+	}
+	return res
+}
+
+// minAreas returns the minimum bounding box area of each label that has one, or nil if none do.
+func minAreas(thresholds map[string]Threshold) map[string]int {
+	var res map[string]int
+	for label, t := range thresholds {
+		if t.MinArea > 0 {
+			if res == nil {
+				res = make(map[string]int)
+			}
+			res[label] = t.MinArea
+		}
+	}
+	return res
+}
+
+// minCounts returns the number of detections each label that has one needs to match, or nil if none do.
+func minCounts(thresholds map[string]Threshold) map[string]int {
+	var res map[string]int
+	for label, t := range thresholds {
+		if t.MinCount > 0 {
+			if res == nil {
+				res = make(map[string]int)
+			}
+			res[label] = t.MinCount
+		}
+	}
+	return res
+}
+
+// largeEnough returns true if the detection's bounding box covers at least the area configured for label, if any.
+func largeEnough(areas map[string]int, label string, d objectdetection.Detection) bool {
+	min, has := areas[label]
+	if !has {
+		return true
+	}
+	box := d.BoundingBox()
+	return box != nil && box.Dx()*box.Dy() >= min
+}
+
+// clears returns true if score passes the minimum min, which it has to be above unless inclusive_threshold is set.
+func (fc *filteredCamera) clears(score, min float64) bool {
+	if fc.inclusiveThreshold {
+		return score >= min
+	}
+	return score > min
+}
+
+// belowCeiling returns true if score doesn't exceed the maximum configured for label, if any.
+func belowCeiling(ceilings map[string]float64, label string, score float64) bool {
+	max, has := ceilings[label]
+	return !has || score <= max
+}
+
+// regexLabelPrefix marks a label key as a regular expression that has to match the whole label, e.g. `re:vehicle\..*`
+const regexLabelPrefix = "re:"
+
+// labelPattern compiles a label key starting with regexLabelPrefix into a regular expression matching whole labels.
+// It returns nil for any other key.
+func labelPattern(key string) (*regexp.Regexp, error) {
+	expr, ok := strings.CutPrefix(key, regexLabelPrefix)
+	if !ok {
+		return nil, nil
+	}
+	return regexp.Compile("^(?:" + expr + ")$")
+}
+
+// compileLabelPatterns compiles the regular expression label keys used in any of the thresholds, which are keyed
+// by vision service name and then label, keyed by label key.
+func compileLabelPatterns(thresholds ...map[string]map[string]float64) (map[string]*regexp.Regexp, error) {
+	patterns := make(map[string]*regexp.Regexp)
+	for _, byService := range thresholds {
+		for _, byLabel := range byService {
+			for key := range byLabel {
+				if _, ok := patterns[key]; ok {
+					continue
+				}
+				pattern, err := labelPattern(key)
+				if err != nil {
+					return nil, err
+				}
+				if pattern != nil {
+					patterns[key] = pattern
+				}
+			}
+		}
+	}
+	return patterns, nil
+}
+
+// configFromAttributes converts the camera's attributes to its Config. It goes through JSON rather than the
+// default attribute conversion so that thresholds can be given either as numbers or as {"min", "max"} objects.
+func configFromAttributes(attributes rutils.AttributeMap) (*Config, error) {
+	b, err := json.Marshal(attributes)
+	if err != nil {
+		return nil, err
+	}
+	conf := &Config{}
+	if err := json.Unmarshal(b, conf); err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
@@ -0,0 +1,335 @@
+package filtered_camera
+
+import (
+	"context"
+	"image"
+	"testing"
+	"time"
+
+	"go.viam.com/rdk/components/camera"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/services/vision"
+	"go.viam.com/rdk/testutils/inject"
+	rutils "go.viam.com/rdk/utils"
+	"go.viam.com/rdk/vision/classification"
+	"go.viam.com/rdk/vision/objectdetection"
+	"go.viam.com/test"
+)
+
+func TestThresholdConfig(t *testing.T) {
+	conf, err := configFromAttributes(rutils.AttributeMap{
+		"camera":         "cam",
+		"window_seconds": 10,
+		"vision_services": []interface{}{
+			map[string]interface{}{
+				"vision":          "classifier",
+				"classifications": map[string]interface{}{"cat": 0.5, "person": map[string]interface{}{"min": 0.8, "max": 0.98}},
+				"objects":         map[string]interface{}{"person": map[string]interface{}{"min": 0.6}},
+			},
+		},
+	})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, conf.Camera, test.ShouldEqual, "cam")
+	test.That(t, conf.WindowSeconds, test.ShouldEqual, 10)
+	test.That(t, conf.VisionServices[0].Classifications, test.ShouldResemble, map[string]Threshold{
+		"cat":    {Min: 0.5},
+		"person": {Min: 0.8, Max: 0.98},
+	})
+	test.That(t, conf.VisionServices[0].Objects, test.ShouldResemble, map[string]Threshold{"person": {Min: 0.6}})
+	_, _, err = conf.Validate("camera")
+	test.That(t, err, test.ShouldBeNil)
+
+	test.That(t, minScores(conf.VisionServices[0].Classifications), test.ShouldResemble, map[string]float64{"cat": 0.5, "person": 0.8})
+	test.That(t, maxScores(conf.VisionServices[0].Classifications), test.ShouldResemble, map[string]float64{"person": 0.98})
+	test.That(t, maxScores(conf.VisionServices[0].Objects), test.ShouldBeNil)
+
+	// the maximum must be above the minimum
+	conf.VisionServices[0].Classifications["person"] = Threshold{Min: 0.8, Max: 0.7}
+	_, _, err = conf.Validate("camera")
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, err.Error(), test.ShouldContainSubstring, "camera.vision_services.0.classifications.person")
+
+	_, err = configFromAttributes(rutils.AttributeMap{
+		"camera":          "cam",
+		"vision_services": []interface{}{map[string]interface{}{"vision": "v", "objects": map[string]interface{}{"person": "high"}}},
+	})
+	test.That(t, err, test.ShouldNotBeNil)
+}
+
+func TestScoreCeiling(t *testing.T) {
+	r := image.Rect(0, 0, 5, 5)
+	score := 0.0
+	visionSvc := inject.NewVisionService("both")
+	visionSvc.ClassificationsFunc = func(ctx context.Context, img *camera.NamedImage, n int, extra map[string]interface{}) (classification.Classifications, error) {
+		return classification.Classifications{classification.NewClassification(score, "person")}, nil
+	}
+	visionSvc.DetectionsFunc = func(ctx context.Context, img *camera.NamedImage, extra map[string]interface{}) ([]objectdetection.Detection, error) {
+		return []objectdetection.Detection{objectdetection.NewDetection(r, r, score, "car")}, nil
+	}
+
+	conf := VisionServiceConfig{
+		Vision:          "both",
+		Classifications: map[string]Threshold{"person": {Min: 0.8, Max: 0.98}},
+		Objects:         map[string]Threshold{"*": {Min: 0.5, Max: 0.9}},
+	}
+	fc := &filteredCamera{
+		conf:                    &Config{},
+		logger:                  logging.NewTestLogger(t),
+		otherVisionServices:     []vision.Service{visionSvc},
+		acceptedClassifications: map[string]map[string]float64{"both": minScores(conf.Classifications)},
+		acceptedObjects:         map[string]map[string]float64{"both": minScores(conf.Objects)},
+		classificationCeilings:  map[string]map[string]float64{"both": maxScores(conf.Classifications)},
+		objectCeilings:          map[string]map[string]float64{"both": maxScores(conf.Objects)},
+	}
+
+	for _, tc := range []struct {
+		score                 float64
+		expectClassifications bool
+		expectObjects         bool
+	}{
+		{0.4, false, false},
+		{0.6, false, true},
+		{0.85, true, true},
+		{0.95, true, false},
+		{0.999, false, false},
+	} {
+		score = tc.score
+		test.That(t, fc.classificationMatches("both", classification.NewClassification(score, "person"), false, 0),
+			test.ShouldEqual, tc.expectClassifications)
+		test.That(t, fc.detectionMatches("both", objectdetection.NewDetection(r, r, score, "car"), false),
+			test.ShouldEqual, tc.expectObjects)
+		res, _, err := fc.shouldSend(context.Background(), namedA, time.Now())
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, res, test.ShouldEqual, tc.expectClassifications || tc.expectObjects)
+	}
+}
+
+func TestMinArea(t *testing.T) {
+	conf, err := configFromAttributes(rutils.AttributeMap{
+		"camera":         "cam",
+		"window_seconds": 10,
+		"vision_services": []interface{}{
+			map[string]interface{}{
+				"vision":  "detector",
+				"objects": map[string]interface{}{"car": map[string]interface{}{"confidence": 0.7, "min_area": 5000}, "*": 0.9},
+			},
+		},
+	})
+	test.That(t, err, test.ShouldBeNil)
+	objects := conf.VisionServices[0].Objects
+	test.That(t, objects, test.ShouldResemble, map[string]Threshold{"car": {Min: 0.7, MinArea: 5000}, "*": {Min: 0.9}})
+	_, _, err = conf.Validate("camera")
+	test.That(t, err, test.ShouldBeNil)
+
+	fc := &filteredCamera{
+		acceptedObjects: map[string]map[string]float64{"detector": minScores(objects)},
+		objectMinAreas:  map[string]map[string]int{"detector": minAreas(objects)},
+	}
+	small := image.Rect(0, 0, 50, 50)
+	large := image.Rect(0, 0, 100, 50)
+	test.That(t, fc.detectionMatches("detector", objectdetection.NewDetection(large, large, 0.8, "car"), false), test.ShouldBeTrue)
+	test.That(t, fc.detectionMatches("detector", objectdetection.NewDetection(large, small, 0.8, "car"), false), test.ShouldBeFalse)
+	test.That(t, fc.detectionMatches("detector", objectdetection.NewDetection(large, large, 0.6, "car"), false), test.ShouldBeFalse)
+	// labels without a minimum area match boxes of any size
+	test.That(t, fc.detectionMatches("detector", objectdetection.NewDetection(large, small, 0.95, "truck"), false), test.ShouldBeTrue)
+
+	// a minimum area only makes sense for objects
+	conf.VisionServices[0].Classifications = map[string]Threshold{"car": {Min: 0.7, MinArea: 5000}}
+	_, _, err = conf.Validate("camera")
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, err.Error(), test.ShouldContainSubstring, "camera.vision_services.0.classifications.car")
+
+	_, err = configFromAttributes(rutils.AttributeMap{
+		"camera": "cam",
+		"vision_services": []interface{}{map[string]interface{}{
+			"vision": "detector", "objects": map[string]interface{}{"car": map[string]interface{}{"min": 0.5, "confidence": 0.7}},
+		}},
+	})
+	test.That(t, err, test.ShouldNotBeNil)
+}
+
+func TestMinCount(t *testing.T) {
+	conf, err := configFromAttributes(rutils.AttributeMap{
+		"camera":         "cam",
+		"window_seconds": 10,
+		"vision_services": []interface{}{
+			map[string]interface{}{
+				"vision": "detector",
+				"objects": map[string]interface{}{
+					"person": map[string]interface{}{"confidence": 0.6, "min_count": 3},
+					"*":      map[string]interface{}{"confidence": 0.8, "min_count": 2},
+					"dog":    0.5,
+				},
+			},
+		},
+	})
+	test.That(t, err, test.ShouldBeNil)
+	objects := conf.VisionServices[0].Objects
+	test.That(t, objects, test.ShouldResemble, map[string]Threshold{
+		"person": {Min: 0.6, MinCount: 3}, "*": {Min: 0.8, MinCount: 2}, "dog": {Min: 0.5},
+	})
+	_, _, err = conf.Validate("camera")
+	test.That(t, err, test.ShouldBeNil)
+
+	fc := &filteredCamera{
+		acceptedObjects: map[string]map[string]float64{"detector": minScores(objects)},
+		objectMinCounts: map[string]map[string]int{"detector": minCounts(objects)},
+	}
+	r := image.Rect(0, 0, 10, 10)
+	detections := func(scores map[string][]float64) []objectdetection.Detection {
+		ds := []objectdetection.Detection{}
+		for label, labelScores := range scores {
+			for _, score := range labelScores {
+				ds = append(ds, objectdetection.NewDetection(r, r, score, label))
+			}
+		}
+		return ds
+	}
+
+	// two people clearing the bar aren't a crowd, three are
+	match, _ := fc.anyDetectionsMatch("detector", detections(map[string][]float64{"person": {0.9, 0.7, 0.5}}), false)
+	test.That(t, match, test.ShouldBeFalse)
+	match, res := fc.anyDetectionsMatch("detector", detections(map[string][]float64{"person": {0.9, 0.7, 0.65}}), false)
+	test.That(t, match, test.ShouldBeTrue)
+	test.That(t, len(res), test.ShouldEqual, 3)
+
+	// labels without a count match on their own, without counting the others
+	match, res = fc.anyDetectionsMatch("detector", detections(map[string][]float64{"person": {0.9}, "dog": {0.6}}), false)
+	test.That(t, match, test.ShouldBeTrue)
+	test.That(t, len(res), test.ShouldEqual, 1)
+	test.That(t, res[0].Label(), test.ShouldEqual, "dog")
+
+	// the wildcard counts every label it matches together
+	match, _ = fc.anyDetectionsMatch("detector", detections(map[string][]float64{"car": {0.9}}), false)
+	test.That(t, match, test.ShouldBeFalse)
+	match, res = fc.anyDetectionsMatch("detector", detections(map[string][]float64{"car": {0.9}, "bike": {0.85}}), false)
+	test.That(t, match, test.ShouldBeTrue)
+	test.That(t, len(res), test.ShouldEqual, 2)
+
+	// a count only makes sense for objects
+	conf.VisionServices[0].Classifications = map[string]Threshold{"person": {Min: 0.6, MinCount: 3}}
+	_, _, err = conf.Validate("camera")
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, err.Error(), test.ShouldContainSubstring, "min_count")
+}
+
+func TestLabelPatterns(t *testing.T) {
+	conf, err := configFromAttributes(rutils.AttributeMap{
+		"camera":         "cam",
+		"window_seconds": 10,
+		"vision_services": []interface{}{
+			map[string]interface{}{
+				"vision":          "both",
+				"classifications": map[string]interface{}{`re:vehicle\..*`: 0.7, "vehicle.bus": 0.95},
+				"objects":         map[string]interface{}{`re:(cat|dog)`: map[string]interface{}{"min": 0.5, "min_area": 100}},
+			},
+		},
+	})
+	test.That(t, err, test.ShouldBeNil)
+	_, _, err = conf.Validate("camera")
+	test.That(t, err, test.ShouldBeNil)
+
+	vs := conf.VisionServices[0]
+	fc := &filteredCamera{
+		acceptedClassifications: map[string]map[string]float64{"both": minScores(vs.Classifications)},
+		acceptedObjects:         map[string]map[string]float64{"both": minScores(vs.Objects)},
+		objectMinAreas:          map[string]map[string]int{"both": minAreas(vs.Objects)},
+	}
+	fc.labelPatterns, err = compileLabelPatterns(fc.acceptedClassifications, fc.acceptedObjects)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, len(fc.labelPatterns), test.ShouldEqual, 2)
+
+	test.That(t, fc.classificationMatches("both", classification.NewClassification(0.8, "vehicle.car"), false, 0), test.ShouldBeTrue)
+	test.That(t, fc.classificationMatches("both", classification.NewClassification(0.8, "vehicle.truck"), false, 0), test.ShouldBeTrue)
+	test.That(t, fc.classificationMatches("both", classification.NewClassification(0.6, "vehicle.car"), false, 0), test.ShouldBeFalse)
+	// the pattern has to match the whole label
+	test.That(t, fc.classificationMatches("both", classification.NewClassification(0.8, "my.vehicle.car"), false, 0), test.ShouldBeFalse)
+	test.That(t, fc.classificationMatches("both", classification.NewClassification(0.8, "vehicles"), false, 0), test.ShouldBeFalse)
+	// like "*", a pattern still applies to labels that also have their own threshold
+	test.That(t, fc.classificationMatches("both", classification.NewClassification(0.8, "vehicle.bus"), false, 0), test.ShouldBeTrue)
+
+	small := image.Rect(0, 0, 5, 5)
+	large := image.Rect(0, 0, 20, 20)
+	test.That(t, fc.detectionMatches("both", objectdetection.NewDetection(large, large, 0.6, "dog"), false), test.ShouldBeTrue)
+	test.That(t, fc.detectionMatches("both", objectdetection.NewDetection(large, small, 0.6, "dog"), false), test.ShouldBeFalse)
+	test.That(t, fc.detectionMatches("both", objectdetection.NewDetection(large, large, 0.6, "catfish"), false), test.ShouldBeFalse)
+
+	// invalid patterns are rejected by Validate
+	conf.VisionServices[0].Classifications = map[string]Threshold{"re:vehicle.(": {Min: 0.7}}
+	_, _, err = conf.Validate("camera")
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, err.Error(), test.ShouldContainSubstring, "invalid label pattern")
+}
+
+func TestDefaultThreshold(t *testing.T) {
+	conf, err := configFromAttributes(rutils.AttributeMap{
+		"camera":         "cam",
+		"window_seconds": 10,
+		"vision_services": []interface{}{
+			map[string]interface{}{
+				"vision":            "both",
+				"classifications":   map[string]interface{}{"cat": 0.9, `re:vehicle\..*`: 0.9},
+				"objects":           map[string]interface{}{"person": 0.9},
+				"default_threshold": 0.6,
+			},
+		},
+	})
+	test.That(t, err, test.ShouldBeNil)
+	_, _, err = conf.Validate("camera")
+	test.That(t, err, test.ShouldBeNil)
+
+	vs := conf.VisionServices[0]
+	fc := &filteredCamera{
+		acceptedClassifications: map[string]map[string]float64{"both": minScores(vs.Classifications)},
+		acceptedObjects:         map[string]map[string]float64{"both": minScores(vs.Objects)},
+		serviceConfigs:          map[string]VisionServiceConfig{"both": vs},
+	}
+	fc.labelPatterns, err = compileLabelPatterns(fc.acceptedClassifications, fc.acceptedObjects)
+	test.That(t, err, test.ShouldBeNil)
+
+	// labels the config doesn't name match at the default
+	test.That(t, fc.classificationMatches("both", classification.NewClassification(0.7, "dog"), false, 0), test.ShouldBeTrue)
+	test.That(t, fc.classificationMatches("both", classification.NewClassification(0.5, "dog"), false, 0), test.ShouldBeFalse)
+	r := image.Rect(0, 0, 5, 5)
+	test.That(t, fc.detectionMatches("both", objectdetection.NewDetection(r, r, 0.7, "car"), false), test.ShouldBeTrue)
+	// unlike "*", the default doesn't lower the threshold of labels named by a key or a pattern
+	test.That(t, fc.classificationMatches("both", classification.NewClassification(0.7, "cat"), false, 0), test.ShouldBeFalse)
+	test.That(t, fc.classificationMatches("both", classification.NewClassification(0.7, "vehicle.car"), false, 0), test.ShouldBeFalse)
+	test.That(t, fc.detectionMatches("both", objectdetection.NewDetection(r, r, 0.7, "person"), false), test.ShouldBeFalse)
+
+	conf.VisionServices[0].DefaultThreshold = 1.5
+	_, _, err = conf.Validate("camera")
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, err.Error(), test.ShouldContainSubstring, "default_threshold")
+}
+
+func TestInclusiveThreshold(t *testing.T) {
+	fc := &filteredCamera{
+		acceptedClassifications: map[string]map[string]float64{"both": {"cat": 0.75, "*": 0.5}},
+		acceptedObjects:         map[string]map[string]float64{"both": {"person": 0.75, "*": 0.5}},
+	}
+	r := image.Rect(0, 0, 5, 5)
+	matches := func() []bool {
+		return []bool{
+			fc.classificationMatches("both", classification.NewClassification(0.75, "cat"), false, 0),
+			fc.classificationMatches("both", classification.NewClassification(0.5, "dog"), false, 0),
+			fc.detectionMatches("both", objectdetection.NewDetection(r, r, 0.75, "person"), false),
+			fc.detectionMatches("both", objectdetection.NewDetection(r, r, 0.5, "car"), false),
+		}
+	}
+
+	// by default a score has to be above the minimum, so one exactly at it doesn't match
+	test.That(t, matches(), test.ShouldResemble, []bool{false, false, false, false})
+
+	// with inclusive_threshold it does, including for the wildcard
+	fc.inclusiveThreshold = true
+	test.That(t, matches(), test.ShouldResemble, []bool{true, true, true, true})
+	test.That(t, fc.classificationMatches("both", classification.NewClassification(0.7, "cat"), false, 0), test.ShouldBeFalse)
+	test.That(t, fc.detectionMatches("both", objectdetection.NewDetection(r, r, 0.7, "person"), false), test.ShouldBeFalse)
+
+	// any_label_min_score follows the same boundary
+	atMin := []objectdetection.Detection{objectdetection.NewDetection(r, r, 0.5, "car"), objectdetection.NewDetection(r, r, 0.6, "dog")}
+	test.That(t, len(fc.detectionsAboveScore(atMin, 0.5)), test.ShouldEqual, 2)
+	fc.inclusiveThreshold = false
+	test.That(t, len(fc.detectionsAboveScore(atMin, 0.5)), test.ShouldEqual, 1)
+}
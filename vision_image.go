@@ -0,0 +1,85 @@
+package filtered_camera
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"math"
+
+	"go.viam.com/rdk/components/camera"
+	"golang.org/x/image/draw"
+)
+
+// visionImage returns the image that should be passed to the vision services for the given frame.
+// The frame that is buffered and returned to data management is never modified.
+func (fc *filteredCamera) visionImage(ctx context.Context, namedImg camera.NamedImage) (camera.NamedImage, error) {
+	if fc.conf.VisionMaxPixels <= 0 && !fc.conf.VisionGrayscaleToRGB {
+		return namedImg, nil
+	}
+
+	// img is only decoded, and only set, once the frame actually needs to be changed
+	var img image.Image
+	if fc.conf.VisionGrayscaleToRGB {
+		decoded, err := namedImg.Image(ctx)
+		if err != nil {
+			return camera.NamedImage{}, err
+		}
+		if isGrayscale(decoded) {
+			img = toRGBA(decoded)
+			fc.logger.Debugf("converted grayscale frame %q to RGB for vision", namedImg.SourceName)
+		}
+	}
+
+	if fc.conf.VisionMaxPixels > 0 {
+		bounds, err := namedImg.Bounds()
+		if err != nil {
+			return camera.NamedImage{}, err
+		}
+		if bounds.Dx()*bounds.Dy() > fc.conf.VisionMaxPixels {
+			if img == nil {
+				img, err = namedImg.Image(ctx)
+				if err != nil {
+					return camera.NamedImage{}, err
+				}
+			}
+			img = downscaleToPixels(img, fc.conf.VisionMaxPixels)
+			fc.logger.Debugf("downscaled %dx%d frame to %dx%d to stay under vision_max_pixels (%d)",
+				bounds.Dx(), bounds.Dy(), img.Bounds().Dx(), img.Bounds().Dy(), fc.conf.VisionMaxPixels)
+		}
+	}
+
+	if img == nil {
+		return namedImg, nil
+	}
+	return camera.NamedImageFromImage(img, namedImg.SourceName, namedImg.MimeType(), namedImg.Annotations)
+}
+
+// isGrayscale returns true for single channel images.
+func isGrayscale(img image.Image) bool {
+	switch img.ColorModel() {
+	case color.GrayModel, color.Gray16Model:
+		return true
+	default:
+		return false
+	}
+}
+
+// toRGBA copies img into a 3 channel RGBA image.
+func toRGBA(img image.Image) *image.RGBA {
+	bounds := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, bounds.Min, draw.Src)
+	return dst
+}
+
+// downscaleToPixels proportionally shrinks img so that its area is at most maxPixels.
+func downscaleToPixels(img image.Image, maxPixels int) image.Image {
+	bounds := img.Bounds()
+	scale := math.Sqrt(float64(maxPixels) / float64(bounds.Dx()*bounds.Dy()))
+	width := int(math.Max(1, math.Floor(float64(bounds.Dx())*scale)))
+	height := int(math.Max(1, math.Floor(float64(bounds.Dy())*scale)))
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.ApproxBiLinear.Scale(dst, dst.Bounds(), img, bounds, draw.Src, nil)
+	return dst
+}
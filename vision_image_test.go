@@ -0,0 +1,101 @@
+package filtered_camera
+
+import (
+	"context"
+	"image"
+	"testing"
+	"time"
+
+	"go.viam.com/rdk/components/camera"
+	"go.viam.com/rdk/data"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/services/vision"
+	"go.viam.com/rdk/testutils/inject"
+	"go.viam.com/rdk/vision/classification"
+	"go.viam.com/test"
+)
+
+func TestVisionMaxPixels(t *testing.T) {
+	var visionBounds image.Rectangle
+	visionSvc := inject.NewVisionService("test_vision")
+	visionSvc.ClassificationsFunc = func(ctx context.Context, img *camera.NamedImage, n int, extra map[string]interface{}) (classification.Classifications, error) {
+		var err error
+		visionBounds, err = img.Bounds()
+		if err != nil {
+			return nil, err
+		}
+		return classification.Classifications{classification.NewClassification(0.9, "person")}, nil
+	}
+
+	fc := &filteredCamera{
+		conf:                    &Config{VisionMaxPixels: 100},
+		logger:                  logging.NewTestLogger(t),
+		otherVisionServices:     []vision.Service{visionSvc},
+		acceptedClassifications: map[string]map[string]float64{"test_vision": {"person": 0.8}},
+	}
+
+	// an oversized frame is downscaled under the cap, keeping its aspect ratio
+	oversized, err := camera.NamedImageFromImage(image.NewRGBA(image.Rect(0, 0, 40, 30)), "color", "image/jpeg", data.Annotations{})
+	test.That(t, err, test.ShouldBeNil)
+	res, _, err := fc.shouldSend(context.Background(), oversized, time.Now())
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res, test.ShouldBeTrue)
+	test.That(t, visionBounds.Dx()*visionBounds.Dy(), test.ShouldBeLessThanOrEqualTo, 100)
+	test.That(t, visionBounds.Dx(), test.ShouldEqual, 11)
+	test.That(t, visionBounds.Dy(), test.ShouldEqual, 8)
+
+	// a frame already under the cap is passed through untouched
+	small, err := camera.NamedImageFromImage(image.NewRGBA(image.Rect(0, 0, 10, 5)), "color", "image/jpeg", data.Annotations{})
+	test.That(t, err, test.ShouldBeNil)
+	_, _, err = fc.shouldSend(context.Background(), small, time.Now())
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, visionBounds, test.ShouldResemble, image.Rect(0, 0, 10, 5))
+}
+
+func TestVisionGrayscaleToRGB(t *testing.T) {
+	var visionImg image.Image
+	visionSvc := inject.NewVisionService("test_vision")
+	visionSvc.ClassificationsFunc = func(ctx context.Context, img *camera.NamedImage, n int, extra map[string]interface{}) (classification.Classifications, error) {
+		var err error
+		visionImg, err = img.Image(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return classification.Classifications{classification.NewClassification(0.9, "person")}, nil
+	}
+
+	fc := &filteredCamera{
+		conf:                    &Config{VisionGrayscaleToRGB: true},
+		logger:                  logging.NewTestLogger(t),
+		otherVisionServices:     []vision.Service{visionSvc},
+		acceptedClassifications: map[string]map[string]float64{"test_vision": {"person": 0.8}},
+	}
+
+	gray := image.NewGray(image.Rect(0, 0, 4, 3))
+	gray.Pix[0] = 200
+	frame, err := camera.NamedImageFromImage(gray, "ir", "image/png", data.Annotations{})
+	test.That(t, err, test.ShouldBeNil)
+	res, _, err := fc.shouldSend(context.Background(), frame, time.Now())
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, res, test.ShouldBeTrue)
+
+	// vision sees an RGB copy of the frame
+	rgba, ok := visionImg.(*image.RGBA)
+	test.That(t, ok, test.ShouldBeTrue)
+	test.That(t, rgba.Bounds(), test.ShouldResemble, image.Rect(0, 0, 4, 3))
+	r, g, b, _ := rgba.At(0, 0).RGBA()
+	test.That(t, []uint32{r >> 8, g >> 8, b >> 8}, test.ShouldResemble, []uint32{200, 200, 200})
+
+	// while the captured frame stays grayscale
+	captured, err := frame.Image(context.Background())
+	test.That(t, err, test.ShouldBeNil)
+	_, ok = captured.(*image.Gray)
+	test.That(t, ok, test.ShouldBeTrue)
+
+	// without the option the grayscale frame is passed through
+	fc.conf.VisionGrayscaleToRGB = false
+	_, _, err = fc.shouldSend(context.Background(), frame, time.Now())
+	test.That(t, err, test.ShouldBeNil)
+	_, ok = visionImg.(*image.Gray)
+	test.That(t, ok, test.ShouldBeTrue)
+}